@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// APIKeyScope is a capability granted to an integration API key
+type APIKeyScope string
+
+const (
+	ScopeTicketsCreate       APIKeyScope = "tickets:create"
+	ScopeTicketsReadCustomer APIKeyScope = "tickets:read:customer"
+	ScopeSCIMProvision       APIKeyScope = "scim:provision"
+)
+
+// apiKeyScopes lists every grantable API key scope
+var apiKeyScopes = []APIKeyScope{ScopeTicketsCreate, ScopeTicketsReadCustomer, ScopeSCIMProvision}
+
+// legacyAPIKeyScopes are what the customer portal's EXTERNAL_API_KEY could always do
+var legacyAPIKeyScopes = []APIKeyScope{ScopeTicketsCreate, ScopeTicketsReadCustomer}
+
+const (
+	// apiKeyPrefix marks platform API keys so they are easy to spot in logs and secret scanners
+	apiKeyPrefix = "grc_"
+	// apiKeyDisplayLength is how much of a key is kept in clear text to identify it
+	apiKeyDisplayLength = 12
+
+	// APIKeyContextKey holds the authenticated *APIKey on integration requests
+	APIKeyContextKey contextKey = "apiKey"
+)
+
+// APIKey is an integration credential. Only a hash of the secret is stored.
+type APIKey struct {
+	ID             string        `json:"id"`
+	OrganizationID string        `json:"organization_id"`
+	Name           string        `json:"name"`
+	KeyPrefix      string        `json:"key_prefix"`
+	Scopes         []APIKeyScope `json:"scopes"`
+	CustomerRef    *string       `json:"customer_ref,omitempty"` // when set, the key only acts for this customer
+	ExpiresAt      *time.Time    `json:"expires_at,omitempty"`
+	LastUsedAt     *time.Time    `json:"last_used_at,omitempty"`
+	LastUsedIP     *string       `json:"last_used_ip,omitempty"`
+	CreatedByID    *string       `json:"created_by_id,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	RevokedAt      *time.Time    `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants a scope
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsCustomer reports whether the key may act for a customer reference
+func (k *APIKey) AllowsCustomer(customerRef string) bool {
+	return k.CustomerRef == nil || *k.CustomerRef == customerRef
+}
+
+// APIKeyRequest is the JSON for creating or updating an API key
+type APIKeyRequest struct {
+	Name        string        `json:"name"`
+	Scopes      []APIKeyScope `json:"scopes"`
+	CustomerRef *string       `json:"customer_ref"`
+	ExpiresAt   *time.Time    `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse returns the new key's secret. It is never shown again.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// isValidAPIKeyScope reports whether a scope exists
+func isValidAPIKeyScope(scope APIKeyScope) bool {
+	for _, s := range apiKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// generateAPIKey returns a new random key in the form grc_<base64url>
+func generateAPIKey() (string, error) {
+	secret, err := randomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + secret, nil
+}
+
+// apiKeyDisplayPrefix returns the clear-text part of a key kept for identification
+func apiKeyDisplayPrefix(key string) string {
+	if len(key) <= apiKeyDisplayLength {
+		return key
+	}
+	return key[:apiKeyDisplayLength]
+}
+
+// RequireAPIKey authenticates integration requests by their X-API-Key header (or
+// a bearer token, which is how SCIM clients send it) and checks the key grants scope. Every accepted or rejected attempt is audited.
+func RequireAPIKey(store *Store, scope APIKeyScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ipAddr := clientIP(r)
+			entityType := "api_key"
+
+			rawKey := r.Header.Get("X-API-Key")
+			if rawKey == "" {
+				rawKey = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+					rawKey = ""
+				}
+			}
+			if rawKey == "" {
+				http.Error(w, "API key required", http.StatusUnauthorized)
+				return
+			}
+
+			reject := func(key *APIKey, reason string) {
+				ctx := r.Context()
+				var keyID *string
+				if key != nil {
+					ctx = WithOrganization(ctx, key.OrganizationID)
+					keyID = &key.ID
+				}
+				changes := map[string]interface{}{
+					"reason":     reason,
+					"key_prefix": apiKeyDisplayPrefix(rawKey),
+					"scope":      scope,
+					"method":     r.Method,
+					"path":       r.URL.Path,
+				}
+				if err := store.LogAudit(ctx, nil, "API_KEY_REJECTED", &entityType, keyID, changes, &ipAddr); err != nil {
+					log.Printf("Error recording rejected API key: %v", err)
+				}
+			}
+
+			key, err := store.GetAPIKeyByHash(r.Context(), hashToken(rawKey))
+			if err != nil {
+				if err.Error() == "api key not found" {
+					reject(nil, "unknown key")
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				log.Printf("Error looking up API key: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			switch {
+			case key.RevokedAt != nil:
+				reject(key, "revoked")
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			case key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()):
+				reject(key, "expired")
+				http.Error(w, "API key has expired", http.StatusUnauthorized)
+				return
+			case !key.HasScope(scope):
+				reject(key, "missing scope")
+				http.Error(w, "Forbidden: API key lacks scope "+string(scope), http.StatusForbidden)
+				return
+			}
+
+			// Everything the key does happens inside its organization
+			r = r.WithContext(WithOrganization(r.Context(), key.OrganizationID))
+
+			if err := store.TouchAPIKey(r.Context(), key.ID, ipAddr); err != nil {
+				log.Printf("Error updating API key last use: %v", err)
+			}
+			changes := map[string]interface{}{
+				"name":   key.Name,
+				"scope":  scope,
+				"method": r.Method,
+				"path":   r.URL.Path,
+			}
+			// A request the audit trail cannot record is not served
+			if err := store.LogAudit(r.Context(), nil, "API_KEY_USED", &entityType, &key.ID, changes, &ipAddr); err != nil {
+				log.Printf("Error recording API key use: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), APIKeyContextKey, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// EnsureLegacyAPIKey registers the key from EXTERNAL_API_KEY so existing portal
+// deployments keep working after the move to managed keys. In development mode
+// the old "test-api-key" default is registered instead when the variable is unset.
+func EnsureLegacyAPIKey(ctx context.Context, store *Store) error {
+	legacyKey := os.Getenv("EXTERNAL_API_KEY")
+	if legacyKey == "" {
+		if !isDevMode() {
+			return nil
+		}
+		legacyKey = "test-api-key"
+	}
+
+	created, err := store.EnsureAPIKey(ctx, "Legacy EXTERNAL_API_KEY", apiKeyDisplayPrefix(legacyKey), hashToken(legacyKey), legacyAPIKeyScopes)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Println("Registered EXTERNAL_API_KEY as a managed API key; create scoped keys under /api/v1/api-keys and remove the variable")
+	}
+	return nil
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit chain
+//
+// Each organization's audit log is a hash chain. Entries are written unchained
+// and then sealed oldest first under a per-organization lock: an entry gets the
+// next sequence number, the previous entry's hash, and its own hash, which is
+// the SHA-256 of the previous hash and the entry's canonical JSON. Changing,
+// removing or reordering an entry breaks every later link.
+//
+// Someone with database access could recompute the whole chain, so the
+// audit-checkpoint job periodically signs the chain head with an Ed25519 key
+// whose private half is encrypted with JWT_SECRET. A rewritten chain no longer
+// matches the checkpoints signed before it. Checkpoints are also written to the
+// server log so they can be kept outside the database.
+
+const (
+	// auditGenesisHash is the previous hash of an organization's first entry
+	auditGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+	// auditCheckpointVersion prefixes the statement a checkpoint signs
+	auditCheckpointVersion = "grc-audit-checkpoint/v1"
+)
+
+// errStopWalk ends WalkAuditChain early without reporting an error
+var errStopWalk = errors.New("stop walking the audit chain")
+
+// AuditChainEntry is an audit_log row with its place in the chain
+type AuditChainEntry struct {
+	Seq              int64
+	ID               string
+	OrganizationID   string
+	PerformedAt      time.Time
+	UserID           *string
+	ActionType       string
+	TargetEntityType *string
+	TargetEntityID   *string
+	Changes          *string
+	IPAddress        *string
+	UserAgent        *string
+	RequestID        *string
+	SessionID        *string
+	PrevHash         string
+	EntryHash        string
+}
+
+// canonicalJSON re-encodes a JSON document with sorted object keys and no
+// insignificant whitespace, so JSONB text read back from PostgreSQL hashes the
+// same however it was originally written
+func canonicalJSON(raw *string) (json.RawMessage, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(*raw), &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// chainHash computes the entry's hash from the previous entry's hash
+func (e AuditChainEntry) chainHash(prevHash string) (string, error) {
+	changes, err := canonicalJSON(e.Changes)
+	if err != nil {
+		return "", fmt.Errorf("entry %s: %w", e.ID, err)
+	}
+	content, err := json.Marshal(struct {
+		Seq              int64           `json:"seq"`
+		ID               string          `json:"id"`
+		OrganizationID   string          `json:"organization_id"`
+		PerformedAt      string          `json:"performed_at"`
+		UserID           *string         `json:"user_id"`
+		ActionType       string          `json:"action_type"`
+		TargetEntityType *string         `json:"target_entity_type"`
+		TargetEntityID   *string         `json:"target_entity_id"`
+		Changes          json.RawMessage `json:"changes"`
+		IPAddress        *string         `json:"ip_address"`
+		// Added later; omitted when unset so older entries keep their hashes
+		UserAgent *string `json:"user_agent,omitempty"`
+		RequestID *string `json:"request_id,omitempty"`
+		SessionID *string `json:"session_id,omitempty"`
+	}{
+		Seq:              e.Seq,
+		ID:               e.ID,
+		OrganizationID:   e.OrganizationID,
+		PerformedAt:      e.PerformedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		UserID:           e.UserID,
+		ActionType:       e.ActionType,
+		TargetEntityType: e.TargetEntityType,
+		TargetEntityID:   e.TargetEntityID,
+		Changes:          changes,
+		IPAddress:        e.IPAddress,
+		UserAgent:        e.UserAgent,
+		RequestID:        e.RequestID,
+		SessionID:        e.SessionID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write([]byte("\n"))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// AuditCheckpoint is a signed statement that an organization's chain had
+// EntryHash as the hash of entry Seq
+type AuditCheckpoint struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	Seq            int64     `json:"seq"`
+	EntryHash      string    `json:"entry_hash"`
+	SignedAt       time.Time `json:"signed_at"`
+	KeyID          string    `json:"key_id"`
+	Signature      string    `json:"signature"` // base64 Ed25519 signature of the statement
+}
+
+// statement is the text the checkpoint's signature covers
+func (c AuditCheckpoint) statement() []byte {
+	return []byte(strings.Join([]string{
+		auditCheckpointVersion,
+		c.OrganizationID,
+		fmt.Sprint(c.Seq),
+		c.EntryHash,
+		c.SignedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+	}, "\n"))
+}
+
+// AuditSigningKey is the public half of a checkpoint signing key
+type AuditSigningKey struct {
+	KeyID     string    `json:"kid"`
+	Algorithm string    `json:"alg"`        // always Ed25519
+	PublicKey string    `json:"public_key"` // base64 of the raw 32-byte key
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StoredAuditSigningKey is a row in 'audit_signing_keys'; the private key is encrypted at rest
+type StoredAuditSigningKey struct {
+	AuditSigningKey
+	PrivateKey string
+}
+
+// AuditChainBreak describes the first place the chain does not verify
+type AuditChainBreak struct {
+	Seq          int64  `json:"seq"`
+	EntryID      string `json:"entry_id,omitempty"`
+	Reason       string `json:"reason"`
+	ExpectedHash string `json:"expected_hash,omitempty"`
+	ActualHash   string `json:"actual_hash,omitempty"`
+}
+
+// AuditVerification is the outcome of walking an organization's chain
+type AuditVerification struct {
+	OrganizationID     string           `json:"organization_id"`
+	Valid              bool             `json:"valid"`
+	EntriesChecked     int64            `json:"entries_checked"`
+	LastSeq            int64            `json:"last_seq"`
+	LastHash           string           `json:"last_hash,omitempty"`
+	CheckpointsChecked int              `json:"checkpoints_checked"`
+	UnsealedEntries    int              `json:"unsealed_entries"` // written but not yet chained
+	FirstBroken        *AuditChainBreak `json:"first_broken,omitempty"`
+	VerifiedAt         time.Time        `json:"verified_at"`
+}
+
+// recordBreak marks the chain invalid, keeping the break nearest its start
+func (v *AuditVerification) recordBreak(b AuditChainBreak) {
+	v.Valid = false
+	if v.FirstBroken == nil || b.Seq < v.FirstBroken.Seq {
+		v.FirstBroken = &b
+	}
+}
+
+// auditChainWalker checks entries one link at a time
+type auditChainWalker struct {
+	seq  int64
+	hash string // empty to accept the first entry's previous hash as given
+}
+
+// next checks that e follows the entries seen so far and returns the break, if any
+func (w *auditChainWalker) next(e AuditChainEntry) *AuditChainBreak {
+	if e.Seq != w.seq+1 {
+		return &AuditChainBreak{Seq: w.seq + 1, Reason: fmt.Sprintf("entry %d is missing", w.seq+1)}
+	}
+	if w.hash != "" && e.PrevHash != w.hash {
+		return &AuditChainBreak{Seq: e.Seq, EntryID: e.ID, Reason: "previous hash does not match the preceding entry", ExpectedHash: w.hash, ActualHash: e.PrevHash}
+	}
+	computed, err := e.chainHash(e.PrevHash)
+	if err != nil {
+		return &AuditChainBreak{Seq: e.Seq, EntryID: e.ID, Reason: err.Error()}
+	}
+	if computed != e.EntryHash {
+		return &AuditChainBreak{Seq: e.Seq, EntryID: e.ID, Reason: "entry content does not match its hash", ExpectedHash: computed, ActualHash: e.EntryHash}
+	}
+	w.seq, w.hash = e.Seq, e.EntryHash
+	return nil
+}
+
+// AuditSigner signs and verifies audit checkpoints
+type AuditSigner struct {
+	store *Store
+	keys  *KeyManager
+
+	mu       sync.Mutex
+	kid      string
+	private  ed25519.PrivateKey
+	verified map[string]ed25519.PublicKey // keys whose private half decrypted and matched
+}
+
+// NewAuditSigner signs with keys encrypted by the key manager
+func NewAuditSigner(store *Store, keys *KeyManager) *AuditSigner {
+	return &AuditSigner{store: store, keys: keys, verified: map[string]ed25519.PublicKey{}}
+}
+
+// generateKey creates and encrypts a new Ed25519 key pair
+func (a *AuditSigner) generateKey() (*StoredAuditSigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := a.keys.encrypt(der)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := randomURLToken(12)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredAuditSigningKey{
+		AuditSigningKey: AuditSigningKey{KeyID: kid, Algorithm: "Ed25519", PublicKey: base64.StdEncoding.EncodeToString(public)},
+		PrivateKey:      encrypted,
+	}, nil
+}
+
+// decryptKey returns a stored key's private half after checking that it
+// belongs to the published public key
+func (a *AuditSigner) decryptKey(stored StoredAuditSigningKey) (ed25519.PrivateKey, error) {
+	der, err := a.keys.decrypt(stored.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("key %s cannot be decrypted with this JWT_SECRET", stored.KeyID)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", stored.KeyID, err)
+	}
+	private, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s is not an Ed25519 key", stored.KeyID)
+	}
+	if base64.StdEncoding.EncodeToString(private.Public().(ed25519.PublicKey)) != stored.PublicKey {
+		return nil, fmt.Errorf("key %s: public key does not match the private key", stored.KeyID)
+	}
+	return private, nil
+}
+
+// signingKey returns the current signing key, creating the first one if needed
+func (a *AuditSigner) signingKey(ctx context.Context) (string, ed25519.PrivateKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.private != nil {
+		return a.kid, a.private, nil
+	}
+
+	stored, err := a.store.EnsureAuditSigningKey(WithoutOrganization(ctx), a.generateKey)
+	if err != nil {
+		return "", nil, err
+	}
+	private, err := a.decryptKey(*stored)
+	if err != nil {
+		return "", nil, err
+	}
+	a.kid, a.private = stored.KeyID, private
+	a.verified[stored.KeyID] = private.Public().(ed25519.PublicKey)
+	return a.kid, a.private, nil
+}
+
+// publicKey returns a signing key's public half once it has been checked
+// against the encrypted private half
+func (a *AuditSigner) publicKey(ctx context.Context, kid string) (ed25519.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if public, ok := a.verified[kid]; ok {
+		return public, nil
+	}
+
+	stored, err := a.store.ListAuditSigningKeys(WithoutOrganization(ctx))
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range stored {
+		if key.KeyID != kid {
+			continue
+		}
+		private, err := a.decryptKey(key)
+		if err != nil {
+			return nil, err
+		}
+		a.verified[kid] = private.Public().(ed25519.PublicKey)
+		return a.verified[kid], nil
+	}
+	return nil, fmt.Errorf("unknown signing key %s", kid)
+}
+
+// verifySignature checks a checkpoint's signature
+func (a *AuditSigner) verifySignature(ctx context.Context, cp AuditCheckpoint) error {
+	public, err := a.publicKey(ctx, cp.KeyID)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(cp.Signature)
+	if err != nil || !ed25519.Verify(public, cp.statement(), signature) {
+		return errors.New("signature does not verify")
+	}
+	return nil
+}
+
+// Verify walks the whole chain of ctx's organization and checks every
+// checkpoint against it
+func (a *AuditSigner) Verify(ctx context.Context) (*AuditVerification, error) {
+	checkpoints, err := a.store.ListAuditCheckpoints(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return a.verify(ctx, checkpoints, &auditChainWalker{hash: auditGenesisHash})
+}
+
+// verify walks the chain from the walker's position. Checkpoints are checked
+// against the entries they name; one past the end of the chain means entries
+// were removed from its tail.
+func (a *AuditSigner) verify(ctx context.Context, checkpoints []AuditCheckpoint, walker *auditChainWalker) (*AuditVerification, error) {
+	result := &AuditVerification{
+		OrganizationID: OrganizationFromContext(ctx),
+		Valid:          true,
+		VerifiedAt:     time.Now().UTC(),
+	}
+
+	bySeq := map[int64]AuditCheckpoint{}
+	for _, cp := range checkpoints {
+		if err := a.verifySignature(ctx, cp); err != nil {
+			result.recordBreak(AuditChainBreak{Seq: cp.Seq, Reason: fmt.Sprintf("checkpoint %s: %v", cp.ID, err)})
+			continue
+		}
+		bySeq[cp.Seq] = cp
+	}
+
+	err := a.store.WalkAuditChain(ctx, walker.seq, func(e AuditChainEntry) error {
+		if b := walker.next(e); b != nil {
+			result.recordBreak(*b)
+			return errStopWalk
+		}
+		result.EntriesChecked++
+		if cp, ok := bySeq[e.Seq]; ok {
+			if cp.EntryHash != e.EntryHash {
+				result.recordBreak(AuditChainBreak{Seq: e.Seq, EntryID: e.ID, Reason: fmt.Sprintf("entry does not match checkpoint %s", cp.ID), ExpectedHash: cp.EntryHash, ActualHash: e.EntryHash})
+				return errStopWalk
+			}
+			result.CheckpointsChecked++
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return nil, err
+	}
+	result.LastSeq, result.LastHash = walker.seq, walker.hash
+
+	if result.Valid {
+		for seq, cp := range bySeq {
+			if seq > walker.seq {
+				result.recordBreak(AuditChainBreak{Seq: walker.seq + 1, Reason: fmt.Sprintf("entries %d to %d named by checkpoint %s are missing", walker.seq+1, seq, cp.ID)})
+			}
+		}
+	}
+
+	if result.UnsealedEntries, err = a.store.CountUnsealedAuditEntries(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Checkpoint seals pending entries, verifies the chain from the previous
+// checkpoint and signs its head. It returns nil when nothing was added since
+// the previous checkpoint, and refuses to sign a broken chain.
+func (a *AuditSigner) Checkpoint(ctx context.Context) (*AuditCheckpoint, error) {
+	if _, err := a.store.SealAuditLog(ctx); err != nil {
+		return nil, fmt.Errorf("sealing audit log: %w", err)
+	}
+
+	latest, err := a.store.ListAuditCheckpoints(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	walker := &auditChainWalker{hash: auditGenesisHash}
+	if len(latest) > 0 {
+		// Start at the checkpointed entry itself so its content is checked too
+		walker = &auditChainWalker{seq: latest[0].Seq - 1}
+	}
+	verification, err := a.verify(ctx, latest, walker)
+	if err != nil {
+		return nil, err
+	}
+	if !verification.Valid {
+		b := verification.FirstBroken
+		return nil, fmt.Errorf("audit chain is broken at entry %d: %s", b.Seq, b.Reason)
+	}
+	if verification.LastSeq == 0 || (len(latest) > 0 && verification.LastSeq == latest[0].Seq) {
+		return nil, nil
+	}
+
+	kid, private, err := a.signingKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cp := &AuditCheckpoint{
+		OrganizationID: verification.OrganizationID,
+		Seq:            verification.LastSeq,
+		EntryHash:      verification.LastHash,
+		SignedAt:       time.Now().UTC().Truncate(time.Microsecond),
+		KeyID:          kid,
+	}
+	cp.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, cp.statement()))
+	if err := a.store.CreateAuditCheckpoint(ctx, cp); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Audit checkpoint: organization=%s seq=%d hash=%s kid=%s signature=%s",
+		cp.OrganizationID, cp.Seq, cp.EntryHash, cp.KeyID, cp.Signature)
+	return cp, nil
+}
+
+// SigningKeys lists the public keys checkpoints are signed with
+func (a *AuditSigner) SigningKeys(ctx context.Context) ([]AuditSigningKey, error) {
+	stored, err := a.store.ListAuditSigningKeys(WithoutOrganization(ctx))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]AuditSigningKey, 0, len(stored))
+	for _, key := range stored {
+		keys = append(keys, key.AuditSigningKey)
+	}
+	return keys, nil
+}
+
+// checkpointAuditLog seals the organization's audit log and signs a checkpoint
+// of its chain head when entries were added since the last one
+func (cs *CronService) checkpointAuditLog(ctx context.Context) (int, error) {
+	checkpoint, err := cs.audit.Checkpoint(ctx)
+	if err != nil || checkpoint == nil {
+		return 0, err
+	}
+	return 1, nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit log search
+//
+// The audit log API filters by actor, action, target entity, date range and the
+// content of the changes document, and pages with an opaque keyset cursor so
+// results stay stable while new entries are written. The same filters drive the
+// per-entity history and the CSV and JSON lines exports.
+
+const (
+	// auditPageDefault and auditPageMax bound the page size of audit queries
+	auditPageDefault = 100
+	auditPageMax     = 1000
+	// auditExportPageSize is how many entries an export reads at a time
+	auditExportPageSize = 500
+)
+
+// auditCSVHeader lists the columns of a CSV export
+var auditCSVHeader = []string{
+	"id", "seq", "performed_at", "user_id", "action_type", "target_entity_type", "target_entity_id",
+	"changes", "ip_address", "user_agent", "request_id", "session_id", "entry_hash",
+}
+
+// AuditLogFilter selects audit entries. Nil fields do not filter.
+type AuditLogFilter struct {
+	UserID       *string
+	ActionType   *string
+	EntityType   *string
+	EntityID     *string
+	From         *time.Time      // inclusive
+	To           *time.Time      // exclusive
+	Changes      json.RawMessage // JSON object the changes document must contain
+	ChangedField *string         // top-level key the changes document must have
+	Ascending    bool
+	After        *AuditLogCursor
+	Limit        int
+	Offset       int // deprecated: use After
+}
+
+// AuditLogCursor is the position after which the next page starts. Pages
+// follow the organization's hash chain sequence, which grows in the order
+// entries are written; performed_at can be older than entries already written
+// when an event is recorded late. Seq is nil for an entry not yet sealed.
+type AuditLogCursor struct {
+	Seq *int64
+	ID  string
+}
+
+// auditLogCursorOf returns the cursor positioned at entry
+func auditLogCursorOf(entry AuditLog) *AuditLogCursor {
+	return &AuditLogCursor{Seq: entry.Seq, ID: entry.ID}
+}
+
+// encode returns the cursor as an opaque URL-safe token
+func (c AuditLogCursor) encode() string {
+	seq := ""
+	if c.Seq != nil {
+		seq = strconv.FormatInt(*c.Seq, 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(seq + "|" + c.ID))
+}
+
+// decodeAuditLogCursor parses a token made by AuditLogCursor.encode
+func decodeAuditLogCursor(token string) (*AuditLogCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	seqText, id, ok := strings.Cut(string(raw), "|")
+	if !ok || uuid.Validate(id) != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	cursor := &AuditLogCursor{ID: id}
+	if seqText != "" {
+		seq, err := strconv.ParseInt(seqText, 10, 64)
+		if err != nil || seq < 1 {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		cursor.Seq = &seq
+	}
+	return cursor, nil
+}
+
+// nextAuditLogCursor returns the cursor of the page after page, or "" when
+// page was the last one
+func nextAuditLogCursor(page []AuditLog, limit int) string {
+	if len(page) == 0 || len(page) < limit {
+		return ""
+	}
+	return auditLogCursorOf(page[len(page)-1]).encode()
+}
+
+// parseAuditTime accepts an RFC 3339 timestamp or a date. A date means the
+// start of that day (UTC), or the start of the next day when endOfDay is set,
+// so "to=2024-03-31" includes the whole of March 31st.
+func parseAuditTime(value string, endOfDay bool) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// parseAuditLogFilter reads the filter and paging query parameters shared by
+// the audit log endpoints. It returns a message for the client when one is invalid.
+func parseAuditLogFilter(r *http.Request) (AuditLogFilter, string) {
+	q := r.URL.Query()
+	filter := AuditLogFilter{Limit: auditPageDefault}
+
+	optional := func(name string) *string {
+		if value := strings.TrimSpace(q.Get(name)); value != "" {
+			return &value
+		}
+		return nil
+	}
+	filter.UserID = optional("user_id")
+	filter.ActionType = optional("action_type")
+	filter.EntityType = optional("entity_type")
+	filter.EntityID = optional("entity_id")
+	filter.ChangedField = optional("changed_field")
+
+	if filter.UserID != nil && uuid.Validate(*filter.UserID) != nil {
+		return filter, "Parameter 'user_id' must be a UUID"
+	}
+	if from := optional("from"); from != nil {
+		t, err := parseAuditTime(*from, false)
+		if err != nil {
+			return filter, "Parameter 'from' must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"
+		}
+		filter.From = t
+	}
+	if to := optional("to"); to != nil {
+		t, err := parseAuditTime(*to, true)
+		if err != nil {
+			return filter, "Parameter 'to' must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"
+		}
+		filter.To = t
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, "Parameter 'from' must be before 'to'"
+	}
+	if changes := optional("changes"); changes != nil {
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(*changes), &object); err != nil || object == nil {
+			return filter, `Parameter 'changes' must be a JSON object, e.g. {"status":"Compliant"}`
+		}
+		filter.Changes = json.RawMessage(*changes)
+	}
+
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, "Parameter 'order' must be 'asc' or 'desc'"
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > auditPageMax {
+			return filter, fmt.Sprintf("Parameter 'limit' must be between 1 and %d", auditPageMax)
+		}
+		filter.Limit = l
+	}
+	if cursor := q.Get("cursor"); cursor != "" {
+		after, err := decodeAuditLogCursor(cursor)
+		if err != nil {
+			return filter, "Parameter 'cursor' is invalid"
+		}
+		filter.After = after
+	} else if offset := q.Get("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil && o >= 0 {
+			filter.Offset = o
+		}
+	}
+	return filter, ""
+}
+
+// describe returns the filter as it is recorded in the export's audit entry
+func (f AuditLogFilter) describe() map[string]interface{} {
+	out := map[string]interface{}{}
+	set := func(name string, value *string) {
+		if value != nil {
+			out[name] = *value
+		}
+	}
+	set("user_id", f.UserID)
+	set("action_type", f.ActionType)
+	set("entity_type", f.EntityType)
+	set("entity_id", f.EntityID)
+	set("changed_field", f.ChangedField)
+	if f.From != nil {
+		out["from"] = f.From.UTC()
+	}
+	if f.To != nil {
+		out["to"] = f.To.UTC()
+	}
+	if len(f.Changes) > 0 {
+		out["changes"] = f.Changes
+	}
+	return out
+}
+
+// auditExportWriter writes audit entries in an export format
+type auditExportWriter interface {
+	write(entry AuditLog) error
+	flush() error
+}
+
+// newAuditExportWriter returns a writer for format ("csv" or "jsonl") and the
+// response's content type
+func newAuditExportWriter(format string, w io.Writer) (auditExportWriter, string, error) {
+	switch format {
+	case "csv":
+		return &auditCSVWriter{w: csv.NewWriter(w)}, "text/csv; charset=utf-8", nil
+	case "jsonl":
+		return &auditJSONLinesWriter{enc: json.NewEncoder(w)}, "application/x-ndjson", nil
+	}
+	return nil, "", fmt.Errorf("unsupported format %q", format)
+}
+
+// auditCSVWriter writes a header row, then one row per entry
+type auditCSVWriter struct {
+	w      *csv.Writer
+	headed bool
+}
+
+// header writes the header row once
+func (a *auditCSVWriter) header() error {
+	if a.headed {
+		return nil
+	}
+	a.headed = true
+	return a.w.Write(auditCSVHeader)
+}
+
+func (a *auditCSVWriter) write(e AuditLog) error {
+	if err := a.header(); err != nil {
+		return err
+	}
+	text := func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return csvSafe(*value)
+	}
+	seq := ""
+	if e.Seq != nil {
+		seq = strconv.FormatInt(*e.Seq, 10)
+	}
+	return a.w.Write([]string{
+		e.ID, seq, e.PerformedAt.UTC().Format(time.RFC3339Nano), text(e.UserID), csvSafe(e.ActionType),
+		text(e.TargetEntityType), text(e.TargetEntityID), text(e.Changes), text(e.IPAddress),
+		text(e.UserAgent), text(e.RequestID), text(e.SessionID), text(e.EntryHash),
+	})
+}
+
+func (a *auditCSVWriter) flush() error {
+	if err := a.header(); err != nil {
+		return err
+	}
+	a.w.Flush()
+	return a.w.Error()
+}
+
+// auditJSONLinesWriter writes one JSON object per line
+type auditJSONLinesWriter struct {
+	enc *json.Encoder
+}
+
+func (a *auditJSONLinesWriter) write(e AuditLog) error {
+	// Embed the changes document as JSON rather than as a string
+	type entry struct {
+		AuditLog
+		Changes json.RawMessage `json:"changes,omitempty"`
+	}
+	out := entry{AuditLog: e}
+	if e.Changes != nil {
+		out.Changes = json.RawMessage(*e.Changes)
+	}
+	return a.enc.Encode(out)
+}
+
+func (a *auditJSONLinesWriter) flush() error { return nil }
+
+// csvSafe stops spreadsheet applications from evaluating a value as a formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// auditExportFilename names an export file after the current time
+func auditExportFilename(format string) string {
+	return fmt.Sprintf("audit-log-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+}
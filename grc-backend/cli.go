@@ -0,0 +1,704 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Command-line interface
+//
+// The backend binary runs the API server by default and also carries the
+// operator tooling, so maintenance tasks use the same configuration, Store and
+// migrations as the service itself:
+//
+//	grc-backend [serve]
+//	grc-backend migrate [up|down [n]|status]
+//	grc-backend seed
+//	grc-backend import-standard [--strict] [--dry-run] <file>...
+//	grc-backend import-oscal [--code <code>] [--catalog <code>] [--strict] [--dry-run] <file>...
+//	grc-backend export-oscal --standard <code> [--format json|xml] [--output <file>]
+//	grc-backend import-mappings <file>...
+//	grc-backend create-admin --email <email> --name <name> [--org <slug>] [--super-admin] [--password-stdin]
+//	grc-backend reset-password --email <email> [--password-stdin]
+//	grc-backend export-tenant --org <slug> [--output <file>]
+//	grc-backend run-job <name> [--org <slug>]
+//	grc-backend verify-audit [--org <slug>]
+//
+// Every command reads DATABASE_URL. Passwords are read from the first line of
+// standard input with --password-stdin; otherwise a random one is generated and
+// printed once.
+
+// cliEnv is what every command shares: one connection pool and the Store on top of it
+type cliEnv struct {
+	pool  *pgxpool.Pool
+	store *Store
+}
+
+// cliCommand is one subcommand of the backend binary
+type cliCommand struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, env *cliEnv, args []string) error
+}
+
+// cliCommands lists the subcommands in the order they are documented
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{"serve", "Run the API server and scheduled jobs (default)", runServe},
+		{"migrate", "Apply, revert or list schema migrations", runMigrateCLI},
+		{"seed", "Load the built-in control library, test users and templates", runSeedCLI},
+		{"import-standard", "Import control standards from JSON files", runImportStandardCLI},
+		{"import-oscal", "Import OSCAL catalogs and profiles (JSON or XML) as standards", runImportOSCALCLI},
+		{"export-oscal", "Export a standard as an OSCAL catalog", runExportOSCALCLI},
+		{"import-mappings", "Import cross-standard control mappings from JSON files", runImportMappingsCLI},
+		{"create-admin", "Create a local administrator", runCreateAdminCLI},
+		{"reset-password", "Set a new password for a local user", runResetPasswordCLI},
+		{"export-tenant", "Export an organization's data as JSON", runExportTenantCLI},
+		{"run-job", "Run one scheduled job now", runJobCLI},
+		{"verify-audit", "Verify the audit log hash chain and its signed checkpoints", runVerifyAuditCLI},
+	}
+}
+
+// printCLIUsage writes the command summary
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: grc-backend <command> [arguments]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range cliCommands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+}
+
+// runCLI dispatches to a subcommand; with no arguments it serves the API
+func runCLI(args []string) error {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		printCLIUsage(os.Stdout)
+		return nil
+	}
+
+	var command *cliCommand
+	for _, cmd := range cliCommands() {
+		if cmd.name == name {
+			command = &cmd
+			break
+		}
+	}
+	if command == nil {
+		printCLIUsage(os.Stderr)
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		return errors.New("DATABASE_URL environment variable is required")
+	}
+
+	ctx := context.Background()
+	pool, err := connectDatabase(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	env := &cliEnv{pool: pool, store: NewStore(pool)}
+	if err := command.run(ctx, env, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// newCLIFlags returns a flag set that reports errors instead of exiting
+func newCLIFlags(usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(strings.Fields(usage)[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: grc-backend %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// seedDatabase loads the reference data the application expects to find
+func seedDatabase(ctx context.Context, pool *pgxpool.Pool) error {
+	if err := SeedControlLibrary(ctx, pool); err != nil {
+		return err
+	}
+	// Templates are optional; the file is missing in some deployments
+	if err := SeedControlTemplates(ctx, pool); err != nil {
+		log.Printf("Warning: Failed to seed control templates: %v", err)
+	}
+	return nil
+}
+
+// cliOrganization resolves an organization slug, or the default organization when empty
+func cliOrganization(ctx context.Context, store *Store, slug string) (*Organization, error) {
+	if slug != "" {
+		return store.GetOrganizationBySlug(ctx, slug)
+	}
+	orgs, err := store.ListOrganizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orgs {
+		if orgs[i].IsDefault {
+			return &orgs[i], nil
+		}
+	}
+	return nil, errors.New("no default organization; pass --org")
+}
+
+// cliPassword reads a password from the first line of stdin, or generates one
+func cliPassword(fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		password, err = randomURLToken(12)
+		return password, true, err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if !isValidPassword(password) {
+		return "", false, fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	return password, false, nil
+}
+
+// cliAuditChanges marks audit entries written by the command line
+func cliAuditChanges(changes map[string]interface{}) map[string]interface{} {
+	changes["source"] = "cli"
+	return changes
+}
+
+func runMigrateCLI(ctx context.Context, env *cliEnv, args []string) error {
+	return runMigrateCommand(ctx, env.pool, args)
+}
+
+func runSeedCLI(ctx context.Context, env *cliEnv, args []string) error {
+	if err := seedDatabase(ctx, env.pool); err != nil {
+		return err
+	}
+	fmt.Println("Seed data loaded")
+	return nil
+}
+
+func runImportStandardCLI(ctx context.Context, env *cliEnv, args []string) error {
+	fs := newCLIFlags("import-standard [--strict] [--dry-run] <file>...")
+	strict := fs.Bool("strict", false, "reject a file with any invalid control instead of skipping those controls")
+	dryRun := fs.Bool("dry-run", false, "print the import report, with the diff against the library, as JSON without importing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("usage: import-standard [--strict] [--dry-run] <file>...")
+	}
+	opts := StandardImportOptions{Mode: StandardImportLenient, DryRun: *dryRun}
+	if *strict {
+		opts.Mode = StandardImportStrict
+	}
+
+	for _, path := range fs.Args() {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var importData StandardImportData
+		if err := json.Unmarshal(body, &importData); err != nil {
+			return fmt.Errorf("%s: invalid JSON: %w", path, err)
+		}
+		if err := cliImportStandard(ctx, env, path, importData, opts, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cliImportStandard imports one standard file read from path and prints its
+// report: the whole report as JSON for a dry run, otherwise its problems and a
+// summary. extra is added to the audit entry.
+func cliImportStandard(ctx context.Context, env *cliEnv, path string, importData StandardImportData, opts StandardImportOptions, extra map[string]interface{}) error {
+	var report *StandardImportReport
+	err := env.store.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		if report, err = env.store.ImportStandard(ctx, importData, opts); err != nil || report.Failed() || opts.DryRun {
+			return err
+		}
+		entityType := "standard"
+		changes := map[string]interface{}{
+			"code":              importData.Standard.Code,
+			"name":              importData.Standard.Name,
+			"version":           importData.Standard.Version,
+			"mode":              report.Mode,
+			"action":            report.Diff.Action,
+			"controls_imported": report.ControlsImported,
+			"controls_skipped":  report.ControlsSkipped,
+			"added":             len(report.Diff.Added),
+			"removed":           len(report.Diff.Removed),
+			"changed":           len(report.Diff.Changed),
+			"file":              path,
+		}
+		if report.Diff.Action == StandardImportNewVersion {
+			changes["supersedes"] = report.Diff.ComparedTo.Code
+		}
+		for k, v := range extra {
+			changes[k] = v
+		}
+		return env.store.LogAudit(ctx, nil, "STANDARD_IMPORTED", &entityType, nil, cliAuditChanges(changes), nil)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if opts.DryRun {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printStandardImportProblems(os.Stderr, path, report)
+	if report.Failed() {
+		return fmt.Errorf("%s: %s", path, report.Error)
+	}
+	fmt.Printf("Imported %s from %s: %s, %d controls imported, %d skipped (%d added, %d removed, %d changed)\n",
+		importData.Standard.Code, path, report.Diff.Action, report.ControlsImported, report.ControlsSkipped,
+		len(report.Diff.Added), len(report.Diff.Removed), len(report.Diff.Changed))
+	return nil
+}
+
+func runImportOSCALCLI(ctx context.Context, env *cliEnv, args []string) error {
+	fs := newCLIFlags("import-oscal [--code <code>] [--catalog <code>] [--strict] [--dry-run] <file>...")
+	code := fs.String("code", "", "standard code (default: the code it was exported with, or the title and version)")
+	catalog := fs.String("catalog", "", "library standard a profile's imports refer to, when they are not files next to it")
+	strict := fs.Bool("strict", false, "reject a document with any invalid control instead of skipping those controls")
+	dryRun := fs.Bool("dry-run", false, "print the import report, with the diff against the library, as JSON without importing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("usage: import-oscal [--code <code>] [--catalog <code>] [--strict] [--dry-run] <file>...")
+	}
+	if *code != "" && fs.NArg() > 1 {
+		return errors.New("--code applies to a single file")
+	}
+	opts := StandardImportOptions{Mode: StandardImportLenient, DryRun: *dryRun}
+	if *strict {
+		opts.Mode = StandardImportStrict
+	}
+
+	for _, path := range fs.Args() {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		doc, err := parseOSCAL(body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		// A profile's imports are files relative to it, else library standards
+		library := env.store.OSCALLibrarySource(ctx, *catalog)
+		source := func(href string) (*oscalDocument, error) {
+			if u, err := url.Parse(href); err == nil && u.Scheme == "" && u.Host == "" {
+				body, err := os.ReadFile(filepath.Join(filepath.Dir(path), filepath.FromSlash(u.Path)))
+				if err == nil {
+					return parseOSCAL(body)
+				}
+				if !errors.Is(err, os.ErrNotExist) {
+					return nil, err
+				}
+			}
+			return library(href)
+		}
+		importData, err := oscalImportData(doc, source, OSCALImportOptions{Code: *code})
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		format := "oscal-catalog"
+		if doc.Profile != nil {
+			format = "oscal-profile"
+		}
+		if err := cliImportStandard(ctx, env, path, importData, opts, map[string]interface{}{"format": format}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runExportOSCALCLI(ctx context.Context, env *cliEnv, args []string) error {
+	fs := newCLIFlags("export-oscal --standard <code> [--format json|xml] [--output <file>]")
+	code := fs.String("standard", "", "code of the standard to export")
+	format := fs.String("format", "json", "json or xml")
+	output := fs.String("output", "", "file to write (standard output if empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *code == "" {
+		fs.Usage()
+		return errors.New("--standard is required")
+	}
+	if *format != "json" && *format != "xml" {
+		return errors.New("--format must be json or xml")
+	}
+
+	std, err := env.store.GetStandardByCode(ctx, *code)
+	if err != nil {
+		return err
+	}
+	if std == nil {
+		return fmt.Errorf("no standard with code %s", *code)
+	}
+	cat, err := env.store.ExportOSCALCatalog(ctx, std.ID)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	if _, err := writeOSCALCatalog(out, cat, *format); err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Printf("Exported %s to %s\n", std.Code, *output)
+	}
+	return nil
+}
+
+// printStandardImportProblems writes the errors and warnings of an import report
+func printStandardImportProblems(w io.Writer, path string, report *StandardImportReport) {
+	for _, issue := range report.Errors {
+		fmt.Fprintf(w, "%s: error: %s %s\n", path, issue.Field, issue.Message)
+	}
+	for _, issue := range report.Warnings {
+		fmt.Fprintf(w, "%s: warning: %s %s\n", path, issue.Field, issue.Message)
+	}
+	for _, c := range report.Controls {
+		for _, msg := range c.Errors {
+			fmt.Fprintf(w, "%s: controls[%d] %s: %s\n", path, c.Index, c.ControlID, msg)
+		}
+		for _, msg := range c.Warnings {
+			fmt.Fprintf(w, "%s: warning: controls[%d] %s: %s\n", path, c.Index, c.ControlID, msg)
+		}
+	}
+}
+
+func runImportMappingsCLI(ctx context.Context, env *cliEnv, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: import-mappings <file>...")
+	}
+
+	for _, path := range args {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file, err := parseControlMappingFile(body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		var result *ControlMappingImportResult
+		err = env.store.InTx(ctx, func(ctx context.Context) error {
+			var err error
+			if result, err = env.store.ImportControlMappings(ctx, file.Mappings, file.Name); err != nil {
+				return err
+			}
+			entityType := "control_mapping"
+			return env.store.LogAudit(ctx, nil, "CONTROL_MAPPINGS_IMPORTED", &entityType, nil, cliAuditChanges(map[string]interface{}{
+				"name":             file.Name,
+				"created":          result.Created,
+				"updated":          result.Updated,
+				"skipped":          result.Skipped,
+				"unknown_controls": result.UnknownControls,
+				"file":             path,
+			}), nil)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("Imported %s from %s: %d created, %d updated, %d skipped\n", file.Name, path, result.Created, result.Updated, result.Skipped)
+		if len(result.UnknownControls) > 0 {
+			fmt.Printf("  Controls not in the library: %s\n", strings.Join(result.UnknownControls, ", "))
+		}
+	}
+	return nil
+}
+
+func runCreateAdminCLI(ctx context.Context, env *cliEnv, args []string) error {
+	fs := newCLIFlags("create-admin --email <email> --name <name> [--org <slug>] [--super-admin] [--password-stdin]")
+	email := fs.String("email", "", "email address to sign in with")
+	name := fs.String("name", "", "display name")
+	orgSlug := fs.String("org", "", "organization slug (default organization if empty)")
+	superAdmin := fs.Bool("super-admin", false, "also make the user a platform super admin")
+	fromStdin := fs.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" || *name == "" {
+		fs.Usage()
+		return errors.New("--email and --name are required")
+	}
+
+	org, err := cliOrganization(ctx, env.store, *orgSlug)
+	if err != nil {
+		return err
+	}
+	password, generated, err := cliPassword(*fromStdin)
+	if err != nil {
+		return err
+	}
+
+	var user *User
+	err = env.store.InTx(WithOrganization(ctx, org.ID), func(ctx context.Context) error {
+		var err error
+		if user, err = env.store.CreateAdminUser(ctx, strings.TrimSpace(*email), strings.TrimSpace(*name), password, *superAdmin); err != nil {
+			return err
+		}
+		entityType := "user"
+		return env.store.LogAudit(ctx, nil, "USER_CREATED", &entityType, &user.ID, cliAuditChanges(map[string]interface{}{
+			"email":          user.Email,
+			"name":           user.Name,
+			"role":           user.Role,
+			"is_super_admin": *superAdmin,
+		}), nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created administrator %s in organization %s (%s)\n", user.Email, org.Slug, user.ID)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+func runResetPasswordCLI(ctx context.Context, env *cliEnv, args []string) error {
+	fs := newCLIFlags("reset-password --email <email> [--password-stdin]")
+	email := fs.String("email", "", "email address of the local user")
+	fromStdin := fs.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errors.New("--email is required")
+	}
+
+	user, err := env.store.GetLocalUserByEmail(ctx, *email)
+	if err != nil {
+		return err
+	}
+	password, generated, err := cliPassword(*fromStdin)
+	if err != nil {
+		return err
+	}
+
+	err = env.store.InTx(WithOrganization(ctx, user.OrganizationID), func(ctx context.Context) error {
+		if err := env.store.SetUserPassword(ctx, user.ID, password); err != nil {
+			return err
+		}
+		entityType := "user"
+		return env.store.LogAudit(ctx, nil, "PASSWORD_RESET_COMPLETED", &entityType, &user.ID, cliAuditChanges(map[string]interface{}{
+			"email": user.Email,
+		}), nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Password changed for %s; existing sessions were signed out\n", user.Email)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+// TenantExport is the document written by export-tenant
+type TenantExport struct {
+	Organization *Organization                `json:"organization"`
+	ExportedAt   time.Time                    `json:"exported_at"`
+	Tables       map[string][]json.RawMessage `json:"tables"`
+}
+
+func runExportTenantCLI(ctx context.Context, env *cliEnv, args []string) error {
+	fs := newCLIFlags("export-tenant --org <slug> [--output <file>]")
+	orgSlug := fs.String("org", "", "organization slug")
+	output := fs.String("output", "", "file to write (standard output if empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *orgSlug == "" {
+		fs.Usage()
+		return errors.New("--org is required")
+	}
+
+	org, err := env.store.GetOrganizationBySlug(ctx, *orgSlug)
+	if err != nil {
+		return err
+	}
+	// The export is recorded before anything is written
+	var tables map[string][]json.RawMessage
+	err = env.store.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		if tables, err = env.store.ExportOrganizationData(ctx, org.ID); err != nil {
+			return err
+		}
+		entityType := "organization"
+		rowCounts := map[string]interface{}{}
+		for table, rows := range tables {
+			rowCounts[table] = len(rows)
+		}
+		return env.store.LogAudit(WithOrganization(ctx, org.ID), nil, "ORGANIZATION_EXPORTED", &entityType, &org.ID, cliAuditChanges(map[string]interface{}{
+			"slug": org.Slug,
+			"rows": rowCounts,
+		}), nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(TenantExport{Organization: org, ExportedAt: time.Now().UTC(), Tables: tables}); err != nil {
+		return err
+	}
+
+	if *output != "" {
+		fmt.Printf("Exported organization %s to %s\n", org.Slug, *output)
+	}
+	return nil
+}
+
+// cliAuditSigner loads the checkpoint signer, which needs the server's JWT_SECRET
+func cliAuditSigner(env *cliEnv) (*AuditSigner, error) {
+	keyManager, err := NewKeyManager(env.store)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditSigner(env.store, keyManager), nil
+}
+
+func runJobCLI(ctx context.Context, env *cliEnv, args []string) error {
+	auditSigner, err := cliAuditSigner(env)
+	if err != nil {
+		return err
+	}
+	cronService := NewCronService(env.store, NewEmailService(), auditSigner)
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: run-job <name> [--org <slug>] (jobs: %s)", strings.Join(cronService.JobNames(), ", "))
+	}
+	name := args[0]
+
+	fs := newCLIFlags("run-job <name> [--org <slug>]")
+	orgSlug := fs.String("org", "", "run for one organization only (all active organizations if empty)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	orgID := ""
+	if *orgSlug != "" {
+		org, err := env.store.GetOrganizationBySlug(ctx, *orgSlug)
+		if err != nil {
+			return err
+		}
+		orgID = org.ID
+	}
+
+	run, err := cronService.RunJob(ctx, name, orgID)
+	if err != nil {
+		if run != nil {
+			return fmt.Errorf("job %s failed (run %s): %w", name, run.ID, err)
+		}
+		return err
+	}
+	fmt.Printf("Job %s finished in %s: %d item(s) processed (run %s)\n",
+		name, run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond), run.ItemsProcessed, run.ID)
+	return nil
+}
+
+func runVerifyAuditCLI(ctx context.Context, env *cliEnv, args []string) error {
+	fs := newCLIFlags("verify-audit [--org <slug>]")
+	orgSlug := fs.String("org", "", "verify one organization only (all organizations if empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	auditSigner, err := cliAuditSigner(env)
+	if err != nil {
+		return err
+	}
+
+	var orgs []Organization
+	if *orgSlug != "" {
+		org, err := env.store.GetOrganizationBySlug(ctx, *orgSlug)
+		if err != nil {
+			return err
+		}
+		orgs = append(orgs, *org)
+	} else if orgs, err = env.store.ListOrganizations(ctx); err != nil {
+		return err
+	}
+
+	broken := 0
+	for _, org := range orgs {
+		result, err := auditSigner.Verify(WithOrganization(ctx, org.ID))
+		if err != nil {
+			return fmt.Errorf("%s: %w", org.Slug, err)
+		}
+		if result.Valid {
+			fmt.Printf("%s: OK, %d entries, %d checkpoint(s), head %d %s\n",
+				org.Slug, result.EntriesChecked, result.CheckpointsChecked, result.LastSeq, result.LastHash)
+		} else {
+			broken++
+			b := result.FirstBroken
+			fmt.Printf("%s: BROKEN at entry %d: %s\n", org.Slug, b.Seq, b.Reason)
+			if b.ExpectedHash != "" {
+				fmt.Printf("  entry %s, expected %s, found %s\n", b.EntryID, b.ExpectedHash, b.ActualHash)
+			}
+		}
+		if result.UnsealedEntries > 0 {
+			fmt.Printf("  %d entries not yet sealed\n", result.UnsealedEntries)
+		}
+	}
+	if broken > 0 {
+		return fmt.Errorf("%d organization(s) have a broken audit chain", broken)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cross-standard control mappings
+//
+// A mapping links two library controls from different standards, e.g.
+// ISO-27001-5.15 and SOC 2 CC6.1, with the relationship between their
+// requirements. Evidence is collected once: evidence submitted on an activated
+// control also counts toward every control it fully covers, that is the
+// controls it is equal to or a superset of. Subset and related mappings are
+// informational. Mappings are not followed transitively.
+
+const (
+	MappingEqual    = "equal"
+	MappingSubset   = "subset"   // the source covers part of the target
+	MappingSuperset = "superset" // the source covers all of the target and more
+	MappingRelated  = "related"
+)
+
+// ControlMapping is a relationship between two library controls, read as
+// "source is <relationship> target"
+type ControlMapping struct {
+	ID              string    `json:"id"`
+	SourceControlID string    `json:"source_control_id"`
+	SourceStandard  string    `json:"source_standard"`
+	SourceName      string    `json:"source_name"`
+	TargetControlID string    `json:"target_control_id"`
+	TargetStandard  string    `json:"target_standard"`
+	TargetName      string    `json:"target_name"`
+	Relationship    string    `json:"relationship"`
+	Notes           *string   `json:"notes,omitempty"`
+	Origin          *string   `json:"origin,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ControlMappingRequest is the JSON for creating a mapping, and one entry of a mapping file
+type ControlMappingRequest struct {
+	SourceControlID string `json:"source_control_id"`
+	TargetControlID string `json:"target_control_id"`
+	Relationship    string `json:"relationship"`
+	Notes           string `json:"notes,omitempty"`
+}
+
+// ControlMappingFile is the format of mapping files such as
+// standards-data/mappings/ISO-27001-2022_SOC-2.json
+type ControlMappingFile struct {
+	Name     string                  `json:"name"`
+	Mappings []ControlMappingRequest `json:"mappings"`
+}
+
+// ControlMappingImportResult summarizes an import. Entries naming controls
+// that are not in the library are skipped and listed.
+type ControlMappingImportResult struct {
+	Created         int      `json:"created"`
+	Updated         int      `json:"updated"`
+	Skipped         int      `json:"skipped"`
+	UnknownControls []string `json:"unknown_controls,omitempty"`
+}
+
+// invertRelationship returns the relationship read from the target's side
+func invertRelationship(relationship string) string {
+	switch relationship {
+	case MappingSubset:
+		return MappingSuperset
+	case MappingSuperset:
+		return MappingSubset
+	}
+	return relationship
+}
+
+// normalizeControlMapping validates a mapping and orders its pair the way it
+// is stored (source ID before target ID), inverting the relationship if needed
+func normalizeControlMapping(req ControlMappingRequest) (ControlMappingRequest, string) {
+	req.SourceControlID = strings.TrimSpace(req.SourceControlID)
+	req.TargetControlID = strings.TrimSpace(req.TargetControlID)
+	req.Relationship = strings.ToLower(strings.TrimSpace(req.Relationship))
+	req.Notes = strings.TrimSpace(req.Notes)
+
+	if req.SourceControlID == "" || req.TargetControlID == "" {
+		return req, "Fields 'source_control_id' and 'target_control_id' are required"
+	}
+	if req.SourceControlID == req.TargetControlID {
+		return req, "A control cannot be mapped to itself"
+	}
+	switch req.Relationship {
+	case MappingEqual, MappingSubset, MappingSuperset, MappingRelated:
+	default:
+		return req, fmt.Sprintf("Field 'relationship' must be one of %s, %s, %s or %s", MappingEqual, MappingSubset, MappingSuperset, MappingRelated)
+	}
+
+	if req.SourceControlID > req.TargetControlID {
+		req.SourceControlID, req.TargetControlID = req.TargetControlID, req.SourceControlID
+		req.Relationship = invertRelationship(req.Relationship)
+	}
+	return req, ""
+}
+
+// parseControlMappingFile decodes a mapping file and normalizes its entries.
+// Any invalid entry rejects the whole file.
+func parseControlMappingFile(body []byte) (*ControlMappingFile, error) {
+	var file ControlMappingFile
+	if err := json.Unmarshal(body, &file); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if len(file.Mappings) == 0 {
+		return nil, fmt.Errorf("the file has no mappings")
+	}
+	for i, m := range file.Mappings {
+		normalized, msg := normalizeControlMapping(m)
+		if msg != "" {
+			return nil, fmt.Errorf("mapping %d (%s -> %s): %s", i+1, m.SourceControlID, m.TargetControlID, msg)
+		}
+		file.Mappings[i] = normalized
+	}
+	return &file, nil
+}
+
+// carriesEvidence reports whether evidence on a control with this relationship
+// to another control also satisfies the other control
+func carriesEvidence(relationship string) bool {
+	return relationship == MappingEqual || relationship == MappingSuperset
+}
+
+// ControlEvidenceSummary is the evidence recorded on one activated control
+type ControlEvidenceSummary struct {
+	ControlID     string    // library ID
+	EvidenceCount int       // entries in control_evidence_log
+	LatestStatus  string    // compliance status of the latest entry
+	LatestAt      time.Time // when the latest entry was recorded
+}
+
+// ControlCoverage is a library control's evidence including what it inherits
+// through mappings. Status is the compliance status of the most recent
+// evidence from either source, and StatusFrom the control it was recorded on.
+type ControlCoverage struct {
+	ControlID           string   `json:"control_id"`
+	EvidenceCount       int      `json:"evidence_count"`
+	MappedEvidenceCount int      `json:"mapped_evidence_count"`
+	Status              string   `json:"status,omitempty"`
+	StatusFrom          string   `json:"status_from,omitempty"`
+	CoveredBy           []string `json:"covered_by,omitempty"` // mapped controls that contributed evidence
+	latestAt            time.Time
+}
+
+// Inherited reports whether the control's status comes from a mapped control
+func (c ControlCoverage) Inherited() bool {
+	return c.StatusFrom != "" && c.StatusFrom != c.ControlID
+}
+
+// computeControlCoverage combines the organization's evidence with the
+// mappings: every control gets its own evidence plus that of the controls
+// that fully cover it
+func computeControlCoverage(evidence map[string]ControlEvidenceSummary, mappings []ControlMapping) map[string]ControlCoverage {
+	coverage := map[string]ControlCoverage{}
+	add := func(controlID string, from ControlEvidenceSummary) {
+		c := coverage[controlID]
+		c.ControlID = controlID
+		if from.ControlID == controlID {
+			c.EvidenceCount += from.EvidenceCount
+		} else {
+			c.MappedEvidenceCount += from.EvidenceCount
+			c.CoveredBy = append(c.CoveredBy, from.ControlID)
+		}
+		if c.Status == "" || from.LatestAt.After(c.latestAt) {
+			c.Status, c.StatusFrom, c.latestAt = from.LatestStatus, from.ControlID, from.LatestAt
+		}
+		coverage[controlID] = c
+	}
+
+	for controlID, summary := range evidence {
+		add(controlID, summary)
+	}
+	for _, m := range mappings {
+		if summary, ok := evidence[m.SourceControlID]; ok && carriesEvidence(m.Relationship) {
+			add(m.TargetControlID, summary)
+		}
+		if summary, ok := evidence[m.TargetControlID]; ok && carriesEvidence(invertRelationship(m.Relationship)) {
+			add(m.SourceControlID, summary)
+		}
+	}
+	for id, c := range coverage {
+		sort.Strings(c.CoveredBy)
+		coverage[id] = c
+	}
+	return coverage
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/robfig/cron/v3"
 )
@@ -11,150 +12,89 @@ import (
 type CronService struct {
 	store *Store
 	email *EmailService
+	audit *AuditSigner
 	cron  *cron.Cron
-}
 
-func NewCronService(store *Store, email *EmailService) *CronService {
-	return &CronService{
-		store: store,
-		email: email,
-		cron:  cron.New(),
-	}
+	schedules    map[string]string // job name -> cron expression; empty when disabled
+	entries      map[string]cron.EntryID
+	maxAttempts  int
+	retryBackoff time.Duration // wait before the first retry; doubles after each failure
+	instance     string
+	done         chan struct{}
 }
 
-func (cs *CronService) Start() {
-	// Run every hour at minute 0
-	cs.cron.AddFunc("0 * * * *", cs.checkDueControls)
-	cs.cron.AddFunc("0 8 * * *", cs.sendDailyDigestEmails) // 8 AM daily
-	cs.cron.AddFunc("0 9 * * 1", cs.sendWeeklyDigestEmails) // 9 AM every Monday
-	cs.cron.Start()
-	log.Println("Cron service started")
+func NewCronService(store *Store, email *EmailService, audit *AuditSigner) *CronService {
+	cs := &CronService{
+		store:        store,
+		email:        email,
+		audit:        audit,
+		cron:         cron.New(),
+		entries:      map[string]cron.EntryID{},
+		maxAttempts:  envInt("JOB_MAX_ATTEMPTS", 3),
+		retryBackoff: envDuration("JOB_RETRY_BACKOFF", time.Minute),
+		instance:     jobInstanceName(),
+		done:         make(chan struct{}),
+	}
+	cs.schedules = loadJobSchedules(cs.jobs())
+	return cs
 }
 
-func (cs *CronService) Stop() {
-	ctx := cs.cron.Stop()
-	<-ctx.Done()
-	log.Println("Cron service stopped")
-}
-
-func (cs *CronService) checkDueControls() {
-	log.Println("Checking for due controls...")
-
-	ctx := context.Background()
-
-	// Get controls that are due today or overdue
-	rows, err := cs.store.db.Query(ctx, `
-		SELECT ac.id, ac.control_library_id, ac.owner_id, u.name, u.email
-		FROM activated_controls ac
-		LEFT JOIN users u ON ac.owner_id = u.id
-		WHERE ac.status = 'active'
-		AND ac.next_review_due_date <= CURRENT_DATE
-		AND ac.owner_id IS NOT NULL
-	`)
-	if err != nil {
-		log.Printf("Error querying due controls: %v", err)
-		return
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var controlID, controlLibraryID, ownerID string
-		var ownerName, ownerEmail *string
-
-		if err := rows.Scan(&controlID, &controlLibraryID, &ownerID, &ownerName, &ownerEmail); err != nil {
-			log.Printf("Error scanning due control row: %v", err)
-			continue
-		}
-
-		// Create notification for the control owner
-		message := fmt.Sprintf("Control %s is due for review", controlLibraryID)
-		linkURL := fmt.Sprintf("/controls/activated/%s", controlID)
-
-		err = cs.store.CreateNotification(ctx, ownerID, message, linkURL)
-		if err != nil {
-			log.Printf("Error creating due control notification: %v", err)
-		} else {
-			log.Printf("Created due control notification for control %s", controlLibraryID)
-		}
-
-		// Send email notification if email is enabled and user has email
-		if cs.email.IsEnabled() && ownerEmail != nil && *ownerEmail != "" {
-			name := "User"
-			if ownerName != nil {
-				name = *ownerName
-			}
-			err = cs.email.SendDueControlReminder(*ownerEmail, name, controlLibraryID, controlID, 0)
-			if err != nil {
-				log.Printf("Error sending due control email to %s: %v", *ownerEmail, err)
-			}
-		}
-	}
-
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating due controls: %v", err)
+// jobs lists the scheduled jobs; the names are used by the admin API, `grc-backend
+// run-job` and the JOB_SCHEDULE_* variables
+func (cs *CronService) jobs() []cronJob {
+	return []cronJob{
+		{"due-controls", "Send control reminders and escalations under the reminder policy", "0 * * * *", cs.checkDueControls}, // hourly
+		{"daily-digest", "Email the daily compliance summary to admins", "0 8 * * *", cs.sendDailyDigestEmails},                // 8 AM daily
+		{"weekly-digest", "Email the weekly compliance summary to admins", "0 9 * * 1", cs.sendWeeklyDigestEmails},             // 9 AM every Monday
+		{"audit-checkpoint", "Seal the audit log and sign its hash chain", "30 * * * *", cs.checkpointAuditLog},                // hourly, at half past
 	}
 }
 
-func (cs *CronService) checkOverdueControls() {
-	log.Println("Checking for overdue controls...")
-
-	ctx := context.Background()
-
-	// Get controls that are overdue (more than 7 days past due)
-	rows, err := cs.store.db.Query(ctx, `
-		SELECT ac.id, ac.control_library_id, ac.owner_id, u.name, u.email
-		FROM activated_controls ac
-		LEFT JOIN users u ON ac.owner_id = u.id
-		WHERE ac.status = 'active'
-		AND ac.next_review_due_date < CURRENT_DATE - INTERVAL '7 days'
-		AND ac.owner_id IS NOT NULL
-	`)
-	if err != nil {
-		log.Printf("Error querying overdue controls: %v", err)
-		return
+// JobNames lists the job names in schedule order
+func (cs *CronService) JobNames() []string {
+	names := []string{}
+	for _, job := range cs.jobs() {
+		names = append(names, job.Name)
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var controlID, controlLibraryID, ownerID string
-		var ownerName, ownerEmail *string
+	return names
+}
 
-		if err := rows.Scan(&controlID, &controlLibraryID, &ownerID, &ownerName, &ownerEmail); err != nil {
-			log.Printf("Error scanning overdue control row: %v", err)
+func (cs *CronService) Start() {
+	for _, job := range cs.jobs() {
+		spec := cs.schedules[job.Name]
+		if spec == "" {
+			log.Printf("Job %s is disabled", job.Name)
 			continue
 		}
-
-		// Create urgent notification for overdue controls
-		message := fmt.Sprintf("URGENT: Control %s is overdue for review", controlLibraryID)
-		linkURL := fmt.Sprintf("/controls/activated/%s", controlID)
-
-		err = cs.store.CreateNotification(ctx, ownerID, message, linkURL)
+		schedule, err := cron.ParseStandard(spec)
 		if err != nil {
-			log.Printf("Error creating overdue control notification: %v", err)
-		} else {
-			log.Printf("Created overdue control notification for control %s", controlLibraryID)
+			log.Printf("Error scheduling job %s: %v", job.Name, err)
+			continue
 		}
+		cs.entries[job.Name] = cs.cron.Schedule(schedule, cron.FuncJob(func() { cs.runScheduled(job, schedule) }))
 	}
+	cs.cron.Start()
+	log.Println("Cron service started")
+}
 
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating overdue controls: %v", err)
-	}
+func (cs *CronService) Stop() {
+	close(cs.done)
+	ctx := cs.cron.Stop()
+	<-ctx.Done()
+	log.Println("Cron service stopped")
 }
 
-func (cs *CronService) sendDailyDigestEmails() {
+func (cs *CronService) sendDailyDigestEmails(ctx context.Context) (int, error) {
 	log.Println("Sending daily digest emails...")
 
-	ctx := context.Background()
-
-	// Get all admin users
+	// Get all active admin users
 	adminRows, err := cs.store.db.Query(ctx, `
 		SELECT id, name, email
 		FROM users
-		WHERE role = 'admin'
+		WHERE role = 'admin' AND active
 	`)
 	if err != nil {
-		log.Printf("Error querying admin users: %v", err)
-		return
+		return 0, fmt.Errorf("querying admin users: %w", err)
 	}
 	defer adminRows.Close()
 
@@ -168,8 +108,7 @@ func (cs *CronService) sendDailyDigestEmails() {
 		FROM activated_controls
 	`).Scan(&totalControls, &compliantControls, &overdueControls)
 	if err != nil {
-		log.Printf("Error getting control counts: %v", err)
-		return
+		return 0, fmt.Errorf("getting control counts: %w", err)
 	}
 
 	// Get open ticket count
@@ -180,10 +119,10 @@ func (cs *CronService) sendDailyDigestEmails() {
 		WHERE status IN ('new', 'in_progress')
 	`).Scan(&openTickets)
 	if err != nil {
-		log.Printf("Error getting open ticket count: %v", err)
-		return
+		return 0, fmt.Errorf("getting open ticket count: %w", err)
 	}
 
+	processed := 0
 	for adminRows.Next() {
 		var adminID, adminName, adminEmail string
 
@@ -199,29 +138,28 @@ func (cs *CronService) sendDailyDigestEmails() {
 				log.Printf("Error sending daily digest email to %s: %v", adminEmail, err)
 			} else {
 				log.Printf("Sent daily digest email to %s", adminEmail)
+				processed++
 			}
 		}
 	}
 
 	if err := adminRows.Err(); err != nil {
-		log.Printf("Error iterating admin users: %v", err)
+		return processed, fmt.Errorf("iterating admin users: %w", err)
 	}
+	return processed, nil
 }
 
-func (cs *CronService) sendWeeklyDigestEmails() {
+func (cs *CronService) sendWeeklyDigestEmails(ctx context.Context) (int, error) {
 	log.Println("Sending weekly digest emails...")
 
-	ctx := context.Background()
-
-	// Get all admin users
+	// Get all active admin users
 	adminRows, err := cs.store.db.Query(ctx, `
 		SELECT id, name, email
 		FROM users
-		WHERE role = 'admin'
+		WHERE role = 'admin' AND active
 	`)
 	if err != nil {
-		log.Printf("Error querying admin users: %v", err)
-		return
+		return 0, fmt.Errorf("querying admin users: %w", err)
 	}
 	defer adminRows.Close()
 
@@ -235,8 +173,7 @@ func (cs *CronService) sendWeeklyDigestEmails() {
 		FROM activated_controls
 	`).Scan(&totalControls, &compliantControls, &overdueControls)
 	if err != nil {
-		log.Printf("Error getting control counts: %v", err)
-		return
+		return 0, fmt.Errorf("getting control counts: %w", err)
 	}
 
 	// Get evidence submissions in the last 7 days
@@ -247,8 +184,7 @@ func (cs *CronService) sendWeeklyDigestEmails() {
 		WHERE performed_at >= NOW() - INTERVAL '7 days'
 	`).Scan(&evidenceSubmissions)
 	if err != nil {
-		log.Printf("Error getting evidence count: %v", err)
-		return
+		return 0, fmt.Errorf("getting evidence count: %w", err)
 	}
 
 	// Get tickets resolved in the last 7 days
@@ -260,8 +196,7 @@ func (cs *CronService) sendWeeklyDigestEmails() {
 		AND resolved_at >= NOW() - INTERVAL '7 days'
 	`).Scan(&ticketsResolved)
 	if err != nil {
-		log.Printf("Error getting resolved tickets count: %v", err)
-		return
+		return 0, fmt.Errorf("getting resolved tickets count: %w", err)
 	}
 
 	// Calculate compliance rate
@@ -278,6 +213,7 @@ func (cs *CronService) sendWeeklyDigestEmails() {
 		"tickets_resolved":      ticketsResolved,
 	}
 
+	processed := 0
 	for adminRows.Next() {
 		var adminID, adminName, adminEmail string
 
@@ -293,11 +229,13 @@ func (cs *CronService) sendWeeklyDigestEmails() {
 				log.Printf("Error sending weekly digest email to %s: %v", adminEmail, err)
 			} else {
 				log.Printf("Sent weekly digest email to %s", adminEmail)
+				processed++
 			}
 		}
 	}
 
 	if err := adminRows.Err(); err != nil {
-		log.Printf("Error iterating admin users: %v", err)
+		return processed, fmt.Errorf("iterating admin users: %w", err)
 	}
+	return processed, nil
 }
@@ -6,7 +6,9 @@ import (
 	"html/template"
 	"log"
 	"net/smtp"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -18,6 +20,7 @@ type EmailService struct {
 	smtpPassword string
 	fromEmail    string
 	fromName     string
+	appURL       string // Base URL of the web app used for links in emails
 	enabled      bool
 }
 
@@ -46,6 +49,11 @@ func NewEmailService() *EmailService {
 		fromName = "GRC Compliance Platform"
 	}
 
+	appURL := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if appURL == "" {
+		appURL = "https://compliance.yourcompany.com"
+	}
+
 	return &EmailService{
 		smtpHost:     smtpHost,
 		smtpPort:     smtpPort,
@@ -53,6 +61,7 @@ func NewEmailService() *EmailService {
 		smtpPassword: smtpPassword,
 		fromEmail:    fromEmail,
 		fromName:     fromName,
+		appURL:       appURL,
 		enabled:      enabled,
 	}
 }
@@ -206,7 +215,7 @@ func (es *EmailService) SendOverdueControlAlert(userEmail, userName, controlName
 			"Please complete the control review as soon as possible to maintain compliance.",
 		controlName, daysOverdue,
 	)
-	actionURL := fmt.Sprintf("https://compliance.yourcompany.com/controls/%s", controlID)
+	actionURL := fmt.Sprintf("%s/controls/%s", es.appURL, controlID)
 	actionText := "Review Control Now"
 
 	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
@@ -216,12 +225,16 @@ func (es *EmailService) SendOverdueControlAlert(userEmail, userName, controlName
 func (es *EmailService) SendDueControlReminder(userEmail, userName, controlName, controlID string, daysUntilDue int) error {
 	subject := fmt.Sprintf("📅 Control Review Due: %s", controlName)
 	title := "Control Review Reminder"
+	when := fmt.Sprintf("in <strong>%d days</strong>", daysUntilDue)
+	if daysUntilDue <= 0 {
+		when = "<strong>today</strong>"
+	}
 	body := fmt.Sprintf(
-		"Control <strong>%s</strong> is due for review in <strong>%d days</strong>.<br><br>"+
+		"Control <strong>%s</strong> is due for review %s.<br><br>"+
 			"Please plan to complete the review before the deadline.",
-		controlName, daysUntilDue,
+		controlName, when,
 	)
-	actionURL := fmt.Sprintf("https://compliance.yourcompany.com/controls/%s", controlID)
+	actionURL := fmt.Sprintf("%s/controls/%s", es.appURL, controlID)
 	actionText := "View Control"
 
 	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
@@ -246,7 +259,7 @@ func (es *EmailService) SendDailyDigest(userEmail, userName string, totalControl
 			"Stay on top of your compliance posture with regular reviews.",
 		totalControls, compliantControls, complianceRate, overdueControls, openTickets,
 	)
-	actionURL := "https://compliance.yourcompany.com/dashboard"
+	actionURL := es.appURL + "/dashboard"
 	actionText := "View Dashboard"
 
 	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
@@ -273,7 +286,7 @@ func (es *EmailService) SendWeeklyDigest(userEmail, userName string, stats map[s
 		stats["evidence_submissions"],
 		stats["tickets_resolved"],
 	)
-	actionURL := "https://compliance.yourcompany.com/reports"
+	actionURL := es.appURL + "/reports"
 	actionText := "View Full Report"
 
 	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
@@ -287,7 +300,7 @@ func (es *EmailService) SendWelcomeEmail(userEmail, userName string) error {
 		"Your account has been successfully created. You can now access the platform to manage controls, " +
 		"track compliance, and generate reports.<br><br>" +
 		"If you have any questions, please don't hesitate to reach out to your administrator."
-	actionURL := "https://compliance.yourcompany.com/dashboard"
+	actionURL := es.appURL + "/dashboard"
 	actionText := "Get Started"
 
 	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
@@ -300,12 +313,27 @@ func (es *EmailService) SendPasswordResetEmail(userEmail, userName, resetToken s
 	body := "We received a request to reset your password.<br><br>" +
 		"Click the button below to reset your password. This link will expire in 1 hour.<br><br>" +
 		"If you didn't request a password reset, please ignore this email."
-	actionURL := fmt.Sprintf("https://compliance.yourcompany.com/reset-password?token=%s", resetToken)
+	actionURL := fmt.Sprintf("%s/reset-password?token=%s", es.appURL, url.QueryEscape(resetToken))
 	actionText := "Reset Password"
 
 	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
 }
 
+// SendInvitationEmail invites a new user to set their password and sign in
+func (es *EmailService) SendInvitationEmail(userEmail, userName, inviterName, inviteToken string) error {
+	subject := "✉️ You've been invited to GRC Compliance Platform"
+	title := "You're Invited"
+	body := fmt.Sprintf(
+		"<strong>%s</strong> has created an account for you on the GRC Compliance Platform.<br><br>"+
+			"Click the button below to choose your password. This link will expire in 72 hours.",
+		inviterName,
+	)
+	actionURL := fmt.Sprintf("%s/set-password?token=%s", es.appURL, url.QueryEscape(inviteToken))
+	actionText := "Set Password"
+
+	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
+}
+
 // SendReportGeneratedEmail sends a notification when a compliance report is generated
 func (es *EmailService) SendReportGeneratedEmail(userEmail, userName, standardName, reportType string) error {
 	subject := fmt.Sprintf("📄 Compliance Report Generated: %s", standardName)
@@ -315,12 +343,28 @@ func (es *EmailService) SendReportGeneratedEmail(userEmail, userName, standardNa
 			"The report includes detailed control status, compliance metrics, and recommendations.",
 		reportType, standardName,
 	)
-	actionURL := "https://compliance.yourcompany.com/compliance-reports"
+	actionURL := es.appURL + "/compliance-reports"
 	actionText := "View Reports"
 
 	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
 }
 
+// SendAccountLockedEmail warns a user that repeated failed sign-ins locked their account
+func (es *EmailService) SendAccountLockedEmail(userEmail, userName string, lockedUntil time.Time, ipAddress string) error {
+	subject := "🔒 Your account has been temporarily locked"
+	title := "Account Locked"
+	body := fmt.Sprintf(
+		"Your account was locked after repeated failed sign-in attempts from <strong>%s</strong>.<br><br>"+
+			"You can sign in again after <strong>%s</strong>, or reset your password to unlock it now. "+
+			"If these attempts were not made by you, contact your administrator.",
+		template.HTMLEscapeString(ipAddress), lockedUntil.UTC().Format("2006-01-02 15:04 MST"),
+	)
+	actionURL := es.appURL + "/forgot-password"
+	actionText := "Reset Password"
+
+	return es.SendTemplatedEmail(userEmail, userName, subject, title, body, actionURL, actionText)
+}
+
 // BatchSendEmails sends multiple emails (useful for digests)
 func (es *EmailService) BatchSendEmails(emails []struct {
 	To      string
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+// Domain events
+//
+// State changes are described by domain events written to the domain_events
+// outbox in the same transaction as the change (see Store.InTx), so an event
+// exists exactly when its change was committed. The EventDispatcher reads the
+// outbox and hands each event to every subscribed handler: the audit log,
+// webhooks, in-app notifications and emails all consume this one stream.
+// Handlers run at least once; the ones that succeeded are recorded so a retry
+// only repeats the failures, and the audit and webhook handlers are idempotent
+// on the event ID. After EVENT_MAX_ATTEMPTS the optional handlers are given
+// up on, but a required one (the audit log) is retried every eventMaxBackoff
+// until it succeeds; the event stays in the outbox, and is not pruned, until then.
+//
+// Password reset and invitation emails are still sent directly by their
+// handlers: they carry one-time tokens that must not be stored in the outbox.
+
+const (
+	// eventMaxBackoff caps the delay between attempts to handle an event
+	eventMaxBackoff = 10 * time.Minute
+	// eventPruneInterval is how often dispatched events past retention are deleted
+	eventPruneInterval = time.Hour
+)
+
+// DomainEvent is something that happened to an entity, as recorded in the outbox
+type DomainEvent struct {
+	ID             string          `json:"id"`
+	OrganizationID string          `json:"organization_id"`
+	Type           string          `json:"event_type"` // e.g. RISK_UPDATED; doubles as the audit action type
+	OccurredAt     time.Time       `json:"occurred_at"`
+	ActorID        *string         `json:"actor_id,omitempty"`
+	EntityType     *string         `json:"entity_type,omitempty"`
+	EntityID       *string         `json:"entity_id,omitempty"`
+	Data           json.RawMessage `json:"data,omitempty"`
+	IPAddress      *string         `json:"ip_address,omitempty"`
+	UserAgent      *string         `json:"user_agent,omitempty"`
+	RequestID      *string         `json:"request_id,omitempty"`
+	SessionID      *string         `json:"session_id,omitempty"`
+	HandledBy      []string        `json:"handled_by"`
+	Attempts       int             `json:"attempts"`
+}
+
+// decodeData unmarshals the event's data into v
+func (e DomainEvent) decodeData(v interface{}) error {
+	if len(e.Data) == 0 {
+		return fmt.Errorf("event %s has no data", e.Type)
+	}
+	return json.Unmarshal(e.Data, v)
+}
+
+// clientIP returns the address the event originated from, or ""
+func (e DomainEvent) clientIP() string {
+	if e.IPAddress == nil {
+		return ""
+	}
+	return *e.IPAddress
+}
+
+// withRequestContext fills in the request fields the caller left unset from the
+// HTTP request and session being served in ctx, if any
+func (e *DomainEvent) withRequestContext(ctx context.Context) {
+	if info, ok := requestInfoFromContext(ctx); ok {
+		if e.IPAddress == nil && info.ClientIP != "" {
+			e.IPAddress = &info.ClientIP
+		}
+		if e.UserAgent == nil && info.UserAgent != "" {
+			e.UserAgent = &info.UserAgent
+		}
+		if e.RequestID == nil {
+			e.RequestID = &info.RequestID
+		}
+	}
+	if sessionID, ok := ctx.Value(SessionIDKey).(string); ok && e.SessionID == nil && sessionID != "" {
+		e.SessionID = &sessionID
+	}
+}
+
+// EventHandler consumes domain events. It must tolerate seeing an event twice.
+type EventHandler struct {
+	Name     string
+	Handle   func(ctx context.Context, event DomainEvent) error
+	Required bool // never given up on
+}
+
+// EventDispatcher feeds committed domain events to the subscribed handlers.
+// Several replicas can run one; each event is leased to a single dispatcher.
+type EventDispatcher struct {
+	store        *Store
+	handlers     []EventHandler
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	retention    time.Duration
+}
+
+// NewEventDispatcher reads the EVENT_* settings
+func NewEventDispatcher(store *Store) *EventDispatcher {
+	return &EventDispatcher{
+		store:        store,
+		pollInterval: envDuration("EVENT_POLL_INTERVAL", 2*time.Second),
+		batchSize:    envInt("EVENT_BATCH_SIZE", 100),
+		maxAttempts:  envInt("EVENT_MAX_ATTEMPTS", 10),
+		retention:    envDuration("EVENT_RETENTION", 7*24*time.Hour),
+	}
+}
+
+// Subscribe registers a handler. Handlers are called in subscription order.
+func (d *EventDispatcher) Subscribe(name string, handle func(ctx context.Context, event DomainEvent) error) {
+	d.handlers = append(d.handlers, EventHandler{Name: name, Handle: handle})
+}
+
+// SubscribeRequired registers a handler that every event must reach: it is
+// retried with capped backoff for as long as it fails
+func (d *EventDispatcher) SubscribeRequired(name string, handle func(ctx context.Context, event DomainEvent) error) {
+	d.handlers = append(d.handlers, EventHandler{Name: name, Handle: handle, Required: true})
+}
+
+// Start dispatches events until ctx is cancelled. Commits made through this
+// process wake it immediately; events from other replicas are found by polling.
+func (d *EventDispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.store.events:
+			}
+			d.dispatchPending(ctx)
+
+			if time.Since(lastPrune) >= eventPruneInterval {
+				lastPrune = time.Now()
+				if n, err := d.store.PruneDomainEvents(WithoutOrganization(ctx), d.retention); err != nil {
+					log.Printf("Error pruning domain events: %v", err)
+				} else if n > 0 {
+					log.Printf("Pruned %d dispatched domain event(s)", n)
+				}
+			}
+		}
+	}()
+}
+
+// dispatchPending claims and handles batches until nothing is due
+func (d *EventDispatcher) dispatchPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := d.store.ClaimDomainEvents(WithoutOrganization(ctx), d.batchSize, time.Minute)
+		if err != nil {
+			log.Printf("Error claiming domain events: %v", err)
+			return
+		}
+		for _, event := range events {
+			d.dispatch(ctx, event)
+		}
+		if len(events) < d.batchSize {
+			return
+		}
+	}
+}
+
+// dispatch runs the handlers that have not yet succeeded for an event and
+// records the outcome
+func (d *EventDispatcher) dispatch(ctx context.Context, event DomainEvent) {
+	scoped := WithOrganization(ctx, event.OrganizationID)
+	handled := append([]string{}, event.HandledBy...)
+
+	var errs []error
+	requiredFailed := false
+	for _, handler := range d.handlers {
+		if slices.Contains(handled, handler.Name) {
+			continue
+		}
+		if err := d.run(scoped, handler, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", handler.Name, err))
+			requiredFailed = requiredFailed || handler.Required
+			continue
+		}
+		handled = append(handled, handler.Name)
+	}
+
+	failure := errors.Join(errs...)
+	done := failure == nil
+	switch {
+	case done:
+	case event.Attempts >= d.maxAttempts && !requiredFailed:
+		log.Printf("Giving up on domain event %s (%s) after %d attempt(s): %v", event.ID, event.Type, event.Attempts, failure)
+		done = true
+	case event.Attempts >= d.maxAttempts:
+		log.Printf("WARNING: domain event %s (%s) still not recorded after %d attempt(s), retrying: %v", event.ID, event.Type, event.Attempts, failure)
+	default:
+		log.Printf("Error handling domain event %s (%s), attempt %d: %v", event.ID, event.Type, event.Attempts, failure)
+	}
+
+	if err := d.store.FinishDomainEvent(WithoutOrganization(ctx), event.ID, handled, done, failure, time.Now().Add(d.backoff(event.Attempts))); err != nil {
+		log.Printf("Error recording domain event %s: %v", event.ID, err)
+	}
+}
+
+// run calls one handler, turning a panic into an error
+func (d *EventDispatcher) run(ctx context.Context, handler EventHandler, event DomainEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Event handler %s panicked: %v\n%s", handler.Name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler.Handle(ctx, event)
+}
+
+// backoff is the delay after the given number of failed attempts
+func (d *EventDispatcher) backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := time.Second << (attempts - 1)
+	if delay > eventMaxBackoff || delay <= 0 {
+		return eventMaxBackoff
+	}
+	return delay
+}
+
+// RegisterEventHandlers subscribes the platform's consumers: the audit log,
+// webhook deliveries, in-app notifications and emails
+func RegisterEventHandlers(d *EventDispatcher, store *Store, email *EmailService) {
+	d.SubscribeRequired("audit", store.WriteAuditEntry)
+	d.Subscribe("webhooks", store.EnqueueWebhookDeliveries)
+	n := &eventNotifier{store: store, email: email}
+	d.Subscribe("notifications", n.notify)
+	d.Subscribe("emails", n.sendEmail)
+}
+
+// eventNotifier turns domain events into in-app notifications and emails
+type eventNotifier struct {
+	store *Store
+	email *EmailService
+}
+
+// reassignmentData is the data of CONTROL_OWNER_REASSIGNED
+type reassignmentData struct {
+	PreviousOwnerID string   `json:"previous_owner_id"`
+	NewOwnerID      *string  `json:"new_owner_id"`
+	ControlIDs      []string `json:"control_ids"`
+	Reason          string   `json:"reason"`
+}
+
+// accountLockedData is the data of ACCOUNT_LOCKED
+type accountLockedData struct {
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// notify creates the in-app notifications for an event
+func (n *eventNotifier) notify(ctx context.Context, event DomainEvent) error {
+	switch event.Type {
+	case "CONTROL_OWNER_REASSIGNED":
+		var data reassignmentData
+		if err := event.decodeData(&data); err != nil {
+			return err
+		}
+		return n.notifyControlReassignment(ctx, data)
+	case "ACCOUNT_LOCKED":
+		var data accountLockedData
+		if err := event.decodeData(&data); err != nil || event.EntityID == nil {
+			return err
+		}
+		return n.notifyAccountLocked(ctx, *event.EntityID, data.LockedUntil, event.clientIP())
+	}
+	return nil
+}
+
+// notifyControlReassignment tells the new owner about controls they inherited or,
+// when nobody did, asks everyone who manages controls to pick a new owner
+func (n *eventNotifier) notifyControlReassignment(ctx context.Context, data reassignmentData) error {
+	if len(data.ControlIDs) == 0 {
+		return nil
+	}
+	formerName := data.PreviousOwnerID
+	if former, err := n.store.GetUserByID(ctx, data.PreviousOwnerID); err == nil {
+		formerName = former.Name
+	}
+
+	if data.NewOwnerID != nil {
+		message := fmt.Sprintf("You are now the owner of %d control(s) previously owned by %s", len(data.ControlIDs), formerName)
+		return n.store.CreateNotification(ctx, *data.NewOwnerID, message, "/controls")
+	}
+
+	recipients, err := n.store.ListActiveUserIDsByRoles(ctx, RolesWithPermission(PermControlsManage))
+	if err != nil {
+		return fmt.Errorf("listing control managers: %w", err)
+	}
+	message := fmt.Sprintf("%d control(s) owned by %s have no owner after the account was deprovisioned", len(data.ControlIDs), formerName)
+	for _, recipientID := range recipients {
+		if err := n.store.CreateNotification(ctx, recipientID, message, "/controls"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyAccountLocked tells the locked-out user and the organization's user administrators
+func (n *eventNotifier) notifyAccountLocked(ctx context.Context, userID string, until time.Time, ipAddr string) error {
+	user, err := n.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("loading locked user: %w", err)
+	}
+
+	message := fmt.Sprintf("Your account was locked until %s after repeated failed sign-in attempts", until.UTC().Format("15:04 MST"))
+	if err := n.store.CreateNotification(ctx, user.ID, message, "/settings/security"); err != nil {
+		return err
+	}
+
+	admins, err := n.store.ListActiveUserIDsByRoles(ctx, RolesWithPermission(PermUsersManage))
+	if err != nil {
+		return fmt.Errorf("listing user administrators: %w", err)
+	}
+	adminMessage := fmt.Sprintf("%s was locked out after repeated failed sign-in attempts from %s", user.Email, ipAddr)
+	for _, adminID := range admins {
+		if adminID == user.ID {
+			continue
+		}
+		if err := n.store.CreateNotification(ctx, adminID, adminMessage, "/users"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendEmail sends the emails for an event
+func (n *eventNotifier) sendEmail(ctx context.Context, event DomainEvent) error {
+	if !n.email.IsEnabled() {
+		return nil
+	}
+	switch event.Type {
+	case "ACCOUNT_LOCKED":
+		var data accountLockedData
+		if err := event.decodeData(&data); err != nil || event.EntityID == nil {
+			return err
+		}
+		user, err := n.store.GetUserByID(ctx, *event.EntityID)
+		if err != nil {
+			return fmt.Errorf("loading locked user: %w", err)
+		}
+		return n.email.SendAccountLockedEmail(user.Email, user.Name, data.LockedUntil, event.clientIP())
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Scheduled jobs
+//
+// Every replica runs the same schedule, so executions are coordinated through
+// PostgreSQL. A session advisory lock per job keeps two instances from running
+// it at the same time, and the job_runs row for a schedule slot can only be
+// inserted once per attempt, so whichever replica fires first does the work and
+// the others skip it. Failed runs are retried with exponential backoff, for the
+// organizations that failed only, so emails already sent are not sent again.
+// Schedules are overridden with JOB_SCHEDULE_<NAME> (e.g. JOB_SCHEDULE_DUE_CONTROLS),
+// where "off" disables the job.
+
+// jobLockPrefix namespaces the advisory lock keys of scheduled jobs
+const jobLockPrefix = "grc_job:"
+
+// errJobBusy means another instance holds the job's lock
+var errJobBusy = errors.New("job is already running")
+
+// cronJob is a named job run once per organization
+type cronJob struct {
+	Name            string
+	Description     string
+	DefaultSchedule string
+	run             func(ctx context.Context) (int, error) // returns the number of items processed
+}
+
+// JobRun is one recorded execution of a job
+type JobRun struct {
+	ID             string     `json:"id"`
+	JobName        string     `json:"job_name"`
+	Source         string     `json:"source"` // schedule, manual or cli
+	Status         string     `json:"status"` // running, succeeded or failed
+	Attempt        int        `json:"attempt"`
+	ScheduledFor   *time.Time `json:"scheduled_for,omitempty"`
+	OrganizationID *string    `json:"organization_id,omitempty"`
+	TriggeredByID  *string    `json:"triggered_by_id,omitempty"`
+	Instance       string     `json:"instance"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	ItemsProcessed int        `json:"items_processed"`
+	Error          *string    `json:"error,omitempty"`
+}
+
+// JobInfo describes a job and its schedule for the admin API
+type JobInfo struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Schedule    string     `json:"schedule"` // cron expression; empty when disabled
+	Enabled     bool       `json:"enabled"`
+	NextRunAt   *time.Time `json:"next_run_at,omitempty"`
+	LastRun     *JobRun    `json:"last_run,omitempty"`
+}
+
+// TriggerJobRequest is the JSON for running a job on demand
+type TriggerJobRequest struct {
+	OrganizationID *string `json:"organization_id,omitempty"` // all active organizations if omitted
+}
+
+// jobScheduleEnv names the variable that overrides a job's schedule
+func jobScheduleEnv(jobName string) string {
+	return "JOB_SCHEDULE_" + strings.ToUpper(strings.ReplaceAll(jobName, "-", "_"))
+}
+
+// loadJobSchedules returns the cron expression for each job; an empty string
+// means the job is disabled
+func loadJobSchedules(jobs []cronJob) map[string]string {
+	schedules := map[string]string{}
+	for _, job := range jobs {
+		spec := strings.TrimSpace(os.Getenv(jobScheduleEnv(job.Name)))
+		switch {
+		case spec == "":
+			spec = job.DefaultSchedule
+		case spec == "off" || spec == "disabled":
+			spec = ""
+		case strings.HasPrefix(spec, "@every"):
+			// Interval schedules are not aligned across replicas, so slots cannot be shared
+			log.Printf("Ignoring %s=%q: use a cron expression", jobScheduleEnv(job.Name), spec)
+			spec = job.DefaultSchedule
+		default:
+			if _, err := cron.ParseStandard(spec); err != nil {
+				log.Printf("Ignoring invalid %s=%q: %v", jobScheduleEnv(job.Name), spec, err)
+				spec = job.DefaultSchedule
+			}
+		}
+		schedules[job.Name] = spec
+	}
+	return schedules
+}
+
+// jobInstanceName identifies this process in job_runs
+func jobInstanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// job looks up a job by name
+func (cs *CronService) job(name string) (cronJob, bool) {
+	for _, job := range cs.jobs() {
+		if job.Name == name {
+			return job, true
+		}
+	}
+	return cronJob{}, false
+}
+
+// acquireJobLock takes the job's advisory lock on a dedicated connection. It
+// returns errJobBusy without waiting when another instance holds it.
+func (cs *CronService) acquireJobLock(ctx context.Context, name string) (func(), error) {
+	conn, err := cs.store.db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1));`, jobLockPrefix+name).Scan(&locked); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	if !locked {
+		conn.Release()
+		return nil, errJobBusy
+	}
+	return func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtext($1));`, jobLockPrefix+name); err != nil {
+			log.Printf("Error releasing lock for job %s: %v", name, err)
+		}
+		conn.Release()
+	}, nil
+}
+
+// startRun locks the job and records the start of a run. When record is set it
+// runs in the same transaction, so the run is only started if it succeeds. The
+// returned release function must be passed to finishRun.
+func (cs *CronService) startRun(ctx context.Context, job cronJob, run JobRun, record func(ctx context.Context, run *JobRun) error) (*JobRun, func(), error) {
+	release, err := cs.acquireJobLock(ctx, job.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	run.JobName = job.Name
+	run.Instance = cs.instance
+
+	var started *JobRun
+	err = cs.store.InTx(WithoutOrganization(ctx), func(ctx context.Context) error {
+		var err error
+		if started, err = cs.store.StartJobRun(ctx, run); err != nil {
+			return err
+		}
+		if record != nil {
+			return record(ctx, started)
+		}
+		return nil
+	})
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return started, release, nil
+}
+
+// finishRun executes a started run, records its outcome and releases the lock.
+// completed is passed on to forEachOrganization and may be nil.
+func (cs *CronService) finishRun(ctx context.Context, job cronJob, run *JobRun, release func(), completed map[string]bool) error {
+	defer release()
+
+	items, runErr := cs.execute(ctx, job, run.OrganizationID, completed)
+	run.ItemsProcessed = items
+	run.Status = "succeeded"
+	if runErr != nil {
+		run.Status = "failed"
+		text := runErr.Error()
+		run.Error = &text
+		log.Printf("Job %s failed (attempt %d): %v", job.Name, run.Attempt, runErr)
+	} else {
+		log.Printf("Job %s finished: %d item(s) processed", job.Name, items)
+	}
+	now := time.Now()
+	run.FinishedAt = &now
+
+	if err := cs.store.FinishJobRun(WithoutOrganization(ctx), run.ID, run.Status, items, runErr); err != nil {
+		log.Printf("Error recording result of job %s: %v", job.Name, err)
+	}
+	return runErr
+}
+
+// execute runs a job for one organization, or for every active organization
+// when orgID is nil. A panic fails the run instead of the process.
+func (cs *CronService) execute(ctx context.Context, job cronJob, orgID *string, completed map[string]bool) (items int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v\n%s", job.Name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if orgID != nil {
+		return job.run(WithOrganization(ctx, *orgID))
+	}
+	return cs.forEachOrganization(ctx, job.run, completed)
+}
+
+// forEachOrganization runs fn once for every active organization, with the
+// store scoped to that organization so data and recipients never mix tenants.
+// Failures in one organization do not stop the others. Organizations in
+// completed are skipped and those that succeed are added to it, when it is set.
+func (cs *CronService) forEachOrganization(ctx context.Context, fn func(ctx context.Context) (int, error), completed map[string]bool) (int, error) {
+	orgs, err := cs.store.ListOrganizations(WithoutOrganization(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("listing organizations: %w", err)
+	}
+
+	total := 0
+	var errs []error
+	for _, org := range orgs {
+		if org.Status != "active" || completed[org.ID] {
+			continue
+		}
+		n, err := fn(WithOrganization(ctx, org.ID))
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", org.Slug, err))
+		} else if completed != nil {
+			completed[org.ID] = true
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// runScheduled is what the cron scheduler calls. All replicas derive the same
+// slot from the schedule, so only the first to claim it runs the job. Retries
+// stay with the instance that claimed the first attempt and skip the
+// organizations an earlier attempt finished.
+func (cs *CronService) runScheduled(job cronJob, schedule cron.Schedule) {
+	slot := schedule.Next(time.Now().Truncate(time.Minute).Add(-time.Second))
+	ctx := context.Background()
+	completed := map[string]bool{}
+
+	for attempt := 1; attempt <= cs.maxAttempts; attempt++ {
+		run, release, err := cs.startRun(ctx, job, JobRun{Source: "schedule", Attempt: attempt, ScheduledFor: &slot}, nil)
+		if err != nil {
+			if errors.Is(err, errJobBusy) || err.Error() == "job run already claimed" {
+				return // another instance has it
+			}
+			log.Printf("Error starting job %s: %v", job.Name, err)
+		} else if err := cs.finishRun(ctx, job, run, release, completed); err == nil {
+			return
+		}
+
+		if attempt == cs.maxAttempts {
+			break
+		}
+		delay := cs.retryBackoff << (attempt - 1)
+		log.Printf("Retrying job %s in %s (attempt %d of %d)", job.Name, delay, attempt+1, cs.maxAttempts)
+		select {
+		case <-time.After(delay):
+		case <-cs.done:
+			return
+		}
+	}
+}
+
+// TriggerJob starts a job in the background on behalf of an administrator and
+// returns its run record. record is called in the transaction that starts the
+// run, for the audit entry.
+func (cs *CronService) TriggerJob(ctx context.Context, name string, orgID, userID *string, record func(ctx context.Context, run *JobRun) error) (*JobRun, error) {
+	job, ok := cs.job(name)
+	if !ok {
+		return nil, fmt.Errorf("job not found")
+	}
+	run, release, err := cs.startRun(ctx, job, JobRun{Source: "manual", Attempt: 1, OrganizationID: orgID, TriggeredByID: userID}, record)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := *run
+	go cs.finishRun(context.Background(), job, run, release, nil)
+	return &snapshot, nil
+}
+
+// RunJob runs a job to completion in the calling process, for a single
+// organization when orgID is set and otherwise for every active organization
+func (cs *CronService) RunJob(ctx context.Context, name, orgID string) (*JobRun, error) {
+	job, ok := cs.job(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown job %q (available: %s)", name, strings.Join(cs.JobNames(), ", "))
+	}
+	request := JobRun{Source: "cli", Attempt: 1}
+	if orgID != "" {
+		request.OrganizationID = &orgID
+	}
+	run, release, err := cs.startRun(ctx, job, request, nil)
+	if err != nil {
+		return nil, err
+	}
+	return run, cs.finishRun(ctx, job, run, release, nil)
+}
+
+// ListJobs describes every job with its schedule, next run and latest run
+func (cs *CronService) ListJobs(ctx context.Context) ([]JobInfo, error) {
+	latest, err := cs.store.LatestJobRuns(WithoutOrganization(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []JobInfo{}
+	for _, job := range cs.jobs() {
+		info := JobInfo{
+			Name:        job.Name,
+			Description: job.Description,
+			Schedule:    cs.schedules[job.Name],
+			Enabled:     cs.schedules[job.Name] != "",
+		}
+		if id, ok := cs.entries[job.Name]; ok {
+			if next := cs.cron.Entry(id).Next; !next.IsZero() {
+				info.NextRunAt = &next
+			}
+		}
+		if run, ok := latest[job.Name]; ok {
+			info.LastRun = &run
+		}
+		jobs = append(jobs, info)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// devJWTSecret is only accepted when APP_ENV is a development environment
+	devJWTSecret = "test-secret"
+	// jwtKeyPrepublish is how long a new key is published in the JWKS before it
+	// signs anything, so verifiers that cache the JWKS pick it up in time
+	jwtKeyPrepublish = time.Hour
+	// jwtKeyReloadInterval is how often each instance reloads keys from the database
+	jwtKeyReloadInterval = time.Minute
+)
+
+// isDevMode reports whether the server runs in a local development environment
+func isDevMode() bool {
+	switch strings.ToLower(os.Getenv("APP_ENV")) {
+	case "dev", "development", "local":
+		return true
+	}
+	return false
+}
+
+// StoredSigningKey is a row in 'jwt_signing_keys'; the private key is encrypted at rest
+type StoredSigningKey struct {
+	Kid         string
+	Algorithm   string
+	PrivateKey  string
+	ActivatesAt time.Time
+	RetiresAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// signingKey is a decrypted key held in memory
+type signingKey struct {
+	kid         string
+	method      jwt.SigningMethod
+	private     crypto.Signer
+	activatesAt time.Time
+	retiresAt   time.Time
+	expiresAt   time.Time
+}
+
+// KeyManager signs and verifies platform tokens with asymmetric keys identified by kid.
+// Keys live in the database so every instance signs with the same key; a new key is
+// created ahead of time and published before it is used, and retired keys remain valid
+// for verification until the tokens they signed have expired.
+type KeyManager struct {
+	store            *Store
+	algorithm        string
+	issuer           string
+	rotationInterval time.Duration
+	encryptionKey    []byte
+
+	mu   sync.RWMutex
+	keys []signingKey
+}
+
+// NewKeyManager configures token signing from environment variables. It refuses to run
+// with a missing or development JWT_SECRET unless APP_ENV marks a development environment.
+func NewKeyManager(store *Store) (*KeyManager, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" || secret == devJWTSecret {
+		if !isDevMode() {
+			return nil, fmt.Errorf("JWT_SECRET must be set to a strong value (set APP_ENV=development to use the development fallback)")
+		}
+		log.Println("WARNING: using development JWT secret - do not use in production")
+		secret = devJWTSecret
+	}
+
+	algorithm := os.Getenv("JWT_SIGNING_ALG")
+	if algorithm == "" {
+		algorithm = "RS256"
+	}
+	if algorithm != "RS256" && algorithm != "EdDSA" {
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q (use RS256 or EdDSA)", algorithm)
+	}
+
+	rotationInterval := 30 * 24 * time.Hour
+	if v := os.Getenv("JWT_KEY_ROTATION_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 2*jwtKeyPrepublish {
+			return nil, fmt.Errorf("invalid JWT_KEY_ROTATION_INTERVAL %q", v)
+		}
+		rotationInterval = d
+	}
+
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "grc-platform"
+	}
+
+	// The secret no longer signs tokens; it encrypts the private keys stored in the database
+	encryptionKey := sha256.Sum256([]byte(secret))
+
+	return &KeyManager{
+		store:            store,
+		algorithm:        algorithm,
+		issuer:           issuer,
+		rotationInterval: rotationInterval,
+		encryptionKey:    encryptionKey[:],
+	}, nil
+}
+
+// Start ensures a signing key exists and keeps keys rotated and reloaded in the background
+func (km *KeyManager) Start(ctx context.Context) error {
+	if err := km.Maintain(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(jwtKeyReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := km.Maintain(ctx); err != nil {
+					log.Printf("Error maintaining JWT signing keys: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Maintain rotates keys when due and reloads the current key set
+func (km *KeyManager) Maintain(ctx context.Context) error {
+	err := km.store.MaintainJWTSigningKeys(ctx, func(existing []StoredSigningKey) ([]StoredSigningKey, error) {
+		now := time.Now()
+
+		var latest *StoredSigningKey
+		for i := range existing {
+			if latest == nil || existing[i].ActivatesAt.After(latest.ActivatesAt) {
+				latest = &existing[i]
+			}
+		}
+
+		var activatesAt time.Time
+		switch {
+		case latest == nil || !latest.RetiresAt.After(now):
+			// Nothing can sign right now: bootstrap a key that is usable immediately
+			activatesAt = now
+		case latest.RetiresAt.Sub(now) <= jwtKeyPrepublish:
+			// Publish the successor before the current key stops signing
+			activatesAt = latest.RetiresAt
+		default:
+			return nil, nil
+		}
+
+		key, err := km.generateKey(activatesAt)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Generated JWT signing key %s (%s), active from %s", key.Kid, key.Algorithm, key.ActivatesAt.Format(time.RFC3339))
+		return []StoredSigningKey{*key}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return km.reload(ctx)
+}
+
+// generateKey creates and encrypts a new key pair
+func (km *KeyManager) generateKey(activatesAt time.Time) (*StoredSigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch km.algorithm {
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := km.encrypt(der)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := randomURLToken(12)
+	if err != nil {
+		return nil, err
+	}
+
+	retiresAt := activatesAt.Add(km.rotationInterval)
+	return &StoredSigningKey{
+		Kid:         kid,
+		Algorithm:   km.algorithm,
+		PrivateKey:  encrypted,
+		ActivatesAt: activatesAt,
+		RetiresAt:   retiresAt,
+		// Keep verifying until every token signed by this key has expired
+		ExpiresAt: retiresAt.Add(accessTokenTTL() + jwtKeyPrepublish),
+	}, nil
+}
+
+// reload replaces the in-memory key set with the unexpired keys from the database
+func (km *KeyManager) reload(ctx context.Context) error {
+	stored, err := km.store.ListJWTSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]signingKey, 0, len(stored))
+	for _, sk := range stored {
+		der, err := km.decrypt(sk.PrivateKey)
+		if err != nil {
+			log.Printf("Skipping JWT signing key %s: %v", sk.Kid, err)
+			continue
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			log.Printf("Skipping JWT signing key %s: %v", sk.Kid, err)
+			continue
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			continue
+		}
+
+		method := jwt.GetSigningMethod(sk.Algorithm)
+		if method == nil {
+			continue
+		}
+		keys = append(keys, signingKey{
+			kid:         sk.Kid,
+			method:      method,
+			private:     signer,
+			activatesAt: sk.ActivatesAt,
+			retiresAt:   sk.RetiresAt,
+			expiresAt:   sk.ExpiresAt,
+		})
+	}
+
+	km.mu.Lock()
+	km.keys = keys
+	km.mu.Unlock()
+	return nil
+}
+
+// GenerateJWT creates a short-lived access token bound to a session and organization
+func (km *KeyManager) GenerateJWT(userID, email, role, orgID, sessionID string) (string, error) {
+	now := time.Now()
+
+	km.mu.RLock()
+	var current *signingKey
+	for i := range km.keys {
+		k := &km.keys[i]
+		if !k.activatesAt.After(now) && k.retiresAt.After(now) {
+			if current == nil || k.activatesAt.After(current.activatesAt) {
+				current = k
+			}
+		}
+	}
+	km.mu.RUnlock()
+	if current == nil {
+		return "", fmt.Errorf("no active JWT signing key")
+	}
+
+	claims := &Claims{
+		UserID:         userID,
+		Email:          email,
+		Role:           role,
+		OrganizationID: orgID,
+		SessionID:      sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    km.issuer,
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(current.method, claims)
+	token.Header["kid"] = current.kid
+	return token.SignedString(current.private)
+}
+
+// ParseToken verifies a platform token against the published keys
+func (km *KeyManager) ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		km.mu.RLock()
+		defer km.mu.RUnlock()
+		for _, k := range km.keys {
+			if k.kid == kid {
+				// The algorithm is pinned to the key, never taken from the token
+				if token.Method.Alg() != k.method.Alg() {
+					return nil, jwt.ErrTokenSignatureInvalid
+				}
+				return k.private.Public(), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}, jwt.WithValidMethods([]string{"RS256", "EdDSA"}), jwt.WithIssuer(km.issuer))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys other services use to verify platform tokens
+func (km *KeyManager) JWKS() map[string][]jsonWebKey {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	keys := []jsonWebKey{}
+	for _, k := range km.keys {
+		jwk := jsonWebKey{Kid: k.kid, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string][]jsonWebKey{"keys": keys}
+}
+
+// encrypt seals data with AES-256-GCM and returns nonce||ciphertext as base64
+func (km *KeyManager) encrypt(plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(km.encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// decrypt reverses encrypt
+func (km *KeyManager) decrypt(encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(km.encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt key (was JWT_SECRET changed?): %w", err)
+	}
+	return plaintext, nil
+}
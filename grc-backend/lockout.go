@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Login throttling
+//
+// Failed password logins are counted per account and per client address. Each
+// further failure on an account doubles the wait before the next attempt is
+// accepted, and reaching the limit locks the account (or blocks the address)
+// for a while. Accounts are unlocked by waiting, by an administrator, or by
+// resetting the password.
+
+// LoginThrottleConfig holds the brute-force protection limits
+type LoginThrottleConfig struct {
+	MaxAccountFailures int           // failures before an account is locked
+	MaxIPFailures      int           // failures from one address before it is blocked
+	FailureWindow      time.Duration // failures older than this are forgotten
+	LockoutDuration    time.Duration // how long a lock or block lasts
+	BaseDelay          time.Duration // wait after the second failure; doubles each time
+	MaxDelay           time.Duration
+}
+
+// LoadLoginThrottleConfig reads LOGIN_* variables, falling back to conservative defaults
+func LoadLoginThrottleConfig() LoginThrottleConfig {
+	return LoginThrottleConfig{
+		MaxAccountFailures: envInt("LOGIN_MAX_FAILED_ATTEMPTS", 5),
+		MaxIPFailures:      envInt("LOGIN_IP_MAX_FAILED_ATTEMPTS", 20),
+		FailureWindow:      envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LockoutDuration:    envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		BaseDelay:          envDuration("LOGIN_DELAY_BASE", time.Second),
+		MaxDelay:           envDuration("LOGIN_DELAY_MAX", 30*time.Second),
+	}
+}
+
+// envInt reads a positive integer variable
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// envDuration reads a positive Go duration variable such as "15m"
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// delayAfter is how long an account must wait after its nth consecutive failure
+func (c LoginThrottleConfig) delayAfter(failures int) time.Duration {
+	if failures < 2 || c.BaseDelay <= 0 {
+		return 0
+	}
+	delay := time.Duration(float64(c.BaseDelay) * math.Pow(2, float64(failures-2)))
+	if delay > c.MaxDelay || delay <= 0 {
+		return c.MaxDelay
+	}
+	return delay
+}
+
+// AccountLoginState is the failure history of the account behind a login email
+type AccountLoginState struct {
+	UserID         string
+	OrganizationID string
+	Failures       int
+	LastFailedAt   *time.Time
+	LockedUntil    *time.Time
+}
+
+// LoginFailureResult reports the counters after recording a failed login
+type LoginFailureResult struct {
+	UserID         *string // nil when no account has the email
+	OrganizationID *string
+	Failures       int
+	AccountLocked  *time.Time // set when this failure locked the account
+	IPFailures     int
+	IPBlocked      *time.Time // set when this failure blocked the address
+}
+
+// BlockedIP is a client address currently refused password logins
+type BlockedIP struct {
+	IPAddress    string    `json:"ip_address"`
+	FailureCount int       `json:"failure_count"`
+	LastFailedAt time.Time `json:"last_failed_at"`
+	BlockedUntil time.Time `json:"blocked_until"`
+}
+
+// dummyPasswordHash is compared against when no account matches a login email
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("no-such-account"), bcrypt.DefaultCost)
+
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []*net.IPNet
+)
+
+// loadTrustedProxies parses TRUSTED_PROXIES, a comma-separated list of addresses or CIDR ranges
+func loadTrustedProxies() []*net.IPNet {
+	trustedProxiesOnce.Do(func() {
+		for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if !strings.Contains(entry, "/") {
+				if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+					entry += "/32"
+				} else {
+					entry += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q", entry)
+				continue
+			}
+			trustedProxies = append(trustedProxies, network)
+		}
+	})
+	return trustedProxies
+}
+
+// isTrustedProxy reports whether addr is one of the configured reverse proxies
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range loadTrustedProxies() {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client behind r. X-Forwarded-For is only
+// believed when the connection comes from a trusted proxy; it is read from the
+// right, skipping further trusted proxies, so clients cannot spoof their address.
+func clientIP(r *http.Request) string {
+	peer := extractIPAddress(r.RemoteAddr)
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return peer
+}
+
+// loginRetryAfter returns how long the caller must wait before another password
+// attempt for this email from this address, or zero if it may proceed now
+func (s *ApiServer) loginRetryAfter(ctx context.Context, email, ipAddr string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+
+	blockedUntil, err := s.store.GetIPLoginBlock(ctx, ipAddr)
+	if err != nil {
+		return 0, err
+	}
+	if blockedUntil != nil && blockedUntil.After(now) {
+		wait = blockedUntil.Sub(now)
+	}
+
+	state, err := s.store.GetAccountLoginState(ctx, email)
+	if err != nil || state == nil {
+		return wait, err
+	}
+	if state.LockedUntil != nil && state.LockedUntil.After(now) && state.LockedUntil.Sub(now) > wait {
+		wait = state.LockedUntil.Sub(now)
+	}
+	if state.LastFailedAt != nil && now.Sub(*state.LastFailedAt) < s.throttle.FailureWindow {
+		next := state.LastFailedAt.Add(s.throttle.delayAfter(state.Failures))
+		if next.After(now) && next.Sub(now) > wait {
+			wait = next.Sub(now)
+		}
+	}
+	return wait, nil
+}
+
+// rejectThrottledLogin answers a login attempt made while throttled
+func rejectThrottledLogin(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed sign-in attempts. Try again later.", http.StatusTooManyRequests)
+}
+
+// recordLoginFailure counts a failed password login, audits it and raises the
+// lockout and block alarms when a limit is reached. The counters and their audit
+// entries commit together; when that fails the attempt is still audited.
+func (s *ApiServer) recordLoginFailure(ctx context.Context, email, ipAddr, reason string) {
+	err := s.store.InTx(ctx, func(ctx context.Context) error {
+		result, err := s.store.RecordLoginFailure(ctx, email, ipAddr, s.throttle)
+		if err != nil {
+			return err
+		}
+		return s.auditLoginFailure(ctx, email, ipAddr, reason, result)
+	})
+	if err != nil {
+		log.Printf("Error recording failed login: %v", err)
+		if err := s.auditLoginFailure(ctx, email, ipAddr, reason, &LoginFailureResult{}); err != nil {
+			log.Printf("Error auditing failed login: %v", err)
+		}
+	}
+}
+
+// auditLoginFailure writes the audit entries for a counted login failure
+func (s *ApiServer) auditLoginFailure(ctx context.Context, email, ipAddr, reason string, result *LoginFailureResult) error {
+	// Rows about a known account belong to its organization
+	auditCtx := ctx
+	entityType := "user"
+	if result.OrganizationID != nil {
+		auditCtx = WithOrganization(ctx, *result.OrganizationID)
+	}
+
+	changes := map[string]interface{}{
+		"email":       email,
+		"reason":      reason,
+		"failures":    result.Failures,
+		"ip_failures": result.IPFailures,
+	}
+	var err error
+	if result.UserID != nil {
+		err = s.store.LogAudit(auditCtx, nil, "LOGIN_FAILED", &entityType, result.UserID, changes, &ipAddr)
+	} else {
+		err = s.store.LogAudit(auditCtx, nil, "LOGIN_FAILED", nil, nil, changes, &ipAddr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if result.IPBlocked != nil {
+		ipEntity := "ip_address"
+		if err := s.store.LogAudit(ctx, nil, "LOGIN_IP_BLOCKED", &ipEntity, &ipAddr, map[string]interface{}{
+			"failures":      result.IPFailures,
+			"blocked_until": result.IPBlocked,
+		}, &ipAddr); err != nil {
+			return err
+		}
+	}
+	// The user and the user administrators are told when the event is dispatched
+	if result.AccountLocked != nil && result.UserID != nil {
+		return s.store.LogAudit(auditCtx, nil, "ACCOUNT_LOCKED", &entityType, result.UserID, map[string]interface{}{
+			"email":        email,
+			"failures":     result.Failures,
+			"locked_until": result.AccountLocked,
+		}, &ipAddr)
+	}
+	return nil
+}
@@ -16,7 +16,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Organization-ID, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Next-Cursor")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -28,45 +29,56 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func main() {
-	// Load environment variables
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL environment variable is required")
+// connectDatabase opens and verifies the connection pool
+func connectDatabase(ctx context.Context, dbURL string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is required")
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to ping database: %w", err)
 	}
+	return pool, nil
+}
 
-	// Connect to database
-	pool, err := pgxpool.New(context.Background(), dbURL)
-	if err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
+func main() {
+	if err := runCLI(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
-	defer pool.Close()
+}
+
+// runServe implements `grc-backend serve`, the default command: it brings the
+// schema up to date, seeds reference data and serves the API until it fails
+func runServe(ctx context.Context, env *cliEnv, args []string) error {
+	pool, store := env.pool, env.store
 
-	// Test database connection
-	if err := pool.Ping(context.Background()); err != nil {
-		log.Fatalf("Unable to ping database: %v", err)
+	// Check the token signing configuration before touching the schema (refuses a
+	// missing or development JWT_SECRET outside APP_ENV=development)
+	keyManager, err := NewKeyManager(store)
+	if err != nil {
+		return fmt.Errorf("invalid token signing configuration: %w", err)
 	}
 
 	fmt.Println("Connected to database successfully")
 
-	// Seed the database with CIS controls
-	if err := SeedControlLibrary(context.Background(), pool); err != nil {
-		log.Fatalf("Failed to seed control library: %v", err)
+	// Bring the schema up to date (replicas wait on an advisory lock); set
+	// AUTO_MIGRATE=false to run `migrate up` as a separate deployment step
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		migrator, err := NewMigrator(pool)
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
 	}
 
-	// Seed control templates
-	if err := SeedControlTemplates(context.Background(), pool); err != nil {
-		log.Printf("Warning: Failed to seed control templates: %v", err)
+	// Seed the control library, test users and control templates
+	if err := seedDatabase(ctx, pool); err != nil {
+		log.Fatalf("Failed to seed control library: %v", err)
 	}
 
-	// Initialize store
-	store := NewStore(pool)
-
 	// Initialize file storage
 	uploadDir := os.Getenv("UPLOAD_DIR")
 	if uploadDir == "" {
@@ -82,56 +94,184 @@ func main() {
 	emailService := NewEmailService()
 	fmt.Println(emailService.GetConfigSummary())
 
+	// Initialize OIDC single sign-on (optional)
+	oidcProvider := NewOIDCProvider()
+
+	// Initialize token signing keys
+	if err := keyManager.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to initialize JWT signing keys: %v", err)
+	}
+
+	// Audit checkpoints are signed with a key encrypted by the key manager
+	auditSigner := NewAuditSigner(store, keyManager)
+
 	// Initialize cron service with email
-	cronService := NewCronService(store, emailService)
+	cronService := NewCronService(store, emailService, auditSigner)
 	cronService.Start()
 
+	// Feed committed domain events to the audit log, webhooks, notifications and emails
+	eventDispatcher := NewEventDispatcher(store)
+	RegisterEventHandlers(eventDispatcher, store, emailService)
+	eventDispatcher.Start(context.Background())
+
+	// Deliver queued webhook events (secrets are decrypted with the key manager)
+	NewWebhookDispatcher(store, keyManager).Start(context.Background())
+
+	// Ship the sealed audit log to the SIEM and/or a JSON lines file (AUDIT_FORWARD_*)
+	auditForwarder, err := NewAuditForwarder(store)
+	if err != nil {
+		log.Fatalf("Invalid audit forwarding configuration: %v", err)
+	}
+	auditForwarder.Start(context.Background())
+
+	// Carry over the single EXTERNAL_API_KEY from older deployments as a managed key
+	if err := EnsureLegacyAPIKey(context.Background(), store); err != nil {
+		log.Fatalf("Failed to register legacy API key: %v", err)
+	}
+
 	// Initialize API server
-	apiServer := NewApiServer(store, fileStorage)
+	apiServer := NewApiServer(store, fileStorage, oidcProvider, emailService, keyManager, cronService, auditSigner, auditForwarder)
 
 	// Setup routes
 	r := mux.NewRouter()
 
-	// Add CORS middleware
+	// Resolve the client address and request ID, then add CORS headers
+	r.Use(RequestContextMiddleware)
 	r.Use(corsMiddleware)
 
+	// Public keys for verifying platform tokens
+	r.HandleFunc("/.well-known/jwks.json", apiServer.HandleJWKS).Methods("GET", "OPTIONS")
+
 	// API routes
 	api := r.PathPrefix("/api/v1").Subrouter()
 
 	// Public routes (no auth required)
 	api.HandleFunc("/auth/login", apiServer.HandleLogin).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/register", apiServer.HandleRegister).Methods("POST", "OPTIONS")
-	api.HandleFunc("/tickets/external", apiServer.HandleCreateExternalTicket).Methods("POST", "OPTIONS")
-	api.HandleFunc("/tickets/external/{customerRef}", apiServer.HandleGetTicketsByCustomerRef).Methods("GET", "OPTIONS")
+	if os.Getenv("ALLOW_PUBLIC_REGISTRATION") == "true" {
+		// Self-service sign-up is off by default; admins invite users instead
+		api.HandleFunc("/auth/register", apiServer.HandleRegister).Methods("POST", "OPTIONS")
+	}
+	api.HandleFunc("/auth/refresh", apiServer.HandleRefreshToken).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/forgot-password", apiServer.HandleForgotPassword).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/reset-password", apiServer.HandleResetPassword).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/oidc/login", apiServer.HandleOIDCLogin).Methods("GET", "OPTIONS")
+	api.HandleFunc("/auth/oidc/callback", apiServer.HandleOIDCCallback).Methods("GET", "OPTIONS")
+	api.HandleFunc("/auth/mfa/verify", apiServer.HandleVerifyMFA).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/mfa/enroll", apiServer.HandleEnrollMFAChallenge).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/mfa/enroll/confirm", apiServer.HandleConfirmMFAChallenge).Methods("POST", "OPTIONS")
+
+	// Integration routes authenticated by scoped API keys (X-API-Key)
+	api.Handle("/tickets/external", RequireAPIKey(store, ScopeTicketsCreate)(http.HandlerFunc(apiServer.HandleCreateExternalTicket))).Methods("POST", "OPTIONS")
+	api.Handle("/tickets/external/{customerRef}", RequireAPIKey(store, ScopeTicketsReadCustomer)(http.HandlerFunc(apiServer.HandleGetTicketsByCustomerRef))).Methods("GET", "OPTIONS")
+
 	api.HandleFunc("/gdpr/dsr/public", apiServer.HandleCreateDSR).Methods("POST", "OPTIONS") // Public DSR submission
 
-	// Protected routes (auth required) - create a subrouter with auth middleware
+	// SCIM 2.0 provisioning, authenticated by API keys with the scim:provision scope
+	scim := r.PathPrefix("/scim/v2").Subrouter()
+	scim.Use(RequireAPIKey(store, ScopeSCIMProvision))
+	scim.HandleFunc("/ServiceProviderConfig", apiServer.HandleSCIMServiceProviderConfig).Methods("GET")
+	scim.HandleFunc("/ResourceTypes", apiServer.HandleSCIMResourceTypes).Methods("GET")
+	scim.HandleFunc("/Users", apiServer.HandleSCIMListUsers).Methods("GET")
+	scim.HandleFunc("/Users", apiServer.HandleSCIMCreateUser).Methods("POST")
+	scim.HandleFunc("/Users/{id}", apiServer.HandleSCIMGetUser).Methods("GET")
+	scim.HandleFunc("/Users/{id}", apiServer.HandleSCIMReplaceUser).Methods("PUT")
+	scim.HandleFunc("/Users/{id}", apiServer.HandleSCIMPatchUser).Methods("PATCH")
+	scim.HandleFunc("/Users/{id}", apiServer.HandleSCIMDeleteUser).Methods("DELETE")
+	scim.HandleFunc("/Groups", apiServer.HandleSCIMListGroups).Methods("GET")
+	scim.HandleFunc("/Groups", apiServer.HandleSCIMCreateGroup).Methods("POST")
+	scim.HandleFunc("/Groups/{id}", apiServer.HandleSCIMGetGroup).Methods("GET")
+	scim.HandleFunc("/Groups/{id}", apiServer.HandleSCIMReplaceGroup).Methods("PUT")
+	scim.HandleFunc("/Groups/{id}", apiServer.HandleSCIMPatchGroup).Methods("PATCH")
+	scim.HandleFunc("/Groups/{id}", apiServer.HandleSCIMDeleteGroup).Methods("DELETE")
+
+	// Protected routes (auth required) - create a subrouter with auth middleware.
+	// Authorize then checks each route against the permission table in permissions.go.
 	protected := api.PathPrefix("").Subrouter()
-	protected.Use(AuthMiddleware)
-
-	// Admin-only routes
-	admin := protected.PathPrefix("").Subrouter()
-	admin.Use(AdminOnly)
-	admin.HandleFunc("/audit/logs", apiServer.HandleGetAuditLogs).Methods("GET", "OPTIONS")
-	admin.HandleFunc("/controls/activated", apiServer.HandleActivatedControls).Methods("POST", "OPTIONS") // Only POST is admin
-	admin.HandleFunc("/controls/activated/{id}", apiServer.HandleSpecificActivatedControl).Methods("PUT", "DELETE")
-	admin.HandleFunc("/tickets/{id}", apiServer.HandleUpdateTicket).Methods("PUT", "OPTIONS")
-
-	// User routes (authenticated users)
+	protected.Use(AuthMiddleware(store, keyManager))
+	protected.Use(Authorize)
+
+	// Administration routes
+	protected.HandleFunc("/audit/logs", apiServer.HandleGetAuditLogs).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/audit/logs/export", apiServer.HandleExportAuditLogs).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/audit/entities/{entityType}/{entityID}", apiServer.HandleGetAuditEntityHistory).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/audit/verify", apiServer.HandleVerifyAuditLog).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/audit/checkpoints", apiServer.HandleListAuditCheckpoints).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/audit/signing-keys", apiServer.HandleListAuditSigningKeys).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/controls/activated", apiServer.HandleActivatedControls).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/controls/activated/{id}", apiServer.HandleSpecificActivatedControl).Methods("PUT", "DELETE")
+	protected.HandleFunc("/tickets/{id}", apiServer.HandleUpdateTicket).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/security/mfa-policy", apiServer.HandleGetMFAPolicy).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/organization", apiServer.HandleGetCurrentOrganization).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/platform/organizations", apiServer.HandleListOrganizations).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/platform/organizations", apiServer.HandleCreateOrganization).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/platform/organizations/{id}", apiServer.HandleGetOrganization).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/platform/organizations/{id}", apiServer.HandleUpdateOrganization).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/platform/organizations/{id}/users", apiServer.HandleListOrganizationUsers).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/platform/users/{id}/organization", apiServer.HandleMoveUserOrganization).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/platform/blocked-ips", apiServer.HandleListBlockedIPs).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/platform/blocked-ips/{ip}", apiServer.HandleUnblockIP).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/platform/audit-forwarding", apiServer.HandleAuditForwardingStatus).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/platform/jobs", apiServer.HandleListJobs).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/platform/jobs/{name}/runs", apiServer.HandleListJobRuns).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/platform/jobs/{name}/run", apiServer.HandleTriggerJob).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/api-keys", apiServer.HandleListAPIKeys).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/api-keys", apiServer.HandleCreateAPIKey).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/api-keys/{id}", apiServer.HandleGetAPIKey).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/api-keys/{id}", apiServer.HandleUpdateAPIKey).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/api-keys/{id}", apiServer.HandleRevokeAPIKey).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/webhooks", apiServer.HandleListWebhooks).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/webhooks", apiServer.HandleCreateWebhook).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}", apiServer.HandleGetWebhook).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}", apiServer.HandleUpdateWebhook).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}", apiServer.HandleDeleteWebhook).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}/rotate-secret", apiServer.HandleRotateWebhookSecret).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}/test", apiServer.HandleTestWebhook).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}/deliveries", apiServer.HandleListWebhookDeliveries).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/webhooks/deliveries/{id}/replay", apiServer.HandleReplayWebhookDelivery).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/security/mfa-policy", apiServer.HandleUpdateMFAPolicy).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/settings/reminder-policy", apiServer.HandleGetReminderPolicy).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/settings/reminder-policy", apiServer.HandleUpdateReminderPolicy).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/users/{id}/mfa", apiServer.HandleResetUserMFA).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/users/invite", apiServer.HandleInviteUser).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/users/{id}/sessions", apiServer.HandleRevokeUserSessions).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/users/{id}/unlock", apiServer.HandleUnlockUser).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/users/{id}/reassign-controls", apiServer.HandleReassignUserControls).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/scim/groups", apiServer.HandleListSCIMGroupMappings).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/scim/groups/{id}/role", apiServer.HandleSetSCIMGroupRole).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/users", apiServer.HandleListUsers).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/users/{id}/role", apiServer.HandleUpdateUserRole).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/roles", apiServer.HandleGetRoles).Methods("GET", "OPTIONS")
+
+	// User routes
 	protected.HandleFunc("/dashboard/summary", apiServer.HandleDashboardSummary).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/notifications", apiServer.HandleGetNotifications).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/notifications/{id}/read", apiServer.HandleMarkNotificationAsRead).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/users/profile", apiServer.HandleUpdateUserProfile).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/users/permissions", apiServer.HandleGetMyPermissions).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/auth/logout", apiServer.HandleLogout).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/auth/logout-all", apiServer.HandleLogoutAll).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/users/sessions", apiServer.HandleListSessions).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/users/sessions/{id}", apiServer.HandleRevokeSession).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/users/mfa", apiServer.HandleGetMFAStatus).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/users/mfa/enroll", apiServer.HandleEnrollMFA).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/users/mfa/confirm", apiServer.HandleConfirmMFA).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/users/mfa/recovery-codes", apiServer.HandleRegenerateRecoveryCodes).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/users/mfa/disable", apiServer.HandleDisableMFA).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/controls/library", apiServer.HandleGetControlLibrary).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/controls/library/export", apiServer.HandleExportControls).Methods("GET", "OPTIONS") // Export controls
 	protected.HandleFunc("/controls/activated", apiServer.HandleActivatedControls).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/controls/activated/{id}", apiServer.HandleSpecificActivatedControl).Methods("GET", "OPTIONS") // GET is for all users
-
-	// Admin-only Control Library Management routes
-	admin.HandleFunc("/controls/library", apiServer.HandleCreateControlLibraryItem).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/controls/library/import", apiServer.HandleImportControls).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/controls/library/{id}", apiServer.HandleUpdateControlLibraryItem).Methods("PUT", "OPTIONS")
-	admin.HandleFunc("/controls/library/{id}", apiServer.HandleDeleteControlLibraryItem).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/controls/activated/{id}", apiServer.HandleSpecificActivatedControl).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/controls/activated/{id}/evidence", apiServer.HandleSpecificActivatedControl).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/controls/activated/{id}/reminders", apiServer.HandleGetControlReminders).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/controls/activated/{id}/delegates", apiServer.HandleGetControlDelegates).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/controls/activated/{id}/delegates", apiServer.HandleAddControlDelegate).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/controls/activated/{id}/delegates/{user_id}", apiServer.HandleRemoveControlDelegate).Methods("DELETE", "OPTIONS")
+
+	// Control Library Management routes
+	protected.HandleFunc("/controls/library", apiServer.HandleCreateControlLibraryItem).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/controls/library/import", apiServer.HandleImportControls).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/controls/library/{id}", apiServer.HandleUpdateControlLibraryItem).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/controls/library/{id}", apiServer.HandleDeleteControlLibraryItem).Methods("DELETE", "OPTIONS")
 	protected.HandleFunc("/tickets/internal", apiServer.HandleCreateInternalTicket).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/tickets", apiServer.HandleGetTickets).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/tickets/{id}", apiServer.HandleGetTicket).Methods("GET", "OPTIONS")
@@ -150,44 +290,44 @@ func main() {
 	protected.HandleFunc("/documents/{id}", apiServer.HandleGetDocument).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/versions/{id}/acknowledge", apiServer.HandleAcknowledgeDocument).Methods("POST", "OPTIONS")
 
-	// Admin-only document routes
-	admin.HandleFunc("/documents", apiServer.HandleCreateDocument).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/documents/{id}/versions", apiServer.HandleCreateDocumentVersion).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/documents/{doc_id}/versions/{version_id}/publish", apiServer.HandlePublishDocumentVersion).Methods("PUT", "OPTIONS")
-	admin.HandleFunc("/mappings/document-to-control", apiServer.HandleCreateDocumentControlMapping).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/mappings/document-to-control", apiServer.HandleDeleteDocumentControlMapping).Methods("DELETE", "OPTIONS")
+	// Document management routes
+	protected.HandleFunc("/documents", apiServer.HandleCreateDocument).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/documents/{id}/versions", apiServer.HandleCreateDocumentVersion).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/documents/{doc_id}/versions/{version_id}/publish", apiServer.HandlePublishDocumentVersion).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/mappings/document-to-control", apiServer.HandleCreateDocumentControlMapping).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/mappings/document-to-control", apiServer.HandleDeleteDocumentControlMapping).Methods("DELETE", "OPTIONS")
 
 	// GDPR ROPA routes
 	protected.HandleFunc("/gdpr/ropa", apiServer.HandleGetROPAs).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/gdpr/ropa/{id}", apiServer.HandleGetROPA).Methods("GET", "OPTIONS")
 
-	// Admin-only GDPR ROPA routes
-	admin.HandleFunc("/gdpr/ropa", apiServer.HandleCreateROPA).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/gdpr/ropa/{id}", apiServer.HandleUpdateROPA).Methods("PUT", "OPTIONS")
-	admin.HandleFunc("/gdpr/ropa/{id}", apiServer.HandleArchiveROPA).Methods("DELETE", "OPTIONS")
+	// GDPR ROPA management routes
+	protected.HandleFunc("/gdpr/ropa", apiServer.HandleCreateROPA).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/gdpr/ropa/{id}", apiServer.HandleUpdateROPA).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/gdpr/ropa/{id}", apiServer.HandleArchiveROPA).Methods("DELETE", "OPTIONS")
 
 	// Risk Assessment routes
 	protected.HandleFunc("/risks", apiServer.HandleGetRisks).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/risks/{id}", apiServer.HandleGetRisk).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/risks/{id}/controls", apiServer.HandleGetRiskControls).Methods("GET", "OPTIONS")
 
-	// Admin-only Risk Assessment routes
-	admin.HandleFunc("/risks", apiServer.HandleCreateRisk).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/risks/{id}", apiServer.HandleUpdateRisk).Methods("PUT", "OPTIONS")
-	admin.HandleFunc("/risks/{id}", apiServer.HandleDeleteRisk).Methods("DELETE", "OPTIONS")
-	admin.HandleFunc("/mappings/risk-to-control", apiServer.HandleCreateRiskControlMapping).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/mappings/risk-to-control", apiServer.HandleDeleteRiskControlMapping).Methods("DELETE", "OPTIONS")
+	// Risk Assessment management routes
+	protected.HandleFunc("/risks", apiServer.HandleCreateRisk).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/risks/{id}", apiServer.HandleUpdateRisk).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/risks/{id}", apiServer.HandleDeleteRisk).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/mappings/risk-to-control", apiServer.HandleCreateRiskControlMapping).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/mappings/risk-to-control", apiServer.HandleDeleteRiskControlMapping).Methods("DELETE", "OPTIONS")
 
 	// GDPR DSR routes
 	protected.HandleFunc("/gdpr/dsr", apiServer.HandleGetDSRs).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/gdpr/dsr/{id}", apiServer.HandleGetDSR).Methods("GET", "OPTIONS")
 
-	// Admin-only GDPR DSR routes
-	admin.HandleFunc("/gdpr/dsr", apiServer.HandleCreateDSR).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/gdpr/dsr/{id}", apiServer.HandleUpdateDSR).Methods("PUT", "OPTIONS")
-	admin.HandleFunc("/gdpr/dsr/{id}/complete", apiServer.HandleCompleteDSR).Methods("PUT", "OPTIONS")
+	// GDPR DSR management routes
+	protected.HandleFunc("/gdpr/dsr", apiServer.HandleCreateDSR).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/gdpr/dsr/{id}", apiServer.HandleUpdateDSR).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/gdpr/dsr/{id}/complete", apiServer.HandleCompleteDSR).Methods("PUT", "OPTIONS")
 
-	// Analytics & Reporting routes (all authenticated users)
+	// Analytics & Reporting routes
 	protected.HandleFunc("/analytics/control-compliance-trends", apiServer.HandleGetControlComplianceTrends).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/analytics/risk-distribution", apiServer.HandleGetRiskDistribution).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/analytics/risk-trends", apiServer.HandleGetRiskTrends).Methods("GET", "OPTIONS")
@@ -201,35 +341,46 @@ func main() {
 	protected.HandleFunc("/vendors/{id}/assessments", apiServer.HandleGetVendorAssessments).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/vendors/{id}/controls", apiServer.HandleGetVendorControls).Methods("GET", "OPTIONS")
 
-	// Admin-only Vendor routes
-	admin.HandleFunc("/vendors", apiServer.HandleCreateVendor).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/vendors/{id}", apiServer.HandleUpdateVendor).Methods("PUT", "OPTIONS")
-	admin.HandleFunc("/vendors/{id}", apiServer.HandleDeleteVendor).Methods("DELETE", "OPTIONS")
-	admin.HandleFunc("/vendors/{id}/assessments", apiServer.HandleCreateVendorAssessment).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/mappings/vendor-to-control", apiServer.HandleCreateVendorControlMapping).Methods("POST", "OPTIONS")
-	admin.HandleFunc("/mappings/vendor-to-control", apiServer.HandleDeleteVendorControlMapping).Methods("DELETE", "OPTIONS")
+	// Vendor management routes
+	protected.HandleFunc("/vendors", apiServer.HandleCreateVendor).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/vendors/{id}", apiServer.HandleUpdateVendor).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/vendors/{id}", apiServer.HandleDeleteVendor).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/vendors/{id}/assessments", apiServer.HandleCreateVendorAssessment).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/mappings/vendor-to-control", apiServer.HandleCreateVendorControlMapping).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/mappings/vendor-to-control", apiServer.HandleDeleteVendorControlMapping).Methods("DELETE", "OPTIONS")
 
-	// Standards Management routes (all authenticated users can view)
+	// Standards routes
 	protected.HandleFunc("/standards", apiServer.HandleGetStandards).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/standards/{id}", apiServer.HandleGetStandardByID).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/standards/{id}/controls", apiServer.HandleGetControlsByStandard).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/controls/{id}/article", apiServer.HandleGetArticleByControlID).Methods("GET", "OPTIONS")
 
-	// Admin-only Standards routes
-	admin.HandleFunc("/standards/import", apiServer.HandleImportStandard).Methods("POST", "OPTIONS")
+	// Standards management routes
+	protected.HandleFunc("/standards/import", apiServer.HandleImportStandard).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/standards/import/oscal", apiServer.HandleImportOSCAL).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/standards/{id}/oscal", apiServer.HandleExportOSCAL).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/standards/{id}/migration", apiServer.HandleGetStandardMigration).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/standards/{id}/migration", apiServer.HandleApplyStandardMigration).Methods("POST", "OPTIONS")
+
+	// Cross-standard control mappings and the evidence they share
+	protected.HandleFunc("/controls/mappings", apiServer.HandleListControlMappings).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/controls/mappings", apiServer.HandleCreateControlMapping).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/controls/mappings/import", apiServer.HandleImportControlMappings).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/controls/mappings/{id}", apiServer.HandleDeleteControlMapping).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/controls/coverage", apiServer.HandleGetControlCoverage).Methods("GET", "OPTIONS")
 
 	// Quick Start Template routes
 	protected.HandleFunc("/templates", apiServer.HandleGetControlTemplates).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/templates/{id}", apiServer.HandleGetTemplateControls).Methods("GET", "OPTIONS")
-	admin.HandleFunc("/templates/{id}/activate", apiServer.HandleActivateTemplate).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/templates/{id}/activate", apiServer.HandleActivateTemplate).Methods("POST", "OPTIONS")
 
 	// Evidence File Upload routes
 	protected.HandleFunc("/evidence/{evidence_id}/files", apiServer.HandleGetEvidenceFiles).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/evidence/{evidence_id}/files", apiServer.HandleUploadEvidenceFile).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/evidence/files/{file_id}/download", apiServer.HandleDownloadEvidenceFile).Methods("GET", "OPTIONS")
-	admin.HandleFunc("/evidence/files/{file_id}", apiServer.HandleDeleteEvidenceFile).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/evidence/files/{file_id}", apiServer.HandleDeleteEvidenceFile).Methods("DELETE", "OPTIONS")
 
-	// Compliance Report Generation routes (authenticated users)
+	// Compliance Report Generation routes
 	protected.HandleFunc("/reports/generate/pdf", apiServer.HandleGeneratePDFReport).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/reports/generate/csv", apiServer.HandleGenerateCSVReport).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/reports/generate/json", apiServer.HandleGenerateJSONReport).Methods("POST", "OPTIONS")
@@ -241,5 +392,5 @@ func main() {
 	}
 
 	fmt.Printf("Server starting on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	return http.ListenAndServe(":"+port, r)
 }
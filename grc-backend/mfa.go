@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// totpPeriod is the RFC 6238 time step in seconds
+	totpPeriod = 30
+	// totpDigits is the length of generated codes
+	totpDigits = 6
+	// totpSkew is the number of time steps accepted either side of now
+	totpSkew = 1
+
+	// mfaChallengeTTL is how long a user has to complete the second login step
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaMaxAttempts is the number of codes that may be tried per challenge
+	mfaMaxAttempts = 5
+	// recoveryCodeCount is the number of single-use recovery codes issued
+	recoveryCodeCount = 10
+
+	// SettingMFAPolicy is the system_settings key for the MFA policy
+	SettingMFAPolicy = "mfa_policy"
+)
+
+// MFAPolicy is the platform-wide multi-factor authentication policy
+type MFAPolicy struct {
+	RequireForAdmins bool `json:"require_mfa_for_admins"`
+}
+
+// MFAStatus describes a user's MFA enrolment
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnrolledAt             *time.Time `json:"enrolled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// MFAChallenge is a pending second login step
+type MFAChallenge struct {
+	ID          string
+	UserID      string
+	Purpose     string // 'verify' or 'enroll'
+	FirstFactor string // 'password' or 'oidc'
+}
+
+// MFAChallengeResponse is returned by login when a second factor is needed
+type MFAChallengeResponse struct {
+	MFARequired           bool   `json:"mfa_required"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	MFAToken              string `json:"mfa_token"`
+	ExpiresIn             int    `json:"expires_in"`
+}
+
+// MFAEnrollmentResponse carries the secret for a new authenticator
+type MFAEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// generateTOTPSecret returns a new random 160-bit base32 secret
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// totpProvisioningURI builds the otpauth:// URI that authenticator apps read from a QR code
+func totpProvisioningURI(accountName, secret string) string {
+	issuer := os.Getenv("MFA_ISSUER")
+	if issuer == "" {
+		issuer = "GRC Compliance Platform"
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", totpDigits))
+	params.Set("period", fmt.Sprintf("%d", totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpCode computes the RFC 6238 code for a time step
+func totpCode(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// validateTOTP checks a code against the current window and returns the matching time step.
+// Steps at or before lastUsedStep are rejected to prevent code replay.
+func validateTOTP(secret, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// generateRecoveryCodes returns n human-friendly single-use codes (xxxxx-xxxxx)
+func generateRecoveryCodes(n int) ([]string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz123456789" // 32 symbols, no i/l/o/0
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[b[j]&31]
+		}
+		codes = append(codes, string(b[:5])+"-"+string(b[5:]))
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode lowercases a recovery code and strips separators
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// hashToken returns the hex SHA-256 of a high-entropy secret for storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,139 +4,158 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // Claims represents the JWT claims structure
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID         string `json:"user_id"`
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	OrganizationID string `json:"org"`
+	SessionID      string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware validates JWT tokens and extracts user information
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Missing authorization header", http.StatusUnauthorized)
-			return
-		}
-
-		// Expected format: "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := parts[1]
-
-		// Parse and validate token
-		claims := &Claims{}
-		jwtSecret := os.Getenv("JWT_SECRET")
-		if jwtSecret == "" {
-			jwtSecret = "test-secret" // Fallback for development
-		}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
-
-		// Add user info to request context
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, RoleKey, claims.Role)
-
-		// Call next handler with updated context
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// accessTokenTTL returns the lifetime of access tokens (ACCESS_TOKEN_TTL, default 15m)
+func accessTokenTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 15 * time.Minute
 }
 
-// AdminOnly middleware ensures only admin users can access the endpoint
-func AdminOnly(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		role, ok := r.Context().Value(RoleKey).(string)
-		if !ok || role != "admin" {
-			http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+// refreshTokenTTL returns how long an unused session stays valid (REFRESH_TOKEN_TTL, default 14 days).
+// Each refresh extends the session by this amount.
+func refreshTokenTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 14 * 24 * time.Hour
 }
 
-// OwnerOrAdmin middleware ensures user is either the owner or an admin
-// ownerIDGetter is a function that extracts the owner ID from the request
-func OwnerOrAdmin(ownerIDGetter func(*http.Request) (string, error)) func(http.Handler) http.Handler {
+// AuthMiddleware validates JWT tokens and extracts user information.
+// Every request is checked against the server-side session so that revoked
+// sessions and role changes take effect immediately.
+func AuthMiddleware(store *Store, keys *KeyManager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			role, _ := r.Context().Value(RoleKey).(string)
-			userID, _ := r.Context().Value(UserIDKey).(string)
+			// Get token from Authorization header
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Missing authorization header", http.StatusUnauthorized)
+				return
+			}
 
-			// Admin can access anything
-			if role == "admin" {
-				next.ServeHTTP(w, r)
+			// Expected format: "Bearer <token>"
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
 				return
 			}
 
-			// Check if user is the owner
-			ownerID, err := ownerIDGetter(r)
-			if err != nil {
-				http.Error(w, "Failed to determine ownership", http.StatusInternalServerError)
+			tokenString := parts[1]
+
+			// Parse and validate token against the current signing keys
+			claims, err := keys.ParseToken(tokenString)
+			if err != nil || claims.SessionID == "" {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 				return
 			}
 
-			if userID != ownerID {
-				http.Error(w, "Forbidden: You can only access your own resources", http.StatusForbidden)
+			// Reject tokens whose session was revoked or whose user's role or organization has since changed
+			principal, err := store.GetSessionPrincipal(r.Context(), claims.SessionID, claims.UserID)
+			if err != nil {
+				if err.Error() == "session not found" {
+					http.Error(w, "Session has been revoked", http.StatusUnauthorized)
+					return
+				}
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
+			if principal.Role != claims.Role || principal.OrganizationID != claims.OrganizationID {
+				http.Error(w, "Token is out of date, please refresh", http.StatusUnauthorized)
+				return
+			}
+			if principal.OrganizationStatus != "active" && !principal.IsSuperAdmin {
+				http.Error(w, "Forbidden: organization is suspended", http.StatusForbidden)
+				return
+			}
+
+			// Super-admins may act inside another organization by naming it
+			orgID := claims.OrganizationID
+			if target := r.Header.Get("X-Organization-ID"); target != "" && target != orgID {
+				if !principal.IsSuperAdmin {
+					http.Error(w, "Forbidden: cannot switch organization", http.StatusForbidden)
+					return
+				}
+				if _, err := store.GetOrganization(r.Context(), target); err != nil {
+					http.Error(w, "Organization not found", http.StatusNotFound)
+					return
+				}
+				orgID = target
+			}
 
-			next.ServeHTTP(w, r)
+			// Add user info to request context; store queries made with it are scoped to the organization
+			ctx := r.Context()
+			ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, RoleKey, claims.Role)
+			ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			ctx = context.WithValue(ctx, SuperAdminKey, principal.IsSuperAdmin)
+			ctx = WithOrganization(ctx, orgID)
+
+			// Call next handler with updated context
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// GenerateJWT creates a new JWT token for a user
-func GenerateJWT(userID, email, role string) (string, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "test-secret" // Fallback for development
-	}
+// RequestInfoKey holds the RequestInfo of the request being served
+const RequestInfoKey contextKey = "requestInfo"
 
-	// Create claims
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			// Token expires in 7 days
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * 7 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
+// userAgentMaxLength caps the user agent recorded in audit entries
+const userAgentMaxLength = 512
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
 
-	// Sign token
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		return "", err
-	}
+// RequestInfo describes where a request came from. Audit entries written while
+// serving it record these fields automatically (see Store.LogAudit).
+type RequestInfo struct {
+	RequestID string
+	ClientIP  string
+	UserAgent string
+}
+
+// RequestContextMiddleware resolves the client address (honouring X-Forwarded-For
+// from TRUSTED_PROXIES), assigns a request ID and stores both in the request
+// context. A request ID sent by a trusted proxy, e.g. nginx's $request_id, is
+// kept so log lines can be correlated across the two; otherwise a new one is
+// generated. The ID is echoed in the X-Request-ID response header.
+func RequestContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) || !isTrustedProxy(extractIPAddress(r.RemoteAddr)) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		userAgent := strings.ToValidUTF8(r.UserAgent(), "")
+		if len(userAgent) > userAgentMaxLength {
+			userAgent = strings.ToValidUTF8(userAgent[:userAgentMaxLength], "")
+		}
+
+		info := RequestInfo{RequestID: requestID, ClientIP: clientIP(r), UserAgent: userAgent}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), RequestInfoKey, info)))
+	})
+}
 
-	return tokenString, nil
+// requestInfoFromContext returns the RequestInfo of the request being served, if any
+func requestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(RequestInfoKey).(RequestInfo)
+	return info, ok
 }
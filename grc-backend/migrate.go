@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Database migrations
+//
+// The schema is built from numbered SQL scripts embedded in the binary:
+// migrations/NNNN_description.up.sql applies a change and the matching
+// .down.sql reverts it. Applied versions are recorded in schema_migrations.
+// Every run holds a PostgreSQL advisory lock, so replicas starting together
+// apply each migration exactly once. Migrations are never edited after they
+// ship; changes go in a new, higher-numbered script.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock key held while migrating
+const migrationLockID = "grc_schema_migrations"
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string // empty when the migration cannot be reverted
+	Checksum string // SHA-256 of the up script
+}
+
+// MigrationStatus describes a migration relative to the database
+type MigrationStatus struct {
+	Version          int64
+	Name             string
+	Applied          bool
+	AppliedAt        *time.Time
+	ChecksumMismatch bool // the script changed after it was applied
+}
+
+// loadMigrations reads and orders the embedded migration scripts
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		m := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected file in migrations: %s", entry.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(body)
+			sum := sha256.Sum256(body)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts the embedded migrations
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewMigrator loads the embedded migrations for pool's database
+func NewMigrator(pool *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock.
+// Other replicas block here until the current holder is done.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock(hashtext($1));`, migrationLockID); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtext($1));`, migrationLockID); err != nil {
+			log.Printf("Error releasing migration lock: %v", err)
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		  version BIGINT PRIMARY KEY,
+		  name TEXT NOT NULL,
+		  checksum TEXT NOT NULL,
+		  applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// appliedMigrations returns the recorded versions with their checksums and times
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int64]MigrationStatus, map[int64]string, error) {
+	rows, err := conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version;`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]MigrationStatus{}
+	checksums := map[int64]string{}
+	for rows.Next() {
+		var status MigrationStatus
+		var checksum string
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &status.Name, &checksum, &appliedAt); err != nil {
+			return nil, nil, err
+		}
+		status.Applied = true
+		status.AppliedAt = &appliedAt
+		applied[status.Version] = status
+		checksums[status.Version] = checksum
+	}
+	return applied, checksums, rows.Err()
+}
+
+// baselineMarkers are objects that only exist once the whole of the first
+// migration has been applied: the tables and columns added after schema.sql
+var baselineMarkers = []string{
+	"organizations", "oidc_login_states", "user_mfa", "mfa_recovery_codes", "mfa_challenges",
+	"system_settings", "password_tokens", "user_sessions", "login_ip_failures",
+	"jwt_signing_keys", "api_keys", "control_delegates", "scim_groups", "scim_group_members",
+	"users.organization_id", "users.mfa_enabled", "users.is_super_admin", "users.scim_external_id",
+	"users.locked_until",
+}
+
+// baselineExisting records the first migration as applied on databases that
+// already hold its schema but predate schema_migrations. A database with only
+// part of it (e.g. one created from the old schema.sql) is refused, as
+// replaying or skipping the first migration would both leave it broken.
+func (m *Migrator) baselineExisting(ctx context.Context, conn *pgxpool.Conn) error {
+	var recorded bool
+	if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations);`).Scan(&recorded); err != nil {
+		return err
+	}
+	var hasSchema bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('public.users') IS NOT NULL;`).Scan(&hasSchema); err != nil {
+		return err
+	}
+	if recorded || !hasSchema || len(m.migrations) == 0 {
+		return nil
+	}
+
+	first := m.migrations[0]
+	var missing []string
+	for _, marker := range baselineMarkers {
+		table, column, isColumn := strings.Cut(marker, ".")
+		var exists bool
+		var err error
+		if isColumn {
+			err = conn.QueryRow(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM information_schema.columns
+					WHERE table_schema = 'public' AND table_name = $1 AND column_name = $2
+				);
+			`, table, column).Scan(&exists)
+		} else {
+			err = conn.QueryRow(ctx, `SELECT to_regclass('public.' || $1) IS NOT NULL;`, table).Scan(&exists)
+		}
+		if err != nil {
+			return err
+		}
+		if !exists {
+			missing = append(missing, marker)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("existing schema does not match migration %04d_%s (missing %s); upgrade it manually, then record the migration in schema_migrations",
+			first.Version, first.Name, strings.Join(missing, ", "))
+	}
+
+	if _, err := conn.Exec(ctx, `
+		INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3);
+	`, first.Version, first.Name, first.Checksum); err != nil {
+		return err
+	}
+	log.Printf("Existing schema found; recorded migration %04d_%s as applied", first.Version, first.Name)
+	return nil
+}
+
+// Up applies every pending migration in order, each in its own transaction, and
+// returns the ones it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		if err := m.baselineExisting(ctx, conn); err != nil {
+			return err
+		}
+		applied, checksums, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				if checksums[migration.Version] != migration.Checksum {
+					log.Printf("Warning: migration %04d_%s was changed after it was applied", migration.Version, migration.Name)
+				}
+				continue
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `
+					INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3);
+				`, migration.Version, migration.Name, migration.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the most recently applied migrations, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, _, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %04d_%s cannot be reverted", migration.Version, migration.Name)
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1;`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Printf("Reverted migration %04d_%s", migration.Version, migration.Name)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known migration and whether it has been applied. Versions
+// recorded in the database but missing from this binary are included too.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, checksums, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status, ok := applied[migration.Version]
+			if !ok {
+				status = MigrationStatus{Version: migration.Version, Name: migration.Name}
+			}
+			status.ChecksumMismatch = ok && checksums[migration.Version] != migration.Checksum
+			statuses = append(statuses, status)
+			delete(applied, migration.Version)
+		}
+		for _, unknown := range applied {
+			statuses = append(statuses, unknown)
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+// runMigrateCommand implements `grc-backend migrate [up|down [n]|status]`
+func runMigrateCommand(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	migrator, err := NewMigrator(pool)
+	if err != nil {
+		return err
+	}
+
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.New("usage: migrate down [steps]")
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migration(s)\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", ""
+			if status.Applied {
+				state = "applied"
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.ChecksumMismatch {
+				state += " (modified)"
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate action %q (use up, down or status)", action)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+-- Drops everything created by 0001_initial_schema.up.sql. All data is lost.
+-- The grc_tenant role is cluster-wide and may be shared, so it is kept.
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM grc_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE USAGE, SELECT ON SEQUENCES FROM grc_tenant;
+
+DROP TABLE IF EXISTS
+  template_controls,
+  control_templates,
+  scim_group_members,
+  scim_groups,
+  vendor_document_mapping,
+  vendor_control_mapping,
+  vendor_assessments,
+  vendors,
+  gdpr_dsr,
+  risk_control_mapping,
+  risk_assessments,
+  gdpr_ropa,
+  notifications,
+  audit_log,
+  ticket_comments,
+  tickets,
+  asset_control_mapping,
+  document_control_mapping,
+  assets,
+  document_read_acknowledgements,
+  document_versions,
+  documents,
+  evidence_files,
+  control_delegates,
+  control_evidence_log,
+  activated_controls,
+  control_articles,
+  control_library,
+  control_standards,
+  api_keys,
+  jwt_signing_keys,
+  login_ip_failures,
+  user_sessions,
+  password_tokens,
+  system_settings,
+  mfa_challenges,
+  mfa_recovery_codes,
+  user_mfa,
+  oidc_login_states,
+  users,
+  organizations
+CASCADE;
+
+DROP FUNCTION IF EXISTS current_org_id();
+DROP FUNCTION IF EXISTS trigger_set_timestamp();
@@ -1,3 +1,5 @@
+-- Baseline schema (formerly schema.sql). Later changes go in new numbered migrations.
+
 -- ### 0. PREPARATION ###
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
@@ -12,20 +14,172 @@ $$ LANGUAGE plpgsql;
 
 -- ### 1. GRC & USER TABLES ###
 
+-- Tenants. Every compliance record belongs to one organization; see TENANT ISOLATION below.
+CREATE TABLE organizations (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  name TEXT NOT NULL,
+  slug TEXT NOT NULL UNIQUE, -- e.g. 'acme-de', used by public forms
+  status TEXT NOT NULL DEFAULT 'active', -- 'active', 'suspended'
+  is_default BOOLEAN NOT NULL DEFAULT false, -- receives self-registrations and public submissions
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TRIGGER set_timestamp BEFORE UPDATE ON organizations FOR EACH ROW EXECUTE PROCEDURE trigger_set_timestamp();
+CREATE UNIQUE INDEX idx_organizations_single_default ON organizations(is_default) WHERE is_default;
+INSERT INTO organizations (name, slug, is_default) VALUES ('Default Organization', 'default', true);
+
+-- The organization new rows belong to: the one the session is scoped to (app.org_id),
+-- otherwise the default organization
+CREATE FUNCTION current_org_id() RETURNS UUID AS $$
+  SELECT COALESCE(NULLIF(current_setting('app.org_id', true), '')::uuid,
+                  (SELECT id FROM organizations WHERE is_default));
+$$ LANGUAGE sql STABLE;
+
 CREATE TABLE users (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   email TEXT NOT NULL UNIQUE,
   name TEXT NOT NULL,
-  role TEXT NOT NULL DEFAULT 'user', -- 'user', 'admin'
+  role TEXT NOT NULL DEFAULT 'user', -- see roleDefinitions in permissions.go
   onboarding_completed BOOLEAN NOT NULL DEFAULT false,
   company_name TEXT,
   company_size TEXT, -- '1-10', '11-50', '51-200', '201-500', '500+'
   company_industry TEXT,
   primary_regulations TEXT, -- Comma-separated: 'GDPR,ISO27001,NIS-2'
+  password_hash TEXT, -- bcrypt hash; NULL for accounts that sign in through SSO
+  auth_provider TEXT NOT NULL DEFAULT 'local', -- 'local', 'oidc'
+  oidc_issuer TEXT,
+  oidc_subject TEXT,
+  mfa_enabled BOOLEAN NOT NULL DEFAULT false,
+  is_super_admin BOOLEAN NOT NULL DEFAULT false, -- platform operator across all organizations
+  active BOOLEAN NOT NULL DEFAULT true, -- false once deprovisioned; inactive users cannot sign in
+  deactivated_at TIMESTAMPTZ,
+  scim_managed BOOLEAN NOT NULL DEFAULT false, -- provisioned through SCIM; role follows directory groups
+  scim_external_id TEXT, -- the IdP's identifier for the user
+  manager_id UUID REFERENCES users(id) ON DELETE SET NULL, -- inherits controls when the user is deprovisioned
+  failed_login_count INT NOT NULL DEFAULT 0, -- consecutive failed password logins within the failure window
+  last_failed_login_at TIMESTAMPTZ,
+  locked_until TIMESTAMPTZ, -- password login is refused until then
   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 CREATE TRIGGER set_timestamp BEFORE UPDATE ON users FOR EACH ROW EXECUTE PROCEDURE trigger_set_timestamp();
+CREATE UNIQUE INDEX idx_users_oidc_identity ON users(oidc_issuer, oidc_subject) WHERE oidc_subject IS NOT NULL;
+
+-- Pending OIDC authorization-code logins (state, PKCE verifier and nonce)
+CREATE TABLE oidc_login_states (
+  state TEXT PRIMARY KEY,
+  code_verifier TEXT NOT NULL,
+  nonce TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- TOTP authenticators (one per user; confirmed_at is NULL while enrolment is pending)
+CREATE TABLE user_mfa (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  totp_secret TEXT NOT NULL,
+  last_used_step BIGINT NOT NULL DEFAULT 0, -- Prevents TOTP code replay
+  confirmed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE mfa_recovery_codes (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL, -- SHA-256 of the normalized code
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
+
+-- Pending second login steps issued after a successful password check
+CREATE TABLE mfa_challenges (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  token_hash TEXT NOT NULL UNIQUE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  purpose TEXT NOT NULL, -- 'verify', 'enroll'
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Platform-wide settings and policies (e.g., 'mfa_policy')
+CREATE TABLE system_settings (
+  key TEXT PRIMARY KEY,
+  value JSONB NOT NULL,
+  updated_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Single-use tokens for password resets and account invitations (only the SHA-256 hash is stored)
+CREATE TABLE password_tokens (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL UNIQUE,
+  purpose TEXT NOT NULL, -- 'reset', 'invite'
+  created_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_password_tokens_user ON password_tokens(user_id);
+
+-- Login sessions backing refresh tokens. Access tokens carry the session ID and are
+-- rejected once the session is revoked; refresh tokens rotate on every use.
+CREATE TABLE user_sessions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  refresh_token_hash TEXT NOT NULL UNIQUE,
+  previous_refresh_token_hash TEXT, -- detects replay of a rotated-out refresh token
+  auth_method TEXT NOT NULL,
+  user_agent TEXT,
+  ip_address TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ,
+  revoked_reason TEXT
+);
+CREATE INDEX idx_user_sessions_user ON user_sessions(user_id) WHERE revoked_at IS NULL;
+CREATE INDEX idx_user_sessions_previous_hash ON user_sessions(previous_refresh_token_hash);
+
+-- Failed password logins per client address, for throttling credential stuffing
+-- across many accounts. Platform-wide, not tenant-scoped.
+CREATE TABLE login_ip_failures (
+  ip_address INET PRIMARY KEY,
+  failure_count INT NOT NULL DEFAULT 0,
+  window_started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  blocked_until TIMESTAMPTZ
+);
+
+-- Asymmetric keys that sign platform access tokens. Private keys are encrypted with
+-- a key derived from JWT_SECRET; public halves are served at /.well-known/jwks.json.
+CREATE TABLE jwt_signing_keys (
+  kid TEXT PRIMARY KEY,
+  algorithm TEXT NOT NULL, -- 'RS256', 'EdDSA'
+  private_key TEXT NOT NULL,
+  activates_at TIMESTAMPTZ NOT NULL, -- published before this, signs from this point
+  retires_at TIMESTAMPTZ NOT NULL, -- stops signing, still verifies
+  expires_at TIMESTAMPTZ NOT NULL, -- removed from the key set
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Integration API keys (external ticket portal etc.). Only a SHA-256 hash of the
+-- secret is stored; key_prefix is kept in clear text to identify a key.
+CREATE TABLE api_keys (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  name TEXT NOT NULL,
+  key_prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE,
+  scopes TEXT[] NOT NULL DEFAULT '{}', -- e.g. 'tickets:create', 'tickets:read:customer'
+  customer_ref TEXT, -- when set, the key can only act for this external customer
+  expires_at TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  last_used_ip TEXT,
+  created_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  revoked_at TIMESTAMPTZ
+);
 
 -- Standards metadata table
 CREATE TABLE control_standards (
@@ -91,6 +245,16 @@ CREATE TABLE control_evidence_log (
   evidence_link TEXT
 );
 
+-- Users allowed to submit evidence on behalf of a control's owner
+CREATE TABLE control_delegates (
+  activated_control_id UUID NOT NULL REFERENCES activated_controls(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  delegated_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (activated_control_id, user_id)
+);
+CREATE INDEX idx_control_delegates_user ON control_delegates(user_id);
+
 -- Evidence file attachments
 CREATE TABLE evidence_files (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -356,6 +520,75 @@ BEFORE UPDATE ON vendor_assessments
 FOR EACH ROW
 EXECUTE FUNCTION trigger_set_timestamp();
 
+-- ### TENANT ISOLATION ###
+-- Tenant-owned tables get organization_id and a row-level security policy. The
+-- backend runs org-scoped requests as grc_tenant with app.org_id set, so those
+-- statements only see and write their own organization's rows. The table owner
+-- (used for login, background jobs and super-admin tooling) is not restricted.
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'grc_tenant') THEN
+    CREATE ROLE grc_tenant NOLOGIN;
+  END IF;
+END $$;
+GRANT grc_tenant TO CURRENT_USER;
+
+DO $$
+DECLARE
+  t TEXT;
+BEGIN
+  FOREACH t IN ARRAY ARRAY[
+    'users', 'activated_controls', 'control_evidence_log', 'control_delegates', 'evidence_files',
+    'documents', 'document_versions', 'document_read_acknowledgements', 'assets',
+    'document_control_mapping', 'asset_control_mapping', 'tickets', 'ticket_comments',
+    'audit_log', 'notifications', 'gdpr_ropa', 'risk_assessments', 'risk_control_mapping',
+    'gdpr_dsr', 'vendors', 'vendor_assessments', 'vendor_control_mapping',
+    'vendor_document_mapping', 'api_keys'
+  ] LOOP
+    EXECUTE format('ALTER TABLE %I ADD COLUMN organization_id UUID NOT NULL DEFAULT current_org_id() REFERENCES organizations(id)', t);
+    EXECUTE format('CREATE INDEX %I ON %I(organization_id)', 'idx_' || t || '_organization', t);
+    EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+    EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (organization_id = NULLIF(current_setting(''app.org_id'', true), '''')::uuid)', t);
+  END LOOP;
+END $$;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO grc_tenant;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO grc_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO grc_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO grc_tenant;
+
+-- ### SCIM PROVISIONING ###
+-- Identity providers push users and groups through /scim/v2. A group mapped to
+-- a role grants it to its members.
+
+CREATE UNIQUE INDEX idx_users_scim_external_id ON users(organization_id, scim_external_id) WHERE scim_external_id IS NOT NULL;
+
+CREATE TABLE scim_groups (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL DEFAULT current_org_id() REFERENCES organizations(id),
+  display_name TEXT NOT NULL,
+  external_id TEXT,
+  role TEXT, -- see roleDefinitions in permissions.go; NULL grants nothing
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (organization_id, display_name)
+);
+CREATE TRIGGER set_timestamp BEFORE UPDATE ON scim_groups FOR EACH ROW EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE TABLE scim_group_members (
+  group_id UUID NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  organization_id UUID NOT NULL DEFAULT current_org_id() REFERENCES organizations(id),
+  PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX idx_scim_group_members_user ON scim_group_members(user_id);
+
+ALTER TABLE scim_groups ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON scim_groups USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
+ALTER TABLE scim_group_members ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON scim_group_members USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
+
 -- ### 8. CONTROL ACTIVATION TEMPLATES ###
 
 CREATE TABLE control_templates (
@@ -370,7 +603,8 @@ CREATE TABLE control_templates (
 );
 CREATE TRIGGER set_timestamp BEFORE UPDATE ON control_templates FOR EACH ROW EXECUTE PROCEDURE trigger_set_timestamp();
 
-CREATE TABLE template_controls (\n  template_id TEXT NOT NULL REFERENCES control_templates(id) ON DELETE CASCADE,
+CREATE TABLE template_controls (
+  template_id TEXT NOT NULL REFERENCES control_templates(id) ON DELETE CASCADE,
   control_library_id TEXT NOT NULL REFERENCES control_library(id) ON DELETE CASCADE,
   priority TEXT NOT NULL, -- 'critical', 'high', 'medium', 'low'
   rationale TEXT,
@@ -0,0 +1,20 @@
+-- History of scheduled job executions. Each scheduled firing is claimed once per
+-- attempt across all replicas through the unique index on
+-- (job_name, scheduled_for, attempt). Platform-wide, not tenant-scoped.
+CREATE TABLE job_runs (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  job_name TEXT NOT NULL,
+  source TEXT NOT NULL, -- 'schedule', 'manual' (API) or 'cli'
+  status TEXT NOT NULL DEFAULT 'running', -- 'running', 'succeeded', 'failed'
+  attempt INT NOT NULL DEFAULT 1,
+  scheduled_for TIMESTAMPTZ, -- the schedule slot; NULL for on-demand runs
+  organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE, -- set when run for one organization only
+  triggered_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  instance TEXT NOT NULL, -- host and process that ran the job
+  started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  finished_at TIMESTAMPTZ,
+  items_processed INT NOT NULL DEFAULT 0,
+  error TEXT
+);
+CREATE INDEX idx_job_runs_job_started ON job_runs(job_name, started_at DESC);
+CREATE UNIQUE INDEX idx_job_runs_schedule_slot ON job_runs(job_name, scheduled_for, attempt) WHERE scheduled_for IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS control_reminders;
+DROP TABLE IF EXISTS reminder_policies;
@@ -0,0 +1,27 @@
+-- Reminder and escalation policy for due controls, one per organization. The
+-- built-in default (see reminders.go) applies until one is saved.
+CREATE TABLE reminder_policies (
+  organization_id UUID PRIMARY KEY DEFAULT current_org_id() REFERENCES organizations(id),
+  policy JSONB NOT NULL,
+  updated_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Reminder stages already sent for a control's current due date, so each stage
+-- fires once. Cleared when evidence is submitted and the due date moves.
+CREATE TABLE control_reminders (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL DEFAULT current_org_id() REFERENCES organizations(id),
+  activated_control_id UUID NOT NULL REFERENCES activated_controls(id) ON DELETE CASCADE,
+  due_date DATE NOT NULL,
+  stage TEXT NOT NULL, -- 'before_7d', 'due', 'overdue_14d'; see reminders.go
+  notified_user_ids UUID[] NOT NULL DEFAULT '{}', -- owner plus any escalation recipients
+  sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (activated_control_id, due_date, stage)
+);
+CREATE INDEX idx_control_reminders_organization ON control_reminders(organization_id);
+
+ALTER TABLE reminder_policies ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON reminder_policies USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
+ALTER TABLE control_reminders ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON control_reminders USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
@@ -0,0 +1,44 @@
+-- Outbound webhook endpoints. events holds audit action types (or '*') the
+-- subscriber wants; the signing secret is encrypted with the JWT_SECRET-derived key.
+CREATE TABLE webhook_subscriptions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL DEFAULT current_org_id() REFERENCES organizations(id),
+  name TEXT NOT NULL,
+  url TEXT NOT NULL,
+  events TEXT[] NOT NULL,
+  secret_encrypted TEXT NOT NULL,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_webhook_subscriptions_organization ON webhook_subscriptions(organization_id);
+
+-- Delivery queue and log. Pending rows are picked up once next_attempt_at has
+-- passed; a replay is a new row pointing at the delivery it repeats.
+CREATE TABLE webhook_deliveries (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL DEFAULT current_org_id() REFERENCES organizations(id),
+  subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+  event_id UUID NOT NULL, -- the audit_log entry, so receivers can de-duplicate
+  event_type TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'succeeded', 'failed'
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_attempt_at TIMESTAMPTZ,
+  response_status INT,
+  response_body TEXT, -- truncated
+  error TEXT,
+  replay_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  delivered_at TIMESTAMPTZ
+);
+CREATE INDEX idx_webhook_deliveries_organization ON webhook_deliveries(organization_id);
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, created_at DESC);
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE webhook_subscriptions ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON webhook_subscriptions USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON webhook_deliveries USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
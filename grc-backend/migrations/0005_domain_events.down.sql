@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_event;
+DROP TABLE IF EXISTS domain_events;
@@ -0,0 +1,30 @@
+-- Transactional outbox. Domain events are written in the same transaction as
+-- the change they describe; the dispatcher then feeds them to the audit log,
+-- webhooks, notifications and emails. handled_by records which handlers have
+-- succeeded so a retry only repeats the ones that failed.
+CREATE TABLE domain_events (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL DEFAULT current_org_id() REFERENCES organizations(id),
+  event_type TEXT NOT NULL,
+  occurred_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+  actor_id UUID,
+  entity_type TEXT,
+  entity_id TEXT,
+  data JSONB,
+  ip_address INET,
+  handled_by TEXT[] NOT NULL DEFAULT '{}',
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_error TEXT,
+  dispatched_at TIMESTAMPTZ
+);
+CREATE INDEX idx_domain_events_organization ON domain_events(organization_id);
+CREATE INDEX idx_domain_events_pending ON domain_events(next_attempt_at) WHERE dispatched_at IS NULL;
+CREATE INDEX idx_domain_events_dispatched ON domain_events(dispatched_at) WHERE dispatched_at IS NOT NULL;
+
+ALTER TABLE domain_events ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON domain_events USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
+
+-- Handlers may run more than once for an event, so both sinks are idempotent
+-- on the event ID
+CREATE UNIQUE INDEX idx_webhook_deliveries_event ON webhook_deliveries(subscription_id, event_id) WHERE replay_of IS NULL;
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP TABLE IF EXISTS audit_signing_keys;
+DROP TRIGGER IF EXISTS protect_truncate ON audit_log;
+DROP TRIGGER IF EXISTS protect_sealed_entries ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_protect();
+UPDATE audit_log SET user_id = NULL WHERE user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = audit_log.user_id);
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+DROP INDEX IF EXISTS idx_audit_log_unchained;
+DROP INDEX IF EXISTS idx_audit_log_chain;
+ALTER TABLE audit_log
+  DROP COLUMN IF EXISTS entry_hash,
+  DROP COLUMN IF EXISTS prev_hash,
+  DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,62 @@
+-- Tamper-evident audit log. Each organization's entries form a hash chain:
+-- entry_hash is the SHA-256 of the previous entry's hash and the entry's
+-- canonical content, and seq numbers the chain without gaps. Entries are
+-- written unchained and sealed in order under a per-organization lock, which
+-- also chains the entries that predate this migration.
+ALTER TABLE audit_log
+  ADD COLUMN seq BIGINT,
+  ADD COLUMN prev_hash TEXT,
+  ADD COLUMN entry_hash TEXT;
+CREATE UNIQUE INDEX idx_audit_log_chain ON audit_log(organization_id, seq);
+CREATE INDEX idx_audit_log_unchained ON audit_log(organization_id, performed_at) WHERE seq IS NULL;
+
+-- The actor is part of the hashed content, so deleting a user must not rewrite it
+ALTER TABLE audit_log DROP CONSTRAINT IF EXISTS audit_log_user_id_fkey;
+
+-- Sealed entries are immutable; only the sealing of an unchained entry may update a row
+CREATE OR REPLACE FUNCTION audit_log_protect() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'TRUNCATE' THEN
+    RAISE EXCEPTION 'audit_log cannot be truncated';
+  END IF;
+  IF OLD.seq IS NOT NULL THEN
+    RAISE EXCEPTION 'audit_log entry % is sealed and cannot be changed', OLD.id;
+  END IF;
+  IF TG_OP = 'DELETE' THEN
+    RETURN OLD;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER protect_sealed_entries BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE PROCEDURE audit_log_protect();
+CREATE TRIGGER protect_truncate BEFORE TRUNCATE ON audit_log
+  FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_protect();
+
+-- Ed25519 keys that sign checkpoints. Platform-wide like jwt_signing_keys; the
+-- private key is encrypted with JWT_SECRET, and a checkpoint only verifies
+-- against a key whose private half can be decrypted, so keys inserted with
+-- database access alone are rejected.
+CREATE TABLE audit_signing_keys (
+  kid TEXT PRIMARY KEY,
+  public_key TEXT NOT NULL,  -- base64
+  private_key TEXT NOT NULL, -- encrypted PKCS#8
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Signed statements that an organization's chain had a given head
+CREATE TABLE audit_checkpoints (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL DEFAULT current_org_id() REFERENCES organizations(id),
+  seq BIGINT NOT NULL,
+  entry_hash TEXT NOT NULL,
+  signed_at TIMESTAMPTZ NOT NULL,
+  key_id TEXT NOT NULL REFERENCES audit_signing_keys(kid),
+  signature TEXT NOT NULL, -- base64 Ed25519 signature of the checkpoint statement
+  UNIQUE (organization_id, seq)
+);
+CREATE INDEX idx_audit_checkpoints_organization ON audit_checkpoints(organization_id);
+
+ALTER TABLE audit_checkpoints ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON audit_checkpoints USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
@@ -0,0 +1,9 @@
+-- How far each SIEM sink has forwarded every organization's audit chain. The
+-- cursor only moves after a batch was accepted, so delivery is at least once.
+CREATE TABLE audit_forward_cursors (
+  sink TEXT NOT NULL, -- e.g. 'syslog' or 'file:<host>:<path>'
+  organization_id UUID NOT NULL REFERENCES organizations(id),
+  last_seq BIGINT NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (sink, organization_id)
+);
@@ -0,0 +1,13 @@
+-- Entries sealed while these columns existed stop verifying once they are dropped
+
+DROP INDEX IF EXISTS idx_audit_log_request;
+
+ALTER TABLE audit_log
+  DROP COLUMN IF EXISTS session_id,
+  DROP COLUMN IF EXISTS request_id,
+  DROP COLUMN IF EXISTS user_agent;
+
+ALTER TABLE domain_events
+  DROP COLUMN IF EXISTS session_id,
+  DROP COLUMN IF EXISTS request_id,
+  DROP COLUMN IF EXISTS user_agent;
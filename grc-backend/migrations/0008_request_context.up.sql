@@ -0,0 +1,13 @@
+-- The HTTP request behind each event and audit entry: who sent it (user agent),
+-- the request ID echoed in X-Request-ID and the session it was made in
+ALTER TABLE domain_events
+  ADD COLUMN user_agent TEXT,
+  ADD COLUMN request_id TEXT,
+  ADD COLUMN session_id UUID;
+
+ALTER TABLE audit_log
+  ADD COLUMN user_agent TEXT,
+  ADD COLUMN request_id TEXT,
+  ADD COLUMN session_id UUID;
+
+CREATE INDEX idx_audit_log_request ON audit_log(request_id) WHERE request_id IS NOT NULL;
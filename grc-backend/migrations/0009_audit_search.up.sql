@@ -0,0 +1,5 @@
+-- Indexes for audit log search: keyset paging by time, per-entity history and
+-- containment/key filters on the changes document
+CREATE INDEX idx_audit_log_performed ON audit_log(organization_id, performed_at DESC, id DESC);
+CREATE INDEX idx_audit_log_entity ON audit_log(organization_id, target_entity_type, target_entity_id, performed_at);
+CREATE INDEX idx_audit_log_changes ON audit_log USING GIN (changes);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS control_library_mappings;
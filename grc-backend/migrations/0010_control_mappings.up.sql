@@ -0,0 +1,18 @@
+-- Equivalences between library controls of different standards, shared by
+-- every organization like control_library itself. Each pair is stored once,
+-- with source_control_id < target_control_id; the relationship reads "source
+-- is <relationship> target" (a subset covers less than its target).
+CREATE TABLE control_library_mappings (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  source_control_id TEXT NOT NULL REFERENCES control_library(id) ON DELETE CASCADE,
+  target_control_id TEXT NOT NULL REFERENCES control_library(id) ON DELETE CASCADE,
+  relationship TEXT NOT NULL CHECK (relationship IN ('equal', 'subset', 'superset', 'related')),
+  notes TEXT,
+  origin TEXT, -- mapping file or 'api'
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (source_control_id < target_control_id),
+  UNIQUE (source_control_id, target_control_id)
+);
+CREATE INDEX idx_control_library_mappings_target ON control_library_mappings(target_control_id);
+CREATE TRIGGER set_timestamp BEFORE UPDATE ON control_library_mappings FOR EACH ROW EXECUTE PROCEDURE trigger_set_timestamp();
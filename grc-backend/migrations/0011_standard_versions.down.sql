@@ -0,0 +1,13 @@
+ALTER TABLE control_evidence_log DROP COLUMN IF EXISTS migrated_from_id;
+ALTER TABLE activated_controls DROP COLUMN IF EXISTS migrated_to_id;
+
+DROP TABLE IF EXISTS control_successors;
+DROP TABLE IF EXISTS control_library_revisions;
+
+ALTER TABLE control_library DROP COLUMN IF EXISTS retired_at;
+
+DROP INDEX IF EXISTS idx_control_standards_lineage;
+ALTER TABLE control_standards
+  DROP COLUMN IF EXISTS superseded_at,
+  DROP COLUMN IF EXISTS supersedes_id,
+  DROP COLUMN IF EXISTS lineage;
@@ -0,0 +1,45 @@
+-- Versions of a standard are kept side by side. A lineage (e.g. 'ISO-27001')
+-- groups them; a new version points at the one it supersedes.
+ALTER TABLE control_standards
+  ADD COLUMN lineage TEXT,
+  ADD COLUMN supersedes_id UUID REFERENCES control_standards(id) ON DELETE SET NULL,
+  ADD COLUMN superseded_at TIMESTAMPTZ;
+UPDATE control_standards SET lineage = code;
+ALTER TABLE control_standards ALTER COLUMN lineage SET NOT NULL;
+CREATE INDEX idx_control_standards_lineage ON control_standards(lineage);
+
+-- Controls dropped by a re-import are retired rather than deleted, since
+-- activations and evidence still reference them
+ALTER TABLE control_library ADD COLUMN retired_at TIMESTAMPTZ;
+
+-- Text a control had before a re-import changed it
+CREATE TABLE control_library_revisions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  control_library_id TEXT NOT NULL REFERENCES control_library(id) ON DELETE CASCADE,
+  standard_id UUID REFERENCES control_standards(id) ON DELETE SET NULL,
+  family TEXT NOT NULL,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL,
+  article_number TEXT,
+  section_name TEXT,
+  full_text TEXT,
+  guidance TEXT,
+  external_references TEXT,
+  replaced_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_control_library_revisions_control ON control_library_revisions(control_library_id, replaced_at);
+
+-- Which controls of a new version take over from which controls of the
+-- version it supersedes ('replaces' declared in the file, or same 'name')
+CREATE TABLE control_successors (
+  predecessor_id TEXT NOT NULL REFERENCES control_library(id) ON DELETE CASCADE,
+  successor_id TEXT NOT NULL REFERENCES control_library(id) ON DELETE CASCADE,
+  match TEXT NOT NULL CHECK (match IN ('replaces', 'name')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (predecessor_id, successor_id)
+);
+CREATE INDEX idx_control_successors_successor ON control_successors(successor_id);
+
+-- Activations and evidence carried over to a new version by a migration
+ALTER TABLE activated_controls ADD COLUMN migrated_to_id UUID REFERENCES activated_controls(id) ON DELETE SET NULL;
+ALTER TABLE control_evidence_log ADD COLUMN migrated_from_id UUID REFERENCES control_evidence_log(id) ON DELETE SET NULL;
@@ -0,0 +1,20 @@
+DROP POLICY IF EXISTS tenant_isolation ON system_settings;
+ALTER TABLE system_settings DISABLE ROW LEVEL SECURITY;
+DELETE FROM system_settings WHERE organization_id <> (SELECT id FROM organizations WHERE is_default);
+ALTER TABLE system_settings DROP CONSTRAINT system_settings_pkey;
+ALTER TABLE system_settings DROP COLUMN organization_id;
+ALTER TABLE system_settings ADD PRIMARY KEY (key);
+
+DO $$
+DECLARE
+  t TEXT;
+BEGIN
+  FOREACH t IN ARRAY ARRAY['user_sessions', 'user_mfa', 'mfa_recovery_codes', 'password_tokens'] LOOP
+    EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+    EXECUTE format('ALTER TABLE %I DISABLE ROW LEVEL SECURITY', t);
+    EXECUTE format('DROP TRIGGER IF EXISTS set_organization ON %I', t);
+    EXECUTE format('ALTER TABLE %I DROP COLUMN IF EXISTS organization_id', t);
+  END LOOP;
+END $$;
+
+DROP FUNCTION IF EXISTS set_organization_from_user();
@@ -0,0 +1,43 @@
+-- Sessions, MFA secrets, recovery codes and password tokens belong to the
+-- user's organization, so org-scoped statements cannot touch another tenant's
+-- credentials. New rows take the organization of their user; under the tenant
+-- role a user of another organization is invisible and the insert fails.
+CREATE FUNCTION set_organization_from_user() RETURNS TRIGGER AS $$
+BEGIN
+  SELECT organization_id INTO NEW.organization_id FROM users WHERE id = NEW.user_id;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+DECLARE
+  t TEXT;
+BEGIN
+  FOREACH t IN ARRAY ARRAY['user_sessions', 'user_mfa', 'mfa_recovery_codes', 'password_tokens'] LOOP
+    EXECUTE format('ALTER TABLE %I ADD COLUMN organization_id UUID REFERENCES organizations(id)', t);
+    EXECUTE format('UPDATE %I x SET organization_id = u.organization_id FROM users u WHERE u.id = x.user_id', t);
+    EXECUTE format('ALTER TABLE %I ALTER COLUMN organization_id SET NOT NULL', t);
+    EXECUTE format('CREATE INDEX %I ON %I(organization_id)', 'idx_' || t || '_organization', t);
+    EXECUTE format('CREATE TRIGGER set_organization BEFORE INSERT ON %I FOR EACH ROW EXECUTE PROCEDURE set_organization_from_user()', t);
+    EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+    EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (organization_id = NULLIF(current_setting(''app.org_id'', true), '''')::uuid)', t);
+  END LOOP;
+END $$;
+
+-- Settings such as the MFA policy are chosen by each organization. The former
+-- platform-wide values carry over to every organization.
+ALTER TABLE system_settings ADD COLUMN organization_id UUID REFERENCES organizations(id);
+INSERT INTO system_settings (organization_id, key, value, updated_by_id, updated_at)
+  SELECT o.id, s.key, s.value, s.updated_by_id, s.updated_at
+  FROM system_settings s CROSS JOIN organizations o
+  WHERE s.organization_id IS NULL AND NOT o.is_default;
+UPDATE system_settings SET organization_id = (SELECT id FROM organizations WHERE is_default)
+  WHERE organization_id IS NULL;
+ALTER TABLE system_settings
+  ALTER COLUMN organization_id SET NOT NULL,
+  ALTER COLUMN organization_id SET DEFAULT current_org_id(),
+  DROP CONSTRAINT system_settings_pkey,
+  ADD PRIMARY KEY (organization_id, key);
+
+ALTER TABLE system_settings ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON system_settings USING (organization_id = NULLIF(current_setting('app.org_id', true), '')::uuid);
@@ -0,0 +1,3 @@
+-- Receivers are tenant-controlled, so their response bodies are no longer kept
+-- or shown; the delivery log records the status code and error only.
+ALTER TABLE webhook_deliveries DROP COLUMN response_body;
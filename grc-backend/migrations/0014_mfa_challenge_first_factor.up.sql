@@ -0,0 +1,3 @@
+-- SSO logins of admins can be challenged for the platform's second factor too,
+-- so a challenge remembers how the user proved the first one.
+ALTER TABLE mfa_challenges ADD COLUMN first_factor TEXT NOT NULL DEFAULT 'password'; -- 'password', 'oidc'
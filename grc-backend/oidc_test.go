@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIssuer is a minimal OpenID provider: discovery, JWKS and a token endpoint
+// that enforces PKCE and returns an RS256-signed ID token
+type testIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string                 // code_challenge of the last authorization request
+	claims    map[string]interface{} // extra claims for the next ID token
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                iss.server.URL,
+			AuthorizationEndpoint: iss.server.URL + "/authorize",
+			TokenEndpoint:         iss.server.URL + "/token",
+			JWKSURI:               iss.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: "test-key",
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+		iss.mu.Lock()
+		challenge, extra := iss.challenge, iss.claims
+		iss.mu.Unlock()
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != "good-code" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		if pkceChallenge(r.PostForm.Get("code_verifier")) != challenge {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss": iss.server.URL,
+			"aud": "grc-client",
+			"sub": "subject-1",
+			"exp": time.Now().Add(5 * time.Minute).Unix(),
+			"iat": time.Now().Unix(),
+		}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Errorf("signing id_token: %v", err)
+		}
+		json.NewEncoder(w).Encode(oidcTokenResponse{IDToken: signed, TokenType: "Bearer"})
+	})
+
+	iss.server = httptest.NewServer(mux)
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+func (iss *testIssuer) provider() *OIDCProvider {
+	return &OIDCProvider{
+		issuer:      iss.server.URL,
+		clientID:    "grc-client",
+		redirectURL: "https://grc.example.com/api/v1/auth/oidc/callback",
+		scopes:      "openid email profile",
+		groupsClaim: "groups",
+		enabled:     true,
+		httpClient:  iss.server.Client(),
+	}
+}
+
+// authorize runs the redirect leg of the flow and records the PKCE challenge
+func (iss *testIssuer) authorize(t *testing.T, p *OIDCProvider, state, nonce, verifier string, claims map[string]interface{}) {
+	t.Helper()
+	authURL, err := p.AuthorizationURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") != state || q.Get("nonce") != nonce || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization parameters: %v", q)
+	}
+	iss.mu.Lock()
+	iss.challenge = q.Get("code_challenge")
+	iss.claims = claims
+	iss.mu.Unlock()
+}
+
+func TestOIDCExchange(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+	ctx := context.Background()
+
+	iss.authorize(t, p, "state-1", "nonce-1", "verifier-1", map[string]interface{}{
+		"nonce":          "nonce-1",
+		"email":          "Alice@Example.com",
+		"email_verified": true,
+		"name":           "Alice",
+		"groups":         []string{"grc-admins"},
+	})
+	identity, err := p.Exchange(ctx, "good-code", "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Issuer != iss.server.URL || identity.Subject != "subject-1" {
+		t.Errorf("identity = %s/%s, want %s/subject-1", identity.Issuer, identity.Subject, iss.server.URL)
+	}
+	if identity.Email != "alice@example.com" || identity.Name != "Alice" {
+		t.Errorf("profile = %q %q", identity.Email, identity.Name)
+	}
+	if len(identity.Groups) != 1 || identity.Groups[0] != "grc-admins" {
+		t.Errorf("groups = %v", identity.Groups)
+	}
+}
+
+func TestOIDCExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		verifier string
+		nonce    string
+	}{
+		{
+			name:     "wrong PKCE verifier",
+			claims:   map[string]interface{}{"nonce": "n", "email": "a@example.com", "email_verified": true},
+			verifier: "other-verifier",
+			nonce:    "n",
+		},
+		{
+			name:     "nonce mismatch",
+			claims:   map[string]interface{}{"nonce": "replayed", "email": "a@example.com", "email_verified": true},
+			verifier: "v",
+			nonce:    "n",
+		},
+		{
+			name:     "unverified email",
+			claims:   map[string]interface{}{"nonce": "n", "email": "a@example.com", "email_verified": false},
+			verifier: "v",
+			nonce:    "n",
+		},
+		{
+			name:     "email_verified absent",
+			claims:   map[string]interface{}{"nonce": "n", "email": "a@example.com"},
+			verifier: "v",
+			nonce:    "n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := newTestIssuer(t)
+			p := iss.provider()
+			iss.authorize(t, p, "s", "n", "v", tt.claims)
+			if identity, err := p.Exchange(context.Background(), "good-code", tt.verifier, tt.nonce); err == nil {
+				t.Fatalf("Exchange succeeded with %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCStateCookie(t *testing.T) {
+	rec := httptest.NewRecorder()
+	setOIDCStateCookie(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil), "state-1")
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	cookie := cookies[0]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+		t.Errorf("cookie attributes = %+v", cookie)
+	}
+	if strings.Contains(cookie.Value, "state-1") {
+		t.Error("cookie must hold a hash of the state, not the state itself")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback", nil)
+	req.AddCookie(cookie)
+	if !oidcStateMatchesCookie(req, "state-1") {
+		t.Error("matching state was rejected")
+	}
+	if oidcStateMatchesCookie(req, "state-2") {
+		t.Error("foreign state was accepted")
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	iss := newTestIssuer(t)
+	s := &ApiServer{oidc: iss.provider()}
+
+	// A login started in another browser: the state is valid but the cookie is missing or foreign
+	for _, cookie := range []*http.Cookie{nil, {Name: oidcStateCookie, Value: pkceChallenge("attacker-state")}} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?state=victim-state&code=good-code", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		s.HandleOIDCCallback(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("cookie %v: status = %d, want %d", cookie, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestOIDCRoleForGroups(t *testing.T) {
+	p := &OIDCProvider{groupRoles: parseOIDCRoleGroups("auditor:grc-auditors, compliance_manager:grc-compliance, admin:grc-admins, bogus:grc-bogus, nogroup")}
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"grc-auditors"}, "auditor"},
+		{[]string{"grc-auditors", "grc-compliance"}, "compliance_manager"},
+		{[]string{"grc-compliance", "grc-admins"}, "admin"},
+		{[]string{"grc-bogus"}, ""},
+		{[]string{"unmapped"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := p.RoleForGroups(tt.groups); got != tt.want {
+			t.Errorf("RoleForGroups(%v) = %q, want %q", tt.groups, got, tt.want)
+		}
+	}
+
+	if got := (&OIDCProvider{}).RoleForGroups([]string{"grc-admins"}); got != "" {
+		t.Errorf("RoleForGroups without mappings = %q, want empty", got)
+	}
+}
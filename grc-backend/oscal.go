@@ -0,0 +1,905 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OSCAL catalogs and profiles
+//
+// Control catalogs in NIST OSCAL (JSON or XML) import as standards: the
+// catalog is converted to a standard file and goes through the same validation
+// and report as StandardImportData. Group titles become families, statements
+// the requirement text, guidance parts the guidance and label props the article
+// numbers. Control IDs are prefixed with the standard code ("NIST-800-53-ac-1")
+// because library IDs are global. A profile is resolved to the catalog it
+// selects from its imports, with its parameter values set, and imports as a
+// standard of its own. Standards export as OSCAL catalogs; the library fields
+// without an OSCAL equivalent travel as props and parts in oscalNamespace, so
+// importing an exported catalog gives back the same standard.
+
+const (
+	oscalVersion   = "1.1.2"
+	oscalNamespace = "urn:grc-platform:oscal" // ns of the props and parts only this platform reads
+	oscalXMLNS     = "http://csrc.nist.gov/ns/oscal/1.0"
+
+	// oscalMaxProfileDepth bounds profiles importing profiles
+	oscalMaxProfileDepth = 5
+)
+
+var (
+	oscalUUIDSpace     = uuid.NewSHA1(uuid.NameSpaceURL, []byte(oscalNamespace))
+	oscalInsertPattern = regexp.MustCompile(`\{\{\s*insert:\s*param,\s*([^\s}]+)\s*\}\}`)
+	oscalTokenPattern  = regexp.MustCompile(`[^a-z0-9._]+`)
+	oscalCodePattern   = regexp.MustCompile(`[^A-Za-z0-9.]+`)
+)
+
+// oscalDocument is an OSCAL JSON document holding a catalog or a profile
+type oscalDocument struct {
+	Catalog *oscalCatalog `json:"catalog,omitempty"`
+	Profile *oscalProfile `json:"profile,omitempty"`
+}
+
+type oscalCatalog struct {
+	UUID       string           `json:"uuid"`
+	Metadata   oscalMetadata    `json:"metadata"`
+	Params     []oscalParam     `json:"params,omitempty"`
+	Controls   []oscalControl   `json:"controls,omitempty"`
+	Groups     []oscalGroup     `json:"groups,omitempty"`
+	BackMatter *oscalBackMatter `json:"back-matter,omitempty"`
+	idPrefix   string           // prefix of library IDs, stripped when a profile selects controls
+}
+
+type oscalMetadata struct {
+	Title              string                  `json:"title"`
+	Published          string                  `json:"published,omitempty"`
+	LastModified       string                  `json:"last-modified"`
+	Version            string                  `json:"version"`
+	OSCALVersion       string                  `json:"oscal-version"`
+	Props              []oscalProp             `json:"props,omitempty"`
+	Links              []oscalLink             `json:"links,omitempty"`
+	Roles              []oscalRole             `json:"roles,omitempty"`
+	Parties            []oscalParty            `json:"parties,omitempty"`
+	ResponsibleParties []oscalResponsibleParty `json:"responsible-parties,omitempty"`
+	Remarks            string                  `json:"remarks,omitempty"`
+}
+
+type oscalProp struct {
+	Name  string `json:"name" xml:"name,attr"`
+	NS    string `json:"ns,omitempty" xml:"ns,attr,omitempty"`
+	Value string `json:"value" xml:"value,attr"`
+	Class string `json:"class,omitempty" xml:"class,attr,omitempty"`
+}
+
+type oscalLink struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+type oscalRole struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+type oscalParty struct {
+	UUID string `json:"uuid"`
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type oscalResponsibleParty struct {
+	RoleID     string   `json:"role-id"`
+	PartyUUIDs []string `json:"party-uuids"`
+}
+
+type oscalGroup struct {
+	ID       string         `json:"id,omitempty"`
+	Class    string         `json:"class,omitempty"`
+	Title    string         `json:"title"`
+	Params   []oscalParam   `json:"params,omitempty"`
+	Props    []oscalProp    `json:"props,omitempty"`
+	Parts    []oscalPart    `json:"parts,omitempty"`
+	Groups   []oscalGroup   `json:"groups,omitempty"`
+	Controls []oscalControl `json:"controls,omitempty"`
+}
+
+type oscalControl struct {
+	ID       string         `json:"id"`
+	Class    string         `json:"class,omitempty"`
+	Title    string         `json:"title"`
+	Params   []oscalParam   `json:"params,omitempty"`
+	Props    []oscalProp    `json:"props,omitempty"`
+	Links    []oscalLink    `json:"links,omitempty"`
+	Parts    []oscalPart    `json:"parts,omitempty"`
+	Controls []oscalControl `json:"controls,omitempty"` // enhancements
+}
+
+type oscalParam struct {
+	ID     string       `json:"id"`
+	Label  string       `json:"label,omitempty"`
+	Values []string     `json:"values,omitempty"`
+	Select *oscalSelect `json:"select,omitempty"`
+}
+
+type oscalSelect struct {
+	HowMany string   `json:"how-many,omitempty"`
+	Choice  []string `json:"choice,omitempty"`
+}
+
+type oscalPart struct {
+	ID    string      `json:"id,omitempty"`
+	Name  string      `json:"name"`
+	NS    string      `json:"ns,omitempty"`
+	Class string      `json:"class,omitempty"`
+	Title string      `json:"title,omitempty"`
+	Props []oscalProp `json:"props,omitempty"`
+	Prose string      `json:"prose,omitempty"`
+	Parts []oscalPart `json:"parts,omitempty"`
+}
+
+type oscalBackMatter struct {
+	Resources []oscalResource `json:"resources,omitempty"`
+}
+
+type oscalResource struct {
+	UUID   string       `json:"uuid"`
+	Title  string       `json:"title,omitempty"`
+	Rlinks []oscalRlink `json:"rlinks,omitempty"`
+	Base64 *oscalBase64 `json:"base64,omitempty"`
+}
+
+type oscalRlink struct {
+	Href      string `json:"href"`
+	MediaType string `json:"media-type,omitempty"`
+}
+
+type oscalBase64 struct {
+	Filename  string `json:"filename,omitempty"`
+	MediaType string `json:"media-type,omitempty"`
+	Value     string `json:"value"`
+}
+
+type oscalProfile struct {
+	UUID       string           `json:"uuid"`
+	Metadata   oscalMetadata    `json:"metadata"`
+	Imports    []oscalImport    `json:"imports"`
+	Modify     *oscalModify     `json:"modify,omitempty"`
+	BackMatter *oscalBackMatter `json:"back-matter,omitempty"`
+}
+
+type oscalImport struct {
+	Href            string                 `json:"href"`
+	IncludeAll      *struct{}              `json:"include-all,omitempty"`
+	IncludeControls []oscalControlSelector `json:"include-controls,omitempty"`
+	ExcludeControls []oscalControlSelector `json:"exclude-controls,omitempty"`
+}
+
+type oscalControlSelector struct {
+	WithChildControls string   `json:"with-child-controls,omitempty"` // yes or no
+	WithIDs           []string `json:"with-ids,omitempty"`
+	Matching          []struct {
+		Pattern string `json:"pattern"`
+	} `json:"matching,omitempty"`
+}
+
+type oscalModify struct {
+	SetParameters []oscalSetParameter `json:"set-parameters,omitempty"`
+}
+
+type oscalSetParameter struct {
+	ParamID string   `json:"param-id"`
+	Label   string   `json:"label,omitempty"`
+	Values  []string `json:"values,omitempty"`
+}
+
+// OSCALImportOptions select how an OSCAL document becomes a standard
+type OSCALImportOptions struct {
+	Code string // standard code; defaults to the one the catalog was exported with, or its title and version
+}
+
+// oscalCatalogSource loads the document a profile import refers to
+type oscalCatalogSource func(href string) (*oscalDocument, error)
+
+// ========== PARSING ==========
+
+// parseOSCAL decodes an OSCAL catalog or profile in JSON or XML
+func parseOSCAL(body []byte) (*oscalDocument, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("the document is empty")
+	}
+	var doc *oscalDocument
+	if trimmed[0] == '<' {
+		var err error
+		if doc, err = parseOSCALXML(trimmed); err != nil {
+			return nil, err
+		}
+	} else {
+		doc = &oscalDocument{}
+		if err := json.Unmarshal(trimmed, doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	if doc.Catalog == nil && doc.Profile == nil {
+		return nil, fmt.Errorf("the document is neither an OSCAL catalog nor a profile")
+	}
+	return doc, nil
+}
+
+// ========== IMPORT ==========
+
+// oscalImportData converts a catalog, or the catalog a profile resolves to, to
+// a standard file
+func oscalImportData(doc *oscalDocument, source oscalCatalogSource, opts OSCALImportOptions) (StandardImportData, error) {
+	cat := doc.Catalog
+	if doc.Profile != nil {
+		var err error
+		if cat, err = resolveOSCALProfile(doc.Profile, source); err != nil {
+			return StandardImportData{}, err
+		}
+	}
+	return oscalStandardData(cat, opts), nil
+}
+
+// oscalHrefCode is the standard code a profile import names by its file,
+// e.g. "ISO-27001-2022" for "../ISO-27001-2022.json"
+func oscalHrefCode(href string) string {
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+	name := path.Base(href)
+	for _, ext := range []string{".json", ".xml"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// oscalStandardData converts a catalog to a standard file. Withdrawn controls
+// are left out.
+func oscalStandardData(cat *oscalCatalog, opts OSCALImportOptions) StandardImportData {
+	var data StandardImportData
+	meta := cat.Metadata
+	exported := oscalPropValue(meta.Props, oscalNamespace, "standard-code")
+
+	data.Standard.Code = strings.TrimSpace(opts.Code)
+	if data.Standard.Code == "" {
+		data.Standard.Code = exported
+	}
+	if data.Standard.Code == "" {
+		data.Standard.Code = oscalStandardCode(meta.Title, meta.Version)
+	}
+	data.Standard.Name = meta.Title
+	data.Standard.Version = meta.Version
+	data.Standard.Organization = oscalOrganization(meta)
+	data.Standard.Description = meta.Remarks
+	data.Standard.Lineage = oscalPropValue(meta.Props, oscalNamespace, "lineage")
+	data.Standard.Supersedes = oscalPropValue(meta.Props, oscalNamespace, "supersedes")
+	if len(meta.Published) >= 10 {
+		if published, err := time.Parse("2006-01-02", meta.Published[:10]); err == nil {
+			data.Standard.PublishedDate = published.Format("2006-01-02")
+		}
+	}
+	for _, link := range meta.Links {
+		if link.Rel == "homepage" {
+			data.Standard.WebsiteURL = link.Href
+			break
+		}
+	}
+
+	// A catalog this platform exported already carries library IDs
+	prefix := data.Standard.Code + "-"
+	if exported != "" {
+		prefix = ""
+	}
+	params := map[string]oscalParam{}
+	collectOSCALParams(cat, func(p oscalParam) { params[p.ID] = p })
+	render := func(text string) string { return renderOSCALParams(text, params) }
+	resources := map[string]string{}
+	if cat.BackMatter != nil {
+		for _, res := range cat.BackMatter.Resources {
+			resources["#"+res.UUID] = res.Title
+		}
+	}
+
+	var add func(controls []oscalControl, family string)
+	add = func(controls []oscalControl, family string) {
+		for _, c := range controls {
+			if !strings.EqualFold(oscalPropValue(c.Props, "", "status"), "withdrawn") {
+				data.Controls = append(data.Controls, oscalControlData(c, family, prefix, exported != "", render, resources))
+			}
+			add(c.Controls, family)
+		}
+	}
+	var addGroups func(groups []oscalGroup)
+	addGroups = func(groups []oscalGroup) {
+		for _, g := range groups {
+			add(g.Controls, g.Title)
+			addGroups(g.Groups)
+		}
+	}
+	add(cat.Controls, meta.Title)
+	addGroups(cat.Groups)
+	data.Standard.TotalControls = len(data.Controls)
+	return data
+}
+
+// oscalControlData converts one control. Controls of an exported catalog read
+// their description, section name and references back from the platform's
+// own parts and props; others list their links as references, naming
+// back-matter resources by title.
+func oscalControlData(c oscalControl, family, prefix string, exported bool, render func(string) string, resources map[string]string) StandardImportControl {
+	var out StandardImportControl
+	out.ControlID = prefix + c.ID
+	out.Name = c.Title
+	out.Family = family
+
+	statement := render(oscalPartText(oscalFindPart(c.Parts, "", "statement")))
+	guidance := render(oscalPartText(oscalFindPart(c.Parts, "", "guidance")))
+	label := oscalPropValue(c.Props, "", "label")
+
+	if exported {
+		if description := oscalFindPart(c.Parts, oscalNamespace, "description"); description != nil {
+			out.Description = description.Prose
+			out.Article.FullText = statement
+		} else {
+			out.Description = statement
+		}
+		out.Article.ArticleNumber = label
+		out.Article.SectionName = oscalPropValue(c.Props, oscalNamespace, "section-name")
+		out.Article.Guidance = guidance
+		if references := oscalFindPart(c.Parts, oscalNamespace, "external-references"); references != nil {
+			out.Article.ExternalReferences = references.Prose
+		}
+		return out
+	}
+
+	out.Description = statement
+	out.Article.FullText = statement
+	out.Article.ArticleNumber = label
+	if label == "" {
+		out.Article.ArticleNumber = c.ID
+	}
+	out.Article.SectionName = c.Title
+	out.Article.Guidance = guidance
+	var references []string
+	for _, link := range c.Links {
+		switch {
+		case link.Rel != "" && link.Rel != "reference":
+		case link.Text != "":
+			references = append(references, link.Text)
+		case resources[link.Href] != "":
+			references = append(references, resources[link.Href])
+		case !strings.HasPrefix(link.Href, "#"):
+			references = append(references, link.Href)
+		}
+	}
+	out.Article.ExternalReferences = strings.Join(references, "; ")
+	return out
+}
+
+// oscalStandardCode derives a standard code from a catalog title and version,
+// e.g. "NIST-SP-800-53-Rev-5"
+func oscalStandardCode(title, version string) string {
+	code := strings.Trim(oscalCodePattern.ReplaceAllString(title, "-"), "-")
+	if v := strings.Trim(oscalCodePattern.ReplaceAllString(version, "-"), "-"); v != "" && !strings.Contains(code, v) {
+		code += "-" + v
+	}
+	return code
+}
+
+// oscalOrganization names the party responsible for a document: the creator,
+// else the publisher, else the only party
+func oscalOrganization(meta oscalMetadata) string {
+	names := map[string]string{}
+	for _, p := range meta.Parties {
+		names[p.UUID] = p.Name
+	}
+	for _, role := range []string{"creator", "publisher"} {
+		for _, rp := range meta.ResponsibleParties {
+			if rp.RoleID != role {
+				continue
+			}
+			for _, id := range rp.PartyUUIDs {
+				if names[id] != "" {
+					return names[id]
+				}
+			}
+		}
+	}
+	if len(meta.Parties) == 1 {
+		return meta.Parties[0].Name
+	}
+	return ""
+}
+
+// oscalPropValue returns the value of a prop; ns "" is the NIST namespace
+func oscalPropValue(props []oscalProp, ns, name string) string {
+	for _, p := range props {
+		if p.Name == name && p.NS == ns {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// oscalFindPart returns the first part with a name, or nil
+func oscalFindPart(parts []oscalPart, ns, name string) *oscalPart {
+	for i := range parts {
+		if parts[i].Name == name && parts[i].NS == ns {
+			return &parts[i]
+		}
+	}
+	return nil
+}
+
+// oscalPartText flattens a part and its items, e.g. the lettered items of a
+// NIST statement, one line each with its label
+func oscalPartText(part *oscalPart) string {
+	if part == nil {
+		return ""
+	}
+	var lines []string
+	var walk func(p oscalPart, depth int)
+	walk = func(p oscalPart, depth int) {
+		text := strings.TrimSpace(p.Prose)
+		if label := oscalPropValue(p.Props, "", "label"); label != "" && depth > 0 {
+			text = strings.TrimSpace(label + " " + text)
+		}
+		if text != "" {
+			lines = append(lines, strings.Repeat("  ", max(depth-1, 0))+text)
+		}
+		for _, sub := range p.Parts {
+			walk(sub, depth+1)
+		}
+	}
+	walk(*part, 0)
+	return strings.Join(lines, "\n")
+}
+
+// collectOSCALParams calls fn for every parameter of a catalog
+func collectOSCALParams(cat *oscalCatalog, fn func(oscalParam)) {
+	var controls func([]oscalControl)
+	controls = func(cs []oscalControl) {
+		for _, c := range cs {
+			for _, p := range c.Params {
+				fn(p)
+			}
+			controls(c.Controls)
+		}
+	}
+	var groups func([]oscalGroup)
+	groups = func(gs []oscalGroup) {
+		for _, g := range gs {
+			for _, p := range g.Params {
+				fn(p)
+			}
+			controls(g.Controls)
+			groups(g.Groups)
+		}
+	}
+	for _, p := range cat.Params {
+		fn(p)
+	}
+	controls(cat.Controls)
+	groups(cat.Groups)
+}
+
+// renderOSCALParams replaces parameter insertions with their values, or with
+// the NIST "[Assignment: ...]" and "[Selection: ...]" placeholders
+func renderOSCALParams(text string, params map[string]oscalParam) string {
+	return oscalInsertPattern.ReplaceAllStringFunc(text, func(insert string) string {
+		id := oscalInsertPattern.FindStringSubmatch(insert)[1]
+		p, ok := params[id]
+		switch {
+		case !ok:
+			return "[Assignment: " + id + "]"
+		case len(p.Values) > 0:
+			return strings.Join(p.Values, ", ")
+		case p.Select != nil:
+			kind := "Selection"
+			if p.Select.HowMany == "one-or-more" {
+				kind = "Selection (one or more)"
+			}
+			return "[" + kind + ": " + strings.Join(p.Select.Choice, "; ") + "]"
+		case p.Label != "":
+			return "[Assignment: " + p.Label + "]"
+		}
+		return "[Assignment: " + id + "]"
+	})
+}
+
+// ========== PROFILES ==========
+
+// resolveOSCALProfile builds the catalog a profile selects: the chosen
+// controls of each import, in their groups, with the profile's parameter
+// values. The result carries the profile's metadata.
+func resolveOSCALProfile(profile *oscalProfile, source oscalCatalogSource) (*oscalCatalog, error) {
+	return resolveOSCALProfileDepth(profile, source, 0)
+}
+
+func resolveOSCALProfileDepth(profile *oscalProfile, source oscalCatalogSource, depth int) (*oscalCatalog, error) {
+	if depth >= oscalMaxProfileDepth {
+		return nil, fmt.Errorf("profiles are nested more than %d deep", oscalMaxProfileDepth)
+	}
+	if len(profile.Imports) == 0 {
+		return nil, fmt.Errorf("the profile has no imports")
+	}
+	resolved := &oscalCatalog{UUID: profile.UUID, Metadata: profile.Metadata}
+
+	for _, imp := range profile.Imports {
+		doc, err := loadOSCALImport(imp.Href, profile.BackMatter, source)
+		if err != nil {
+			return nil, fmt.Errorf("import %s: %w", imp.Href, err)
+		}
+		cat := doc.Catalog
+		if doc.Profile != nil {
+			if cat, err = resolveOSCALProfileDepth(doc.Profile, source, depth+1); err != nil {
+				return nil, fmt.Errorf("import %s: %w", imp.Href, err)
+			}
+		}
+		selected, err := selectOSCALControls(cat, imp)
+		if err != nil {
+			return nil, fmt.Errorf("import %s: %w", imp.Href, err)
+		}
+		controls, groups := pruneOSCALControls(cat.Controls, selected), pruneOSCALGroups(cat.Groups, selected)
+		if cat.idPrefix != "" {
+			// Back to the catalog's own IDs, which the profile's IDs are prefixed with
+			stripOSCALIDPrefix(controls, groups, cat.idPrefix)
+		}
+		resolved.Params = append(resolved.Params, cat.Params...)
+		resolved.Controls = append(resolved.Controls, controls...)
+		resolved.Groups = append(resolved.Groups, groups...)
+		if cat.BackMatter != nil {
+			if resolved.BackMatter == nil {
+				resolved.BackMatter = &oscalBackMatter{}
+			}
+			resolved.BackMatter.Resources = append(resolved.BackMatter.Resources, cat.BackMatter.Resources...)
+		}
+	}
+
+	if profile.Modify != nil && len(profile.Modify.SetParameters) > 0 {
+		set := map[string]oscalSetParameter{}
+		for _, sp := range profile.Modify.SetParameters {
+			set[sp.ParamID] = sp
+		}
+		setOSCALParams(resolved, set)
+	}
+	return resolved, nil
+}
+
+// loadOSCALImport loads the document an import refers to: a back-matter
+// resource ("#uuid"), embedded or linked, or whatever the source finds
+func loadOSCALImport(href string, backMatter *oscalBackMatter, source oscalCatalogSource) (*oscalDocument, error) {
+	if !strings.HasPrefix(href, "#") {
+		return source(href)
+	}
+	if backMatter != nil {
+		for _, res := range backMatter.Resources {
+			if res.UUID != strings.TrimPrefix(href, "#") {
+				continue
+			}
+			if res.Base64 != nil {
+				body, err := base64.StdEncoding.DecodeString(strings.TrimSpace(res.Base64.Value))
+				if err != nil {
+					return nil, fmt.Errorf("invalid base64 content: %w", err)
+				}
+				return parseOSCAL(body)
+			}
+			var lastErr error = fmt.Errorf("resource has no content")
+			for _, link := range res.Rlinks {
+				doc, err := source(link.Href)
+				if err == nil {
+					return doc, nil
+				}
+				lastErr = err
+			}
+			return nil, lastErr
+		}
+	}
+	return nil, fmt.Errorf("no back-matter resource %s", href)
+}
+
+// selectOSCALControls returns the IDs of the controls an import selects
+func selectOSCALControls(cat *oscalCatalog, imp oscalImport) (map[string]bool, error) {
+	if imp.IncludeAll == nil && len(imp.IncludeControls) == 0 {
+		return nil, fmt.Errorf("the import includes no controls")
+	}
+
+	// Every control with its enhancements, in document order
+	children := map[string][]string{}
+	var ids []string
+	var walk func(controls []oscalControl)
+	walk = func(controls []oscalControl) {
+		for _, c := range controls {
+			ids = append(ids, c.ID)
+			for _, child := range c.Controls {
+				children[c.ID] = append(children[c.ID], child.ID)
+			}
+			walk(c.Controls)
+		}
+	}
+	var walkGroups func(groups []oscalGroup)
+	walkGroups = func(groups []oscalGroup) {
+		for _, g := range groups {
+			walk(g.Controls)
+			walkGroups(g.Groups)
+		}
+	}
+	walk(cat.Controls)
+	walkGroups(cat.Groups)
+
+	shortID := func(id string) string {
+		if cat.idPrefix != "" && len(id) > len(cat.idPrefix) && strings.EqualFold(id[:len(cat.idPrefix)], cat.idPrefix) {
+			return id[len(cat.idPrefix):]
+		}
+		return id
+	}
+	if cat.idPrefix != "" {
+		// The library keeps no nesting; enhancements are named after their
+		// control, ac-2.1 for ac-2
+		byShort := map[string]string{}
+		for _, id := range ids {
+			byShort[strings.ToLower(shortID(id))] = id
+		}
+		for _, id := range ids {
+			short := strings.ToLower(shortID(id))
+			if dot := strings.LastIndex(short, "."); dot > 0 {
+				if parent, ok := byShort[short[:dot]]; ok {
+					children[parent] = append(children[parent], id)
+				}
+			}
+		}
+	}
+
+	matches := func(sel oscalControlSelector, id string) bool {
+		short := shortID(id)
+		for _, want := range sel.WithIDs {
+			if strings.EqualFold(want, id) || strings.EqualFold(want, short) {
+				return true
+			}
+		}
+		for _, m := range sel.Matching {
+			if ok, _ := path.Match(m.Pattern, short); ok {
+				return true
+			}
+			if ok, _ := path.Match(m.Pattern, id); ok {
+				return true
+			}
+		}
+		return false
+	}
+	apply := func(selectors []oscalControlSelector, set map[string]bool, value bool) {
+		for _, sel := range selectors {
+			var mark func(id string)
+			mark = func(id string) {
+				set[id] = value
+				if sel.WithChildControls == "yes" {
+					for _, child := range children[id] {
+						mark(child)
+					}
+				}
+			}
+			for _, id := range ids {
+				if matches(sel, id) {
+					mark(id)
+				}
+			}
+		}
+	}
+
+	selected := map[string]bool{}
+	if imp.IncludeAll != nil {
+		for _, id := range ids {
+			selected[id] = true
+		}
+	}
+	apply(imp.IncludeControls, selected, true)
+	apply(imp.ExcludeControls, selected, false)
+	for id, ok := range selected {
+		if !ok {
+			delete(selected, id)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("the import selects none of the catalog's controls")
+	}
+	return selected, nil
+}
+
+// pruneOSCALControls keeps the selected controls. The selected enhancements
+// of a control that is not selected take its place.
+func pruneOSCALControls(controls []oscalControl, selected map[string]bool) []oscalControl {
+	var out []oscalControl
+	for _, c := range controls {
+		kept := pruneOSCALControls(c.Controls, selected)
+		if selected[c.ID] {
+			c.Controls = kept
+			out = append(out, c)
+		} else {
+			out = append(out, kept...)
+		}
+	}
+	return out
+}
+
+// pruneOSCALGroups keeps the groups with selected controls
+func pruneOSCALGroups(groups []oscalGroup, selected map[string]bool) []oscalGroup {
+	var out []oscalGroup
+	for _, g := range groups {
+		g.Controls = pruneOSCALControls(g.Controls, selected)
+		g.Groups = pruneOSCALGroups(g.Groups, selected)
+		if len(g.Controls) > 0 || len(g.Groups) > 0 {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// stripOSCALIDPrefix removes the library prefix from control IDs
+func stripOSCALIDPrefix(controls []oscalControl, groups []oscalGroup, prefix string) {
+	for i := range controls {
+		if len(controls[i].ID) > len(prefix) && strings.EqualFold(controls[i].ID[:len(prefix)], prefix) {
+			controls[i].ID = controls[i].ID[len(prefix):]
+		}
+		stripOSCALIDPrefix(controls[i].Controls, nil, prefix)
+	}
+	for i := range groups {
+		stripOSCALIDPrefix(groups[i].Controls, groups[i].Groups, prefix)
+	}
+}
+
+// setOSCALParams applies a profile's set-parameters to a resolved catalog
+func setOSCALParams(cat *oscalCatalog, set map[string]oscalSetParameter) {
+	apply := func(params []oscalParam) {
+		for i := range params {
+			sp, ok := set[params[i].ID]
+			if !ok {
+				continue
+			}
+			if len(sp.Values) > 0 {
+				params[i].Values = sp.Values
+			}
+			if sp.Label != "" {
+				params[i].Label = sp.Label
+			}
+		}
+	}
+	var controls func([]oscalControl)
+	controls = func(cs []oscalControl) {
+		for i := range cs {
+			apply(cs[i].Params)
+			controls(cs[i].Controls)
+		}
+	}
+	var groups func([]oscalGroup)
+	groups = func(gs []oscalGroup) {
+		for i := range gs {
+			apply(gs[i].Params)
+			controls(gs[i].Controls)
+			groups(gs[i].Groups)
+		}
+	}
+	apply(cat.Params)
+	controls(cat.Controls)
+	groups(cat.Groups)
+}
+
+// ========== EXPORT ==========
+
+// buildOSCALCatalog exports a standard and its controls as an OSCAL catalog,
+// one group per family. supersedes is the code of the version it replaces.
+func buildOSCALCatalog(std *ControlStandard, supersedes string, controls []StandardImportControl) *oscalCatalog {
+	partyUUID := uuid.NewSHA1(oscalUUIDSpace, []byte("party:"+std.Organization)).String()
+	cat := &oscalCatalog{
+		UUID: uuid.NewSHA1(oscalUUIDSpace, []byte(std.Code+"@"+std.UpdatedAt.UTC().Format(time.RFC3339Nano))).String(),
+		Metadata: oscalMetadata{
+			Title:        std.Name,
+			LastModified: std.UpdatedAt.UTC().Format(time.RFC3339),
+			Version:      std.Version,
+			OSCALVersion: oscalVersion,
+			Props: []oscalProp{
+				{Name: "standard-code", NS: oscalNamespace, Value: std.Code},
+				{Name: "lineage", NS: oscalNamespace, Value: std.Lineage},
+			},
+			Roles:              []oscalRole{{ID: "creator", Title: "Document Creator"}},
+			Parties:            []oscalParty{{UUID: partyUUID, Type: "organization", Name: std.Organization}},
+			ResponsibleParties: []oscalResponsibleParty{{RoleID: "creator", PartyUUIDs: []string{partyUUID}}},
+			Remarks:            std.Description,
+		},
+		idPrefix: std.Code + "-",
+	}
+	if supersedes != "" {
+		cat.Metadata.Props = append(cat.Metadata.Props, oscalProp{Name: "supersedes", NS: oscalNamespace, Value: supersedes})
+	}
+	if std.PublishedDate != nil {
+		cat.Metadata.Published = std.PublishedDate.UTC().Format("2006-01-02") + "T00:00:00Z"
+	}
+	if std.WebsiteURL != "" {
+		cat.Metadata.Links = []oscalLink{{Href: std.WebsiteURL, Rel: "homepage"}}
+	}
+
+	groupIndex := map[string]int{}
+	for _, c := range controls {
+		i, ok := groupIndex[c.Family]
+		if !ok {
+			i = len(cat.Groups)
+			groupIndex[c.Family] = i
+			cat.Groups = append(cat.Groups, oscalGroup{ID: oscalToken(c.Family), Class: "family", Title: c.Family})
+		}
+		cat.Groups[i].Controls = append(cat.Groups[i].Controls, oscalExportControl(c))
+	}
+	return cat
+}
+
+// oscalExportControl exports one control. Without an article the description
+// is the statement.
+func oscalExportControl(c StandardImportControl) oscalControl {
+	out := oscalControl{ID: c.ControlID, Title: c.Name}
+	article := c.Article
+	if article.ArticleNumber != "" {
+		out.Props = append(out.Props, oscalProp{Name: "label", Value: article.ArticleNumber})
+	}
+	if article.SectionName != "" {
+		out.Props = append(out.Props, oscalProp{Name: "section-name", NS: oscalNamespace, Value: article.SectionName})
+	}
+
+	statement := c.Description
+	if article.FullText != "" {
+		statement = article.FullText
+	}
+	out.Parts = append(out.Parts, oscalPart{ID: c.ControlID + "_smt", Name: "statement", Prose: statement})
+	if article.FullText != "" {
+		out.Parts = append(out.Parts, oscalPart{ID: c.ControlID + "_desc", Name: "description", NS: oscalNamespace, Prose: c.Description})
+	}
+	if article.Guidance != "" {
+		out.Parts = append(out.Parts, oscalPart{ID: c.ControlID + "_gdn", Name: "guidance", Prose: article.Guidance})
+	}
+	if article.ExternalReferences != "" {
+		out.Parts = append(out.Parts, oscalPart{ID: c.ControlID + "_ref", Name: "external-references", NS: oscalNamespace, Prose: article.ExternalReferences})
+	}
+	return out
+}
+
+// oscalToken makes an OSCAL token (an XML NCName) of a name, e.g. a group ID
+// from a family
+func oscalToken(name string) string {
+	token := strings.Trim(oscalTokenPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if token == "" || !(token[0] == '_' || token[0] >= 'a' && token[0] <= 'z') {
+		token = "g-" + token
+	}
+	return token
+}
+
+// writeOSCALCatalog writes a catalog as "json" or "xml" and returns the
+// content type
+func writeOSCALCatalog(w io.Writer, cat *oscalCatalog, format string) (string, error) {
+	switch format {
+	case "", "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return "application/oscal.catalog+json", enc.Encode(oscalDocument{Catalog: cat})
+	case "xml":
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return "", err
+		}
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(oscalCatalogToXML(cat)); err != nil {
+			return "", err
+		}
+		_, err := io.WriteString(w, "\n")
+		return "application/oscal.catalog+xml", err
+	}
+	return "", fmt.Errorf("unsupported format %q", format)
+}
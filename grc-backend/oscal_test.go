@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// oscalExampleDir holds the example catalogs and profile shipped with the repository
+var oscalExampleDir = filepath.Join("..", "standards-data", "oscal")
+
+func readOSCALExample(t *testing.T, name string) *oscalDocument {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join(oscalExampleDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := parseOSCAL(body)
+	if err != nil {
+		t.Fatalf("parseOSCAL(%s): %v", name, err)
+	}
+	return doc
+}
+
+// oscalExampleSource resolves profile imports against the example directory
+func oscalExampleSource(href string) (*oscalDocument, error) {
+	body, err := os.ReadFile(filepath.Join(oscalExampleDir, filepath.FromSlash(href)))
+	if err != nil {
+		return nil, err
+	}
+	return parseOSCAL(body)
+}
+
+func controlsByID(controls []StandardImportControl) map[string]StandardImportControl {
+	byID := map[string]StandardImportControl{}
+	for _, c := range controls {
+		byID[c.ControlID] = c
+	}
+	return byID
+}
+
+func controlIDs(controls []StandardImportControl) string {
+	ids := make([]string, len(controls))
+	for i, c := range controls {
+		ids[i] = c.ControlID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestOSCALCatalogImport(t *testing.T) {
+	var imported []StandardImportData
+	for _, name := range []string{"example-catalog.json", "example-catalog.xml"} {
+		data, err := oscalImportData(readOSCALExample(t, name), nil, OSCALImportOptions{Code: "EXAMPLE"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		imported = append(imported, data)
+
+		// The withdrawn ac-2.2 is left out; enhancements follow their control
+		if got, want := controlIDs(data.Controls), "EXAMPLE-ac-1,EXAMPLE-ac-2,EXAMPLE-ac-2.1,EXAMPLE-ac-3,EXAMPLE-au-2,EXAMPLE-au-6"; got != want {
+			t.Errorf("%s: controls = %s, want %s", name, got, want)
+		}
+		if data.Standard.Code != "EXAMPLE" || data.Standard.Name != "Example Security Controls Catalog" ||
+			data.Standard.Organization != "Example Standards Body" || data.Standard.PublishedDate != "2024-01-15" ||
+			data.Standard.WebsiteURL != "https://pages.nist.gov/OSCAL/" || data.Standard.TotalControls != 6 {
+			t.Errorf("%s: standard = %+v", name, data.Standard)
+		}
+
+		controls := controlsByID(data.Controls)
+		ac1 := controls["EXAMPLE-ac-1"]
+		// Statement items keep their labels and unset parameters become placeholders
+		for _, want := range []string{
+			"a. Develop, document, and disseminate to [Assignment: organization-defined personnel or roles] a " +
+				"[Selection (one or more): organization-level; mission/business process-level; system-level] access control policy;",
+			"b. Review and update the access control policy and procedures [Assignment: organization-defined frequency].",
+		} {
+			if !strings.Contains(ac1.Description, want) {
+				t.Errorf("%s: ac-1 statement %q lacks %q", name, ac1.Description, want)
+			}
+		}
+		if ac1.Family != "Access Control" || ac1.Article.ArticleNumber != "AC-1" || !strings.HasPrefix(ac1.Article.Guidance, "The policy addresses") {
+			t.Errorf("%s: ac-1 = %+v", name, ac1)
+		}
+
+		ac2 := controls["EXAMPLE-ac-2"]
+		if !strings.Contains(ac2.Description, "inactive for [Assignment: organization-defined time period].") {
+			t.Errorf("%s: ac-2 statement = %q", name, ac2.Description)
+		}
+		if ac2.Article.ExternalReferences != "NIST SP 800-53 Rev. 5; NIST glossary: account management" {
+			t.Errorf("%s: ac-2 references = %q", name, ac2.Article.ExternalReferences)
+		}
+		if au6 := controls["EXAMPLE-au-6"]; au6.Family != "Audit and Accountability" || au6.Article.ArticleNumber != "AU-6" {
+			t.Errorf("%s: au-6 = %+v", name, au6)
+		}
+	}
+
+	if !reflect.DeepEqual(imported[0], imported[1]) {
+		t.Errorf("JSON and XML catalogs import differently:\n%+v\n%+v", imported[0], imported[1])
+	}
+}
+
+func TestOSCALCatalogRoundTrip(t *testing.T) {
+	for _, name := range []string{"example-catalog.json", "example-catalog.xml"} {
+		data, err := oscalImportData(readOSCALExample(t, name), nil, OSCALImportOptions{Code: "EXAMPLE"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		published := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+		std := &ControlStandard{
+			Code:          data.Standard.Code,
+			Name:          data.Standard.Name,
+			Version:       data.Standard.Version,
+			Organization:  data.Standard.Organization,
+			PublishedDate: &published,
+			Description:   data.Standard.Description,
+			WebsiteURL:    data.Standard.WebsiteURL,
+			Lineage:       data.Standard.Code,
+			UpdatedAt:     published,
+		}
+
+		for _, format := range []string{"json", "xml"} {
+			var buf bytes.Buffer
+			if _, err := writeOSCALCatalog(&buf, buildOSCALCatalog(std, "", data.Controls), format); err != nil {
+				t.Fatalf("%s as %s: %v", name, format, err)
+			}
+			doc, err := parseOSCAL(buf.Bytes())
+			if err != nil {
+				t.Fatalf("%s as %s: exported catalog does not parse: %v", name, format, err)
+			}
+
+			// The export carries library IDs and the platform's parts
+			exported := doc.Catalog
+			if len(exported.Groups) != 2 || exported.Groups[0].Title != "Access Control" || len(exported.Groups[0].Controls) != 4 {
+				t.Fatalf("%s as %s: groups = %+v", name, format, exported.Groups)
+			}
+			ac2 := exported.Groups[0].Controls[1]
+			if ac2.ID != "EXAMPLE-ac-2" || oscalPropValue(ac2.Props, "", "label") != "AC-2" {
+				t.Errorf("%s as %s: ac-2 = %+v", name, format, ac2)
+			}
+			for _, part := range []struct{ ns, name string }{{"", "statement"}, {"", "guidance"}, {oscalNamespace, "description"}, {oscalNamespace, "external-references"}} {
+				if oscalFindPart(ac2.Parts, part.ns, part.name) == nil {
+					t.Errorf("%s as %s: ac-2 has no %s part", name, format, part.name)
+				}
+			}
+
+			again, err := oscalImportData(doc, nil, OSCALImportOptions{})
+			if err != nil {
+				t.Fatalf("%s as %s: %v", name, format, err)
+			}
+			if again.Standard.Code != "EXAMPLE" || again.Standard.Lineage != "EXAMPLE" || again.Standard.PublishedDate != "2024-01-15" {
+				t.Errorf("%s as %s: standard = %+v", name, format, again.Standard)
+			}
+			if !reflect.DeepEqual(again.Controls, data.Controls) {
+				t.Errorf("%s as %s: controls changed in the round trip:\n got %+v\nwant %+v", name, format, again.Controls, data.Controls)
+			}
+		}
+	}
+}
+
+func TestOSCALProfileResolution(t *testing.T) {
+	data, err := oscalImportData(readOSCALExample(t, "example-profile.json"), oscalExampleSource, OSCALImportOptions{Code: "EXAMPLE-MOD"})
+	if err != nil {
+		t.Fatalf("resolving profile: %v", err)
+	}
+
+	// with-child-controls brings ac-2.1; the withdrawn ac-2.2 stays out
+	if got, want := controlIDs(data.Controls), "EXAMPLE-MOD-ac-2,EXAMPLE-MOD-ac-2.1,EXAMPLE-MOD-ac-3,EXAMPLE-MOD-au-6"; got != want {
+		t.Errorf("controls = %s, want %s", got, want)
+	}
+	if data.Standard.Name != "Example Moderate Baseline" {
+		t.Errorf("standard = %+v", data.Standard)
+	}
+
+	// The profile's parameter values replace the placeholders
+	controls := controlsByID(data.Controls)
+	for id, want := range map[string]string{
+		"EXAMPLE-MOD-ac-2":   "Disable accounts that have been inactive for 90 days.",
+		"EXAMPLE-MOD-ac-2.1": "Support the management of system accounts using the identity management system.",
+		"EXAMPLE-MOD-au-6":   "Review and analyze system audit records weekly for indications",
+	} {
+		if !strings.Contains(controls[id].Description, want) {
+			t.Errorf("%s statement = %q, want it to contain %q", id, controls[id].Description, want)
+		}
+	}
+	if families := controls["EXAMPLE-MOD-ac-3"].Family + "," + controls["EXAMPLE-MOD-au-6"].Family; families != "Access Control,Audit and Accountability" {
+		t.Errorf("families = %s", families)
+	}
+}
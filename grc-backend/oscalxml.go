@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OSCAL XML
+//
+// The XML format has the same model as JSON, but prose, titles and remarks are
+// markup (<p>, <ol>, <insert>) instead of markdown strings. Documents are
+// decoded into the structs below and converted to the JSON model; markup is
+// read as plain text with one line per block and parameter insertions kept in
+// the JSON form. Exports write each line of text as a paragraph.
+
+// oscalXMLMarkup is markup kept as raw XML
+type oscalXMLMarkup struct {
+	Inner string `xml:",innerxml"`
+}
+
+type oscalXMLCatalog struct {
+	XMLName    xml.Name            `xml:"catalog"`
+	XMLNS      string              `xml:"xmlns,attr,omitempty"`
+	UUID       string              `xml:"uuid,attr"`
+	Metadata   oscalXMLMetadata    `xml:"metadata"`
+	Params     []oscalXMLParam     `xml:"param"`
+	Controls   []oscalXMLControl   `xml:"control"`
+	Groups     []oscalXMLGroup     `xml:"group"`
+	BackMatter *oscalXMLBackMatter `xml:"back-matter"`
+}
+
+type oscalXMLMetadata struct {
+	Title              oscalXMLMarkup             `xml:"title"`
+	Published          string                     `xml:"published,omitempty"`
+	LastModified       string                     `xml:"last-modified"`
+	Version            string                     `xml:"version"`
+	OSCALVersion       string                     `xml:"oscal-version"`
+	Props              []oscalProp                `xml:"prop"`
+	Links              []oscalXMLLink             `xml:"link"`
+	Roles              []oscalXMLRole             `xml:"role"`
+	Parties            []oscalXMLParty            `xml:"party"`
+	ResponsibleParties []oscalXMLResponsibleParty `xml:"responsible-party"`
+	Remarks            *oscalXMLMarkup            `xml:"remarks"`
+}
+
+type oscalXMLLink struct {
+	Href string          `xml:"href,attr"`
+	Rel  string          `xml:"rel,attr,omitempty"`
+	Text *oscalXMLMarkup `xml:"text"`
+}
+
+type oscalXMLRole struct {
+	ID    string         `xml:"id,attr"`
+	Title oscalXMLMarkup `xml:"title"`
+}
+
+type oscalXMLParty struct {
+	UUID string `xml:"uuid,attr"`
+	Type string `xml:"type,attr"`
+	Name string `xml:"name,omitempty"`
+}
+
+type oscalXMLResponsibleParty struct {
+	RoleID     string   `xml:"role-id,attr"`
+	PartyUUIDs []string `xml:"party-uuid"`
+}
+
+type oscalXMLGroup struct {
+	ID       string            `xml:"id,attr,omitempty"`
+	Class    string            `xml:"class,attr,omitempty"`
+	Title    oscalXMLMarkup    `xml:"title"`
+	Params   []oscalXMLParam   `xml:"param"`
+	Props    []oscalProp       `xml:"prop"`
+	Parts    []oscalXMLPart    `xml:"part"`
+	Groups   []oscalXMLGroup   `xml:"group"`
+	Controls []oscalXMLControl `xml:"control"`
+}
+
+type oscalXMLControl struct {
+	ID       string            `xml:"id,attr"`
+	Class    string            `xml:"class,attr,omitempty"`
+	Title    oscalXMLMarkup    `xml:"title"`
+	Params   []oscalXMLParam   `xml:"param"`
+	Props    []oscalProp       `xml:"prop"`
+	Links    []oscalXMLLink    `xml:"link"`
+	Parts    []oscalXMLPart    `xml:"part"`
+	Controls []oscalXMLControl `xml:"control"`
+}
+
+type oscalXMLParam struct {
+	ID     string          `xml:"id,attr"`
+	Label  *oscalXMLMarkup `xml:"label"`
+	Values []string        `xml:"value"`
+	Select *struct {
+		HowMany string           `xml:"how-many,attr,omitempty"`
+		Choice  []oscalXMLMarkup `xml:"choice"`
+	} `xml:"select"`
+}
+
+// oscalXMLPart holds its prose as raw XML. Decoding captures all of its
+// content there, sub-parts included; encoding writes it between the props and
+// the sub-parts.
+type oscalXMLPart struct {
+	ID    string          `xml:"id,attr,omitempty"`
+	Name  string          `xml:"name,attr"`
+	NS    string          `xml:"ns,attr,omitempty"`
+	Class string          `xml:"class,attr,omitempty"`
+	Title *oscalXMLMarkup `xml:"title"`
+	Props []oscalProp     `xml:"prop"`
+	Prose string          `xml:",innerxml"`
+	Parts []oscalXMLPart  `xml:"part"`
+}
+
+type oscalXMLBackMatter struct {
+	Resources []struct {
+		UUID   string          `xml:"uuid,attr"`
+		Title  *oscalXMLMarkup `xml:"title"`
+		Rlinks []struct {
+			Href      string `xml:"href,attr"`
+			MediaType string `xml:"media-type,attr,omitempty"`
+		} `xml:"rlink"`
+		Base64 *struct {
+			Filename  string `xml:"filename,attr,omitempty"`
+			MediaType string `xml:"media-type,attr,omitempty"`
+			Value     string `xml:",chardata"`
+		} `xml:"base64"`
+	} `xml:"resource"`
+}
+
+type oscalXMLProfile struct {
+	XMLName  xml.Name         `xml:"profile"`
+	UUID     string           `xml:"uuid,attr"`
+	Metadata oscalXMLMetadata `xml:"metadata"`
+	Imports  []struct {
+		Href            string             `xml:"href,attr"`
+		IncludeAll      *struct{}          `xml:"include-all"`
+		IncludeControls []oscalXMLSelector `xml:"include-controls"`
+		ExcludeControls []oscalXMLSelector `xml:"exclude-controls"`
+	} `xml:"import"`
+	Modify *struct {
+		SetParameters []struct {
+			ParamID string          `xml:"param-id,attr"`
+			Label   *oscalXMLMarkup `xml:"label"`
+			Values  []string        `xml:"value"`
+		} `xml:"set-parameter"`
+	} `xml:"modify"`
+	BackMatter *oscalXMLBackMatter `xml:"back-matter"`
+}
+
+type oscalXMLSelector struct {
+	WithChildControls string   `xml:"with-child-controls,attr,omitempty"`
+	WithIDs           []string `xml:"with-id"`
+	Matching          []struct {
+		Pattern string `xml:"pattern,attr"`
+	} `xml:"matching"`
+}
+
+// parseOSCALXML decodes an XML catalog or profile into the JSON model
+func parseOSCALXML(body []byte) (*oscalDocument, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("invalid XML: no root element")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "catalog":
+			var x oscalXMLCatalog
+			if err := dec.DecodeElement(&x, &start); err != nil {
+				return nil, fmt.Errorf("invalid XML: %w", err)
+			}
+			return &oscalDocument{Catalog: x.model()}, nil
+		case "profile":
+			var x oscalXMLProfile
+			if err := dec.DecodeElement(&x, &start); err != nil {
+				return nil, fmt.Errorf("invalid XML: %w", err)
+			}
+			return &oscalDocument{Profile: x.model()}, nil
+		}
+		return nil, fmt.Errorf("the document is neither an OSCAL catalog nor a profile (root element %s)", start.Name.Local)
+	}
+}
+
+// oscalMarkupText reads markup as plain text, one line per block element.
+// Parameter insertions become "{{ insert: param, id }}" and the elements of a
+// part that are not prose (sub-parts, props, title, links) are left out.
+func oscalMarkupText(markup string) string {
+	dec := xml.NewDecoder(strings.NewReader("<markup>" + markup + "</markup>"))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	var lines []string
+	var line strings.Builder
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "part", "prop", "title", "link":
+				dec.Skip()
+			case "insert":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "id-ref" {
+						line.WriteString("{{ insert: param, " + attr.Value + " }}")
+					}
+				}
+				dec.Skip()
+			case "br":
+				flush()
+			default:
+				if oscalBlockElement(t.Name.Local) {
+					flush()
+				}
+			}
+		case xml.EndElement:
+			if oscalBlockElement(t.Name.Local) {
+				flush()
+			}
+		case xml.CharData:
+			line.Write(t)
+		}
+	}
+	flush()
+	return strings.Join(lines, "\n")
+}
+
+// oscalBlockElement reports whether a markup element starts a new line
+func oscalBlockElement(name string) bool {
+	switch name {
+	case "p", "li", "ol", "ul", "pre", "blockquote", "table", "tr", "h1", "h2", "h3", "h4", "h5", "h6":
+		return true
+	}
+	return false
+}
+
+// oscalXMLProse writes text as markup, one paragraph per line
+func oscalXMLProse(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		xml.EscapeText(&b, []byte(line))
+		b.WriteString("</p>")
+	}
+	return b.String()
+}
+
+// oscalXMLText writes text as single-line markup, e.g. a title
+func oscalXMLText(text string) oscalXMLMarkup {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return oscalXMLMarkup{Inner: b.String()}
+}
+
+func (m *oscalXMLMarkup) text() string {
+	if m == nil {
+		return ""
+	}
+	return oscalMarkupText(m.Inner)
+}
+
+// ========== XML TO MODEL ==========
+
+func (x *oscalXMLCatalog) model() *oscalCatalog {
+	cat := &oscalCatalog{UUID: x.UUID, Metadata: x.Metadata.model(), BackMatter: x.BackMatter.model()}
+	for _, p := range x.Params {
+		cat.Params = append(cat.Params, p.model())
+	}
+	for _, c := range x.Controls {
+		cat.Controls = append(cat.Controls, c.model())
+	}
+	for _, g := range x.Groups {
+		cat.Groups = append(cat.Groups, g.model())
+	}
+	return cat
+}
+
+func (x *oscalXMLMetadata) model() oscalMetadata {
+	meta := oscalMetadata{
+		Title:        x.Title.text(),
+		Published:    strings.TrimSpace(x.Published),
+		LastModified: strings.TrimSpace(x.LastModified),
+		Version:      strings.TrimSpace(x.Version),
+		OSCALVersion: strings.TrimSpace(x.OSCALVersion),
+		Props:        x.Props,
+		Remarks:      x.Remarks.text(),
+	}
+	for _, l := range x.Links {
+		meta.Links = append(meta.Links, l.model())
+	}
+	for _, r := range x.Roles {
+		meta.Roles = append(meta.Roles, oscalRole{ID: r.ID, Title: r.Title.text()})
+	}
+	for _, p := range x.Parties {
+		meta.Parties = append(meta.Parties, oscalParty{UUID: p.UUID, Type: p.Type, Name: strings.TrimSpace(p.Name)})
+	}
+	for _, rp := range x.ResponsibleParties {
+		party := oscalResponsibleParty{RoleID: rp.RoleID}
+		for _, id := range rp.PartyUUIDs {
+			party.PartyUUIDs = append(party.PartyUUIDs, strings.TrimSpace(id))
+		}
+		meta.ResponsibleParties = append(meta.ResponsibleParties, party)
+	}
+	return meta
+}
+
+func (x oscalXMLLink) model() oscalLink {
+	return oscalLink{Href: x.Href, Rel: x.Rel, Text: x.Text.text()}
+}
+
+func (x oscalXMLGroup) model() oscalGroup {
+	g := oscalGroup{ID: x.ID, Class: x.Class, Title: x.Title.text(), Props: x.Props}
+	for _, p := range x.Params {
+		g.Params = append(g.Params, p.model())
+	}
+	for _, p := range x.Parts {
+		g.Parts = append(g.Parts, p.model())
+	}
+	for _, sub := range x.Groups {
+		g.Groups = append(g.Groups, sub.model())
+	}
+	for _, c := range x.Controls {
+		g.Controls = append(g.Controls, c.model())
+	}
+	return g
+}
+
+func (x oscalXMLControl) model() oscalControl {
+	c := oscalControl{ID: x.ID, Class: x.Class, Title: x.Title.text(), Props: x.Props}
+	for _, p := range x.Params {
+		c.Params = append(c.Params, p.model())
+	}
+	for _, l := range x.Links {
+		c.Links = append(c.Links, l.model())
+	}
+	for _, p := range x.Parts {
+		c.Parts = append(c.Parts, p.model())
+	}
+	for _, sub := range x.Controls {
+		c.Controls = append(c.Controls, sub.model())
+	}
+	return c
+}
+
+func (x oscalXMLParam) model() oscalParam {
+	p := oscalParam{ID: x.ID, Label: x.Label.text()}
+	for _, v := range x.Values {
+		p.Values = append(p.Values, strings.TrimSpace(v))
+	}
+	if x.Select != nil {
+		p.Select = &oscalSelect{HowMany: x.Select.HowMany}
+		for _, choice := range x.Select.Choice {
+			p.Select.Choice = append(p.Select.Choice, choice.text())
+		}
+	}
+	return p
+}
+
+func (x oscalXMLPart) model() oscalPart {
+	p := oscalPart{ID: x.ID, Name: x.Name, NS: x.NS, Class: x.Class, Title: x.Title.text(), Props: x.Props, Prose: oscalMarkupText(x.Prose)}
+	for _, sub := range x.Parts {
+		p.Parts = append(p.Parts, sub.model())
+	}
+	return p
+}
+
+func (x *oscalXMLBackMatter) model() *oscalBackMatter {
+	if x == nil {
+		return nil
+	}
+	bm := &oscalBackMatter{}
+	for _, r := range x.Resources {
+		res := oscalResource{UUID: r.UUID, Title: r.Title.text()}
+		for _, l := range r.Rlinks {
+			res.Rlinks = append(res.Rlinks, oscalRlink{Href: l.Href, MediaType: l.MediaType})
+		}
+		if r.Base64 != nil {
+			res.Base64 = &oscalBase64{Filename: r.Base64.Filename, MediaType: r.Base64.MediaType, Value: r.Base64.Value}
+		}
+		bm.Resources = append(bm.Resources, res)
+	}
+	return bm
+}
+
+func (x *oscalXMLProfile) model() *oscalProfile {
+	profile := &oscalProfile{UUID: x.UUID, Metadata: x.Metadata.model(), BackMatter: x.BackMatter.model()}
+	selectors := func(xs []oscalXMLSelector) []oscalControlSelector {
+		var out []oscalControlSelector
+		for _, s := range xs {
+			sel := oscalControlSelector{WithChildControls: s.WithChildControls}
+			for _, id := range s.WithIDs {
+				sel.WithIDs = append(sel.WithIDs, strings.TrimSpace(id))
+			}
+			for _, m := range s.Matching {
+				sel.Matching = append(sel.Matching, struct {
+					Pattern string `json:"pattern"`
+				}{m.Pattern})
+			}
+			out = append(out, sel)
+		}
+		return out
+	}
+	for _, imp := range x.Imports {
+		profile.Imports = append(profile.Imports, oscalImport{
+			Href:            imp.Href,
+			IncludeAll:      imp.IncludeAll,
+			IncludeControls: selectors(imp.IncludeControls),
+			ExcludeControls: selectors(imp.ExcludeControls),
+		})
+	}
+	if x.Modify != nil {
+		profile.Modify = &oscalModify{}
+		for _, sp := range x.Modify.SetParameters {
+			set := oscalSetParameter{ParamID: sp.ParamID, Label: sp.Label.text()}
+			for _, v := range sp.Values {
+				set.Values = append(set.Values, strings.TrimSpace(v))
+			}
+			profile.Modify.SetParameters = append(profile.Modify.SetParameters, set)
+		}
+	}
+	return profile
+}
+
+// ========== MODEL TO XML ==========
+
+// oscalCatalogToXML converts an exported catalog for writing as XML. Exports
+// only use groups, controls, props, parts and links.
+func oscalCatalogToXML(cat *oscalCatalog) *oscalXMLCatalog {
+	meta := cat.Metadata
+	x := &oscalXMLCatalog{
+		XMLNS: oscalXMLNS,
+		UUID:  cat.UUID,
+		Metadata: oscalXMLMetadata{
+			Title:        oscalXMLText(meta.Title),
+			Published:    meta.Published,
+			LastModified: meta.LastModified,
+			Version:      meta.Version,
+			OSCALVersion: meta.OSCALVersion,
+			Props:        meta.Props,
+		},
+	}
+	for _, l := range meta.Links {
+		link := oscalXMLLink{Href: l.Href, Rel: l.Rel}
+		if l.Text != "" {
+			text := oscalXMLText(l.Text)
+			link.Text = &text
+		}
+		x.Metadata.Links = append(x.Metadata.Links, link)
+	}
+	for _, r := range meta.Roles {
+		x.Metadata.Roles = append(x.Metadata.Roles, oscalXMLRole{ID: r.ID, Title: oscalXMLText(r.Title)})
+	}
+	for _, p := range meta.Parties {
+		x.Metadata.Parties = append(x.Metadata.Parties, oscalXMLParty{UUID: p.UUID, Type: p.Type, Name: p.Name})
+	}
+	for _, rp := range meta.ResponsibleParties {
+		x.Metadata.ResponsibleParties = append(x.Metadata.ResponsibleParties, oscalXMLResponsibleParty{RoleID: rp.RoleID, PartyUUIDs: rp.PartyUUIDs})
+	}
+	if meta.Remarks != "" {
+		x.Metadata.Remarks = &oscalXMLMarkup{Inner: oscalXMLProse(meta.Remarks)}
+	}
+
+	var control func(c oscalControl) oscalXMLControl
+	control = func(c oscalControl) oscalXMLControl {
+		out := oscalXMLControl{ID: c.ID, Class: c.Class, Title: oscalXMLText(c.Title), Props: c.Props}
+		for _, p := range c.Parts {
+			out.Parts = append(out.Parts, oscalPartToXML(p))
+		}
+		for _, sub := range c.Controls {
+			out.Controls = append(out.Controls, control(sub))
+		}
+		return out
+	}
+	for _, c := range cat.Controls {
+		x.Controls = append(x.Controls, control(c))
+	}
+	for _, g := range cat.Groups {
+		group := oscalXMLGroup{ID: g.ID, Class: g.Class, Title: oscalXMLText(g.Title), Props: g.Props}
+		for _, c := range g.Controls {
+			group.Controls = append(group.Controls, control(c))
+		}
+		x.Groups = append(x.Groups, group)
+	}
+	return x
+}
+
+func oscalPartToXML(p oscalPart) oscalXMLPart {
+	out := oscalXMLPart{ID: p.ID, Name: p.Name, NS: p.NS, Class: p.Class, Props: p.Props, Prose: oscalXMLProse(p.Prose)}
+	if p.Title != "" {
+		title := oscalXMLText(p.Title)
+		out.Title = &title
+	}
+	for _, sub := range p.Parts {
+		out.Parts = append(out.Parts, oscalPartToXML(sub))
+	}
+	return out
+}
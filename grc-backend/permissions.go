@@ -0,0 +1,437 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Permission is a resource/action pair such as "risks:write"
+type Permission string
+
+const (
+	PermDashboardRead   Permission = "dashboard:read"
+	PermControlsRead    Permission = "controls:read"
+	PermControlsManage  Permission = "controls:manage"
+	PermEvidenceRead    Permission = "evidence:read"
+	PermEvidenceReadAll Permission = "evidence:read_all"
+	PermEvidenceSubmit  Permission = "evidence:submit"
+	PermEvidenceDelete  Permission = "evidence:delete"
+	PermAssetsRead      Permission = "assets:read"
+	PermAssetsWrite     Permission = "assets:write"
+	PermDocumentsRead   Permission = "documents:read"
+	PermDocumentsWrite  Permission = "documents:write"
+	PermRisksRead       Permission = "risks:read"
+	PermRisksWrite      Permission = "risks:write"
+	PermVendorsRead     Permission = "vendors:read"
+	PermVendorsWrite    Permission = "vendors:write"
+	PermGDPRRead        Permission = "gdpr:read"
+	PermGDPRWrite       Permission = "gdpr:write"
+	PermTicketsCreate   Permission = "tickets:create"
+	PermTicketsReadAll  Permission = "tickets:read_all"
+	PermTicketsManage   Permission = "tickets:manage"
+	PermReportsGenerate Permission = "reports:generate"
+	PermAuditRead       Permission = "audit:read"
+	PermUsersManage     Permission = "users:manage"
+	PermSettingsManage  Permission = "settings:manage"
+
+	// PermAuthenticated marks routes open to any signed-in user (own profile, notifications, sessions)
+	PermAuthenticated Permission = "authenticated"
+	// PermSuperAdmin marks cross-organization platform tooling. No role grants it;
+	// it comes from the user's is_super_admin flag.
+	PermSuperAdmin Permission = "platform:super_admin"
+)
+
+// allPermissions lists every grantable permission
+var allPermissions = []Permission{
+	PermDashboardRead, PermControlsRead, PermControlsManage,
+	PermEvidenceRead, PermEvidenceReadAll, PermEvidenceSubmit, PermEvidenceDelete,
+	PermAssetsRead, PermAssetsWrite, PermDocumentsRead, PermDocumentsWrite,
+	PermRisksRead, PermRisksWrite, PermVendorsRead, PermVendorsWrite,
+	PermGDPRRead, PermGDPRWrite,
+	PermTicketsCreate, PermTicketsReadAll, PermTicketsManage,
+	PermReportsGenerate, PermAuditRead, PermUsersManage, PermSettingsManage,
+}
+
+// RoleDefinition describes a built-in role and the permissions it grants
+type RoleDefinition struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// roleDefinitions are the built-in roles, in display order
+var roleDefinitions = []RoleDefinition{
+	{
+		Name:        "admin",
+		Description: "Full access, including user management and platform settings",
+		Permissions: allPermissions,
+	},
+	{
+		Name:        "compliance_manager",
+		Description: "Runs the compliance programme across all modules; cannot manage users or settings",
+		Permissions: []Permission{
+			PermDashboardRead, PermControlsRead, PermControlsManage,
+			PermEvidenceRead, PermEvidenceReadAll, PermEvidenceSubmit, PermEvidenceDelete,
+			PermAssetsRead, PermAssetsWrite, PermDocumentsRead, PermDocumentsWrite,
+			PermRisksRead, PermRisksWrite, PermVendorsRead, PermVendorsWrite,
+			PermGDPRRead, PermGDPRWrite,
+			PermTicketsCreate, PermTicketsReadAll, PermTicketsManage,
+			PermReportsGenerate, PermAuditRead,
+		},
+	},
+	{
+		Name:        "control_owner",
+		Description: "Reviews controls and submits evidence",
+		Permissions: []Permission{
+			PermDashboardRead, PermControlsRead, PermEvidenceRead, PermEvidenceSubmit,
+			PermAssetsRead, PermDocumentsRead, PermRisksRead, PermTicketsCreate,
+		},
+	},
+	{
+		Name:        "auditor",
+		Description: "Read-only access to everything, including audit logs",
+		Permissions: []Permission{
+			PermDashboardRead, PermControlsRead, PermEvidenceRead, PermEvidenceReadAll,
+			PermAssetsRead, PermDocumentsRead, PermRisksRead, PermVendorsRead, PermGDPRRead,
+			PermTicketsReadAll, PermReportsGenerate, PermAuditRead,
+		},
+	},
+	{
+		Name:        "dpo",
+		Description: "Data protection officer; GDPR module only",
+		Permissions: []Permission{PermGDPRRead, PermGDPRWrite},
+	},
+	{
+		Name:        "vendor_manager",
+		Description: "Manages vendors, their assessments and control mappings",
+		Permissions: []Permission{PermControlsRead, PermVendorsRead, PermVendorsWrite},
+	},
+	{
+		Name:        "user",
+		Description: "General contributor (default for new accounts)",
+		Permissions: []Permission{
+			PermDashboardRead, PermControlsRead, PermEvidenceRead, PermEvidenceSubmit,
+			PermAssetsRead, PermAssetsWrite, PermDocumentsRead, PermRisksRead,
+			PermVendorsRead, PermGDPRRead, PermTicketsCreate, PermReportsGenerate,
+		},
+	},
+}
+
+// rolePermissions indexes roleDefinitions for lookups
+var rolePermissions = func() map[string]map[Permission]bool {
+	index := make(map[string]map[Permission]bool, len(roleDefinitions))
+	for _, role := range roleDefinitions {
+		set := make(map[Permission]bool, len(role.Permissions))
+		for _, p := range role.Permissions {
+			set[p] = true
+		}
+		index[role.Name] = set
+	}
+	return index
+}()
+
+// IsValidRole reports whether role is a built-in role
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants permission
+func HasPermission(role string, permission Permission) bool {
+	if permission == PermAuthenticated {
+		return IsValidRole(role)
+	}
+	return rolePermissions[role][permission]
+}
+
+// PermissionsForRole returns the sorted permissions granted by role
+func PermissionsForRole(role string) []Permission {
+	perms := make([]Permission, 0, len(rolePermissions[role]))
+	for p := range rolePermissions[role] {
+		perms = append(perms, p)
+	}
+	sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+	return perms
+}
+
+// RolesWithPermission returns the built-in roles that grant permission
+func RolesWithPermission(permission Permission) []string {
+	var roles []string
+	for _, role := range roleDefinitions {
+		if HasPermission(role.Name, permission) {
+			roles = append(roles, role.Name)
+		}
+	}
+	return roles
+}
+
+// canSubmitEvidence reports whether the caller may record evidence for a control:
+// its owner, a delegate, or someone who manages controls
+func canSubmitEvidence(role string, access *EvidenceAccess) bool {
+	return access.IsOwner || access.IsDelegate || HasPermission(role, PermControlsManage)
+}
+
+// canReadEvidence reports whether the caller may list or download a control's evidence files
+func canReadEvidence(role string, access *EvidenceAccess) bool {
+	return canSubmitEvidence(role, access) || access.IsPerformer || HasPermission(role, PermEvidenceReadAll)
+}
+
+// routePermissions is the authorization policy for every authenticated route,
+// keyed by "METHOD /path-template" relative to /api/v1. Routes missing from this
+// table are denied.
+var routePermissions = map[string]Permission{
+	// Account
+	"PUT /users/profile":              PermAuthenticated,
+	"GET /users/permissions":          PermAuthenticated,
+	"POST /auth/logout":               PermAuthenticated,
+	"POST /auth/logout-all":           PermAuthenticated,
+	"GET /users/sessions":             PermAuthenticated,
+	"DELETE /users/sessions/{id}":     PermAuthenticated,
+	"GET /users/mfa":                  PermAuthenticated,
+	"POST /users/mfa/enroll":          PermAuthenticated,
+	"POST /users/mfa/confirm":         PermAuthenticated,
+	"POST /users/mfa/recovery-codes":  PermAuthenticated,
+	"POST /users/mfa/disable":         PermAuthenticated,
+	"GET /notifications":              PermAuthenticated,
+	"POST /notifications/{id}/read":   PermAuthenticated,
+	"POST /versions/{id}/acknowledge": PermAuthenticated,
+	"GET /dashboard/summary":          PermDashboardRead,
+
+	// User and platform administration
+	"GET /users":                  PermUsersManage,
+	"GET /roles":                  PermUsersManage,
+	"PUT /users/{id}/role":        PermUsersManage,
+	"POST /users/invite":          PermUsersManage,
+	"DELETE /users/{id}/mfa":      PermUsersManage,
+	"DELETE /users/{id}/sessions": PermUsersManage,
+	"POST /users/{id}/unlock":     PermUsersManage,
+	"GET /security/mfa-policy":    PermSettingsManage,
+	"PUT /security/mfa-policy":    PermSettingsManage,
+	"GET /audit/logs":             PermAuditRead,
+
+	// Audit log export and per-entity history
+	"GET /audit/logs/export":                      PermAuditRead,
+	"GET /audit/entities/{entityType}/{entityID}": PermAuditRead,
+
+	// Audit chain verification and signed checkpoints
+	"GET /audit/verify":       PermAuditRead,
+	"GET /audit/checkpoints":  PermAuditRead,
+	"GET /audit/signing-keys": PermAuditRead,
+
+	// Cross-standard control mappings. Mappings are shared by every organization,
+	// so only super-admins change them.
+	"GET /controls/mappings":         PermControlsRead,
+	"POST /controls/mappings":        PermSuperAdmin,
+	"POST /controls/mappings/import": PermSuperAdmin,
+	"DELETE /controls/mappings/{id}": PermSuperAdmin,
+	"GET /controls/coverage":         PermControlsRead,
+
+	// Migrating activated controls to a new version of a standard
+	"GET /standards/{id}/migration":  PermControlsRead,
+	"POST /standards/{id}/migration": PermControlsManage,
+
+	// OSCAL catalog and profile import, catalog export
+	"POST /standards/import/oscal": PermSuperAdmin,
+	"GET /standards/{id}/oscal":    PermControlsRead,
+
+	// Reminder and escalation policy for due controls
+	"GET /settings/reminder-policy": PermControlsRead,
+	"PUT /settings/reminder-policy": PermSettingsManage,
+
+	// Organizations. /platform routes work across every tenant.
+	"GET /organization":                      PermAuthenticated,
+	"GET /platform/organizations":            PermSuperAdmin,
+	"POST /platform/organizations":           PermSuperAdmin,
+	"GET /platform/organizations/{id}":       PermSuperAdmin,
+	"PUT /platform/organizations/{id}":       PermSuperAdmin,
+	"GET /platform/organizations/{id}/users": PermSuperAdmin,
+	"PUT /platform/users/{id}/organization":  PermSuperAdmin,
+	"GET /platform/blocked-ips":              PermSuperAdmin,
+	"DELETE /platform/blocked-ips/{ip}":      PermSuperAdmin,
+
+	// SIEM forwarding of every tenant's audit log
+	"GET /platform/audit-forwarding": PermSuperAdmin,
+
+	// Scheduled jobs run across every tenant
+	"GET /platform/jobs":             PermSuperAdmin,
+	"GET /platform/jobs/{name}/runs": PermSuperAdmin,
+	"POST /platform/jobs/{name}/run": PermSuperAdmin,
+
+	// Integration API keys
+	"GET /api-keys":         PermSettingsManage,
+	"POST /api-keys":        PermSettingsManage,
+	"GET /api-keys/{id}":    PermSettingsManage,
+	"PUT /api-keys/{id}":    PermSettingsManage,
+	"DELETE /api-keys/{id}": PermSettingsManage,
+
+	// Outbound webhooks and their delivery log
+	"GET /webhooks":                         PermSettingsManage,
+	"POST /webhooks":                        PermSettingsManage,
+	"GET /webhooks/{id}":                    PermSettingsManage,
+	"PUT /webhooks/{id}":                    PermSettingsManage,
+	"DELETE /webhooks/{id}":                 PermSettingsManage,
+	"POST /webhooks/{id}/rotate-secret":     PermSettingsManage,
+	"POST /webhooks/{id}/test":              PermSettingsManage,
+	"GET /webhooks/{id}/deliveries":         PermSettingsManage,
+	"POST /webhooks/deliveries/{id}/replay": PermSettingsManage,
+
+	// SCIM group-to-role mappings and control handover after offboarding
+	"GET /scim/groups":                   PermUsersManage,
+	"PUT /scim/groups/{id}/role":         PermUsersManage,
+	"POST /users/{id}/reassign-controls": PermControlsManage,
+
+	// Controls, standards and templates. The control library and standards are
+	// shared by every organization, so only super-admins change them.
+	"GET /controls/library":                  PermControlsRead,
+	"GET /controls/library/export":           PermControlsRead,
+	"POST /controls/library":                 PermSuperAdmin,
+	"POST /controls/library/import":          PermSuperAdmin,
+	"PUT /controls/library/{id}":             PermSuperAdmin,
+	"DELETE /controls/library/{id}":          PermSuperAdmin,
+	"GET /controls/activated":                PermControlsRead,
+	"POST /controls/activated":               PermControlsManage,
+	"GET /controls/activated/{id}":           PermControlsRead,
+	"PUT /controls/activated/{id}":           PermControlsManage,
+	"DELETE /controls/activated/{id}":        PermControlsManage,
+	"POST /controls/activated/{id}/evidence": PermEvidenceSubmit,
+	"GET /controls/{id}/article":             PermControlsRead,
+	"GET /standards":                         PermControlsRead,
+	"GET /standards/{id}":                    PermControlsRead,
+	"GET /standards/{id}/controls":           PermControlsRead,
+	"POST /standards/import":                 PermSuperAdmin,
+	"GET /templates":                         PermControlsRead,
+	"GET /templates/{id}":                    PermControlsRead,
+	"POST /templates/{id}/activate":          PermControlsManage,
+
+	// Reminder stages sent for a control (object-level check in the handler)
+	"GET /controls/activated/{id}/reminders": PermControlsRead,
+
+	// Control delegates (object-level checks in the handlers)
+	"GET /controls/activated/{id}/delegates":              PermControlsRead,
+	"POST /controls/activated/{id}/delegates":             PermEvidenceSubmit,
+	"DELETE /controls/activated/{id}/delegates/{user_id}": PermEvidenceSubmit,
+
+	// Evidence files (object-level checks in canReadEvidence / canSubmitEvidence)
+	"GET /evidence/{evidence_id}/files":      PermEvidenceRead,
+	"POST /evidence/{evidence_id}/files":     PermEvidenceSubmit,
+	"GET /evidence/files/{file_id}/download": PermEvidenceRead,
+	"DELETE /evidence/files/{file_id}":       PermEvidenceDelete,
+
+	// Tickets (non-managers only see tickets they created or are assigned to)
+	"POST /tickets/internal":      PermTicketsCreate,
+	"GET /tickets":                PermAuthenticated,
+	"GET /tickets/{id}":           PermAuthenticated,
+	"POST /tickets/{id}/comments": PermTicketsCreate,
+	"PUT /tickets/{id}":           PermTicketsManage,
+
+	// Assets
+	"GET /assets":                       PermAssetsRead,
+	"POST /assets":                      PermAssetsWrite,
+	"GET /assets/{id}":                  PermAssetsRead,
+	"PUT /assets/{id}":                  PermAssetsWrite,
+	"DELETE /assets/{id}":               PermAssetsWrite,
+	"GET /assets/{id}/controls":         PermAssetsRead,
+	"POST /mappings/asset-to-control":   PermAssetsWrite,
+	"DELETE /mappings/asset-to-control": PermAssetsWrite,
+
+	// Documents
+	"GET /documents":                PermDocumentsRead,
+	"GET /documents/{id}":           PermDocumentsRead,
+	"POST /documents":               PermDocumentsWrite,
+	"POST /documents/{id}/versions": PermDocumentsWrite,
+	"PUT /documents/{doc_id}/versions/{version_id}/publish": PermDocumentsWrite,
+	"POST /mappings/document-to-control":                    PermDocumentsWrite,
+	"DELETE /mappings/document-to-control":                  PermDocumentsWrite,
+
+	// Risks
+	"GET /risks":                       PermRisksRead,
+	"GET /risks/{id}":                  PermRisksRead,
+	"GET /risks/{id}/controls":         PermRisksRead,
+	"POST /risks":                      PermRisksWrite,
+	"PUT /risks/{id}":                  PermRisksWrite,
+	"DELETE /risks/{id}":               PermRisksWrite,
+	"POST /mappings/risk-to-control":   PermRisksWrite,
+	"DELETE /mappings/risk-to-control": PermRisksWrite,
+
+	// Vendors
+	"GET /vendors":                       PermVendorsRead,
+	"GET /vendors/{id}":                  PermVendorsRead,
+	"GET /vendors/{id}/assessments":      PermVendorsRead,
+	"GET /vendors/{id}/controls":         PermVendorsRead,
+	"POST /vendors":                      PermVendorsWrite,
+	"PUT /vendors/{id}":                  PermVendorsWrite,
+	"DELETE /vendors/{id}":               PermVendorsWrite,
+	"POST /vendors/{id}/assessments":     PermVendorsWrite,
+	"POST /mappings/vendor-to-control":   PermVendorsWrite,
+	"DELETE /mappings/vendor-to-control": PermVendorsWrite,
+
+	// GDPR
+	"GET /gdpr/ropa":              PermGDPRRead,
+	"GET /gdpr/ropa/{id}":         PermGDPRRead,
+	"POST /gdpr/ropa":             PermGDPRWrite,
+	"PUT /gdpr/ropa/{id}":         PermGDPRWrite,
+	"DELETE /gdpr/ropa/{id}":      PermGDPRWrite,
+	"GET /gdpr/dsr":               PermGDPRRead,
+	"GET /gdpr/dsr/{id}":          PermGDPRRead,
+	"POST /gdpr/dsr":              PermGDPRWrite,
+	"PUT /gdpr/dsr/{id}":          PermGDPRWrite,
+	"PUT /gdpr/dsr/{id}/complete": PermGDPRWrite,
+
+	// Analytics follow the module they report on
+	"GET /analytics/control-compliance-trends": PermControlsRead,
+	"GET /analytics/risk-distribution":         PermRisksRead,
+	"GET /analytics/risk-trends":               PermRisksRead,
+	"GET /analytics/dsr-metrics":               PermGDPRRead,
+	"GET /analytics/asset-breakdown":           PermAssetsRead,
+	"GET /analytics/ropa-metrics":              PermGDPRRead,
+
+	// Reports
+	"POST /reports/generate/pdf":  PermReportsGenerate,
+	"POST /reports/generate/csv":  PermReportsGenerate,
+	"POST /reports/generate/json": PermReportsGenerate,
+}
+
+// Authorize is the authorization middleware for all authenticated routes. It looks up
+// the matched route in routePermissions and checks the caller's role; it must run after
+// AuthMiddleware.
+func Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value(RoleKey).(string)
+
+		permission, ok := requiredPermission(r)
+		if !ok {
+			http.Error(w, "Forbidden: no access policy for this endpoint", http.StatusForbidden)
+			return
+		}
+		if permission == PermSuperAdmin {
+			if superAdmin, _ := r.Context().Value(SuperAdminKey).(bool); !superAdmin {
+				http.Error(w, "Forbidden: super-admin only", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !HasPermission(role, permission) {
+			http.Error(w, "Forbidden: missing permission "+string(permission), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredPermission resolves the permission for the request's matched route
+func requiredPermission(r *http.Request) (Permission, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	permission, ok := routePermissions[r.Method+" "+strings.TrimPrefix(template, "/api/v1")]
+	return permission, ok
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Control reminders
+//
+// The due-controls job applies each organization's reminder policy to its
+// active controls: reminders a number of days before the review is due, one on
+// the due date, then escalations once the control is overdue by configured
+// thresholds. Only the latest stage that has been reached is sent, and it is
+// recorded in control_reminders against the control's due date so it fires
+// once. Submitting evidence moves the due date and clears the record, which
+// starts the cycle again. Controls without an active owner go to everyone who
+// can manage controls at every stage.
+
+const (
+	// EscalateToOwner repeats the alert to the control owner only
+	EscalateToOwner = "owner"
+	// EscalateToManager also alerts the owner's manager, or the admins if there is none
+	EscalateToManager = "manager"
+	// EscalateToAdmins also alerts everyone who can manage controls
+	EscalateToAdmins = "admins"
+)
+
+// ReminderPolicy configures when control owners are reminded and escalated
+type ReminderPolicy struct {
+	RemindDaysBefore []int                `json:"remind_days_before"` // e.g. [7, 1]
+	RemindOnDueDate  bool                 `json:"remind_on_due_date"`
+	Escalations      []ReminderEscalation `json:"escalations"`
+}
+
+// ReminderEscalation alerts Notify once a control is DaysOverdue days late
+type ReminderEscalation struct {
+	DaysOverdue int    `json:"days_overdue"`
+	Notify      string `json:"notify"` // owner, manager or admins
+}
+
+// ControlReminder is a reminder stage sent for a control's due date
+type ControlReminder struct {
+	ID                 string    `json:"id"`
+	ActivatedControlID string    `json:"activated_control_id"`
+	DueDate            time.Time `json:"due_date"`
+	Stage              string    `json:"stage"`
+	NotifiedUserIDs    []string  `json:"notified_user_ids"`
+	SentAt             time.Time `json:"sent_at"`
+}
+
+// RemindableControl is an active control close to or past its due date
+type RemindableControl struct {
+	ID               string
+	ControlLibraryID string
+	DueDate          time.Time
+	DaysUntilDue     int                // negative once overdue
+	Owner            *ReminderRecipient // nil without an active owner
+	Manager          *ReminderRecipient // the owner's active manager, if any
+	SentStages       []string           // stages already sent for DueDate
+}
+
+// ReminderRecipient is someone a reminder is sent to
+type ReminderRecipient struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// DefaultReminderPolicy applies until an organization saves its own
+func DefaultReminderPolicy() ReminderPolicy {
+	return ReminderPolicy{
+		RemindDaysBefore: []int{7, 1},
+		RemindOnDueDate:  true,
+		Escalations: []ReminderEscalation{
+			{DaysOverdue: 1, Notify: EscalateToOwner},
+			{DaysOverdue: 7, Notify: EscalateToManager},
+			{DaysOverdue: 14, Notify: EscalateToAdmins},
+		},
+	}
+}
+
+// Validate checks the policy and puts its stages in order
+func (p *ReminderPolicy) Validate() error {
+	seen := map[int]bool{}
+	for _, days := range p.RemindDaysBefore {
+		if days < 1 || days > 365 {
+			return fmt.Errorf("remind_days_before values must be between 1 and 365")
+		}
+		if seen[days] {
+			return fmt.Errorf("remind_days_before contains %d twice", days)
+		}
+		seen[days] = true
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(p.RemindDaysBefore)))
+
+	seen = map[int]bool{}
+	for _, escalation := range p.Escalations {
+		if escalation.DaysOverdue < 1 || escalation.DaysOverdue > 365 {
+			return fmt.Errorf("days_overdue must be between 1 and 365")
+		}
+		if seen[escalation.DaysOverdue] {
+			return fmt.Errorf("two escalations at %d days overdue", escalation.DaysOverdue)
+		}
+		seen[escalation.DaysOverdue] = true
+		switch escalation.Notify {
+		case EscalateToOwner, EscalateToManager, EscalateToAdmins:
+		default:
+			return fmt.Errorf("notify must be owner, manager or admins")
+		}
+	}
+	sort.Slice(p.Escalations, func(i, j int) bool { return p.Escalations[i].DaysOverdue < p.Escalations[j].DaysOverdue })
+	if p.RemindDaysBefore == nil {
+		p.RemindDaysBefore = []int{}
+	}
+	if p.Escalations == nil {
+		p.Escalations = []ReminderEscalation{}
+	}
+	return nil
+}
+
+// reminderStage is one step of a policy, placed relative to the due date
+type reminderStage struct {
+	Key    string // before_7d, due or overdue_14d
+	Offset int    // days after the due date; negative before it
+	Notify string
+}
+
+// stages lists the policy's steps in the order they are reached
+func (p ReminderPolicy) stages() []reminderStage {
+	stages := []reminderStage{}
+	for _, days := range p.RemindDaysBefore {
+		stages = append(stages, reminderStage{Key: fmt.Sprintf("before_%dd", days), Offset: -days, Notify: EscalateToOwner})
+	}
+	if p.RemindOnDueDate {
+		stages = append(stages, reminderStage{Key: "due", Offset: 0, Notify: EscalateToOwner})
+	}
+	for _, escalation := range p.Escalations {
+		stages = append(stages, reminderStage{Key: fmt.Sprintf("overdue_%dd", escalation.DaysOverdue), Offset: escalation.DaysOverdue, Notify: escalation.Notify})
+	}
+	sort.SliceStable(stages, func(i, j int) bool { return stages[i].Offset < stages[j].Offset })
+	return stages
+}
+
+// currentStage returns the latest stage a control has reached, or nil if none
+// has been reached yet
+func currentStage(stages []reminderStage, daysUntilDue int) *reminderStage {
+	var current *reminderStage
+	for i := range stages {
+		if -daysUntilDue >= stages[i].Offset {
+			current = &stages[i]
+		}
+	}
+	return current
+}
+
+// checkDueControls sends the reminder or escalation each control has reached
+// under the organization's policy, once per stage
+func (cs *CronService) checkDueControls(ctx context.Context) (int, error) {
+	log.Println("Checking for due controls...")
+
+	policy, err := cs.store.GetReminderPolicy(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("loading reminder policy: %w", err)
+	}
+	stages := policy.stages()
+	if len(stages) == 0 {
+		return 0, nil
+	}
+	lookahead := 0
+	if stages[0].Offset < 0 {
+		lookahead = -stages[0].Offset
+	}
+
+	controls, err := cs.store.ListRemindableControls(ctx, lookahead)
+	if err != nil {
+		return 0, fmt.Errorf("querying due controls: %w", err)
+	}
+
+	var admins []ReminderRecipient
+	adminsLoaded := false
+	controlAdmins := func() ([]ReminderRecipient, error) {
+		if !adminsLoaded {
+			var err error
+			if admins, err = cs.store.ListReminderContactsByRoles(ctx, RolesWithPermission(PermControlsManage)); err != nil {
+				return nil, fmt.Errorf("listing control administrators: %w", err)
+			}
+			adminsLoaded = true
+		}
+		return admins, nil
+	}
+
+	processed := 0
+	for _, control := range controls {
+		stage := currentStage(stages, control.DaysUntilDue)
+		if stage == nil || slices.Contains(control.SentStages, stage.Key) {
+			continue
+		}
+
+		// The owner is reminded and others are escalated to; without an active
+		// owner the administrators get every stage instead
+		remind := []ReminderRecipient{}
+		escalateTo := []ReminderRecipient{}
+		switch {
+		case control.Owner == nil:
+			admins, err := controlAdmins()
+			if err != nil {
+				return processed, err
+			}
+			remind = append(remind, admins...)
+		case stage.Notify == EscalateToManager && control.Manager != nil:
+			escalateTo = append(escalateTo, *control.Manager)
+		case stage.Notify == EscalateToManager || stage.Notify == EscalateToAdmins:
+			admins, err := controlAdmins()
+			if err != nil {
+				return processed, err
+			}
+			for _, admin := range admins {
+				if admin.ID != control.Owner.ID {
+					escalateTo = append(escalateTo, admin)
+				}
+			}
+		}
+		if control.Owner != nil {
+			remind = append(remind, *control.Owner)
+		}
+		if len(remind) == 0 {
+			log.Printf("No one to remind about control %s: it has no active owner and no administrators", control.ControlLibraryID)
+			continue
+		}
+
+		notified := []string{}
+		for _, recipient := range append(remind, escalateTo...) {
+			notified = append(notified, recipient.ID)
+		}
+		claimed, err := cs.store.ClaimControlReminder(ctx, control.ID, control.DueDate, stage.Key, notified)
+		if err != nil {
+			log.Printf("Error recording reminder for control %s: %v", control.ControlLibraryID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		for _, recipient := range remind {
+			cs.sendControlReminder(ctx, control, recipient, false)
+		}
+		for _, recipient := range escalateTo {
+			cs.sendControlReminder(ctx, control, recipient, true)
+		}
+		log.Printf("Sent %s reminder for control %s to %d recipient(s)", stage.Key, control.ControlLibraryID, len(notified))
+		processed++
+	}
+	return processed, nil
+}
+
+// sendControlReminder notifies one recipient in the app and by email.
+// Escalated recipients are told whose control it is.
+func (cs *CronService) sendControlReminder(ctx context.Context, control RemindableControl, recipient ReminderRecipient, escalated bool) {
+	daysOverdue := -control.DaysUntilDue
+	var message string
+	switch {
+	case control.Owner == nil && daysOverdue > 0:
+		message = fmt.Sprintf("URGENT: Control %s has no active owner and is %d day(s) overdue for review", control.ControlLibraryID, daysOverdue)
+	case control.Owner == nil:
+		message = fmt.Sprintf("Control %s has no active owner and is due for review on %s", control.ControlLibraryID, control.DueDate.Format("2006-01-02"))
+	case escalated:
+		message = fmt.Sprintf("Escalation: control %s owned by %s is %d day(s) overdue for review", control.ControlLibraryID, control.Owner.Name, daysOverdue)
+	case daysOverdue > 0:
+		message = fmt.Sprintf("URGENT: Control %s is %d day(s) overdue for review", control.ControlLibraryID, daysOverdue)
+	case daysOverdue == 0:
+		message = fmt.Sprintf("Control %s is due for review today", control.ControlLibraryID)
+	default:
+		message = fmt.Sprintf("Control %s is due for review in %d day(s)", control.ControlLibraryID, control.DaysUntilDue)
+	}
+	linkURL := fmt.Sprintf("/controls/activated/%s", control.ID)
+	if err := cs.store.CreateNotification(ctx, recipient.ID, message, linkURL); err != nil {
+		log.Printf("Error creating reminder notification for control %s: %v", control.ControlLibraryID, err)
+	}
+
+	if !cs.email.IsEnabled() || recipient.Email == "" {
+		return
+	}
+	var err error
+	if daysOverdue > 0 {
+		err = cs.email.SendOverdueControlAlert(recipient.Email, recipient.Name, control.ControlLibraryID, control.ID, daysOverdue)
+	} else {
+		err = cs.email.SendDueControlReminder(recipient.Email, recipient.Name, control.ControlLibraryID, control.ID, control.DaysUntilDue)
+	}
+	if err != nil {
+		log.Printf("Error sending reminder email to %s: %v", recipient.Email, err)
+	}
+}
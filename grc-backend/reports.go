@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jung-kurt/gofpdf"
@@ -34,6 +35,7 @@ type ComplianceReportData struct {
 	Controls           []ReportControl
 	TotalControls      int
 	ActivatedControls  int
+	MappedControls     int // not activated, but covered by a mapped control's evidence
 	CompliantControls  int
 	NonCompliantControls int
 	ComplianceRate     float64
@@ -49,7 +51,9 @@ type ReportControl struct {
 	Status            string
 	LastReviewedAt    string
 	NextReviewDue     string
-	EvidenceCount     int
+	EvidenceCount     int      // including evidence from mapped controls
+	MappedEvidenceCount int
+	CoveredBy         []string // mapped controls whose evidence counts toward this one
 	LatestEvidence    *ControlEvidenceLog
 	IsOverdue         bool
 }
@@ -105,6 +109,12 @@ func (rg *ReportGenerator) fetchReportData(ctx context.Context, req ComplianceRe
 		return nil, fmt.Errorf("failed to fetch activated controls: %w", err)
 	}
 
+	// Evidence per library control, including evidence shared by mapped controls
+	coverage, err := rg.store.GetControlCoverage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch control evidence: %w", err)
+	}
+
 	// Build map of activated controls by library ID
 	activatedMap := make(map[string]ActiveControlListItem)
 	for _, ac := range activatedControls {
@@ -114,6 +124,7 @@ func (rg *ReportGenerator) fetchReportData(ctx context.Context, req ComplianceRe
 	// Build report control data
 	var reportControls []ReportControl
 	totalActivated := 0
+	totalMapped := 0
 	totalCompliant := 0
 	totalNonCompliant := 0
 
@@ -124,10 +135,11 @@ func (rg *ReportGenerator) fetchReportData(ctx context.Context, req ComplianceRe
 			Family:      control.Family,
 			Status:      "not_activated",
 		}
+		cov, hasEvidence := coverage[control.ID]
 
 		// Check if control is activated
 		if activated, exists := activatedMap[control.ID]; exists {
-			rc.Status = activated.Status
+			rc.Status = "pending"
 			rc.NextReviewDue = activated.NextReviewDueDate
 			if activated.LastReviewedAt.Valid {
 				rc.LastReviewedAt = activated.LastReviewedAt.String
@@ -140,16 +152,26 @@ func (rg *ReportGenerator) fetchReportData(ctx context.Context, req ComplianceRe
 			}
 
 			totalActivated++
+		} else if hasEvidence {
+			// Not activated, but a mapped control's evidence covers it
+			rc.Status = "pending"
+			totalMapped++
+		}
+
+		if hasEvidence {
+			rc.EvidenceCount = cov.EvidenceCount + cov.MappedEvidenceCount
+			rc.MappedEvidenceCount = cov.MappedEvidenceCount
+			rc.CoveredBy = cov.CoveredBy
 
-			// Count compliance status
-			if activated.Status == "compliant" {
+			// Count compliance status of the latest evidence, wherever it was recorded
+			switch cov.Status {
+			case "compliant":
+				rc.Status = "compliant"
 				totalCompliant++
-			} else if activated.Status == "non_compliant" {
+			case "non-compliant":
+				rc.Status = "non_compliant"
 				totalNonCompliant++
 			}
-
-			// Evidence fetching removed for simplicity - can be added later if needed
-			rc.EvidenceCount = 0
 		}
 
 		reportControls = append(reportControls, rc)
@@ -157,8 +179,8 @@ func (rg *ReportGenerator) fetchReportData(ctx context.Context, req ComplianceRe
 
 	// Calculate compliance rate
 	complianceRate := 0.0
-	if totalActivated > 0 {
-		complianceRate = (float64(totalCompliant) / float64(totalActivated)) * 100
+	if totalActivated+totalMapped > 0 {
+		complianceRate = (float64(totalCompliant) / float64(totalActivated+totalMapped)) * 100
 	}
 
 	dateRange := fmt.Sprintf("%s to %s", req.StartDate.Format("2006-01-02"), req.EndDate.Format("2006-01-02"))
@@ -168,6 +190,7 @@ func (rg *ReportGenerator) fetchReportData(ctx context.Context, req ComplianceRe
 		Controls:             reportControls,
 		TotalControls:        len(controls),
 		ActivatedControls:    totalActivated,
+		MappedControls:       totalMapped,
 		CompliantControls:    totalCompliant,
 		NonCompliantControls: totalNonCompliant,
 		ComplianceRate:       complianceRate,
@@ -260,6 +283,15 @@ func (rg *ReportGenerator) addExecutiveSummary(pdf *gofpdf.Fpdf, data *Complianc
 	pdf.Cell(0, 8, fmt.Sprintf("%d (%.1f%%)", data.ActivatedControls, activationRate))
 	pdf.Ln(8)
 
+	// Controls covered only through mapped controls from other standards
+	if data.MappedControls > 0 {
+		pdf.SetFont("Arial", "B", 11)
+		pdf.Cell(70, 8, "Covered by Mapped Controls:")
+		pdf.SetFont("Arial", "", 11)
+		pdf.Cell(0, 8, fmt.Sprintf("%d", data.MappedControls))
+		pdf.Ln(8)
+	}
+
 	// Compliant controls
 	pdf.SetFont("Arial", "B", 11)
 	pdf.SetTextColor(0, 128, 0)
@@ -337,8 +369,8 @@ func (rg *ReportGenerator) addExecutiveSummary(pdf *gofpdf.Fpdf, data *Complianc
 		pdf.Ln(3)
 	}
 
-	if data.ActivatedControls < data.TotalControls {
-		notActivated := data.TotalControls - data.ActivatedControls
+	if data.ActivatedControls+data.MappedControls < data.TotalControls {
+		notActivated := data.TotalControls - data.ActivatedControls - data.MappedControls
 		pdf.MultiCell(0, 6, fmt.Sprintf("• %d controls from the standard have not been activated. Consider activating these controls to achieve comprehensive compliance.", notActivated), "", "L", false)
 	}
 }
@@ -368,7 +400,11 @@ func (rg *ReportGenerator) addControlsDetail(pdf *gofpdf.Fpdf, data *ComplianceR
 	if len(activatedControls) > 0 {
 		pdf.SetFont("Arial", "B", 14)
 		pdf.SetTextColor(0, 0, 0)
-		pdf.Cell(0, 10, fmt.Sprintf("Activated Controls (%d)", len(activatedControls)))
+		heading := "Activated Controls"
+		if data.MappedControls > 0 {
+			heading = "Activated and Mapped Controls"
+		}
+		pdf.Cell(0, 10, fmt.Sprintf("%s (%d)", heading, len(activatedControls)))
 		pdf.Ln(10)
 
 		for _, control := range activatedControls {
@@ -421,7 +457,11 @@ func (rg *ReportGenerator) addControlsDetail(pdf *gofpdf.Fpdf, data *ComplianceR
 			// Evidence count
 			if includeEvidence && control.EvidenceCount > 0 {
 				pdf.SetXY(25, pdf.GetY()+16)
-				pdf.Cell(0, 4, fmt.Sprintf("Evidence submissions: %d", control.EvidenceCount))
+				evidenceInfo := fmt.Sprintf("Evidence submissions: %d", control.EvidenceCount)
+				if control.MappedEvidenceCount > 0 {
+					evidenceInfo += fmt.Sprintf(" (%d via %s)", control.MappedEvidenceCount, strings.Join(control.CoveredBy, ", "))
+				}
+				pdf.Cell(0, 4, evidenceInfo)
 			}
 
 			pdf.SetY(pdf.GetY() + boxHeight + 3)
@@ -486,7 +526,7 @@ func (rg *ReportGenerator) GenerateCSVReport(ctx context.Context, req Compliance
 		return "", err
 	}
 
-	csv := "Control ID,Control Name,Family,Status,Last Reviewed,Next Review Due,Overdue,Evidence Count\n"
+	csv := "Control ID,Control Name,Family,Status,Last Reviewed,Next Review Due,Overdue,Evidence Count,Covered By\n"
 
 	for _, control := range data.Controls {
 		overdue := "No"
@@ -494,7 +534,7 @@ func (rg *ReportGenerator) GenerateCSVReport(ctx context.Context, req Compliance
 			overdue = "Yes"
 		}
 		
-		csv += fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%d\n",
+		csv += fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%d,%s\n",
 			control.ControlID,
 			control.ControlName,
 			control.Family,
@@ -503,6 +543,7 @@ func (rg *ReportGenerator) GenerateCSVReport(ctx context.Context, req Compliance
 			control.NextReviewDue,
 			overdue,
 			control.EvidenceCount,
+			strings.Join(control.CoveredBy, ";"),
 		)
 	}
 
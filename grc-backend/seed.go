@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // SeedControlLibrary populates the control_library table with CIS, ISO27001, and NIS-2 controls
@@ -491,29 +492,36 @@ func SeedTestUsers(ctx context.Context, db *pgxpool.Pool) error {
 		{
 			email:    "admin@company.com",
 			name:     "System Administrator",
-			password: "admin123", // In production, this should be hashed
+			password: "admin123",
 			role:     "admin",
 		},
 		{
 			email:    "user@company.com",
 			name:     "Compliance User",
-			password: "user123", // In production, this should be hashed
+			password: "user123",
 			role:     "user",
 		},
 		{
 			email:    "john.doe@company.com",
 			name:     "John Doe",
-			password: "john123", // In production, this should be hashed
+			password: "john123",
 			role:     "user",
 		},
 	}
 
 	for _, user := range testUsers {
-		_, err := db.Exec(ctx, `
-			INSERT INTO users (email, name, role)
-			VALUES ($1, $2, $3)
-			ON CONFLICT (email) DO NOTHING
-		`, user.email, user.name, user.role)
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+
+		// Existing demo users created before passwords were hashed get a hash backfilled
+		_, err = db.Exec(ctx, `
+			INSERT INTO users (email, name, role, password_hash)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (email) DO UPDATE SET
+				password_hash = COALESCE(users.password_hash, EXCLUDED.password_hash)
+		`, user.email, user.name, user.role, string(passwordHash))
 		if err != nil {
 			log.Printf("Error inserting user %s: %v", user.email, err)
 			return err
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SIEM forwarding
+//
+// The audit forwarder ships every sealed audit entry to the configured sinks:
+// a syslog receiver (RFC 5424 or CEF over TCP, TLS or UDP) and/or a local
+// newline-delimited JSON file with size-based rotation. Each sink keeps a
+// cursor per organization in audit_forward_cursors that only moves once a
+// batch was accepted, so entries are delivered at least once and in chain
+// order; receivers can de-duplicate on the entry ID. Batches are read from the
+// database only as fast as the sink takes them, so a slow or unreachable
+// receiver builds a backlog in audit_log rather than in memory, and failures
+// are retried with exponential backoff.
+
+const (
+	// siemEnterpriseID is the private enterprise number in structured data IDs
+	// (32473 is reserved for documentation by RFC 5612)
+	siemEnterpriseID = "32473"
+	// siemMinBackoff is the first delay after a failed batch
+	siemMinBackoff = time.Second
+)
+
+// auditRecord is the JSON form of an audit entry in forwarded messages
+type auditRecord struct {
+	ID               string          `json:"id"`
+	OrganizationID   string          `json:"organization_id"`
+	Seq              int64           `json:"seq"`
+	PerformedAt      time.Time       `json:"performed_at"`
+	UserID           *string         `json:"user_id,omitempty"`
+	ActionType       string          `json:"action_type"`
+	TargetEntityType *string         `json:"target_entity_type,omitempty"`
+	TargetEntityID   *string         `json:"target_entity_id,omitempty"`
+	Changes          json.RawMessage `json:"changes,omitempty"`
+	IPAddress        *string         `json:"ip_address,omitempty"`
+	UserAgent        *string         `json:"user_agent,omitempty"`
+	RequestID        *string         `json:"request_id,omitempty"`
+	SessionID        *string         `json:"session_id,omitempty"`
+	PrevHash         string          `json:"prev_hash"`
+	EntryHash        string          `json:"entry_hash"`
+}
+
+// newAuditRecord converts a chain entry for forwarding
+func newAuditRecord(e AuditChainEntry) auditRecord {
+	record := auditRecord{
+		ID:               e.ID,
+		OrganizationID:   e.OrganizationID,
+		Seq:              e.Seq,
+		PerformedAt:      e.PerformedAt.UTC(),
+		UserID:           e.UserID,
+		ActionType:       e.ActionType,
+		TargetEntityType: e.TargetEntityType,
+		TargetEntityID:   e.TargetEntityID,
+		IPAddress:        e.IPAddress,
+		UserAgent:        e.UserAgent,
+		RequestID:        e.RequestID,
+		SessionID:        e.SessionID,
+		PrevHash:         e.PrevHash,
+		EntryHash:        e.EntryHash,
+	}
+	if e.Changes != nil {
+		record.Changes = json.RawMessage(*e.Changes)
+	}
+	return record
+}
+
+// auditSeverity maps an action to a syslog severity: warning for failures and
+// lockouts, notice for everything else
+func auditSeverity(actionType string) int {
+	for _, marker := range []string{"FAILED", "LOCKED", "BLOCKED"} {
+		if strings.Contains(actionType, marker) {
+			return 4
+		}
+	}
+	return 5
+}
+
+// sdEscape escapes an RFC 5424 structured data parameter value
+func sdEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// cefHeaderEscape escapes a CEF header field
+func cefHeaderEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace(value)
+}
+
+// cefValueEscape escapes a CEF extension value
+func cefValueEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
+
+// formatCEF renders an entry as an ArcSight Common Event Format line
+func formatCEF(e AuditChainEntry) string {
+	severity := 3
+	if auditSeverity(e.ActionType) == 4 {
+		severity = 7
+	}
+	ext := []string{
+		"rt=" + strconv.FormatInt(e.PerformedAt.UnixMilli(), 10),
+		"externalId=" + cefValueEscape(e.ID),
+		"cs1Label=organizationId",
+		"cs1=" + cefValueEscape(e.OrganizationID),
+		"cn1Label=seq",
+		"cn1=" + strconv.FormatInt(e.Seq, 10),
+		"cs5Label=entryHash",
+		"cs5=" + e.EntryHash,
+	}
+	if e.UserID != nil {
+		ext = append(ext, "suid="+cefValueEscape(*e.UserID))
+	}
+	if e.IPAddress != nil {
+		ext = append(ext, "src="+cefValueEscape(*e.IPAddress))
+	}
+	if e.TargetEntityType != nil {
+		ext = append(ext, "cs2Label=entityType", "cs2="+cefValueEscape(*e.TargetEntityType))
+	}
+	if e.TargetEntityID != nil {
+		ext = append(ext, "cs3Label=entityId", "cs3="+cefValueEscape(*e.TargetEntityID))
+	}
+	if e.Changes != nil {
+		ext = append(ext, "cs4Label=changes", "cs4="+cefValueEscape(*e.Changes))
+	}
+	if e.RequestID != nil {
+		ext = append(ext, "cs6Label=requestId", "cs6="+cefValueEscape(*e.RequestID))
+	}
+	if e.UserAgent != nil {
+		ext = append(ext, "requestClientApplication="+cefValueEscape(*e.UserAgent))
+	}
+	action := cefHeaderEscape(e.ActionType)
+	return fmt.Sprintf("CEF:0|GRC Platform|grc-backend|1.0|%s|%s|%d|%s", action, action, severity, strings.Join(ext, " "))
+}
+
+// auditSink is a destination audit entries are forwarded to
+type auditSink interface {
+	name() string   // cursor key, stable across restarts
+	target() string // where entries go, for the status API
+	format() string
+	// send delivers the batch or returns an error, in which case the whole
+	// batch is sent again
+	send(entries []AuditChainEntry) error
+	close()
+}
+
+// syslogSink sends RFC 5424 messages, carrying JSON or CEF, to a syslog receiver
+type syslogSink struct {
+	protocol  string // tcp, tls or udp
+	addr      string
+	msgFormat string // rfc5424 or cef
+	framing   string // octet-counting or newline; stream protocols only
+	facility  int
+	hostname  string
+	appName   string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	conn net.Conn
+}
+
+func (s *syslogSink) name() string   { return "syslog" }
+func (s *syslogSink) target() string { return s.protocol + "://" + s.addr }
+func (s *syslogSink) format() string { return s.msgFormat }
+
+// message renders one entry as an RFC 5424 syslog message
+func (s *syslogSink) message(e AuditChainEntry) (string, error) {
+	pri := s.facility*8 + auditSeverity(e.ActionType)
+	timestamp := e.PerformedAt.UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	msgID := e.ActionType
+	if len(msgID) > 32 {
+		msgID = msgID[:32]
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s - %s", pri, timestamp, s.hostname, s.appName, msgID)
+
+	if s.msgFormat == "cef" {
+		return header + " - " + formatCEF(e), nil
+	}
+
+	params := []string{
+		fmt.Sprintf(`id="%s"`, sdEscape(e.ID)),
+		fmt.Sprintf(`org="%s"`, sdEscape(e.OrganizationID)),
+		fmt.Sprintf(`seq="%d"`, e.Seq),
+		fmt.Sprintf(`hash="%s"`, sdEscape(e.EntryHash)),
+	}
+	if e.UserID != nil {
+		params = append(params, fmt.Sprintf(`user="%s"`, sdEscape(*e.UserID)))
+	}
+	if e.TargetEntityType != nil {
+		params = append(params, fmt.Sprintf(`entity_type="%s"`, sdEscape(*e.TargetEntityType)))
+	}
+	if e.TargetEntityID != nil {
+		params = append(params, fmt.Sprintf(`entity_id="%s"`, sdEscape(*e.TargetEntityID)))
+	}
+	if e.IPAddress != nil {
+		params = append(params, fmt.Sprintf(`ip="%s"`, sdEscape(*e.IPAddress)))
+	}
+	if e.RequestID != nil {
+		params = append(params, fmt.Sprintf(`request_id="%s"`, sdEscape(*e.RequestID)))
+	}
+	if e.SessionID != nil {
+		params = append(params, fmt.Sprintf(`session="%s"`, sdEscape(*e.SessionID)))
+	}
+	body, err := json.Marshal(newAuditRecord(e))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s [audit@%s %s] %s", header, siemEnterpriseID, strings.Join(params, " "), body), nil
+}
+
+// dial connects to the receiver
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.timeout}
+	switch s.protocol {
+	case "tls":
+		return tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+	default:
+		return dialer.Dial(s.protocol, s.addr)
+	}
+}
+
+// connAlive reports whether a stream connection is still open. Receivers never
+// write to us, so a read that does not time out means the peer has gone away
+// and anything written now would be lost.
+func (s *syslogSink) connAlive() bool {
+	if s.protocol == "udp" {
+		return true
+	}
+	s.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	var probe [1]byte
+	_, err := s.conn.Read(probe[:])
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (s *syslogSink) send(entries []AuditChainEntry) error {
+	if s.conn != nil && !s.connAlive() {
+		s.close()
+	}
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	var stream bytes.Buffer
+	for _, e := range entries {
+		msg, err := s.message(e)
+		if err != nil {
+			return err
+		}
+		switch {
+		case s.protocol == "udp":
+			s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+			if _, err := s.conn.Write([]byte(msg)); err != nil {
+				s.close()
+				return err
+			}
+		case s.framing == "newline":
+			stream.WriteString(msg)
+			stream.WriteByte('\n')
+		default:
+			fmt.Fprintf(&stream, "%d %s", len(msg), msg)
+		}
+	}
+	if stream.Len() == 0 {
+		return nil
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	if _, err := s.conn.Write(stream.Bytes()); err != nil {
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// fileSink appends one JSON object per line to a local file, rotating it by size
+type fileSink struct {
+	path       string
+	hostname   string
+	maxBytes   int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+// name includes the host: every replica with a file sink writes the whole stream
+func (f *fileSink) name() string   { return "file:" + f.hostname + ":" + f.path }
+func (f *fileSink) target() string { return f.path }
+func (f *fileSink) format() string { return "ndjson" }
+
+// open opens the file for appending
+func (f *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate renames the file to path.1, shifting older files up and dropping
+// the oldest, and starts a new file
+func (f *fileSink) rotate() error {
+	f.close()
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return f.open()
+}
+
+func (f *fileSink) send(entries []AuditChainEntry) error {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	for _, e := range entries {
+		line, err := json.Marshal(newAuditRecord(e))
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if f.size > 0 && f.size+int64(len(line)) > f.maxBytes {
+			if err := f.rotate(); err != nil {
+				return err
+			}
+		}
+		n, err := f.file.Write(line)
+		f.size += int64(n)
+		if err != nil {
+			f.close()
+			return err
+		}
+	}
+	// The cursor moves once the batch is on disk
+	if err := f.file.Sync(); err != nil {
+		f.close()
+		return err
+	}
+	return nil
+}
+
+func (f *fileSink) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// AuditForwardStatus describes one sink for the platform API. Counters and
+// errors are those of this replica since it started.
+type AuditForwardStatus struct {
+	Sink                string     `json:"sink"`
+	Target              string     `json:"target"`
+	Format              string     `json:"format"`
+	Pending             int64      `json:"pending"` // sealed entries not yet forwarded
+	Forwarded           int64      `json:"forwarded"`
+	LastForwardedAt     *time.Time `json:"last_forwarded_at,omitempty"`
+	LastError           *string    `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// AuditForwarder ships sealed audit entries to the configured sinks
+type AuditForwarder struct {
+	store        *Store
+	sinks        []auditSink
+	batchSize    int
+	pollInterval time.Duration
+	maxBackoff   time.Duration
+
+	mu     sync.Mutex
+	status map[string]*AuditForwardStatus
+}
+
+// NewAuditForwarder reads the AUDIT_FORWARD_* settings. With neither a syslog
+// address nor a file configured it forwards nothing.
+func NewAuditForwarder(store *Store) (*AuditForwarder, error) {
+	f := &AuditForwarder{
+		store:        store,
+		batchSize:    envInt("AUDIT_FORWARD_BATCH_SIZE", 500),
+		pollInterval: envDuration("AUDIT_FORWARD_POLL_INTERVAL", 5*time.Second),
+		maxBackoff:   envDuration("AUDIT_FORWARD_MAX_BACKOFF", 5*time.Minute),
+		status:       map[string]*AuditForwardStatus{},
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	if addr := os.Getenv("AUDIT_FORWARD_SYSLOG_ADDR"); addr != "" {
+		sink, err := newSyslogSink(addr, hostname)
+		if err != nil {
+			return nil, err
+		}
+		f.sinks = append(f.sinks, sink)
+	}
+
+	if path := os.Getenv("AUDIT_FORWARD_FILE"); path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUDIT_FORWARD_FILE: %w", err)
+		}
+		f.sinks = append(f.sinks, &fileSink{
+			path:       abs,
+			hostname:   hostname,
+			maxBytes:   int64(envInt("AUDIT_FORWARD_FILE_MAX_MB", 100)) << 20,
+			maxBackups: envInt("AUDIT_FORWARD_FILE_MAX_BACKUPS", 10),
+		})
+	}
+
+	for _, sink := range f.sinks {
+		f.status[sink.name()] = &AuditForwardStatus{Sink: sink.name(), Target: sink.target(), Format: sink.format()}
+	}
+	return f, nil
+}
+
+// newSyslogSink configures the syslog sink from the environment
+func newSyslogSink(addr, hostname string) (*syslogSink, error) {
+	sink := &syslogSink{
+		protocol:  strings.ToLower(os.Getenv("AUDIT_FORWARD_SYSLOG_PROTOCOL")),
+		addr:      addr,
+		msgFormat: strings.ToLower(os.Getenv("AUDIT_FORWARD_SYSLOG_FORMAT")),
+		framing:   strings.ToLower(os.Getenv("AUDIT_FORWARD_SYSLOG_FRAMING")),
+		facility:  13, // log audit
+		hostname:  hostname,
+		appName:   os.Getenv("AUDIT_FORWARD_SYSLOG_APP_NAME"),
+		timeout:   envDuration("AUDIT_FORWARD_TIMEOUT", 10*time.Second),
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid AUDIT_FORWARD_SYSLOG_ADDR %q: %w", addr, err)
+	}
+	if sink.protocol == "" {
+		sink.protocol = "tcp"
+	}
+	if sink.protocol != "tcp" && sink.protocol != "tls" && sink.protocol != "udp" {
+		return nil, fmt.Errorf("unsupported AUDIT_FORWARD_SYSLOG_PROTOCOL %q (use tcp, tls or udp)", sink.protocol)
+	}
+	if sink.msgFormat == "" {
+		sink.msgFormat = "rfc5424"
+	}
+	if sink.msgFormat != "rfc5424" && sink.msgFormat != "cef" {
+		return nil, fmt.Errorf("unsupported AUDIT_FORWARD_SYSLOG_FORMAT %q (use rfc5424 or cef)", sink.msgFormat)
+	}
+	if sink.framing == "" {
+		sink.framing = "octet-counting"
+	}
+	if sink.framing != "octet-counting" && sink.framing != "newline" {
+		return nil, fmt.Errorf("unsupported AUDIT_FORWARD_SYSLOG_FRAMING %q (use octet-counting or newline)", sink.framing)
+	}
+	if v := os.Getenv("AUDIT_FORWARD_SYSLOG_FACILITY"); v != "" {
+		facility, err := strconv.Atoi(v)
+		if err != nil || facility < 0 || facility > 23 {
+			return nil, fmt.Errorf("invalid AUDIT_FORWARD_SYSLOG_FACILITY %q (0-23)", v)
+		}
+		sink.facility = facility
+	}
+	if sink.appName == "" {
+		sink.appName = "grc-platform"
+	}
+
+	if sink.protocol == "tls" {
+		config, err := siemTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		sink.tlsConfig = config
+	}
+	return sink, nil
+}
+
+// siemTLSConfig builds the TLS client settings: an optional private CA, an
+// optional client certificate and an optional server name override
+func siemTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: os.Getenv("AUDIT_FORWARD_TLS_SERVER_NAME")}
+	if caFile := os.Getenv("AUDIT_FORWARD_TLS_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading AUDIT_FORWARD_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("AUDIT_FORWARD_TLS_CA_FILE contains no certificates")
+		}
+		config.RootCAs = pool
+	}
+	certFile, keyFile := os.Getenv("AUDIT_FORWARD_TLS_CERT_FILE"), os.Getenv("AUDIT_FORWARD_TLS_KEY_FILE")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Start forwards to each sink in the background until ctx is cancelled
+func (f *AuditForwarder) Start(ctx context.Context) {
+	for _, sink := range f.sinks {
+		log.Printf("Forwarding audit log to %s (%s)", sink.target(), sink.format())
+		go f.run(ctx, sink)
+	}
+}
+
+// run forwards batches to one sink, draining the backlog before waiting again
+// and backing off after failures
+func (f *AuditForwarder) run(ctx context.Context, sink auditSink) {
+	defer sink.close()
+	backoff := time.Duration(0)
+	for {
+		wait := f.pollInterval
+		if backoff > 0 {
+			wait = backoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		for ctx.Err() == nil {
+			n, err := f.store.ForwardAuditEntries(WithoutOrganization(ctx), sink.name(), f.batchSize, sink.send)
+			f.record(sink, n, err)
+			if err != nil {
+				backoff = f.nextBackoff(backoff)
+				log.Printf("Error forwarding audit log to %s (retrying in %s): %v", sink.target(), backoff, err)
+				break
+			}
+			backoff = 0
+			if n < f.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// nextBackoff doubles the delay after a failure, up to maxBackoff
+func (f *AuditForwarder) nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next < siemMinBackoff {
+		next = siemMinBackoff
+	}
+	if next > f.maxBackoff {
+		next = f.maxBackoff
+	}
+	return next
+}
+
+// record updates a sink's status after a batch
+func (f *AuditForwarder) record(sink auditSink, forwarded int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := f.status[sink.name()]
+	now := time.Now()
+	if err != nil {
+		text := err.Error()
+		status.LastError, status.LastErrorAt = &text, &now
+		status.ConsecutiveFailures++
+		return
+	}
+	status.ConsecutiveFailures = 0
+	if forwarded > 0 {
+		status.Forwarded += int64(forwarded)
+		status.LastForwardedAt = &now
+	}
+}
+
+// Status reports each configured sink with its backlog
+func (f *AuditForwarder) Status(ctx context.Context) ([]AuditForwardStatus, error) {
+	statuses := []AuditForwardStatus{}
+	for _, sink := range f.sinks {
+		pending, err := f.store.CountPendingAuditForwards(WithoutOrganization(ctx), sink.name())
+		if err != nil {
+			return nil, err
+		}
+		f.mu.Lock()
+		status := *f.status[sink.name()]
+		f.mu.Unlock()
+		status.Pending = pending
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
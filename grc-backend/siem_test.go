@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc5424Pattern splits a message into PRI, timestamp, hostname, app name,
+// MSGID, structured data and the JSON body; PROCID is always nil
+var rfc5424Pattern = regexp.MustCompile(`^<(\d{1,3})>1 (\S+) (\S+) (\S+) - (\S+) (\[audit@32473 (?:[^\]\\]|\\.)*\]) (\{.*\})$`)
+
+func testAuditEntries() []AuditChainEntry {
+	userID := "user-1"
+	entityType := "control"
+	entityID := `ac-2 "quoted" [x]`
+	changes := `{"status":"implemented"}`
+	performedAt := time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC)
+	return []AuditChainEntry{
+		{Seq: 1, ID: "entry-1", OrganizationID: "org-a", PerformedAt: performedAt, UserID: &userID, ActionType: "CONTROL_UPDATED",
+			TargetEntityType: &entityType, TargetEntityID: &entityID, Changes: &changes, PrevHash: "00", EntryHash: "aa"},
+		{Seq: 2, ID: "entry-2", OrganizationID: "org-a", PerformedAt: performedAt, ActionType: "LOGIN_FAILED", PrevHash: "aa", EntryHash: "bb"},
+		{Seq: 7, ID: "entry-7", OrganizationID: "org-b", PerformedAt: performedAt, ActionType: "USER_LOGIN_SUCCESS", PrevHash: "cc", EntryHash: "dd"},
+	}
+}
+
+func testSyslogSink(protocol, addr, framing string) *syslogSink {
+	return &syslogSink{
+		protocol:  protocol,
+		addr:      addr,
+		msgFormat: "rfc5424",
+		framing:   framing,
+		facility:  13,
+		hostname:  "grc-host",
+		appName:   "grc-platform",
+		timeout:   5 * time.Second,
+	}
+}
+
+// checkRFC5424 asserts a forwarded message is well-formed and describes entry
+func checkRFC5424(t *testing.T, msg string, entry AuditChainEntry) {
+	t.Helper()
+	m := rfc5424Pattern.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("not an RFC 5424 message: %q", msg)
+	}
+	if want := strconv.Itoa(13*8 + auditSeverity(entry.ActionType)); m[1] != want {
+		t.Errorf("PRI = %s, want %s", m[1], want)
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, m[2]); err != nil || !ts.Equal(entry.PerformedAt) {
+		t.Errorf("timestamp = %s (%v), want %s", m[2], err, entry.PerformedAt)
+	}
+	if m[3] != "grc-host" || m[4] != "grc-platform" || m[5] != entry.ActionType {
+		t.Errorf("header fields = %q %q %q", m[3], m[4], m[5])
+	}
+	if !strings.Contains(m[6], `id="`+entry.ID+`"`) || !strings.Contains(m[6], `seq="`+strconv.FormatInt(entry.Seq, 10)+`"`) {
+		t.Errorf("structured data = %s", m[6])
+	}
+	if entry.TargetEntityID != nil && !strings.Contains(m[6], `entity_id="`+sdEscape(*entry.TargetEntityID)+`"`) {
+		t.Errorf("entity_id not escaped in %s", m[6])
+	}
+
+	var record auditRecord
+	if err := json.Unmarshal([]byte(m[7]), &record); err != nil {
+		t.Fatalf("message body is not JSON: %v", err)
+	}
+	if record.ID != entry.ID || record.Seq != entry.Seq || record.EntryHash != entry.EntryHash {
+		t.Errorf("body = %+v", record)
+	}
+}
+
+// readOctetCounted splits a TCP stream framed per RFC 6587 octet counting
+func readOctetCounted(t *testing.T, stream []byte) []string {
+	t.Helper()
+	r := bufio.NewReader(strings.NewReader(string(stream)))
+	var msgs []string
+	for {
+		length, err := r.ReadString(' ')
+		if err == io.EOF && length == "" {
+			return msgs
+		}
+		n, convErr := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil || convErr != nil {
+			t.Fatalf("bad frame length %q: %v", length, err)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatalf("short frame: %v", err)
+		}
+		msgs = append(msgs, string(msg))
+	}
+}
+
+// acceptAll reads everything the first client writes until it disconnects
+func acceptAll(ln net.Listener) <-chan []byte {
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	return received
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	entries := testAuditEntries()
+	for _, framing := range []string{"octet-counting", "newline"} {
+		t.Run(framing, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			received := acceptAll(ln)
+
+			sink := testSyslogSink("tcp", ln.Addr().String(), framing)
+			if err := sink.send(entries); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			sink.close()
+
+			stream := <-received
+			var msgs []string
+			if framing == "newline" {
+				msgs = strings.Split(strings.TrimSuffix(string(stream), "\n"), "\n")
+			} else {
+				msgs = readOctetCounted(t, stream)
+			}
+			if len(msgs) != len(entries) {
+				t.Fatalf("received %d messages, want %d: %q", len(msgs), len(entries), stream)
+			}
+			for i, msg := range msgs {
+				checkRFC5424(t, msg, entries[i])
+			}
+		})
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	entries := testAuditEntries()
+	sink := testSyslogSink("udp", conn.LocalAddr().String(), "octet-counting")
+	defer sink.close()
+	if err := sink.send(entries); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	// One unframed message per datagram
+	buf := make([]byte, 65536)
+	for _, entry := range entries {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("reading datagram: %v", err)
+		}
+		checkRFC5424(t, string(buf[:n]), entry)
+	}
+}
+
+func TestForwardBatchAdvancesCursorAfterSend(t *testing.T) {
+	entries := testAuditEntries()
+	type advanced struct {
+		orgIDs []string
+		seqs   []int64
+	}
+	var calls []advanced
+	advance := func(orgIDs []string, seqs []int64) error {
+		calls = append(calls, advanced{orgIDs, seqs})
+		return nil
+	}
+
+	// Receiver down: the batch fails and the cursor stays where it was
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	down := testSyslogSink("tcp", addr, "octet-counting")
+	if err := forwardBatch(entries, down.send, advance); err == nil {
+		t.Fatal("send to a closed port succeeded")
+	}
+	if len(calls) != 0 {
+		t.Fatalf("cursor advanced after a failed send: %+v", calls)
+	}
+
+	// Receiver up: the cursor moves to each organization's last entry
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := acceptAll(ln)
+	up := testSyslogSink("tcp", ln.Addr().String(), "octet-counting")
+	if err := forwardBatch(entries, up.send, advance); err != nil {
+		t.Fatalf("forwardBatch: %v", err)
+	}
+	up.close()
+	if msgs := readOctetCounted(t, <-received); len(msgs) != len(entries) {
+		t.Fatalf("received %d messages, want %d", len(msgs), len(entries))
+	}
+	if len(calls) != 1 {
+		t.Fatalf("cursor advanced %d times, want once", len(calls))
+	}
+	got := calls[0]
+	if strings.Join(got.orgIDs, ",") != "org-a,org-b" || len(got.seqs) != 2 || got.seqs[0] != 2 || got.seqs[1] != 7 {
+		t.Errorf("cursors = %v %v, want org-a:2 org-b:7", got.orgIDs, got.seqs)
+	}
+
+	// A failed cursor update fails the batch so it is sent again
+	failing := func([]string, []int64) error { return errors.New("database unavailable") }
+	if err := forwardBatch(entries, func([]AuditChainEntry) error { return nil }, failing); err == nil {
+		t.Error("forwardBatch ignored a failed cursor update")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Standard import validation
+//
+// A standard file is validated before anything is written: required fields,
+// duplicate control IDs and a total_controls that disagrees with the file. In
+// strict mode any problem rejects the file. In lenient mode invalid controls
+// (and controls whose ID belongs to another standard) are skipped and the rest
+// imported, and a total_controls mismatch is only a warning. Either way the
+// import runs in one transaction and reports the outcome of every control.
+
+const (
+	StandardImportStrict  = "strict"
+	StandardImportLenient = "lenient"
+
+	// Outcomes of a control
+	ControlImportCreated   = "created"
+	ControlImportUpdated   = "updated"
+	ControlImportUnchanged = "unchanged"
+	ControlImportSkipped   = "skipped" // lenient mode: not imported because of its errors
+	ControlImportInvalid   = "invalid" // the import failed; this control has errors
+	ControlImportValid     = "valid"   // the import failed; this control has none
+)
+
+// StandardImportOptions select how a file is imported
+type StandardImportOptions struct {
+	Mode   string // strict or lenient (default)
+	DryRun bool   // validate and diff without writing
+}
+
+// StandardImportIssue is a problem with the file as a whole
+type StandardImportIssue struct {
+	Field   string `json:"field"` // e.g. standard.version
+	Message string `json:"message"`
+}
+
+// ControlImportResult is the outcome for one control of the file
+type ControlImportResult struct {
+	Index     int      `json:"index"` // position in the file's controls array
+	ControlID string   `json:"control_id"`
+	Status    string   `json:"status"`
+	Errors    []string `json:"errors,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// StandardImportReport is the result of importing a standard file
+type StandardImportReport struct {
+	Status           string                `json:"status"` // success, partial (lenient, controls skipped) or failed
+	Error            string                `json:"error,omitempty"`
+	Mode             string                `json:"mode"`
+	DryRun           bool                  `json:"dry_run,omitempty"`
+	Standard         string                `json:"standard"`
+	ControlsImported int                   `json:"controls_imported"`
+	ControlsSkipped  int                   `json:"controls_skipped"`
+	Errors           []StandardImportIssue `json:"errors,omitempty"`
+	Warnings         []StandardImportIssue `json:"warnings,omitempty"`
+	Controls         []ControlImportResult `json:"controls"`
+	Diff             *StandardDiff         `json:"diff,omitempty"`
+}
+
+// Failed reports whether nothing was (or would be) imported
+func (r *StandardImportReport) Failed() bool {
+	return r.Status == "failed"
+}
+
+// fail marks the report failed with a summary for the caller
+func (r *StandardImportReport) fail(summary string) {
+	r.Status, r.Error, r.ControlsImported = "failed", summary, 0
+	for i := range r.Controls {
+		if len(r.Controls[i].Errors) > 0 {
+			r.Controls[i].Status = ControlImportInvalid
+		} else {
+			r.Controls[i].Status = ControlImportValid
+		}
+	}
+}
+
+// controlErrorCount counts the controls with errors
+func (r *StandardImportReport) controlErrorCount() int {
+	n := 0
+	for _, c := range r.Controls {
+		if len(c.Errors) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// validateStandardImport checks a standard file and starts its report. It
+// does not consult the database.
+func validateStandardImport(data StandardImportData, opts StandardImportOptions) *StandardImportReport {
+	report := &StandardImportReport{
+		Status:   "success",
+		Mode:     opts.Mode,
+		DryRun:   opts.DryRun,
+		Standard: data.Standard.Code,
+		Controls: make([]ControlImportResult, len(data.Controls)),
+	}
+	addError := func(field, message string) {
+		report.Errors = append(report.Errors, StandardImportIssue{Field: field, Message: message})
+	}
+
+	required := [][2]string{
+		{"code", data.Standard.Code},
+		{"name", data.Standard.Name},
+		{"version", data.Standard.Version},
+		{"organization", data.Standard.Organization},
+	}
+	for _, f := range required {
+		if strings.TrimSpace(f[1]) == "" {
+			addError("standard."+f[0], "is required")
+		}
+	}
+	if data.Standard.Code != strings.TrimSpace(data.Standard.Code) {
+		addError("standard.code", "must not start or end with spaces")
+	}
+	if data.Standard.PublishedDate != "" {
+		if _, err := time.Parse("2006-01-02", data.Standard.PublishedDate); err != nil {
+			addError("standard.published_date", "must be a date (YYYY-MM-DD)")
+		}
+	}
+	if data.Standard.Supersedes != "" && data.Standard.Supersedes == data.Standard.Code {
+		addError("standard.supersedes", "must name another standard")
+	}
+	if len(data.Controls) == 0 {
+		addError("controls", "the file has no controls")
+	}
+	if data.Standard.TotalControls < 0 {
+		addError("standard.total_controls", "must not be negative")
+	} else if data.Standard.TotalControls > 0 && data.Standard.TotalControls != len(data.Controls) {
+		issue := StandardImportIssue{
+			Field:   "standard.total_controls",
+			Message: fmt.Sprintf("is %d but the file has %d controls", data.Standard.TotalControls, len(data.Controls)),
+		}
+		if opts.Mode == StandardImportStrict {
+			report.Errors = append(report.Errors, issue)
+		} else {
+			report.Warnings = append(report.Warnings, issue)
+		}
+	}
+
+	firstIndex := map[string]int{}
+	for i, c := range data.Controls {
+		result := &report.Controls[i]
+		result.Index, result.ControlID = i, c.ControlID
+
+		fields := [][2]string{
+			{"control_id", c.ControlID},
+			{"name", c.Name},
+			{"family", c.Family},
+			{"description", c.Description},
+		}
+		for _, f := range fields {
+			if strings.TrimSpace(f[1]) == "" {
+				result.Errors = append(result.Errors, f[0]+" is required")
+			}
+		}
+		if c.ControlID != strings.TrimSpace(c.ControlID) {
+			result.Errors = append(result.Errors, "control_id must not start or end with spaces")
+		}
+		if c.ControlID != "" {
+			if first, ok := firstIndex[c.ControlID]; ok {
+				result.Errors = append(result.Errors, fmt.Sprintf("duplicate control_id, first used by controls[%d]", first))
+			} else {
+				firstIndex[c.ControlID] = i
+			}
+		}
+		for _, id := range c.Replaces {
+			if id == c.ControlID {
+				result.Errors = append(result.Errors, "a control cannot replace itself")
+			}
+		}
+		article := c.Article
+		if article.FullText == "" && (article.ArticleNumber != "" || article.SectionName != "" || article.Guidance != "" || article.ExternalReferences != "") {
+			result.Warnings = append(result.Warnings, "article is ignored without full_text")
+		}
+	}
+	return report
+}
+
+// diffControlProblems lists, by control ID, what the comparison with the
+// library found wrong with single controls
+func diffControlProblems(diff *StandardDiff) map[string][]string {
+	problems := map[string][]string{}
+	for _, c := range diff.Conflicts {
+		problems[c.ControlID] = append(problems[c.ControlID], "control_id already belongs to "+c.Standard)
+	}
+	for id, errs := range diff.controlErrors {
+		problems[id] = append(problems[id], errs...)
+	}
+	return problems
+}
+
+// recordOutcomes sets the status of every control from the diff of the
+// controls being imported
+func (r *StandardImportReport) recordOutcomes(diff *StandardDiff) {
+	added, changed := map[string]bool{}, map[string]bool{}
+	for _, c := range diff.Added {
+		added[c.ControlID] = true
+	}
+	for _, c := range diff.Changed {
+		if c.PreviousID == "" {
+			changed[c.ControlID] = true
+		}
+	}
+
+	r.ControlsImported, r.ControlsSkipped = 0, 0
+	for i := range r.Controls {
+		c := &r.Controls[i]
+		switch {
+		case len(c.Errors) > 0:
+			c.Status = ControlImportSkipped
+			r.ControlsSkipped++
+			continue
+		case diff.Action != StandardImportUpdate || added[c.ControlID]:
+			c.Status = ControlImportCreated
+		case changed[c.ControlID]:
+			c.Status = ControlImportUpdated
+		default:
+			c.Status = ControlImportUnchanged
+		}
+		r.ControlsImported++
+	}
+	if r.ControlsSkipped > 0 {
+		r.Status = "partial"
+	}
+}
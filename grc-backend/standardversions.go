@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Standard versions
+//
+// Each version of a standard is imported under its own code (ISO-27001-2013,
+// ISO-27001-2022) with its own control IDs, and the versions of one standard
+// share a lineage. A file declares the version it supersedes; its controls can
+// name the controls they replace, and otherwise take over from a control of the
+// same name. Importing a file can be previewed as a diff, and re-importing the
+// same code keeps the text it replaces as a revision. Once a new version is in
+// the library, each organization migrates its activated controls, evidence
+// included, with a plan proposed from those matches.
+
+const (
+	StandardImportCreate     = "create"      // a new standard
+	StandardImportUpdate     = "update"      // the same code again
+	StandardImportNewVersion = "new_version" // a new code superseding an imported one
+
+	SuccessorReplaces = "replaces" // declared with "replaces" in the file
+	SuccessorName     = "name"     // same control name
+)
+
+// StandardDiff is what importing a standard file changes compared to the
+// library. For a new version it compares against the superseded version.
+type StandardDiff struct {
+	Code       string            `json:"code"`
+	Version    string            `json:"version"`
+	Lineage    string            `json:"lineage"`
+	Action     string            `json:"action"`
+	ComparedTo *ControlStandard  `json:"compared_to,omitempty"`
+	Metadata   []FieldChange     `json:"metadata_changes,omitempty"`
+	Added      []DiffControl     `json:"added"`
+	Removed    []DiffControl     `json:"removed"`
+	Changed    []ControlChange   `json:"changed"`
+	Unchanged  int               `json:"unchanged"`
+	Conflicts  []ControlConflict `json:"conflicts,omitempty"`
+	Errors     []string          `json:"errors,omitempty"`
+	matches    []controlMatch    // predecessor/successor pairs of a new version
+	// controlErrors are problems with single controls, by control ID
+	controlErrors map[string][]string
+}
+
+// Blocked reports whether the import must be refused
+func (d *StandardDiff) Blocked() bool {
+	return len(d.Errors) > 0 || len(d.Conflicts) > 0 || len(d.controlErrors) > 0
+}
+
+// FieldChange is one field whose value differs
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// DiffControl identifies a control that is added or removed
+type DiffControl struct {
+	ControlID string `json:"control_id"`
+	Name      string `json:"name"`
+	Family    string `json:"family"`
+}
+
+// ControlChange is a control whose text changed, or that a control of the new
+// version takes over from (PreviousID set)
+type ControlChange struct {
+	ControlID  string        `json:"control_id"`
+	PreviousID string        `json:"previous_id,omitempty"`
+	Match      string        `json:"match,omitempty"`
+	Fields     []FieldChange `json:"fields"`
+}
+
+// ControlConflict is a control ID in the file that already belongs to another
+// standard. Importing it would move the control, so the import is refused.
+type ControlConflict struct {
+	ControlID string `json:"control_id"`
+	Standard  string `json:"standard"`
+}
+
+// controlMatch pairs a control of the superseded version with its successor
+type controlMatch struct {
+	predecessor StandardImportControl
+	successor   StandardImportControl
+	match       string
+}
+
+// controlFields lists the compared fields of a control
+func controlFields(c StandardImportControl) [][2]string {
+	return [][2]string{
+		{"name", c.Name},
+		{"family", c.Family},
+		{"description", c.Description},
+		{"article_number", c.Article.ArticleNumber},
+		{"section_name", c.Article.SectionName},
+		{"full_text", c.Article.FullText},
+		{"guidance", c.Article.Guidance},
+		{"external_references", c.Article.ExternalReferences},
+	}
+}
+
+// diffControlFields returns the fields that differ between two controls
+func diffControlFields(old, new StandardImportControl) []FieldChange {
+	changes := []FieldChange{}
+	newFields := controlFields(new)
+	for i, f := range controlFields(old) {
+		if f[1] != newFields[i][1] {
+			changes = append(changes, FieldChange{Field: f[0], Old: f[1], New: newFields[i][1]})
+		}
+	}
+	return changes
+}
+
+// requirementChanged reports whether the requirement itself, rather than its
+// naming or guidance, differs between two controls
+func requirementChanged(changes []FieldChange) bool {
+	for _, c := range changes {
+		if c.Field == "description" || c.Field == "full_text" {
+			return true
+		}
+	}
+	return false
+}
+
+func diffControl(c StandardImportControl) DiffControl {
+	return DiffControl{ControlID: c.ControlID, Name: c.Name, Family: c.Family}
+}
+
+// compareStandardControls fills the control sections of a diff. An update
+// matches controls by ID; a new version by "replaces", then by name.
+func compareStandardControls(diff *StandardDiff, base, incoming []StandardImportControl) {
+	diff.Added, diff.Removed, diff.Changed = []DiffControl{}, []DiffControl{}, []ControlChange{}
+	diff.controlErrors = map[string][]string{}
+	byID := map[string]StandardImportControl{}
+	for _, c := range base {
+		byID[c.ControlID] = c
+	}
+
+	matched := map[string]bool{} // base controls with a counterpart
+	if diff.Action != StandardImportNewVersion {
+		for _, c := range incoming {
+			old, ok := byID[c.ControlID]
+			if !ok {
+				diff.Added = append(diff.Added, diffControl(c))
+				continue
+			}
+			matched[c.ControlID] = true
+			if fields := diffControlFields(old, c); len(fields) > 0 {
+				diff.Changed = append(diff.Changed, ControlChange{ControlID: c.ControlID, Fields: fields})
+			} else {
+				diff.Unchanged++
+			}
+		}
+	} else {
+		byName := map[string][]StandardImportControl{}
+		for _, c := range base {
+			key := strings.ToLower(strings.TrimSpace(c.Name))
+			byName[key] = append(byName[key], c)
+		}
+		for _, c := range incoming {
+			var pairs []controlMatch
+			for _, id := range c.Replaces {
+				if old, ok := byID[id]; ok {
+					pairs = append(pairs, controlMatch{predecessor: old, successor: c, match: SuccessorReplaces})
+				} else {
+					diff.controlErrors[c.ControlID] = append(diff.controlErrors[c.ControlID],
+						fmt.Sprintf("replaces %s, which is not a control of %s", id, diff.ComparedTo.Code))
+				}
+			}
+			// Names only match when they are unambiguous
+			if named := byName[strings.ToLower(strings.TrimSpace(c.Name))]; len(c.Replaces) == 0 && len(named) == 1 {
+				pairs = append(pairs, controlMatch{predecessor: named[0], successor: c, match: SuccessorName})
+			}
+			if len(pairs) == 0 {
+				diff.Added = append(diff.Added, diffControl(c))
+				continue
+			}
+			for _, p := range pairs {
+				matched[p.predecessor.ControlID] = true
+				diff.matches = append(diff.matches, p)
+				diff.Changed = append(diff.Changed, ControlChange{
+					ControlID:  c.ControlID,
+					PreviousID: p.predecessor.ControlID,
+					Match:      p.match,
+					Fields:     diffControlFields(p.predecessor, c),
+				})
+			}
+		}
+	}
+
+	for _, c := range base {
+		if !matched[c.ControlID] {
+			diff.Removed = append(diff.Removed, diffControl(c))
+		}
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].ControlID < diff.Removed[j].ControlID })
+}
+
+// compareStandardMetadata lists the metadata fields an update changes
+func compareStandardMetadata(diff *StandardDiff, existing *ControlStandard, data StandardImportData) {
+	published := ""
+	if existing.PublishedDate != nil {
+		published = existing.PublishedDate.Format("2006-01-02")
+	}
+	fields := [][3]string{
+		{"name", existing.Name, data.Standard.Name},
+		{"version", existing.Version, data.Standard.Version},
+		{"organization", existing.Organization, data.Standard.Organization},
+		{"published_date", published, data.Standard.PublishedDate},
+		{"description", existing.Description, data.Standard.Description},
+		{"website_url", existing.WebsiteURL, data.Standard.WebsiteURL},
+		{"total_controls", fmt.Sprint(existing.TotalControls), fmt.Sprint(data.Standard.TotalControls)},
+	}
+	for _, f := range fields {
+		if f[1] != f[2] {
+			diff.Metadata = append(diff.Metadata, FieldChange{Field: f[0], Old: f[1], New: f[2]})
+		}
+	}
+}
+
+// StandardMigrationPlan proposes where each of an organization's activated
+// controls of the superseded version goes in the new one
+type StandardMigrationPlan struct {
+	Standard *ControlStandard      `json:"standard"`
+	From     *ControlStandard      `json:"from"`
+	Controls []ControlMigrationRow `json:"controls"`
+}
+
+// ControlMigrationRow is one activated control of the superseded version
+type ControlMigrationRow struct {
+	ActivatedControlID string                   `json:"activated_control_id"`
+	ControlID          string                   `json:"control_id"`
+	Name               string                   `json:"name"`
+	Status             string                   `json:"status"`
+	EvidenceCount      int                      `json:"evidence_count"`
+	Targets            []ControlMigrationTarget `json:"targets"`
+}
+
+// ControlMigrationTarget is a control of the new version a row can migrate to
+type ControlMigrationTarget struct {
+	ControlID          string  `json:"control_id"`
+	Name               string  `json:"name"`
+	Match              string  `json:"match"`                          // replaces, name or a mapping relationship
+	ActivatedControlID *string `json:"activated_control_id,omitempty"` // set if already activated
+}
+
+// StandardMigrationRequest is the JSON for applying a migration. Without
+// controls, every proposed row with targets is migrated as proposed.
+type StandardMigrationRequest struct {
+	Controls []struct {
+		ActivatedControlID string   `json:"activated_control_id"`
+		To                 []string `json:"to"`
+	} `json:"controls"`
+	KeepPrevious bool `json:"keep_previous"` // leave the old activations active
+}
+
+// StandardMigrationResult summarizes an applied migration
+type StandardMigrationResult struct {
+	Migrated       int                       `json:"migrated"`          // activated controls of the old version handled
+	Moved          int                       `json:"moved"`             // re-pointed to a new control, evidence and all
+	Activated      int                       `json:"activated"`         // new activations created for further targets
+	EvidenceCopied int                       `json:"evidence_copied"`   // evidence entries copied to further targets
+	Skipped        []string                  `json:"skipped,omitempty"` // controls with no target
+	Controls       []ControlMigrationOutcome `json:"controls"`
+}
+
+// ControlMigrationOutcome is what happened to one activated control
+type ControlMigrationOutcome struct {
+	ActivatedControlID string   `json:"activated_control_id"`
+	From               string   `json:"from"`
+	To                 []string `json:"to"`
+	Moved              bool     `json:"moved"` // the activation itself now belongs to To[0]
+}
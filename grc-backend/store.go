@@ -4,23 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Store holds the database connection pool
+// Store holds the database connection pool. Queries are scoped to the
+// organization carried by their context (see tenancy.go).
 type Store struct {
-	db *pgxpool.Pool
+	db     *tenantDB
+	events chan struct{} // signalled when domain events are committed
 }
 
 // NewStore creates a new Store
 func NewStore(db *pgxpool.Pool) *Store {
-	return &Store{db: db}
+	return &Store{db: &tenantDB{pool: db}, events: make(chan struct{}, 1)}
 }
 
 // ControlLibraryItem represents a row in 'control_library'
@@ -76,14 +81,32 @@ type ControlEvidenceLog struct {
 
 // EvidenceFile represents a file attached to evidence
 type EvidenceFile struct {
-	ID              string `json:"id" db:"id"`
-	EvidenceLogID   string `json:"evidence_log_id" db:"evidence_log_id"`
-	Filename        string `json:"filename" db:"filename"`
-	StoredFilename  string `json:"stored_filename" db:"stored_filename"`
-	FileSize        int64  `json:"file_size" db:"file_size"`
-	ContentType     string `json:"content_type" db:"content_type"`
-	UploadedByID    string `json:"uploaded_by_id" db:"uploaded_by_id"`
-	UploadedAt      string `json:"uploaded_at" db:"uploaded_at"`
+	ID             string `json:"id" db:"id"`
+	EvidenceLogID  string `json:"evidence_log_id" db:"evidence_log_id"`
+	Filename       string `json:"filename" db:"filename"`
+	StoredFilename string `json:"stored_filename" db:"stored_filename"`
+	FileSize       int64  `json:"file_size" db:"file_size"`
+	ContentType    string `json:"content_type" db:"content_type"`
+	UploadedByID   string `json:"uploaded_by_id" db:"uploaded_by_id"`
+	UploadedAt     string `json:"uploaded_at" db:"uploaded_at"`
+}
+
+// EvidenceAccess describes how a user relates to an activated control's evidence
+type EvidenceAccess struct {
+	ActivatedControlID string
+	OwnerID            string
+	IsOwner            bool
+	IsDelegate         bool
+	IsPerformer        bool // only set for evidence log lookups
+}
+
+// ControlDelegate is a user allowed to submit evidence on behalf of a control's owner
+type ControlDelegate struct {
+	UserID        string    `json:"user_id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	DelegatedByID *string   `json:"delegated_by_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 // SubmitEvidenceRequest is the JSON for submitting evidence
@@ -157,15 +180,17 @@ type UpdateTicketRequest struct {
 
 // User represents a row in 'users'
 type User struct {
-	ID                   string `json:"id" db:"id"`
-	Email                string `json:"email" db:"email"`
-	Name                 string `json:"name" db:"name"`
-	Role                 string `json:"role" db:"role"`
-	OnboardingCompleted  bool   `json:"onboarding_completed" db:"onboarding_completed"`
-	CompanyName          string `json:"company_name,omitempty" db:"company_name"`
-	CompanySize          string `json:"company_size,omitempty" db:"company_size"`
-	CompanyIndustry      string `json:"company_industry,omitempty" db:"company_industry"`
-	PrimaryRegulations   string `json:"primary_regulations,omitempty" db:"primary_regulations"`
+	ID                  string     `json:"id" db:"id"`
+	Email               string     `json:"email" db:"email"`
+	Name                string     `json:"name" db:"name"`
+	Role                string     `json:"role" db:"role"`
+	OnboardingCompleted bool       `json:"onboarding_completed" db:"onboarding_completed"`
+	CompanyName         string     `json:"company_name,omitempty" db:"company_name"`
+	CompanySize         string     `json:"company_size,omitempty" db:"company_size"`
+	CompanyIndustry     string     `json:"company_industry,omitempty" db:"company_industry"`
+	PrimaryRegulations  string     `json:"primary_regulations,omitempty" db:"primary_regulations"`
+	OrganizationID      string     `json:"organization_id" db:"organization_id"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty" db:"locked_until"`
 }
 
 // LoginRequest is the JSON for login
@@ -176,8 +201,28 @@ type LoginRequest struct {
 
 // LoginResponse is the JSON response for login
 type LoginResponse struct {
-	User  User   `json:"user"`
-	Token string `json:"token"`
+	User         User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// RefreshRequest is the JSON for exchanging a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Session represents an active login session in 'user_sessions'
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	AuthMethod string    `json:"auth_method"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
 }
 
 // RegisterRequest is the JSON for registration
@@ -187,6 +232,24 @@ type RegisterRequest struct {
 	Password string `json:"password"`
 }
 
+// InviteUserRequest is the JSON for an admin inviting a new user
+type InviteUserRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+}
+
+// ForgotPasswordRequest is the JSON for requesting a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest is the JSON for setting a password with a reset or invitation token
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
 // Asset represents a row in 'assets'
 type Asset struct {
 	ID        string    `json:"id" db:"id"`
@@ -495,6 +558,9 @@ func (s *Store) SubmitControlEvidence(ctx context.Context, activatedControlID st
 	intervalQuery := "SELECT review_interval_days FROM activated_controls WHERE id = $1"
 	err = tx.QueryRow(ctx, intervalQuery, activatedControlID).Scan(&reviewIntervalDays)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("control not found")
+		}
 		return nil, fmt.Errorf("control with ID %s not found: %w", activatedControlID, err)
 	}
 
@@ -528,6 +594,11 @@ func (s *Store) SubmitControlEvidence(ctx context.Context, activatedControlID st
 		return nil, err
 	}
 
+	// The due date moved, so the reminder cycle starts over
+	if _, err := tx.Exec(ctx, `DELETE FROM control_reminders WHERE activated_control_id = $1`, activatedControlID); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
@@ -917,22 +988,25 @@ func (s *Store) AuthenticateUser(ctx context.Context, email, password string) (*
 		       COALESCE(company_name, '') as company_name,
 		       COALESCE(company_size, '') as company_size,
 		       COALESCE(company_industry, '') as company_industry,
-		       COALESCE(primary_regulations, '') as primary_regulations,
-		       COALESCE(password_hash, '') as password_hash
+		       COALESCE(primary_regulations, '') as primary_regulations, organization_id,
+		       COALESCE(password_hash, '') as password_hash, active
 		FROM users
-		WHERE email = $1 AND role IN ('admin', 'user')
+		WHERE email = $1
 		LIMIT 1;
 	`
 
 	var user User
 	var passwordHash string
+	var active bool
 	err := s.db.QueryRow(ctx, query, email).Scan(
 		&user.ID, &user.Email, &user.Name, &user.Role, &user.OnboardingCompleted,
-		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations,
-		&passwordHash,
+		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations, &user.OrganizationID,
+		&passwordHash, &active,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Spend the same time as a wrong password so response times do not reveal which emails exist
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
 			return nil, fmt.Errorf("invalid credentials")
 		}
 		log.Printf("Error authenticating user: %v", err)
@@ -946,10 +1020,13 @@ func (s *Store) AuthenticateUser(ctx context.Context, email, password string) (*
 			return nil, fmt.Errorf("invalid credentials")
 		}
 	} else {
-		// For demo purposes, accept test passwords for seeded users without password_hash
-		if password != "admin123" && password != "user123" && password != "john123" && password != "password123" {
-			return nil, fmt.Errorf("invalid credentials")
-		}
+		// Accounts without a local password (e.g., SSO-provisioned) cannot sign in with one
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	// Checked after the password so deactivation does not reveal which emails exist
+	if !active {
+		return nil, ErrAccountDeactivated
 	}
 
 	return &user, nil
@@ -971,13 +1048,13 @@ func (s *Store) RegisterUser(ctx context.Context, req RegisterRequest) (*User, e
 		          COALESCE(company_name, '') as company_name,
 		          COALESCE(company_size, '') as company_size,
 		          COALESCE(company_industry, '') as company_industry,
-		          COALESCE(primary_regulations, '') as primary_regulations;
+		          COALESCE(primary_regulations, '') as primary_regulations, organization_id;
 	`
 
 	var user User
 	err = s.db.QueryRow(ctx, query, req.Email, req.Name, string(hashedPassword)).Scan(
 		&user.ID, &user.Email, &user.Name, &user.Role, &user.OnboardingCompleted,
-		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations,
+		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations, &user.OrganizationID,
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
@@ -990,13 +1067,38 @@ func (s *Store) RegisterUser(ctx context.Context, req RegisterRequest) (*User, e
 	return &user, nil
 }
 
+// CreateAdminUser creates a local administrator with a password, for bootstrapping
+// an organization from the command line. The user belongs to ctx's organization.
+func (s *Store) CreateAdminUser(ctx context.Context, email, name, password string, superAdmin bool) (*User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		return nil, fmt.Errorf("failed to hash password")
+	}
+
+	var userID string
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO users (email, name, role, password_hash, onboarding_completed, is_super_admin)
+		VALUES ($1, $2, 'admin', $3, true, $4)
+		RETURNING id;
+	`, email, name, string(hashedPassword), superAdmin).Scan(&userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
+			return nil, fmt.Errorf("email already exists")
+		}
+		log.Printf("Error INSERT into users: %v", err)
+		return nil, err
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
 // UpdateUserProfileRequest is the JSON for updating user profile
 type UpdateUserProfileRequest struct {
-	CompanyName        *string `json:"company_name,omitempty"`
-	CompanySize        *string `json:"company_size,omitempty"`
-	CompanyIndustry    *string `json:"company_industry,omitempty"`
-	PrimaryRegulations *string `json:"primary_regulations,omitempty"`
-	OnboardingCompleted *bool  `json:"onboarding_completed,omitempty"`
+	CompanyName         *string `json:"company_name,omitempty"`
+	CompanySize         *string `json:"company_size,omitempty"`
+	CompanyIndustry     *string `json:"company_industry,omitempty"`
+	PrimaryRegulations  *string `json:"primary_regulations,omitempty"`
+	OnboardingCompleted *bool   `json:"onboarding_completed,omitempty"`
 }
 
 // UpdateUserProfile updates the user's profile and onboarding status
@@ -1045,7 +1147,7 @@ func (s *Store) UpdateUserProfile(ctx context.Context, userID string, req Update
 		          COALESCE(company_name, '') as company_name,
 		          COALESCE(company_size, '') as company_size,
 		          COALESCE(company_industry, '') as company_industry,
-		          COALESCE(primary_regulations, '') as primary_regulations;
+		          COALESCE(primary_regulations, '') as primary_regulations, organization_id;
 	`, setClause, argCount)
 
 	args = append(args, userID)
@@ -1053,7 +1155,7 @@ func (s *Store) UpdateUserProfile(ctx context.Context, userID string, req Update
 	var user User
 	err := s.db.QueryRow(ctx, query, args...).Scan(
 		&user.ID, &user.Email, &user.Name, &user.Role, &user.OnboardingCompleted,
-		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations,
+		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations, &user.OrganizationID,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -1072,14 +1174,14 @@ func (s *Store) GetUserByID(ctx context.Context, userID string) (*User, error) {
 		       COALESCE(company_name, '') as company_name,
 		       COALESCE(company_size, '') as company_size,
 		       COALESCE(company_industry, '') as company_industry,
-		       COALESCE(primary_regulations, '') as primary_regulations
+		       COALESCE(primary_regulations, '') as primary_regulations, organization_id
 		FROM users
 		WHERE id = $1;
 	`
 	var user User
 	err := s.db.QueryRow(ctx, query, userID).Scan(
 		&user.ID, &user.Email, &user.Name, &user.Role, &user.OnboardingCompleted,
-		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations,
+		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations, &user.OrganizationID,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -1091,2232 +1193,6232 @@ func (s *Store) GetUserByID(ctx context.Context, userID string) (*User, error) {
 	return &user, nil
 }
 
-// Asset CRUD operations
-func (s *Store) CreateAsset(ctx context.Context, req CreateAssetRequest) (*Asset, error) {
-	query := `
-		INSERT INTO assets
-		(name, asset_type, owner_id, status)
-		VALUES ($1, $2, $3, 'active')
-		RETURNING id, name, asset_type, owner_id, status, created_at, updated_at;
-	`
-	var asset Asset
-	err := s.db.QueryRow(ctx, query,
-		req.Name, req.AssetType, req.OwnerID,
-	).Scan(
-		&asset.ID, &asset.Name, &asset.AssetType,
-		&asset.OwnerID, &asset.Status, &asset.CreatedAt, &asset.UpdatedAt,
-	)
-	if err != nil {
-		log.Printf("Error INSERT into assets: %v", err)
-		return nil, err
-	}
-	return &asset, nil
-}
-
-func (s *Store) GetAssets(ctx context.Context) ([]Asset, error) {
+// ListUsers returns all users ordered by name
+func (s *Store) ListUsers(ctx context.Context) ([]User, error) {
 	query := `
-		SELECT id, name, asset_type, owner_id, status, created_at, updated_at
-		FROM assets ORDER BY created_at DESC;
+		SELECT id, email, name, role, onboarding_completed,
+		       COALESCE(company_name, '') as company_name,
+		       COALESCE(company_size, '') as company_size,
+		       COALESCE(company_industry, '') as company_industry,
+		       COALESCE(primary_regulations, '') as primary_regulations, organization_id,
+		       CASE WHEN locked_until > NOW() THEN locked_until END as locked_until
+		FROM users
+		ORDER BY name;
 	`
 	rows, err := s.db.Query(ctx, query)
 	if err != nil {
-		log.Printf("Error querying assets: %v", err)
+		log.Printf("Error querying users: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var assets []Asset
+	users := []User{}
 	for rows.Next() {
-		var asset Asset
+		var user User
 		if err := rows.Scan(
-			&asset.ID, &asset.Name, &asset.AssetType,
-			&asset.OwnerID, &asset.Status, &asset.CreatedAt, &asset.UpdatedAt,
+			&user.ID, &user.Email, &user.Name, &user.Role, &user.OnboardingCompleted,
+			&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations, &user.OrganizationID,
+			&user.LockedUntil,
 		); err != nil {
-			log.Printf("Error scanning asset row: %v", err)
 			return nil, err
 		}
-		assets = append(assets, asset)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+		users = append(users, user)
 	}
-	if assets == nil {
-		assets = make([]Asset, 0)
-	}
-	return assets, nil
+	return users, rows.Err()
 }
 
-func (s *Store) GetAssetByID(ctx context.Context, assetID string) (*Asset, error) {
-	query := `
-		SELECT id, name, asset_type, owner_id, status, created_at, updated_at
-		FROM assets WHERE id = $1;
-	`
-	var asset Asset
-	err := s.db.QueryRow(ctx, query, assetID).Scan(
-		&asset.ID, &asset.Name, &asset.AssetType,
-		&asset.OwnerID, &asset.Status, &asset.CreatedAt, &asset.UpdatedAt,
-	)
+// UpdateUserRole assigns a role and returns the previous role with the updated user.
+// The last remaining admin cannot be demoted.
+func (s *Store) UpdateUserRole(ctx context.Context, userID, role string) (string, *User, error) {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("asset not found")
-		}
-		log.Printf("Error querying asset by ID: %v", err)
-		return nil, err
+		return "", nil, err
 	}
-	return &asset, nil
-}
-
-func (s *Store) UpdateAsset(ctx context.Context, assetID string, req UpdateAssetRequest) (*Asset, error) {
-	setParts := []string{}
-	args := []interface{}{}
-	argCount := 1
+	defer tx.Rollback(ctx)
 
-	if req.Name != nil {
-		setParts = append(setParts, fmt.Sprintf("name = $%d", argCount))
-		args = append(args, *req.Name)
-		argCount++
-	}
-	if req.AssetType != nil {
-		setParts = append(setParts, fmt.Sprintf("asset_type = $%d", argCount))
-		args = append(args, *req.AssetType)
-		argCount++
-	}
-	if req.OwnerID != nil {
-		setParts = append(setParts, fmt.Sprintf("owner_id = $%d", argCount))
-		args = append(args, *req.OwnerID)
-		argCount++
-	}
-	if req.Status != nil {
-		setParts = append(setParts, fmt.Sprintf("status = $%d", argCount))
-		args = append(args, *req.Status)
-		argCount++
+	if err := lockUserRoles(ctx, tx); err != nil {
+		return "", nil, err
 	}
 
-	if len(setParts) == 0 {
-		return s.GetAssetByID(ctx, assetID)
+	var previousRole, orgID string
+	err = tx.QueryRow(ctx, `SELECT role, organization_id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&previousRole, &orgID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil, fmt.Errorf("user not found")
+		}
+		return "", nil, err
 	}
 
-	setClause := strings.Join(setParts, ", ")
-	query := fmt.Sprintf(`
-		UPDATE assets
-		SET %s, updated_at = NOW()
-		WHERE id = $%d
-		RETURNING id, name, asset_type, owner_id, status, created_at, updated_at;
-	`, setClause, argCount)
-
-	args = append(args, assetID)
+	if err := checkLastAdmin(ctx, tx, orgID, userID, previousRole, role); err != nil {
+		return "", nil, err
+	}
 
-	var asset Asset
-	err := s.db.QueryRow(ctx, query, args...).Scan(
-		&asset.ID, &asset.Name, &asset.AssetType,
-		&asset.OwnerID, &asset.Status, &asset.CreatedAt, &asset.UpdatedAt,
+	var user User
+	err = tx.QueryRow(ctx, `
+		UPDATE users SET role = $2 WHERE id = $1
+		RETURNING id, email, name, role, onboarding_completed,
+		          COALESCE(company_name, '') as company_name,
+		          COALESCE(company_size, '') as company_size,
+		          COALESCE(company_industry, '') as company_industry,
+		          COALESCE(primary_regulations, '') as primary_regulations, organization_id;
+	`, userID, role).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &user.OnboardingCompleted,
+		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations, &user.OrganizationID,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("asset not found")
-		}
-		log.Printf("Error UPDATE asset: %v", err)
-		return nil, err
+		return "", nil, err
 	}
-	return &asset, nil
-}
 
-func (s *Store) DeleteAsset(ctx context.Context, assetID string) error {
-	query := `DELETE FROM assets WHERE id = $1;`
-	result, err := s.db.Exec(ctx, query, assetID)
-	if err != nil {
-		log.Printf("Error DELETE asset: %v", err)
-		return err
-	}
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("asset not found")
+	if err := tx.Commit(ctx); err != nil {
+		return "", nil, err
 	}
-	return nil
+	return previousRole, &user, nil
 }
 
-// AuditLog represents a row in 'audit_log'
-type AuditLog struct {
-	ID               string    `json:"id" db:"id"`
-	PerformedAt      time.Time `json:"performed_at" db:"performed_at"`
-	UserID           *string   `json:"user_id,omitempty" db:"user_id"`
-	ActionType       string    `json:"action_type" db:"action_type"`
-	TargetEntityType *string   `json:"target_entity_type,omitempty" db:"target_entity_type"`
-	TargetEntityID   *string   `json:"target_entity_id,omitempty" db:"target_entity_id"`
-	Changes          *string   `json:"changes,omitempty" db:"changes"`
-	IPAddress        *string   `json:"ip_address,omitempty" db:"ip_address"`
+// lockUserRoles serializes role changes so two concurrent demotions cannot both
+// pass the last-admin check
+func lockUserRoles(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('user_roles'))`)
+	return err
 }
 
-// LogAudit logs an audit event
-func (s *Store) LogAudit(ctx context.Context, userID *string, actionType string, targetEntityType *string, targetEntityID *string, changes interface{}, ipAddress *string) error {
-	var changesJSON *string
-	if changes != nil {
-		changesBytes, err := json.Marshal(changes)
-		if err != nil {
-			log.Printf("Error marshaling changes to JSON: %v", err)
-			return err
-		}
-		changesStr := string(changesBytes)
-		changesJSON = &changesStr
+// checkLastAdmin refuses to take the admin role from the last active admin of an
+// organization, either by changing it to role or, with an empty role, by
+// deactivating the user. Callers hold lockUserRoles and pass their own tx, which
+// may not be scoped to the organization.
+func checkLastAdmin(ctx context.Context, tx pgx.Tx, orgID, userID, previousRole, role string) error {
+	if previousRole != "admin" || role == "admin" {
+		return nil
 	}
-
-	query := `
-		INSERT INTO audit_log
-		(user_id, action_type, target_entity_type, target_entity_id, changes, ip_address)
-		VALUES ($1, $2, $3, $4, $5, $6);
-	`
-
-	_, err := s.db.Exec(ctx, query, userID, actionType, targetEntityType, targetEntityID, changesJSON, ipAddress)
+	var others int
+	var isActiveAdmin bool
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE id <> $2), COALESCE(bool_or(id = $2), false)
+		FROM users
+		WHERE role = 'admin' AND active AND organization_id = $1;
+	`, orgID, userID).Scan(&others, &isActiveAdmin)
 	if err != nil {
-		log.Printf("Error INSERT into audit_log: %v", err)
 		return err
 	}
+	if isActiveAdmin && others == 0 {
+		return fmt.Errorf("cannot remove the last admin")
+	}
 	return nil
 }
 
-// GetAuditLogs retrieves audit logs with optional filtering
-func (s *Store) GetAuditLogs(ctx context.Context, limit int, offset int, userID *string, actionType *string, entityType *string) ([]AuditLog, error) {
-	query := `
-		SELECT id, performed_at, user_id, action_type, target_entity_type, target_entity_id, changes, ip_address
-		FROM audit_log
-		WHERE ($1::uuid IS NULL OR user_id = $1)
-		AND ($2::text IS NULL OR action_type = $2)
-		AND ($3::text IS NULL OR target_entity_type = $3)
-		ORDER BY performed_at DESC
-		LIMIT $4 OFFSET $5;
-	`
+// Errors of signing in with an external identity
+var (
+	// ErrOIDCIdentityConflict is returned when the email belongs to an account
+	// already linked to another SSO identity
+	ErrOIDCIdentityConflict = errors.New("email is linked to a different identity")
+	ErrAccountDeactivated   = errors.New("account deactivated")
+)
 
-	rows, err := s.db.Query(ctx, query, userID, actionType, entityType, limit, offset)
+// FindOrProvisionOIDCUser resolves an OIDC identity to a platform user. Users are
+// matched by (issuer, subject) first. Otherwise an account with the same email
+// is linked, but only if it has no SSO identity yet; failing that a user is
+// created. An empty role leaves the stored role untouched (new users default to
+// 'user'), and the last admin is never demoted by a login.
+func (s *Store) FindOrProvisionOIDCUser(ctx context.Context, identity OIDCIdentity, role string) (*User, bool, error) {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		log.Printf("Error querying audit logs: %v", err)
-		return nil, err
+		return nil, false, err
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	var logs []AuditLog
-	for rows.Next() {
-		var auditLog AuditLog
-		if err := rows.Scan(
-			&auditLog.ID, &auditLog.PerformedAt, &auditLog.UserID, &auditLog.ActionType,
-			&auditLog.TargetEntityType, &auditLog.TargetEntityID, &auditLog.Changes, &auditLog.IPAddress,
-		); err != nil {
-			log.Printf("Error scanning audit log row: %v", err)
-			return nil, err
+	// Taken before any row lock, in the same order as UpdateUserRole
+	if role != "" {
+		if err := lockUserRoles(ctx, tx); err != nil {
+			return nil, false, err
 		}
-		logs = append(logs, auditLog)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+
+	var userID, currentRole, orgID string
+	var active bool
+	err = tx.QueryRow(ctx, `
+		SELECT id, active, role, organization_id FROM users
+		WHERE oidc_issuer = $1 AND oidc_subject = $2
+		FOR UPDATE;
+	`, identity.Issuer, identity.Subject).Scan(&userID, &active, &currentRole, &orgID)
+	linked := err == nil
+	if errors.Is(err, pgx.ErrNoRows) {
+		var boundSubject *string
+		err = tx.QueryRow(ctx, `
+			SELECT id, active, role, organization_id, oidc_subject FROM users
+			WHERE LOWER(email) = LOWER($1)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE;
+		`, identity.Email).Scan(&userID, &active, &currentRole, &orgID, &boundSubject)
+		if err == nil && boundSubject != nil {
+			return nil, false, ErrOIDCIdentityConflict
+		}
 	}
-	if logs == nil {
-		logs = make([]AuditLog, 0)
+
+	created := false
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		name := identity.Name
+		if name == "" {
+			name = identity.Email
+		}
+		newRole := role
+		if newRole == "" {
+			newRole = "user"
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO users (email, name, role, auth_provider, oidc_issuer, oidc_subject, onboarding_completed)
+			VALUES ($1, $2, $3, 'oidc', $4, $5, false)
+			RETURNING id;
+		`, identity.Email, name, newRole, identity.Issuer, identity.Subject).Scan(&userID)
+		if err != nil {
+			log.Printf("Error INSERT OIDC user: %v", err)
+			return nil, false, err
+		}
+		created = true
+	case err != nil:
+		log.Printf("Error looking up OIDC user: %v", err)
+		return nil, false, err
+	case !active:
+		return nil, false, ErrAccountDeactivated
+	default:
+		if role != "" {
+			if err := checkLastAdmin(ctx, tx, orgID, userID, currentRole, role); err != nil {
+				log.Printf("Keeping role of user %s on OIDC login: %v", userID, err)
+				role = ""
+			}
+		}
+		// Roles of SCIM-managed users follow their directory groups, not the ID token
+		_, err = tx.Exec(ctx, `
+			UPDATE users
+			SET oidc_issuer = $2, oidc_subject = $3,
+			    role = CASE WHEN scim_managed THEN role ELSE COALESCE(NULLIF($4, ''), role) END
+			WHERE id = $1;
+		`, userID, identity.Issuer, identity.Subject, role)
+		if err != nil {
+			log.Printf("Error linking OIDC identity: %v", err)
+			return nil, false, err
+		}
+		if !linked {
+			log.Printf("Linked OIDC identity %s to existing user %s", identity.Subject, userID)
+		}
 	}
-	return logs, nil
-}
 
-// Notification represents a row in 'notifications'
-type Notification struct {
-	ID        string    `json:"id" db:"id"`
-	UserID    string    `json:"user_id" db:"user_id"`
-	Message   string    `json:"message" db:"message"`
-	LinkURL   string    `json:"link_url,omitempty" db:"link_url"`
-	IsRead    bool      `json:"is_read" db:"is_read"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	return user, created, nil
 }
 
-// CreateNotification creates a new notification
-func (s *Store) CreateNotification(ctx context.Context, userID string, message string, linkURL string) error {
-	query := `
-		INSERT INTO notifications
-		(user_id, message, link_url)
-		VALUES ($1, $2, $3);
-	`
+// CreateOIDCLoginState stores the state, PKCE verifier and nonce of a pending OIDC login
+func (s *Store) CreateOIDCLoginState(ctx context.Context, state, codeVerifier, nonce string) error {
+	// Opportunistically clear abandoned logins
+	if _, err := s.db.Exec(ctx, `DELETE FROM oidc_login_states WHERE created_at < NOW() - INTERVAL '1 hour'`); err != nil {
+		log.Printf("Error cleaning up OIDC login states: %v", err)
+	}
 
-	_, err := s.db.Exec(ctx, query, userID, message, linkURL)
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO oidc_login_states (state, code_verifier, nonce)
+		VALUES ($1, $2, $3);
+	`, state, codeVerifier, nonce)
 	if err != nil {
-		log.Printf("Error INSERT into notifications: %v", err)
+		log.Printf("Error INSERT into oidc_login_states: %v", err)
 		return err
 	}
 	return nil
 }
 
-// GetNotificationsForUser retrieves notifications for a specific user
-func (s *Store) GetNotificationsForUser(ctx context.Context, userID string, onlyUnread bool) ([]Notification, error) {
-	var query string
-	if onlyUnread {
-		query = `
-			SELECT id, user_id, message, link_url, is_read, created_at
-			FROM notifications
-			WHERE user_id = $1 AND is_read = false
-			ORDER BY created_at DESC;
-		`
-	} else {
-		query = `
-			SELECT id, user_id, message, link_url, is_read, created_at
-			FROM notifications
-			WHERE user_id = $1
-			ORDER BY created_at DESC;
-		`
+// ConsumeOIDCLoginState deletes and returns a pending login; states are single-use and expire after 10 minutes
+func (s *Store) ConsumeOIDCLoginState(ctx context.Context, state string) (codeVerifier, nonce string, err error) {
+	var fresh bool
+	err = s.db.QueryRow(ctx, `
+		DELETE FROM oidc_login_states
+		WHERE state = $1
+		RETURNING code_verifier, nonce, created_at > NOW() - INTERVAL '10 minutes';
+	`, state).Scan(&codeVerifier, &nonce, &fresh)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !fresh) {
+		return "", "", fmt.Errorf("invalid or expired login state")
 	}
-
-	rows, err := s.db.Query(ctx, query, userID)
 	if err != nil {
-		log.Printf("Error querying notifications: %v", err)
-		return nil, err
+		return "", "", err
 	}
-	defer rows.Close()
+	return codeVerifier, nonce, nil
+}
 
-	var notifications []Notification
-	for rows.Next() {
-		var n Notification
-		if err := rows.Scan(
-			&n.ID, &n.UserID, &n.Message, &n.LinkURL, &n.IsRead, &n.CreatedAt,
-		); err != nil {
-			log.Printf("Error scanning notification row: %v", err)
-			return nil, err
+// ========== PASSWORD RESET & INVITATIONS ==========
+
+// GetLocalUserByEmail returns a user who signs in with a platform password (or has not
+// set one yet). SSO-provisioned accounts are excluded because their password lives with the IdP.
+func (s *Store) GetLocalUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT id, email, name, role, onboarding_completed,
+		       COALESCE(company_name, '') as company_name,
+		       COALESCE(company_size, '') as company_size,
+		       COALESCE(company_industry, '') as company_industry,
+		       COALESCE(primary_regulations, '') as primary_regulations, organization_id
+		FROM users
+		WHERE LOWER(email) = LOWER($1) AND auth_provider = 'local' AND active
+		LIMIT 1;
+	`
+	var user User
+	err := s.db.QueryRow(ctx, query, email).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &user.OnboardingCompleted,
+		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations, &user.OrganizationID,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("user not found")
 		}
-		notifications = append(notifications, n)
-	}
-	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	if notifications == nil {
-		notifications = make([]Notification, 0)
-	}
-	return notifications, nil
+	return &user, nil
 }
 
-// MarkNotificationAsRead marks a notification as read
-func (s *Store) MarkNotificationAsRead(ctx context.Context, notificationID string, userID string) error {
+// InviteUser creates an account without a password; the user sets one through an invitation token
+func (s *Store) InviteUser(ctx context.Context, req InviteUserRequest) (*User, error) {
 	query := `
-		UPDATE notifications
-		SET is_read = true
-		WHERE id = $1 AND user_id = $2;
+		INSERT INTO users (email, name, role, onboarding_completed)
+		VALUES ($1, $2, $3, false)
+		RETURNING id, email, name, role, onboarding_completed,
+		          COALESCE(company_name, '') as company_name,
+		          COALESCE(company_size, '') as company_size,
+		          COALESCE(company_industry, '') as company_industry,
+		          COALESCE(primary_regulations, '') as primary_regulations, organization_id;
 	`
 
-	result, err := s.db.Exec(ctx, query, notificationID, userID)
+	var user User
+	err := s.db.QueryRow(ctx, query, req.Email, req.Name, req.Role).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &user.OnboardingCompleted,
+		&user.CompanyName, &user.CompanySize, &user.CompanyIndustry, &user.PrimaryRegulations, &user.OrganizationID,
+	)
 	if err != nil {
-		log.Printf("Error UPDATE notification: %v", err)
-		return err
-	}
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("notification not found or not owned by user")
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
+			return nil, fmt.Errorf("email already exists")
+		}
+		log.Printf("Error INSERT into users: %v", err)
+		return nil, err
 	}
-	return nil
+
+	return &user, nil
 }
 
-// GetDashboardSummary provides comprehensive dashboard statistics
-func (s *Store) GetDashboardSummary(ctx context.Context) (map[string]interface{}, error) {
-	// Get control statistics
-	controlStats := make(map[string]interface{})
+// CreatePasswordToken stores a reset or invitation token hash. Any earlier unused token
+// for the same user is invalidated so only the most recent link works.
+func (s *Store) CreatePasswordToken(ctx context.Context, userID, purpose, tokenHash string, ttl time.Duration, createdByID *string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
-	// Total controls in library
-	var totalControls int
-	err := s.db.QueryRow(ctx, "SELECT COUNT(*) FROM control_library").Scan(&totalControls)
+	if _, err := tx.Exec(ctx, `DELETE FROM password_tokens WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO password_tokens (user_id, token_hash, purpose, created_by_id, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + MAKE_INTERVAL(secs => $5));
+	`, userID, tokenHash, purpose, createdByID, ttl.Seconds())
 	if err != nil {
-		return nil, fmt.Errorf("error counting total controls: %w", err)
+		return err
 	}
-	controlStats["totalControls"] = totalControls
 
-	// Activated controls
-	var activatedControls int
-	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM activated_controls WHERE status = 'active'").Scan(&activatedControls)
+	return tx.Commit(ctx)
+}
+
+// ConsumePasswordToken redeems a token and sets the user's new password in one transaction.
+// It returns the user ID and token purpose.
+func (s *Store) ConsumePasswordToken(ctx context.Context, tokenHash, newPassword string) (string, string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, fmt.Errorf("error counting activated controls: %w", err)
+		log.Printf("Error hashing password: %v", err)
+		return "", "", fmt.Errorf("failed to hash password")
 	}
-	controlStats["activatedControls"] = activatedControls
 
-	// Compliant controls (last evidence was compliant)
-	var compliantControls int
-	err = s.db.QueryRow(ctx, `
-		SELECT COUNT(DISTINCT ac.id)
-		FROM activated_controls ac
-		WHERE ac.status = 'active'
-		AND EXISTS (
-			SELECT 1 FROM control_evidence_log cel
-			WHERE cel.activated_control_id = ac.id
-			AND cel.compliance_status = 'compliant'
-			AND cel.performed_at = (
-				SELECT MAX(performed_at)
-				FROM control_evidence_log
-				WHERE activated_control_id = ac.id
-			)
-		)
-	`).Scan(&compliantControls)
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error counting compliant controls: %w", err)
+		return "", "", err
 	}
-	controlStats["compliantControls"] = compliantControls
+	defer tx.Rollback(ctx)
 
-	// Non-compliant controls
-	var nonCompliantControls int
-	err = s.db.QueryRow(ctx, `
-		SELECT COUNT(DISTINCT ac.id)
-		FROM activated_controls ac
-		WHERE ac.status = 'active'
-		AND EXISTS (
-			SELECT 1 FROM control_evidence_log cel
-			WHERE cel.activated_control_id = ac.id
-			AND cel.compliance_status = 'non-compliant'
-			AND cel.performed_at = (
-				SELECT MAX(performed_at)
-				FROM control_evidence_log
-				WHERE activated_control_id = ac.id
-			)
-		)
-	`).Scan(&nonCompliantControls)
+	var userID, purpose string
+	err = tx.QueryRow(ctx, `
+		UPDATE password_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, purpose;
+	`, tokenHash).Scan(&userID, &purpose)
 	if err != nil {
-		return nil, fmt.Errorf("error counting non-compliant controls: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", fmt.Errorf("invalid or expired token")
+		}
+		return "", "", err
 	}
-	controlStats["nonCompliantControls"] = nonCompliantControls
 
-	// Overdue controls
-	var overdueControls int
-	err = s.db.QueryRow(ctx, `
-		SELECT COUNT(*)
-		FROM activated_controls
-		WHERE status = 'active'
-		AND next_review_due_date < CURRENT_DATE
-	`).Scan(&overdueControls)
+	// Setting a new password also lifts any login lockout
+	if _, err := tx.Exec(ctx, `
+		UPDATE users SET password_hash = $1, failed_login_count = 0, locked_until = NULL WHERE id = $2;
+	`, string(hashedPassword), userID); err != nil {
+		return "", "", err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM password_tokens WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return "", "", err
+	}
+	// A new password signs the user out everywhere
+	if _, err := tx.Exec(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'password_reset'
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID); err != nil {
+		return "", "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", "", err
+	}
+	return userID, purpose, nil
+}
+
+// SetUserPassword replaces a local user's password outside the token flow (admin
+// CLI). Like a reset it lifts any lockout, voids open tokens and ends all sessions.
+func (s *Store) SetUserPassword(ctx context.Context, userID, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, fmt.Errorf("error counting overdue controls: %w", err)
+		log.Printf("Error hashing password: %v", err)
+		return fmt.Errorf("failed to hash password")
 	}
-	controlStats["overdueControls"] = overdueControls
 
-	// Get ticket statistics
-	ticketStats := make(map[string]interface{})
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
-	// Total tickets
-	var totalTickets int
-	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM tickets").Scan(&totalTickets)
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET password_hash = $1, failed_login_count = 0, locked_until = NULL
+		WHERE id = $2 AND auth_provider = 'local';
+	`, string(hashedPassword), userID)
 	if err != nil {
-		return nil, fmt.Errorf("error counting total tickets: %w", err)
+		return err
 	}
-	ticketStats["totalTickets"] = totalTickets
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM password_tokens WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'password_reset'
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
 
-	// Open tickets
-	var openTickets int
-	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM tickets WHERE status IN ('new', 'in_progress')").Scan(&openTickets)
+// ========== SESSIONS ==========
+
+// CreateSession starts a login session and returns its ID
+func (s *Store) CreateSession(ctx context.Context, userID, refreshTokenHash, authMethod, userAgent, ipAddress string, ttl time.Duration) (string, error) {
+	var sessionID string
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO user_sessions (user_id, refresh_token_hash, auth_method, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NOW() + MAKE_INTERVAL(secs => $6))
+		RETURNING id;
+	`, userID, refreshTokenHash, authMethod, userAgent, ipAddress, ttl.Seconds()).Scan(&sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("error counting open tickets: %w", err)
+		log.Printf("Error INSERT into user_sessions: %v", err)
+		return "", err
 	}
-	ticketStats["openTickets"] = openTickets
+	return sessionID, nil
+}
 
-	// Resolved tickets this month
-	var resolvedThisMonth int
-	err = s.db.QueryRow(ctx, `
-		SELECT COUNT(*)
-		FROM tickets
-		WHERE status = 'resolved'
-		AND resolved_at >= DATE_TRUNC('month', CURRENT_DATE)
-	`).Scan(&resolvedThisMonth)
+// RotateSession swaps a session's refresh token for a new one and extends it.
+// Presenting a refresh token that was already rotated out revokes the whole
+// session, since it means the token has been copied.
+func (s *Store) RotateSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, ttl time.Duration) (*Session, error) {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error counting resolved tickets this month: %w", err)
+		return nil, err
 	}
-	ticketStats["resolvedThisMonth"] = resolvedThisMonth
+	defer tx.Rollback(ctx)
 
-	// Get asset and document statistics
-	var totalAssets int
-	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM assets WHERE status = 'active'").Scan(&totalAssets)
+	var session Session
+	var active bool
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id, revoked_at IS NULL AND expires_at > NOW()
+		FROM user_sessions WHERE refresh_token_hash = $1
+		FOR UPDATE;
+	`, refreshTokenHash).Scan(&session.ID, &session.UserID, &active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		result, err := tx.Exec(ctx, `
+			UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'refresh_token_reuse'
+			WHERE previous_refresh_token_hash = $1 AND revoked_at IS NULL;
+		`, refreshTokenHash)
+		if err != nil {
+			return nil, err
+		}
+		if result.RowsAffected() > 0 {
+			if err := tx.Commit(ctx); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("refresh token reused")
+		}
+		return nil, fmt.Errorf("invalid refresh token")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error counting assets: %w", err)
+		return nil, err
+	}
+	if !active {
+		return nil, fmt.Errorf("invalid refresh token")
 	}
 
-	var totalDocuments int
-	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM documents").Scan(&totalDocuments)
+	err = tx.QueryRow(ctx, `
+		UPDATE user_sessions
+		SET refresh_token_hash = $2, previous_refresh_token_hash = refresh_token_hash,
+		    last_used_at = NOW(), expires_at = NOW() + MAKE_INTERVAL(secs => $3)
+		WHERE id = $1
+		RETURNING auth_method, COALESCE(user_agent, ''), COALESCE(ip_address, ''), created_at, last_used_at, expires_at;
+	`, session.ID, newRefreshTokenHash, ttl.Seconds()).Scan(
+		&session.AuthMethod, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("error counting documents: %w", err)
+		return nil, err
 	}
 
-	// Calculate compliance percentage
-	compliancePercentage := 0.0
-	if activatedControls > 0 {
-		compliancePercentage = float64(compliantControls) / float64(activatedControls) * 100
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
 	}
+	return &session, nil
+}
 
-	return map[string]interface{}{
-		"controls": map[string]interface{}{
-			"total":                totalControls,
-			"activated":            activatedControls,
-			"compliant":            compliantControls,
-			"nonCompliant":         nonCompliantControls,
-			"overdue":              overdueControls,
-			"compliancePercentage": compliancePercentage,
-		},
-		"tickets": ticketStats,
-		"assets": map[string]interface{}{
-			"total": totalAssets,
-		},
-		"documents": map[string]interface{}{
-			"total": totalDocuments,
-		},
-	}, nil
+// GetSessionPrincipal returns the user's current role and organization if the session is still active
+func (s *Store) GetSessionPrincipal(ctx context.Context, sessionID, userID string) (*SessionPrincipal, error) {
+	var principal SessionPrincipal
+	err := s.db.QueryRow(ctx, `
+		SELECT u.role, u.organization_id, o.status, u.is_super_admin
+		FROM user_sessions us
+		JOIN users u ON u.id = us.user_id
+		JOIN organizations o ON o.id = u.organization_id
+		WHERE us.id = $1 AND us.user_id = $2 AND us.revoked_at IS NULL AND us.expires_at > NOW() AND u.active;
+	`, sessionID, userID).Scan(&principal.Role, &principal.OrganizationID, &principal.OrganizationStatus, &principal.IsSuperAdmin)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, err
+	}
+	return &principal, nil
 }
 
-// ========== DOCUMENT MANAGEMENT ==========
+// ListUserSessions returns a user's active sessions, most recently used first
+func (s *Store) ListUserSessions(ctx context.Context, userID string) ([]Session, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, auth_method, COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+		       created_at, last_used_at, expires_at
+		FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-// DocumentInfo represents a document with its basic info
-type DocumentInfo struct {
-	ID                 string         `json:"id"`
-	Title              string         `json:"title"`
-	Category           string         `json:"category"`
-	OwnerID            sql.NullString `json:"owner_id,omitempty"`
-	PublishedVersionID sql.NullString `json:"published_version_id,omitempty"`
-	CreatedAt          time.Time      `json:"created_at"`
-	UpdatedAt          time.Time      `json:"updated_at"`
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(
+			&session.ID, &session.UserID, &session.AuthMethod, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
 }
 
-// DocumentVersion represents a version of a document
-type DocumentVersion struct {
-	ID                string    `json:"id"`
-	DocumentID        string    `json:"document_id"`
-	VersionNumber     int       `json:"version_number"`
-	BodyContent       string    `json:"body_content"`
-	ChangeDescription string    `json:"change_description,omitempty"`
-	Status            string    `json:"status"`
-	CreatedByUserID   string    `json:"created_by_user_id"`
-	CreatedAt         time.Time `json:"created_at"`
+// RevokeSession revokes one of a user's sessions
+func (s *Store) RevokeSession(ctx context.Context, sessionID, userID, reason string) error {
+	result, err := s.db.Exec(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+	`, sessionID, userID, reason)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
 }
 
-// CreateDocumentRequest is the JSON for creating a document
-type CreateDocumentRequest struct {
-	Title    string `json:"title"`
-	Category string `json:"category"`
-	OwnerID  string `json:"owner_id"`
+// RevokeUserSessions revokes every active session of a user and returns how many were revoked
+func (s *Store) RevokeUserSessions(ctx context.Context, userID, reason string) (int64, error) {
+	result, err := s.db.Exec(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID, reason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-// CreateDocumentVersionRequest is the JSON for creating a document version
-type CreateDocumentVersionRequest struct {
-	BodyContent       string `json:"body_content"`
-	ChangeDescription string `json:"change_description,omitempty"`
+// ========== LOGIN THROTTLING ==========
+
+// GetAccountLoginState returns the failure history of the account with email, or nil if there is none
+func (s *Store) GetAccountLoginState(ctx context.Context, email string) (*AccountLoginState, error) {
+	var state AccountLoginState
+	err := s.db.QueryRow(ctx, `
+		SELECT id, organization_id, failed_login_count, last_failed_login_at, locked_until
+		FROM users WHERE LOWER(email) = LOWER($1);
+	`, email).Scan(&state.UserID, &state.OrganizationID, &state.Failures, &state.LastFailedAt, &state.LockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
 }
 
-// CreateDocument creates a new document
-func (s *Store) CreateDocument(ctx context.Context, title, category, ownerID string) (*DocumentInfo, error) {
-	var doc DocumentInfo
+// GetIPLoginBlock returns until when an address is blocked, or nil if it is not
+func (s *Store) GetIPLoginBlock(ctx context.Context, ipAddress string) (*time.Time, error) {
+	var blockedUntil *time.Time
 	err := s.db.QueryRow(ctx, `
-		INSERT INTO documents (title, category, owner_id)
-		VALUES ($1, $2, $3)
-		RETURNING id, title, category, owner_id, published_version_id, created_at, updated_at
-	`, title, category, ownerID).Scan(
-		&doc.ID, &doc.Title, &doc.Category, &doc.OwnerID, &doc.PublishedVersionID,
-		&doc.CreatedAt, &doc.UpdatedAt,
-	)
+		SELECT blocked_until FROM login_ip_failures WHERE ip_address = $1::inet AND blocked_until > NOW();
+	`, ipAddress).Scan(&blockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return blockedUntil, err
+}
+
+// RecordLoginFailure counts a failed password login against the account (if one
+// has the email) and the client address, locking or blocking them when a limit
+// is reached. Counters restart after each lock so every lock is reported once.
+func (s *Store) RecordLoginFailure(ctx context.Context, email, ipAddress string, cfg LoginThrottleConfig) (*LoginFailureResult, error) {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error creating document: %w", err)
+		return nil, err
 	}
-	return &doc, nil
+	defer tx.Rollback(ctx)
+
+	window := cfg.FailureWindow.Seconds()
+	lockout := cfg.LockoutDuration.Seconds()
+	result := &LoginFailureResult{}
+
+	var lockedUntil *time.Time
+	var userID, orgID string
+	err = tx.QueryRow(ctx, `
+		WITH target AS (
+			SELECT id,
+			       CASE WHEN last_failed_login_at > NOW() - MAKE_INTERVAL(secs => $2)
+			            THEN failed_login_count ELSE 0 END + 1 AS failures
+			FROM users WHERE LOWER(email) = LOWER($1)
+			FOR UPDATE
+		)
+		UPDATE users u
+		SET failed_login_count = CASE WHEN t.failures >= $3 THEN 0 ELSE t.failures END,
+		    last_failed_login_at = NOW(),
+		    locked_until = CASE WHEN t.failures >= $3 THEN NOW() + MAKE_INTERVAL(secs => $4) ELSE u.locked_until END
+		FROM target t
+		WHERE u.id = t.id
+		RETURNING u.id, u.organization_id, t.failures,
+		          CASE WHEN t.failures >= $3 THEN u.locked_until END;
+	`, email, window, cfg.MaxAccountFailures, lockout).Scan(&userID, &orgID, &result.Failures, &lockedUntil)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return nil, err
+	default:
+		result.UserID, result.OrganizationID, result.AccountLocked = &userID, &orgID, lockedUntil
+	}
+
+	var blockedUntil *time.Time
+	err = tx.QueryRow(ctx, `
+		INSERT INTO login_ip_failures (ip_address, failure_count, window_started_at, last_failed_at)
+		VALUES ($1::inet, 1, NOW(), NOW())
+		ON CONFLICT (ip_address) DO UPDATE SET
+		    failure_count = CASE WHEN login_ip_failures.window_started_at > NOW() - MAKE_INTERVAL(secs => $2)
+		                         THEN login_ip_failures.failure_count + 1 ELSE 1 END,
+		    window_started_at = CASE WHEN login_ip_failures.window_started_at > NOW() - MAKE_INTERVAL(secs => $2)
+		                             THEN login_ip_failures.window_started_at ELSE NOW() END,
+		    last_failed_at = NOW()
+		RETURNING failure_count;
+	`, ipAddress, window).Scan(&result.IPFailures)
+	if err != nil {
+		return nil, err
+	}
+	if result.IPFailures >= cfg.MaxIPFailures {
+		err = tx.QueryRow(ctx, `
+			UPDATE login_ip_failures
+			SET blocked_until = NOW() + MAKE_INTERVAL(secs => $2), failure_count = 0, window_started_at = NOW()
+			WHERE ip_address = $1::inet
+			RETURNING blocked_until;
+		`, ipAddress, lockout).Scan(&blockedUntil)
+		if err != nil {
+			return nil, err
+		}
+		result.IPBlocked = blockedUntil
+	}
+
+	// Opportunistically forget addresses that have been quiet for a day
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM login_ip_failures
+		WHERE last_failed_at < NOW() - INTERVAL '1 day' AND (blocked_until IS NULL OR blocked_until < NOW());
+	`); err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit(ctx)
 }
 
-// GetDocuments retrieves all documents
-func (s *Store) GetDocuments(ctx context.Context) ([]DocumentInfo, error) {
+// ClearLoginFailures resets an account's failure count after a successful login
+func (s *Store) ClearLoginFailures(ctx context.Context, userID string) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL
+		WHERE id = $1 AND (failed_login_count > 0 OR last_failed_login_at IS NOT NULL);
+	`, userID)
+	return err
+}
+
+// UnlockUser lifts an account lockout and clears its failure count
+func (s *Store) UnlockUser(ctx context.Context, userID string) error {
+	result, err := s.db.Exec(ctx, `
+		UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL
+		WHERE id = $1;
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// ListBlockedIPs returns the addresses currently refused password logins
+func (s *Store) ListBlockedIPs(ctx context.Context) ([]BlockedIP, error) {
 	rows, err := s.db.Query(ctx, `
-		SELECT id, title, category, owner_id, published_version_id, created_at, updated_at
-		FROM documents
-		ORDER BY created_at DESC
+		SELECT host(ip_address), failure_count, last_failed_at, blocked_until
+		FROM login_ip_failures
+		WHERE blocked_until > NOW()
+		ORDER BY blocked_until DESC;
 	`)
 	if err != nil {
-		return nil, fmt.Errorf("error querying documents: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
 
-	var documents []DocumentInfo
+	blocked := []BlockedIP{}
 	for rows.Next() {
-		var doc DocumentInfo
-		if err := rows.Scan(&doc.ID, &doc.Title, &doc.Category, &doc.OwnerID,
-			&doc.PublishedVersionID, &doc.CreatedAt, &doc.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning document: %w", err)
+		var b BlockedIP
+		if err := rows.Scan(&b.IPAddress, &b.FailureCount, &b.LastFailedAt, &b.BlockedUntil); err != nil {
+			return nil, err
 		}
-		documents = append(documents, doc)
+		blocked = append(blocked, b)
 	}
-	return documents, nil
+	return blocked, rows.Err()
 }
 
-// GetDocumentByID retrieves a single document by ID
-func (s *Store) GetDocumentByID(ctx context.Context, documentID string) (*DocumentInfo, error) {
-	var doc DocumentInfo
-	err := s.db.QueryRow(ctx, `
-		SELECT id, title, category, owner_id, published_version_id, created_at, updated_at
-		FROM documents
-		WHERE id = $1
-	`, documentID).Scan(
-		&doc.ID, &doc.Title, &doc.Category, &doc.OwnerID, &doc.PublishedVersionID,
-		&doc.CreatedAt, &doc.UpdatedAt,
-	)
+// UnblockIP lifts a block on a client address
+func (s *Store) UnblockIP(ctx context.Context, ipAddress string) error {
+	result, err := s.db.Exec(ctx, `
+		DELETE FROM login_ip_failures WHERE ip_address = $1::inet AND blocked_until > NOW();
+	`, ipAddress)
 	if err != nil {
-		return nil, fmt.Errorf("error getting document: %w", err)
+		return err
 	}
-	return &doc, nil
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ip not blocked")
+	}
+	return nil
 }
 
-// CreateDocumentVersion creates a new draft version of a document
-func (s *Store) CreateDocumentVersion(ctx context.Context, documentID, bodyContent, changeDescription, userID string) (*DocumentVersion, error) {
-	// Get the next version number
-	var nextVersion int
-	err := s.db.QueryRow(ctx, `
-		SELECT COALESCE(MAX(version_number), 0) + 1
-		FROM document_versions
-		WHERE document_id = $1
-	`, documentID).Scan(&nextVersion)
+// ========== JWT SIGNING KEYS ==========
+
+// ListJWTSigningKeys returns all keys that are still valid for verification
+func (s *Store) ListJWTSigningKeys(ctx context.Context) ([]StoredSigningKey, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT kid, algorithm, private_key, activates_at, retires_at, expires_at
+		FROM jwt_signing_keys
+		WHERE expires_at > NOW()
+		ORDER BY activates_at;
+	`)
 	if err != nil {
-		return nil, fmt.Errorf("error getting next version number: %w", err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Create the new version
-	var version DocumentVersion
-	err = s.db.QueryRow(ctx, `
-		INSERT INTO document_versions (document_id, version_number, body_content, change_description, status, created_by_user_id)
-		VALUES ($1, $2, $3, $4, 'draft', $5)
-		RETURNING id, document_id, version_number, body_content, change_description, status, created_by_user_id, created_at
-	`, documentID, nextVersion, bodyContent, changeDescription, userID).Scan(
-		&version.ID, &version.DocumentID, &version.VersionNumber, &version.BodyContent,
-		&version.ChangeDescription, &version.Status, &version.CreatedByUserID, &version.CreatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error creating document version: %w", err)
+	keys := []StoredSigningKey{}
+	for rows.Next() {
+		var k StoredSigningKey
+		if err := rows.Scan(&k.Kid, &k.Algorithm, &k.PrivateKey, &k.ActivatesAt, &k.RetiresAt, &k.ExpiresAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
 	}
-	return &version, nil
+	return keys, rows.Err()
 }
 
-// PublishDocumentVersion publishes a draft version
-func (s *Store) PublishDocumentVersion(ctx context.Context, versionID, documentID string) error {
-	// Start transaction
+// MaintainJWTSigningKeys prunes expired keys and inserts whatever keys plan decides are
+// needed. A transaction-scoped advisory lock ensures only one instance rotates at a time.
+func (s *Store) MaintainJWTSigningKeys(ctx context.Context, plan func(existing []StoredSigningKey) ([]StoredSigningKey, error)) error {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
+		return err
 	}
 	defer tx.Rollback(ctx)
 
-	// Archive any currently published versions
-	_, err = tx.Exec(ctx, `
-		UPDATE document_versions
-		SET status = 'archived'
-		WHERE document_id = $1 AND status = 'published'
-	`, documentID)
-	if err != nil {
-		return fmt.Errorf("error archiving old versions: %w", err)
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('jwt_signing_keys'))`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM jwt_signing_keys WHERE expires_at <= NOW()`); err != nil {
+		return err
 	}
 
-	// Set the new version as published
-	_, err = tx.Exec(ctx, `
-		UPDATE document_versions
-		SET status = 'published'
-		WHERE id = $1
-	`, versionID)
+	rows, err := tx.Query(ctx, `SELECT kid, algorithm, activates_at, retires_at, expires_at FROM jwt_signing_keys`)
 	if err != nil {
-		return fmt.Errorf("error publishing version: %w", err)
+		return err
+	}
+	existing := []StoredSigningKey{}
+	for rows.Next() {
+		var k StoredSigningKey
+		if err := rows.Scan(&k.Kid, &k.Algorithm, &k.ActivatesAt, &k.RetiresAt, &k.ExpiresAt); err != nil {
+			rows.Close()
+			return err
+		}
+		existing = append(existing, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	// Update the document's published_version_id
-	_, err = tx.Exec(ctx, `
-		UPDATE documents
-		SET published_version_id = $1
-		WHERE id = $2
-	`, versionID, documentID)
+	newKeys, err := plan(existing)
 	if err != nil {
-		return fmt.Errorf("error updating document published version: %w", err)
+		return err
+	}
+	for _, k := range newKeys {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO jwt_signing_keys (kid, algorithm, private_key, activates_at, retires_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6);
+		`, k.Kid, k.Algorithm, k.PrivateKey, k.ActivatesAt, k.RetiresAt, k.ExpiresAt)
+		if err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit(ctx)
 }
 
-// GetDocumentVersions retrieves all versions of a document
-func (s *Store) GetDocumentVersions(ctx context.Context, documentID string) ([]DocumentVersion, error) {
-	rows, err := s.db.Query(ctx, `
-		SELECT id, document_id, version_number, body_content, change_description, status, created_by_user_id, created_at
-		FROM document_versions
-		WHERE document_id = $1
-		ORDER BY version_number DESC
-	`, documentID)
-	if err != nil {
-		return nil, fmt.Errorf("error querying document versions: %w", err)
-	}
-	defer rows.Close()
+// ========== MULTI-FACTOR AUTHENTICATION ==========
 
-	var versions []DocumentVersion
-	for rows.Next() {
-		var version DocumentVersion
-		if err := rows.Scan(&version.ID, &version.DocumentID, &version.VersionNumber,
-			&version.BodyContent, &version.ChangeDescription, &version.Status,
-			&version.CreatedByUserID, &version.CreatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning version: %w", err)
-		}
-		versions = append(versions, version)
+// GetMFAStatus returns a user's MFA enrolment state
+func (s *Store) GetMFAStatus(ctx context.Context, userID string) (*MFAStatus, error) {
+	query := `
+		SELECT u.mfa_enabled, m.confirmed_at,
+		       (SELECT COUNT(*) FROM mfa_recovery_codes rc WHERE rc.user_id = u.id AND rc.used_at IS NULL)
+		FROM users u
+		LEFT JOIN user_mfa m ON m.user_id = u.id
+		WHERE u.id = $1;
+	`
+	var status MFAStatus
+	err := s.db.QueryRow(ctx, query, userID).Scan(&status.Enabled, &status.EnrolledAt, &status.RecoveryCodesRemaining)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("user not found")
 	}
-	return versions, nil
+	if err != nil {
+		log.Printf("Error querying MFA status: %v", err)
+		return nil, err
+	}
+	return &status, nil
 }
 
-// AcknowledgeDocument records that a user has read a specific version
-func (s *Store) AcknowledgeDocument(ctx context.Context, versionID, userID string) error {
-	_, err := s.db.Exec(ctx, `
-		INSERT INTO document_read_acknowledgements (document_version_id, user_id)
+// BeginMFAEnrollment stores a pending (unconfirmed) TOTP secret for a user
+func (s *Store) BeginMFAEnrollment(ctx context.Context, userID, secret string) error {
+	result, err := s.db.Exec(ctx, `
+		INSERT INTO user_mfa (user_id, totp_secret)
 		VALUES ($1, $2)
-		ON CONFLICT (document_version_id, user_id) DO NOTHING
-	`, versionID, userID)
+		ON CONFLICT (user_id) DO UPDATE SET
+			totp_secret = EXCLUDED.totp_secret,
+			last_used_step = 0,
+			created_at = NOW()
+		WHERE user_mfa.confirmed_at IS NULL;
+	`, userID, secret)
 	if err != nil {
-		return fmt.Errorf("error acknowledging document: %w", err)
+		log.Printf("Error INSERT into user_mfa: %v", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("mfa already enabled")
 	}
 	return nil
 }
 
-// CreateDocumentControlMapping links a document to a control
-func (s *Store) CreateDocumentControlMapping(ctx context.Context, documentID, activatedControlID string) error {
-	_, err := s.db.Exec(ctx, `
-		INSERT INTO document_control_mapping (document_id, activated_control_id)
-		VALUES ($1, $2)
-		ON CONFLICT (document_id, activated_control_id) DO NOTHING
-	`, documentID, activatedControlID)
+// GetMFASecret returns a user's TOTP secret, whether it is confirmed, and the last accepted time step
+func (s *Store) GetMFASecret(ctx context.Context, userID string) (string, bool, int64, error) {
+	var secret string
+	var confirmedAt *time.Time
+	var lastUsedStep int64
+	err := s.db.QueryRow(ctx, `
+		SELECT totp_secret, confirmed_at, last_used_step FROM user_mfa WHERE user_id = $1;
+	`, userID).Scan(&secret, &confirmedAt, &lastUsedStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, 0, fmt.Errorf("mfa not enrolled")
+	}
 	if err != nil {
-		return fmt.Errorf("error creating document-control mapping: %w", err)
+		log.Printf("Error querying user_mfa: %v", err)
+		return "", false, 0, err
 	}
-	return nil
+	return secret, confirmedAt != nil, lastUsedStep, nil
 }
 
-// DeleteDocumentControlMapping removes a document-control mapping
-func (s *Store) DeleteDocumentControlMapping(ctx context.Context, documentID, activatedControlID string) error {
+// RecordTOTPStep atomically marks a time step as used; it returns false if the step was already consumed
+func (s *Store) RecordTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
 	result, err := s.db.Exec(ctx, `
-		DELETE FROM document_control_mapping
-		WHERE document_id = $1 AND activated_control_id = $2
-	`, documentID, activatedControlID)
+		UPDATE user_mfa SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2;
+	`, userID, step)
 	if err != nil {
-		return fmt.Errorf("error deleting document-control mapping: %w", err)
+		log.Printf("Error UPDATE user_mfa step: %v", err)
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// ConfirmMFAEnrollment activates a pending authenticator and issues fresh recovery codes
+func (s *Store) ConfirmMFAEnrollment(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		UPDATE user_mfa SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL AND last_used_step < $2;
+	`, userID, step)
+	if err != nil {
+		log.Printf("Error confirming MFA enrolment: %v", err)
+		return err
 	}
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("mapping not found")
+		return fmt.Errorf("no pending mfa enrollment")
 	}
-	return nil
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET mfa_enabled = true WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-// ========== GDPR ROPA MANAGEMENT ==========
+// ReplaceRecoveryCodes invalidates all existing recovery codes and stores new ones
+func (s *Store) ReplaceRecoveryCodes(ctx context.Context, userID string, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
-// GDPRROPA represents a Record of Processing Activities
-type GDPRROPA struct {
-	ID                    string    `json:"id"`
-	ActivityName          string    `json:"activity_name"`
-	Department            string    `json:"department,omitempty"`
-	DataControllerDetails string    `json:"data_controller_details"`
-	DataCategories        string    `json:"data_categories"`
-	DataSubjectCategories string    `json:"data_subject_categories"`
-	Recipients            string    `json:"recipients,omitempty"`
-	ThirdCountryTransfers string    `json:"third_country_transfers,omitempty"`
-	RetentionPeriod       string    `json:"retention_period,omitempty"`
-	SecurityMeasures      string    `json:"security_measures,omitempty"`
-	Status                string    `json:"status"`
-	CreatedAt             time.Time `json:"created_at"`
-	UpdatedAt             time.Time `json:"updated_at"`
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// CreateROPARequest is the JSON for creating a ROPA entry
-type CreateROPARequest struct {
-	ActivityName          string `json:"activity_name"`
-	Department            string `json:"department,omitempty"`
-	DataControllerDetails string `json:"data_controller_details"`
-	DataCategories        string `json:"data_categories"`
-	DataSubjectCategories string `json:"data_subject_categories"`
-	Recipients            string `json:"recipients,omitempty"`
-	ThirdCountryTransfers string `json:"third_country_transfers,omitempty"`
-	RetentionPeriod       string `json:"retention_period,omitempty"`
-	SecurityMeasures      string `json:"security_measures,omitempty"`
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string, recoveryCodeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error DELETE from mfa_recovery_codes: %v", err)
+		return err
+	}
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2);
+		`, userID, codeHash); err != nil {
+			log.Printf("Error INSERT into mfa_recovery_codes: %v", err)
+			return err
+		}
+	}
+	return nil
 }
 
-// UpdateROPARequest is the JSON for updating a ROPA entry
-type UpdateROPARequest struct {
-	ActivityName          *string `json:"activity_name,omitempty"`
-	Department            *string `json:"department,omitempty"`
-	DataControllerDetails *string `json:"data_controller_details,omitempty"`
-	DataCategories        *string `json:"data_categories,omitempty"`
-	DataSubjectCategories *string `json:"data_subject_categories,omitempty"`
-	Recipients            *string `json:"recipients,omitempty"`
-	ThirdCountryTransfers *string `json:"third_country_transfers,omitempty"`
-	RetentionPeriod       *string `json:"retention_period,omitempty"`
-	SecurityMeasures      *string `json:"security_measures,omitempty"`
-	Status                *string `json:"status,omitempty"`
+// UseRecoveryCode consumes an unused recovery code; it returns false if no such code exists
+func (s *Store) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	result, err := s.db.Exec(ctx, `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE id = (
+			SELECT id FROM mfa_recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		);
+	`, userID, codeHash)
+	if err != nil {
+		log.Printf("Error UPDATE mfa_recovery_codes: %v", err)
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
 }
 
-// CreateROPA creates a new ROPA entry
-func (s *Store) CreateROPA(ctx context.Context, req CreateROPARequest) (*GDPRROPA, error) {
-	var ropa GDPRROPA
+// DisableMFA removes a user's authenticator and recovery codes
+func (s *Store) DisableMFA(ctx context.Context, userID string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	result, err := tx.Exec(ctx, `UPDATE users SET mfa_enabled = false WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return tx.Commit(ctx)
+}
+
+// CreateMFAChallenge stores a pending second login step keyed by the hash of its token
+func (s *Store) CreateMFAChallenge(ctx context.Context, userID, purpose, firstFactor, tokenHash string, ttl time.Duration) error {
+	// Opportunistically clear expired challenges
+	if _, err := s.db.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at < NOW()`); err != nil {
+		log.Printf("Error cleaning up MFA challenges: %v", err)
+	}
+
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO mfa_challenges (token_hash, user_id, purpose, first_factor, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + MAKE_INTERVAL(secs => $5));
+	`, tokenHash, userID, purpose, firstFactor, ttl.Seconds())
+	if err != nil {
+		log.Printf("Error INSERT into mfa_challenges: %v", err)
+		return err
+	}
+	return nil
+}
+
+// AttemptMFAChallenge looks up a live challenge and counts an attempt against it
+func (s *Store) AttemptMFAChallenge(ctx context.Context, tokenHash string) (*MFAChallenge, error) {
+	var challenge MFAChallenge
 	err := s.db.QueryRow(ctx, `
-		INSERT INTO gdpr_ropa (
-			activity_name, department, data_controller_details, data_categories,
-			data_subject_categories, recipients, third_country_transfers,
-			retention_period, security_measures, status
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 'draft')
-		RETURNING id, activity_name, department, data_controller_details, data_categories,
-			data_subject_categories, recipients, third_country_transfers, retention_period,
-			security_measures, status, created_at, updated_at
-	`, req.ActivityName, req.Department, req.DataControllerDetails, req.DataCategories,
-		req.DataSubjectCategories, req.Recipients, req.ThirdCountryTransfers,
-		req.RetentionPeriod, req.SecurityMeasures).Scan(
-		&ropa.ID, &ropa.ActivityName, &ropa.Department, &ropa.DataControllerDetails,
-		&ropa.DataCategories, &ropa.DataSubjectCategories, &ropa.Recipients,
-		&ropa.ThirdCountryTransfers, &ropa.RetentionPeriod, &ropa.SecurityMeasures,
-		&ropa.Status, &ropa.CreatedAt, &ropa.UpdatedAt,
-	)
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND expires_at > NOW() AND attempts < $2
+		RETURNING id, user_id, purpose, first_factor;
+	`, tokenHash, mfaMaxAttempts).Scan(&challenge.ID, &challenge.UserID, &challenge.Purpose, &challenge.FirstFactor)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("invalid or expired mfa token")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error creating ROPA: %w", err)
+		log.Printf("Error UPDATE mfa_challenges: %v", err)
+		return nil, err
 	}
-	return &ropa, nil
+	return &challenge, nil
 }
 
-// GetROPAs retrieves all ROPA entries
-func (s *Store) GetROPAs(ctx context.Context) ([]GDPRROPA, error) {
-	rows, err := s.db.Query(ctx, `
-		SELECT id, activity_name, department, data_controller_details, data_categories,
-			data_subject_categories, recipients, third_country_transfers, retention_period,
-			security_measures, status, created_at, updated_at
-		FROM gdpr_ropa
-		WHERE status != 'archived'
-		ORDER BY created_at DESC
-	`)
+// DeleteMFAChallenge removes a completed challenge
+func (s *Store) DeleteMFAChallenge(ctx context.Context, challengeID string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM mfa_challenges WHERE id = $1`, challengeID)
+	return err
+}
+
+// ========== ORGANIZATIONS ==========
+
+// organizationColumns is the column list scanned by scanOrganization
+const organizationColumns = `o.id, o.name, o.slug, o.status, o.is_default,
+	(SELECT COUNT(*) FROM users u WHERE u.organization_id = o.id), o.created_at, o.updated_at`
+
+// scanOrganization reads one organizations row selected with organizationColumns
+func scanOrganization(row pgx.Row) (*Organization, error) {
+	var org Organization
+	if err := row.Scan(&org.ID, &org.Name, &org.Slug, &org.Status, &org.IsDefault,
+		&org.UserCount, &org.CreatedAt, &org.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// ListOrganizations returns every organization. Call with an unscoped context
+// (WithoutOrganization) so user counts cover all tenants.
+func (s *Store) ListOrganizations(ctx context.Context) ([]Organization, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+organizationColumns+` FROM organizations o ORDER BY o.name;`)
 	if err != nil {
-		return nil, fmt.Errorf("error querying ROPAs: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
 
-	var ropas []GDPRROPA
+	orgs := []Organization{}
 	for rows.Next() {
-		var ropa GDPRROPA
-		if err := rows.Scan(&ropa.ID, &ropa.ActivityName, &ropa.Department,
-			&ropa.DataControllerDetails, &ropa.DataCategories, &ropa.DataSubjectCategories,
-			&ropa.Recipients, &ropa.ThirdCountryTransfers, &ropa.RetentionPeriod,
-			&ropa.SecurityMeasures, &ropa.Status, &ropa.CreatedAt, &ropa.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning ROPA: %w", err)
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
 		}
-		ropas = append(ropas, ropa)
+		orgs = append(orgs, *org)
 	}
-	return ropas, nil
+	return orgs, rows.Err()
 }
 
-// GetROPAByID retrieves a single ROPA entry by ID
-func (s *Store) GetROPAByID(ctx context.Context, ropaID string) (*GDPRROPA, error) {
-	var ropa GDPRROPA
-	err := s.db.QueryRow(ctx, `
-		SELECT id, activity_name, department, data_controller_details, data_categories,
-			data_subject_categories, recipients, third_country_transfers, retention_period,
-			security_measures, status, created_at, updated_at
-		FROM gdpr_ropa
-		WHERE id = $1
-	`, ropaID).Scan(
-		&ropa.ID, &ropa.ActivityName, &ropa.Department, &ropa.DataControllerDetails,
-		&ropa.DataCategories, &ropa.DataSubjectCategories, &ropa.Recipients,
-		&ropa.ThirdCountryTransfers, &ropa.RetentionPeriod, &ropa.SecurityMeasures,
-		&ropa.Status, &ropa.CreatedAt, &ropa.UpdatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error getting ROPA: %w", err)
+// GetOrganization returns one organization by ID
+func (s *Store) GetOrganization(ctx context.Context, orgID string) (*Organization, error) {
+	org, err := scanOrganization(s.db.QueryRow(ctx, `SELECT `+organizationColumns+` FROM organizations o WHERE o.id = $1;`, orgID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("organization not found")
 	}
-	return &ropa, nil
+	return org, err
 }
 
-// UpdateROPA updates a ROPA entry
-func (s *Store) UpdateROPA(ctx context.Context, ropaID string, req UpdateROPARequest) (*GDPRROPA, error) {
-	// Build dynamic update query
-	updates := []string{}
-	args := []interface{}{}
-	argPos := 1
+// GetOrganizationBySlug returns one organization by its slug
+func (s *Store) GetOrganizationBySlug(ctx context.Context, slug string) (*Organization, error) {
+	org, err := scanOrganization(s.db.QueryRow(ctx, `SELECT `+organizationColumns+` FROM organizations o WHERE o.slug = $1;`, slug))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("organization not found")
+	}
+	return org, err
+}
 
-	if req.ActivityName != nil {
-		updates = append(updates, fmt.Sprintf("activity_name = $%d", argPos))
-		args = append(args, *req.ActivityName)
-		argPos++
+// CreateOrganization adds a new tenant
+func (s *Store) CreateOrganization(ctx context.Context, req OrganizationRequest) (*Organization, error) {
+	var orgID string
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO organizations (name, slug) VALUES ($1, $2) RETURNING id;
+	`, req.Name, req.Slug).Scan(&orgID)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, fmt.Errorf("slug already exists")
+		}
+		log.Printf("Error INSERT into organizations: %v", err)
+		return nil, err
 	}
-	if req.Department != nil {
-		updates = append(updates, fmt.Sprintf("department = $%d", argPos))
-		args = append(args, *req.Department)
-		argPos++
+	return s.GetOrganization(ctx, orgID)
+}
+
+// UpdateOrganization renames an organization or changes its status
+func (s *Store) UpdateOrganization(ctx context.Context, orgID string, req OrganizationRequest) (*Organization, error) {
+	result, err := s.db.Exec(ctx, `
+		UPDATE organizations SET name = $2, slug = $3, status = $4 WHERE id = $1;
+	`, orgID, req.Name, req.Slug, req.Status)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, fmt.Errorf("slug already exists")
+		}
+		return nil, err
 	}
-	if req.DataControllerDetails != nil {
-		updates = append(updates, fmt.Sprintf("data_controller_details = $%d", argPos))
-		args = append(args, *req.DataControllerDetails)
-		argPos++
+	if result.RowsAffected() == 0 {
+		return nil, fmt.Errorf("organization not found")
 	}
-	if req.DataCategories != nil {
-		updates = append(updates, fmt.Sprintf("data_categories = $%d", argPos))
-		args = append(args, *req.DataCategories)
-		argPos++
+	return s.GetOrganization(ctx, orgID)
+}
+
+// MoveUserToOrganization reassigns a user to another tenant and ends their sessions.
+// Control delegations in the old organization are dropped.
+func (s *Store) MoveUserToOrganization(ctx context.Context, userID, orgID string) (string, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", err
 	}
-	if req.DataSubjectCategories != nil {
-		updates = append(updates, fmt.Sprintf("data_subject_categories = $%d", argPos))
-		args = append(args, *req.DataSubjectCategories)
-		argPos++
+	defer tx.Rollback(ctx)
+
+	var previousOrgID string
+	err = tx.QueryRow(ctx, `SELECT organization_id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&previousOrgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("user not found")
 	}
-	if req.Recipients != nil {
-		updates = append(updates, fmt.Sprintf("recipients = $%d", argPos))
-		args = append(args, *req.Recipients)
-		argPos++
+	if err != nil {
+		return "", err
 	}
-	if req.ThirdCountryTransfers != nil {
-		updates = append(updates, fmt.Sprintf("third_country_transfers = $%d", argPos))
-		args = append(args, *req.ThirdCountryTransfers)
-		argPos++
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET organization_id = $2 WHERE id = $1`, userID, orgID); err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return "", fmt.Errorf("organization not found")
+		}
+		return "", err
 	}
-	if req.RetentionPeriod != nil {
-		updates = append(updates, fmt.Sprintf("retention_period = $%d", argPos))
-		args = append(args, *req.RetentionPeriod)
-		argPos++
+	if _, err := tx.Exec(ctx, `DELETE FROM control_delegates WHERE user_id = $1`, userID); err != nil {
+		return "", err
 	}
-	if req.SecurityMeasures != nil {
-		updates = append(updates, fmt.Sprintf("security_measures = $%d", argPos))
-		args = append(args, *req.SecurityMeasures)
-		argPos++
+	if _, err := tx.Exec(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'organization_changed'
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID); err != nil {
+		return "", err
 	}
-	if req.Status != nil {
-		updates = append(updates, fmt.Sprintf("status = $%d", argPos))
-		args = append(args, *req.Status)
-		argPos++
+	for _, table := range userCredentialTables {
+		if _, err := tx.Exec(ctx, `UPDATE `+table+` SET organization_id = $2 WHERE user_id = $1`, userID, orgID); err != nil {
+			return "", err
+		}
 	}
 
-	if len(updates) == 0 {
-		return s.GetROPAByID(ctx, ropaID)
+	return previousOrgID, tx.Commit(ctx)
+}
+
+// tenantTables lists every table that carries organization_id, parents before children
+var tenantTables = []string{
+	"users", "api_keys", "scim_groups", "scim_group_members",
+	"activated_controls", "control_evidence_log", "control_delegates", "evidence_files",
+	"documents", "document_versions", "document_read_acknowledgements", "document_control_mapping",
+	"assets", "asset_control_mapping", "tickets", "ticket_comments",
+	"gdpr_ropa", "gdpr_dsr", "risk_assessments", "risk_control_mapping",
+	"vendors", "vendor_assessments", "vendor_control_mapping", "vendor_document_mapping",
+	"reminder_policies", "control_reminders", "webhook_subscriptions", "webhook_deliveries",
+	"domain_events", "notifications", "audit_log", "audit_checkpoints",
+	"system_settings", "user_sessions", "user_mfa", "mfa_recovery_codes", "password_tokens",
+}
+
+// userCredentialTables hold a user's sessions and secrets; their organization
+// follows the user's
+var userCredentialTables = []string{"user_sessions", "user_mfa", "mfa_recovery_codes", "password_tokens"}
+
+// exportOmittedColumns are credentials left out of tenant exports
+var exportOmittedColumns = map[string][]string{
+	"users":                 {"password_hash"},
+	"api_keys":              {"key_hash"},
+	"webhook_subscriptions": {"secret_encrypted"},
+	"user_sessions":         {"refresh_token_hash", "previous_refresh_token_hash"},
+	"user_mfa":              {"totp_secret"},
+	"mfa_recovery_codes":    {"code_hash"},
+	"password_tokens":       {"token_hash"},
+}
+
+// ExportOrganizationData returns every row an organization owns, as JSON objects
+// keyed by table name. Password, API key, session and recovery code hashes, TOTP
+// secrets and webhook secrets are omitted.
+func (s *Store) ExportOrganizationData(ctx context.Context, orgID string) (map[string][]json.RawMessage, error) {
+	ctx = WithOrganization(ctx, orgID)
+	data := map[string][]json.RawMessage{}
+	for _, table := range tenantTables {
+		row := "to_jsonb(t)"
+		for _, column := range exportOmittedColumns[table] {
+			row += " - '" + column + "'"
+		}
+		rows, err := s.db.Query(ctx, `SELECT `+row+` FROM `+table+` t WHERE t.organization_id = $1;`, orgID)
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", table, err)
+		}
+		records := []json.RawMessage{}
+		for rows.Next() {
+			var record json.RawMessage
+			if err := rows.Scan(&record); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("exporting %s: %w", table, err)
+			}
+			records = append(records, record)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", table, err)
+		}
+		data[table] = records
 	}
+	return data, nil
+}
 
-	args = append(args, ropaID)
-	query := fmt.Sprintf(`
-		UPDATE gdpr_ropa
-		SET %s
-		WHERE id = $%d
-		RETURNING id, activity_name, department, data_controller_details, data_categories,
-			data_subject_categories, recipients, third_country_transfers, retention_period,
-			security_measures, status, created_at, updated_at
-	`, strings.Join(updates, ", "), argPos)
+// ========== API KEYS ==========
 
-	var ropa GDPRROPA
-	err := s.db.QueryRow(ctx, query, args...).Scan(
-		&ropa.ID, &ropa.ActivityName, &ropa.Department, &ropa.DataControllerDetails,
-		&ropa.DataCategories, &ropa.DataSubjectCategories, &ropa.Recipients,
-		&ropa.ThirdCountryTransfers, &ropa.RetentionPeriod, &ropa.SecurityMeasures,
-		&ropa.Status, &ropa.CreatedAt, &ropa.UpdatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error updating ROPA: %w", err)
+// apiKeyColumns is the column list scanned by scanAPIKey
+const apiKeyColumns = `id, organization_id, name, key_prefix, scopes, customer_ref, expires_at, last_used_at,
+	last_used_ip, created_by_id, created_at, revoked_at`
+
+// scanAPIKey reads one api_keys row selected with apiKeyColumns
+func scanAPIKey(row pgx.Row) (*APIKey, error) {
+	var key APIKey
+	var scopes []string
+	if err := row.Scan(
+		&key.ID, &key.OrganizationID, &key.Name, &key.KeyPrefix, &scopes, &key.CustomerRef, &key.ExpiresAt, &key.LastUsedAt,
+		&key.LastUsedIP, &key.CreatedByID, &key.CreatedAt, &key.RevokedAt,
+	); err != nil {
+		return nil, err
 	}
-	return &ropa, nil
+	key.Scopes = make([]APIKeyScope, 0, len(scopes))
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, APIKeyScope(scope))
+	}
+	return &key, nil
 }
 
-// ArchiveROPA soft-deletes a ROPA entry by setting status to 'archived'
-func (s *Store) ArchiveROPA(ctx context.Context, ropaID string) error {
+// apiKeyScopeStrings converts scopes for storage in a TEXT[] column
+func apiKeyScopeStrings(scopes []APIKeyScope) []string {
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		out = append(out, string(scope))
+	}
+	return out
+}
+
+// GetAPIKeyByHash looks up a key by the hash of its secret, including revoked and expired keys
+func (s *Store) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1;`, keyHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("api key not found")
+	}
+	return key, err
+}
+
+// TouchAPIKey records that a key was just used
+func (s *Store) TouchAPIKey(ctx context.Context, keyID, ipAddress string) error {
 	_, err := s.db.Exec(ctx, `
-		UPDATE gdpr_ropa
-		SET status = 'archived'
-		WHERE id = $1
-	`, ropaID)
+		UPDATE api_keys SET last_used_at = NOW(), last_used_ip = NULLIF($2, '') WHERE id = $1;
+	`, keyID, ipAddress)
+	return err
+}
+
+// ListAPIKeys returns every API key, newest first
+func (s *Store) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC;`)
 	if err != nil {
-		return fmt.Errorf("error archiving ROPA: %w", err)
+		return nil, err
 	}
-	return nil
-}
+	defer rows.Close()
 
-// MappedControl represents a control mapped to an asset or risk
-type MappedControl struct {
-	ActivatedControlID string     `json:"activated_control_id"`
-	ControlLibraryID   string     `json:"control_library_id"`
-	ControlName        string     `json:"control_name"`
-	Status             string     `json:"status"`
-	NextReviewDueDate  *time.Time `json:"next_review_due_date,omitempty"`
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
 }
 
-// Risk Assessment CRUD operations
+// GetAPIKey returns one API key by ID
+func (s *Store) GetAPIKey(ctx context.Context, keyID string) (*APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1;`, keyID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("api key not found")
+	}
+	return key, err
+}
 
-// RiskAssessment represents a risk assessment record
-type RiskAssessment struct {
-	ID                 string     `json:"id"`
-	Title              string     `json:"title"`
-	Description        string     `json:"description"`
-	Category           *string    `json:"category"`
-	Likelihood         int        `json:"likelihood"` // 1-5
-	Impact             int        `json:"impact"`     // 1-5
-	RiskScore          int        `json:"risk_score"` // Calculated: likelihood * impact
-	Status             string     `json:"status"`     // identified, assessed, mitigated, accepted, closed
-	OwnerID            *string    `json:"owner_id"`
-	MitigationPlan     *string    `json:"mitigation_plan"`
-	ResidualLikelihood *int       `json:"residual_likelihood"` // After mitigation
-	ResidualImpact     *int       `json:"residual_impact"`     // After mitigation
-	ResidualRiskScore  int        `json:"residual_risk_score"` // Calculated
-	ReviewDate         *time.Time `json:"review_date"`
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
+// CreateAPIKey stores a new key. keyHash is the SHA-256 of the secret, which is not kept.
+func (s *Store) CreateAPIKey(ctx context.Context, req APIKeyRequest, keyPrefix, keyHash, createdByID string) (*APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(ctx, `
+		INSERT INTO api_keys (name, key_prefix, key_hash, scopes, customer_ref, expires_at, created_by_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+		RETURNING `+apiKeyColumns+`;
+	`, req.Name, keyPrefix, keyHash, apiKeyScopeStrings(req.Scopes), req.CustomerRef, req.ExpiresAt, createdByID))
+	if err != nil {
+		log.Printf("Error INSERT into api_keys: %v", err)
+		return nil, err
+	}
+	return key, nil
 }
 
-// CreateRiskRequest represents the request body for creating a risk
-type CreateRiskRequest struct {
-	Title              string     `json:"title"`
-	Description        string     `json:"description"`
-	Category           *string    `json:"category"`
-	Likelihood         int        `json:"likelihood"`
-	Impact             int        `json:"impact"`
-	OwnerID            *string    `json:"owner_id"`
-	MitigationPlan     *string    `json:"mitigation_plan"`
-	ResidualLikelihood *int       `json:"residual_likelihood"`
-	ResidualImpact     *int       `json:"residual_impact"`
-	ReviewDate         *time.Time `json:"review_date"`
+// UpdateAPIKey changes a key's name, scopes, customer restriction and expiry
+func (s *Store) UpdateAPIKey(ctx context.Context, keyID string, req APIKeyRequest) (*APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(ctx, `
+		UPDATE api_keys SET name = $2, scopes = $3, customer_ref = NULLIF($4, ''), expires_at = $5
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns+`;
+	`, keyID, req.Name, apiKeyScopeStrings(req.Scopes), req.CustomerRef, req.ExpiresAt))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("api key not found")
+	}
+	return key, err
 }
 
-// UpdateRiskRequest represents the request body for updating a risk
-type UpdateRiskRequest struct {
-	Title              *string    `json:"title"`
-	Description        *string    `json:"description"`
-	Category           *string    `json:"category"`
-	Likelihood         *int       `json:"likelihood"`
-	Impact             *int       `json:"impact"`
-	Status             *string    `json:"status"`
-	OwnerID            *string    `json:"owner_id"`
-	MitigationPlan     *string    `json:"mitigation_plan"`
-	ResidualLikelihood *int       `json:"residual_likelihood"`
-	ResidualImpact     *int       `json:"residual_impact"`
-	ReviewDate         *time.Time `json:"review_date"`
+// RevokeAPIKey permanently disables a key
+func (s *Store) RevokeAPIKey(ctx context.Context, keyID string) error {
+	result, err := s.db.Exec(ctx, `
+		UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL;
+	`, keyID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("api key not found")
+	}
+	return nil
 }
 
-// CreateRisk creates a new risk assessment
-func (s *Store) CreateRisk(ctx context.Context, req CreateRiskRequest) (*RiskAssessment, error) {
-	query := `
-		INSERT INTO risk_assessments
-		(title, description, category, likelihood, impact, owner_id, mitigation_plan,
-		 residual_likelihood, residual_impact, review_date)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id, title, description, category, likelihood, impact, risk_score, status,
-			owner_id, mitigation_plan, residual_likelihood, residual_impact, residual_risk_score,
-			review_date, created_at, updated_at
-	`
-	var risk RiskAssessment
-	err := s.db.QueryRow(ctx, query,
-		req.Title, req.Description, req.Category, req.Likelihood, req.Impact,
-		req.OwnerID, req.MitigationPlan, req.ResidualLikelihood, req.ResidualImpact, req.ReviewDate,
-	).Scan(
-		&risk.ID, &risk.Title, &risk.Description, &risk.Category, &risk.Likelihood, &risk.Impact,
-		&risk.RiskScore, &risk.Status, &risk.OwnerID, &risk.MitigationPlan,
-		&risk.ResidualLikelihood, &risk.ResidualImpact, &risk.ResidualRiskScore,
-		&risk.ReviewDate, &risk.CreatedAt, &risk.UpdatedAt,
-	)
+// EnsureAPIKey registers a key by hash unless it already exists (revoked or not).
+// It reports whether a new row was created.
+func (s *Store) EnsureAPIKey(ctx context.Context, name, keyPrefix, keyHash string, scopes []APIKeyScope) (bool, error) {
+	result, err := s.db.Exec(ctx, `
+		INSERT INTO api_keys (name, key_prefix, key_hash, scopes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key_hash) DO NOTHING;
+	`, name, keyPrefix, keyHash, apiKeyScopeStrings(scopes))
 	if err != nil {
-		log.Printf("Error creating risk: %v", err)
-		return nil, fmt.Errorf("error creating risk: %w", err)
+		return false, err
 	}
-	return &risk, nil
+	return result.RowsAffected() > 0, nil
 }
 
-// GetRisks retrieves all risk assessments
-func (s *Store) GetRisks(ctx context.Context) ([]RiskAssessment, error) {
-	rows, err := s.db.Query(ctx, `
-		SELECT id, title, description, category, likelihood, impact, risk_score, status,
-			owner_id, mitigation_plan, residual_likelihood, residual_impact, residual_risk_score,
-			review_date, created_at, updated_at
-		FROM risk_assessments
-		WHERE status != 'closed'
-		ORDER BY risk_score DESC, created_at DESC
-	`)
+// ========== WEBHOOKS ==========
+
+// webhookColumns is the column list scanned by scanWebhookSubscription
+const webhookColumns = `id, organization_id, name, url, events, active, created_by_id, created_at, updated_at`
+
+// scanWebhookSubscription reads one webhook_subscriptions row selected with webhookColumns
+func scanWebhookSubscription(row pgx.Row) (*WebhookSubscription, error) {
+	var sub WebhookSubscription
+	if err := row.Scan(
+		&sub.ID, &sub.OrganizationID, &sub.Name, &sub.URL, &sub.Events, &sub.Active, &sub.CreatedByID, &sub.CreatedAt, &sub.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// webhookDeliveryColumns is the column list scanned by scanWebhookDelivery
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_attempt_at, response_status, error, replay_of, created_at, delivered_at`
+
+// scanWebhookDelivery reads one webhook_deliveries row selected with webhookDeliveryColumns
+func scanWebhookDelivery(row pgx.Row) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	if err := row.Scan(
+		&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastAttemptAt, &d.ResponseStatus, &d.Error, &d.ReplayOf, &d.CreatedAt, &d.DeliveredAt,
+	); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListWebhookSubscriptions returns every subscription, newest first
+func (s *Store) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions ORDER BY created_at DESC;`)
 	if err != nil {
-		return nil, fmt.Errorf("error querying risks: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
 
-	var risks []RiskAssessment
+	subs := []WebhookSubscription{}
 	for rows.Next() {
-		var risk RiskAssessment
-		if err := rows.Scan(&risk.ID, &risk.Title, &risk.Description, &risk.Category,
-			&risk.Likelihood, &risk.Impact, &risk.RiskScore, &risk.Status, &risk.OwnerID,
-			&risk.MitigationPlan, &risk.ResidualLikelihood, &risk.ResidualImpact,
-			&risk.ResidualRiskScore, &risk.ReviewDate, &risk.CreatedAt, &risk.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning risk: %w", err)
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
 		}
-		risks = append(risks, risk)
+		subs = append(subs, *sub)
 	}
-	return risks, nil
+	return subs, rows.Err()
 }
 
-// GetRiskByID retrieves a single risk assessment by ID
-func (s *Store) GetRiskByID(ctx context.Context, riskID string) (*RiskAssessment, error) {
-	var risk RiskAssessment
-	err := s.db.QueryRow(ctx, `
-		SELECT id, title, description, category, likelihood, impact, risk_score, status,
-			owner_id, mitigation_plan, residual_likelihood, residual_impact, residual_risk_score,
-			review_date, created_at, updated_at
-		FROM risk_assessments
-		WHERE id = $1
-	`, riskID).Scan(
-		&risk.ID, &risk.Title, &risk.Description, &risk.Category, &risk.Likelihood, &risk.Impact,
-		&risk.RiskScore, &risk.Status, &risk.OwnerID, &risk.MitigationPlan,
-		&risk.ResidualLikelihood, &risk.ResidualImpact, &risk.ResidualRiskScore,
-		&risk.ReviewDate, &risk.CreatedAt, &risk.UpdatedAt,
-	)
+// GetWebhookSubscription returns one subscription by ID
+func (s *Store) GetWebhookSubscription(ctx context.Context, id string) (*WebhookSubscription, error) {
+	sub, err := scanWebhookSubscription(s.db.QueryRow(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE id = $1;`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	return sub, err
+}
+
+// CreateWebhookSubscription stores a new subscription with its encrypted signing secret
+func (s *Store) CreateWebhookSubscription(ctx context.Context, req WebhookRequest, secretEncrypted, createdByID string) (*WebhookSubscription, error) {
+	active := req.Active == nil || *req.Active
+	sub, err := scanWebhookSubscription(s.db.QueryRow(ctx, `
+		INSERT INTO webhook_subscriptions (name, url, events, secret_encrypted, active, created_by_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+webhookColumns+`;
+	`, req.Name, req.URL, req.Events, secretEncrypted, active, createdByID))
 	if err != nil {
-		return nil, fmt.Errorf("error getting risk: %w", err)
+		log.Printf("Error INSERT into webhook_subscriptions: %v", err)
+		return nil, err
 	}
-	return &risk, nil
+	return sub, nil
 }
 
-// UpdateRisk updates a risk assessment
-func (s *Store) UpdateRisk(ctx context.Context, riskID string, req UpdateRiskRequest) (*RiskAssessment, error) {
-	updates := []string{}
-	args := []interface{}{}
-	argPos := 1
+// UpdateWebhookSubscription changes a subscription's name, URL and events, and
+// its active flag when one is given
+func (s *Store) UpdateWebhookSubscription(ctx context.Context, id string, req WebhookRequest) (*WebhookSubscription, error) {
+	sub, err := scanWebhookSubscription(s.db.QueryRow(ctx, `
+		UPDATE webhook_subscriptions
+		SET name = $2, url = $3, events = $4, active = COALESCE($5, active), updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+webhookColumns+`;
+	`, id, req.Name, req.URL, req.Events, req.Active))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	return sub, err
+}
 
-	if req.Title != nil {
-		updates = append(updates, fmt.Sprintf("title = $%d", argPos))
-		args = append(args, *req.Title)
-		argPos++
+// RotateWebhookSecret replaces a subscription's signing secret
+func (s *Store) RotateWebhookSecret(ctx context.Context, id, secretEncrypted string) (*WebhookSubscription, error) {
+	sub, err := scanWebhookSubscription(s.db.QueryRow(ctx, `
+		UPDATE webhook_subscriptions SET secret_encrypted = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+webhookColumns+`;
+	`, id, secretEncrypted))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("webhook not found")
 	}
-	if req.Description != nil {
-		updates = append(updates, fmt.Sprintf("description = $%d", argPos))
-		args = append(args, *req.Description)
-		argPos++
+	return sub, err
+}
+
+// DeleteWebhookSubscription removes a subscription and its delivery log
+func (s *Store) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	result, err := s.db.Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1;`, id)
+	if err != nil {
+		return err
 	}
-	if req.Category != nil {
-		updates = append(updates, fmt.Sprintf("category = $%d", argPos))
-		args = append(args, *req.Category)
-		argPos++
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("webhook not found")
 	}
-	if req.Likelihood != nil {
-		updates = append(updates, fmt.Sprintf("likelihood = $%d", argPos))
-		args = append(args, *req.Likelihood)
-		argPos++
+	return nil
+}
+
+// ListWebhookDeliveries returns a subscription's most recent deliveries,
+// optionally only those with the given status
+func (s *Store) ListWebhookDeliveries(ctx context.Context, subscriptionID string, status *string, limit int) ([]WebhookDelivery, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2::text IS NULL OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3;
+	`, subscriptionID, status, limit)
+	if err != nil {
+		return nil, err
 	}
-	if req.Impact != nil {
-		updates = append(updates, fmt.Sprintf("impact = $%d", argPos))
-		args = append(args, *req.Impact)
-		argPos++
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
 	}
-	if req.Status != nil {
-		updates = append(updates, fmt.Sprintf("status = $%d", argPos))
-		args = append(args, *req.Status)
-		argPos++
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDelivery returns one delivery by ID
+func (s *Store) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	delivery, err := scanWebhookDelivery(s.db.QueryRow(ctx, `SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id = $1;`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("webhook delivery not found")
 	}
-	if req.OwnerID != nil {
-		updates = append(updates, fmt.Sprintf("owner_id = $%d", argPos))
-		args = append(args, *req.OwnerID)
-		argPos++
+	return delivery, err
+}
+
+// ReplayWebhookDelivery queues a finished delivery to be sent again as a new
+// delivery with the same event and payload
+func (s *Store) ReplayWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	delivery, err := scanWebhookDelivery(s.db.QueryRow(ctx, `
+		INSERT INTO webhook_deliveries (organization_id, subscription_id, event_id, event_type, payload, replay_of)
+		SELECT organization_id, subscription_id, event_id, event_type, payload, id
+		FROM webhook_deliveries WHERE id = $1
+		RETURNING `+webhookDeliveryColumns+`;
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("webhook delivery not found")
 	}
-	if req.MitigationPlan != nil {
-		updates = append(updates, fmt.Sprintf("mitigation_plan = $%d", argPos))
-		args = append(args, *req.MitigationPlan)
-		argPos++
-	}
-	if req.ResidualLikelihood != nil {
-		updates = append(updates, fmt.Sprintf("residual_likelihood = $%d", argPos))
-		args = append(args, *req.ResidualLikelihood)
-		argPos++
-	}
-	if req.ResidualImpact != nil {
-		updates = append(updates, fmt.Sprintf("residual_impact = $%d", argPos))
-		args = append(args, *req.ResidualImpact)
-		argPos++
-	}
-	if req.ReviewDate != nil {
-		updates = append(updates, fmt.Sprintf("review_date = $%d", argPos))
-		args = append(args, *req.ReviewDate)
-		argPos++
-	}
-
-	if len(updates) == 0 {
-		return s.GetRiskByID(ctx, riskID)
-	}
-
-	args = append(args, riskID)
-	query := fmt.Sprintf(`
-		UPDATE risk_assessments
-		SET %s
-		WHERE id = $%d
-		RETURNING id, title, description, category, likelihood, impact, risk_score, status,
-			owner_id, mitigation_plan, residual_likelihood, residual_impact, residual_risk_score,
-			review_date, created_at, updated_at
-	`, strings.Join(updates, ", "), argPos)
-
-	var risk RiskAssessment
-	err := s.db.QueryRow(ctx, query, args...).Scan(
-		&risk.ID, &risk.Title, &risk.Description, &risk.Category, &risk.Likelihood, &risk.Impact,
-		&risk.RiskScore, &risk.Status, &risk.OwnerID, &risk.MitigationPlan,
-		&risk.ResidualLikelihood, &risk.ResidualImpact, &risk.ResidualRiskScore,
-		&risk.ReviewDate, &risk.CreatedAt, &risk.UpdatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error updating risk: %w", err)
-	}
-	return &risk, nil
+	return delivery, err
 }
 
-// DeleteRisk deletes a risk assessment (hard delete)
-func (s *Store) DeleteRisk(ctx context.Context, riskID string) error {
-	_, err := s.db.Exec(ctx, `DELETE FROM risk_assessments WHERE id = $1`, riskID)
-	if err != nil {
-		return fmt.Errorf("error deleting risk: %w", err)
+// EnqueueWebhookTest queues a WEBHOOK_TEST event for one subscription
+func (s *Store) EnqueueWebhookTest(ctx context.Context, subscriptionID, userID string) (*WebhookDelivery, error) {
+	delivery, err := scanWebhookDelivery(s.db.QueryRow(ctx, `
+		INSERT INTO webhook_deliveries (organization_id, subscription_id, event_id, event_type, payload)
+		SELECT ws.organization_id, ws.id, e.id, $3,
+		       jsonb_build_object('id', e.id, 'event', $3::text, 'occurred_at', NOW(),
+		                          'organization_id', ws.organization_id, 'actor_id', $2::uuid,
+		                          'entity_type', 'webhook_subscription', 'entity_id', ws.id,
+		                          'data', jsonb_build_object('message', 'Test event from the GRC platform'))
+		FROM webhook_subscriptions ws, (SELECT uuid_generate_v4() AS id) e
+		WHERE ws.id = $1
+		RETURNING `+webhookDeliveryColumns+`;
+	`, subscriptionID, userID, webhookTestEvent))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("webhook not found")
 	}
-	return nil
-}
-
-// CreateRiskControlMapping links a risk to a control
-func (s *Store) CreateRiskControlMapping(ctx context.Context, riskID, controlID string) error {
-	_, err := s.db.Exec(ctx, `
-		INSERT INTO risk_control_mapping (risk_id, activated_control_id)
-		VALUES ($1, $2)
-		ON CONFLICT DO NOTHING
-	`, riskID, controlID)
-	return err
+	return delivery, err
 }
 
-// DeleteRiskControlMapping removes a risk-control link
-func (s *Store) DeleteRiskControlMapping(ctx context.Context, riskID, controlID string) error {
+// EnqueueWebhookDeliveries is the event handler that queues a delivery of an
+// event for each of the organization's active subscriptions to its type
+func (s *Store) EnqueueWebhookDeliveries(ctx context.Context, event DomainEvent) error {
 	_, err := s.db.Exec(ctx, `
-		DELETE FROM risk_control_mapping
-		WHERE risk_id = $1 AND activated_control_id = $2
-	`, riskID, controlID)
+		INSERT INTO webhook_deliveries (organization_id, subscription_id, event_id, event_type, payload)
+		SELECT ws.organization_id, ws.id, $1, $2,
+		       jsonb_build_object('id', $1::uuid, 'event', $2::text, 'occurred_at', $3::timestamptz,
+		                          'organization_id', ws.organization_id, 'actor_id', $4::uuid,
+		                          'entity_type', $5::text, 'entity_id', $6::text, 'data', $7::jsonb)
+		FROM webhook_subscriptions ws
+		WHERE ws.organization_id = $8 AND ws.active AND ($2 = ANY(ws.events) OR '*' = ANY(ws.events))
+		ON CONFLICT (subscription_id, event_id) WHERE replay_of IS NULL DO NOTHING;
+	`, event.ID, event.Type, event.OccurredAt, event.ActorID, event.EntityType, event.EntityID, event.Data, event.OrganizationID)
 	return err
 }
 
-// GetRiskControls retrieves all controls linked to a risk
-func (s *Store) GetRiskControls(ctx context.Context, riskID string) ([]MappedControl, error) {
+// ClaimWebhookDeliveries leases up to limit due deliveries of active
+// subscriptions, across every organization, and counts the attempt. Rows locked
+// by another dispatcher are skipped.
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]claimedWebhookDelivery, error) {
 	rows, err := s.db.Query(ctx, `
-		SELECT ac.id, cl.id, cl.name, ac.status, ac.next_review_due_date
-		FROM risk_control_mapping rcm
-		JOIN activated_controls ac ON rcm.activated_control_id = ac.id
-		JOIN control_library cl ON ac.control_library_id = cl.id
-		WHERE rcm.risk_id = $1
-	`, riskID)
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, last_attempt_at = NOW(),
+		    next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		FROM webhook_subscriptions ws
+		WHERE ws.id = d.subscription_id AND d.id IN (
+			SELECT q.id FROM webhook_deliveries q
+			JOIN webhook_subscriptions qs ON qs.id = q.subscription_id
+			WHERE q.status = 'pending' AND q.next_attempt_at <= NOW() AND qs.active
+			ORDER BY q.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF q SKIP LOCKED
+		)
+		RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts, ws.url, ws.secret_encrypted;
+	`, limit, int(lease.Seconds()))
 	if err != nil {
-		return nil, fmt.Errorf("error querying risk controls: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
 
-	var controls []MappedControl
+	deliveries := []claimedWebhookDelivery{}
 	for rows.Next() {
-		var ctrl MappedControl
-		if err := rows.Scan(&ctrl.ActivatedControlID, &ctrl.ControlLibraryID, &ctrl.ControlName,
-			&ctrl.Status, &ctrl.NextReviewDueDate); err != nil {
-			return nil, fmt.Errorf("error scanning control: %w", err)
+		var d claimedWebhookDelivery
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Attempts, &d.URL, &d.SecretEncrypted); err != nil {
+			return nil, err
 		}
-		controls = append(controls, ctrl)
+		deliveries = append(deliveries, d)
 	}
-	return controls, nil
+	return deliveries, rows.Err()
 }
 
-// GDPR Data Subject Request (DSR) CRUD operations
-
-// GDPRDSR represents a data subject request
-type GDPRDSR struct {
-	ID               string     `json:"id"`
-	RequestType      string     `json:"request_type"` // access, erasure, rectification, portability, restriction, objection
-	RequesterName    string     `json:"requester_name"`
-	RequesterEmail   string     `json:"requester_email"`
-	RequesterPhone   *string    `json:"requester_phone"`
-	DataSubjectInfo  string     `json:"data_subject_info"`
-	RequestDetails   *string    `json:"request_details"`
-	Status           string     `json:"status"`   // submitted, under_review, in_progress, completed, rejected
-	Priority         string     `json:"priority"` // low, normal, high, urgent
-	AssignedToUserID *string    `json:"assigned_to_user_id"`
-	DeadlineDate     time.Time  `json:"deadline_date"`
-	CompletedDate    *time.Time `json:"completed_date"`
-	ResponseSummary  *string    `json:"response_summary"`
-	RejectionReason  *string    `json:"rejection_reason"`
-	CreatedAt        time.Time  `json:"created_at"`
-	UpdatedAt        time.Time  `json:"updated_at"`
+// FinishWebhookDelivery records the outcome of an attempt. A pending result is
+// retried at its NextAttemptAt.
+func (s *Store) FinishWebhookDelivery(ctx context.Context, result WebhookDelivery) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, response_status = $3, error = $4,
+		    next_attempt_at = CASE WHEN $2 = 'pending' THEN $5 ELSE next_attempt_at END,
+		    delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() END
+		WHERE id = $1;
+	`, result.ID, result.Status, result.ResponseStatus, result.Error, result.NextAttemptAt)
+	return err
 }
 
-// CreateDSRRequest represents the request body for creating a DSR
-type CreateDSRRequest struct {
-	RequestType     string  `json:"request_type"`
-	RequesterName   string  `json:"requester_name"`
-	RequesterEmail  string  `json:"requester_email"`
-	RequesterPhone  *string `json:"requester_phone"`
-	DataSubjectInfo string  `json:"data_subject_info"`
-	RequestDetails  *string `json:"request_details"`
-	Priority        string  `json:"priority"`
+// ========== SCIM PROVISIONING ==========
+
+// scimUserColumns is the column list scanned by scanSCIMUser
+const scimUserColumns = `id, email, name, scim_external_id, active, manager_id, role, created_at, updated_at`
+
+// scanSCIMUser reads one users row selected with scimUserColumns
+func scanSCIMUser(row pgx.Row) (*SCIMUser, error) {
+	var user SCIMUser
+	if err := row.Scan(
+		&user.ID, &user.Email, &user.Name, &user.ExternalID, &user.Active, &user.ManagerID, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-// UpdateDSRRequest represents the request body for updating a DSR
-type UpdateDSRRequest struct {
-	Status           *string    `json:"status"`
-	Priority         *string    `json:"priority"`
-	AssignedToUserID *string    `json:"assigned_to_user_id"`
-	DeadlineDate     *time.Time `json:"deadline_date"`
-	ResponseSummary  *string    `json:"response_summary"`
-	RejectionReason  *string    `json:"rejection_reason"`
+// scimFilterCondition turns a parsed filter into a WHERE clause on column names
+func scimFilterCondition(filter *scimFilter, columns map[string]string) (string, []interface{}) {
+	if filter == nil {
+		return "TRUE", nil
+	}
+	column, ok := columns[filter.Attribute]
+	if !ok {
+		return "FALSE", nil
+	}
+	return "LOWER(" + column + ") = LOWER($1)", []interface{}{filter.Value}
 }
 
-// CreateDSR creates a new data subject request with automatic 30-day deadline
-func (s *Store) CreateDSR(ctx context.Context, req CreateDSRRequest) (*GDPRDSR, error) {
-	// Calculate deadline (30 days from now, GDPR requirement)
-	deadline := time.Now().AddDate(0, 0, 30)
+// ListSCIMUsers returns a page of users matching filter and the total number of matches.
+// A negative limit returns every match.
+func (s *Store) ListSCIMUsers(ctx context.Context, filter *scimFilter, offset, limit int) ([]SCIMUser, int, error) {
+	where, args := scimFilterCondition(filter, map[string]string{
+		"username": "email", "emails.value": "email", "externalid": "scim_external_id",
+	})
 
-	query := `
-		INSERT INTO gdpr_dsr
-		(request_type, requester_name, requester_email, requester_phone, data_subject_info,
-		 request_details, priority, deadline_date)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, request_type, requester_name, requester_email, requester_phone,
-			data_subject_info, request_details, status, priority, assigned_to_user_id,
-			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
-	`
-	var dsr GDPRDSR
-	err := s.db.QueryRow(ctx, query,
-		req.RequestType, req.RequesterName, req.RequesterEmail, req.RequesterPhone,
-		req.DataSubjectInfo, req.RequestDetails, req.Priority, deadline,
-	).Scan(
-		&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail, &dsr.RequesterPhone,
-		&dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status, &dsr.Priority,
-		&dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate, &dsr.ResponseSummary,
-		&dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt,
-	)
+	var total int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	n := len(args)
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+		SELECT `+scimUserColumns+` FROM users WHERE `+where+`
+		ORDER BY created_at, id
+		OFFSET $%d LIMIT NULLIF($%d, -1);
+	`, n+1, n+2), append(args, offset, limit)...)
 	if err != nil {
-		log.Printf("Error creating DSR: %v", err)
-		return nil, fmt.Errorf("error creating DSR: %w", err)
+		return nil, 0, err
 	}
-	return &dsr, nil
+	defer rows.Close()
+
+	users := []SCIMUser{}
+	for rows.Next() {
+		user, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if err := s.attachSCIMUserGroups(ctx, users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
 }
 
-// GetDSRs retrieves all data subject requests
-func (s *Store) GetDSRs(ctx context.Context) ([]GDPRDSR, error) {
+// attachSCIMUserGroups fills in the groups of each user
+func (s *Store) attachSCIMUserGroups(ctx context.Context, users []SCIMUser) error {
+	if len(users) == 0 {
+		return nil
+	}
+	index := make(map[string]*SCIMUser, len(users))
+	ids := make([]string, 0, len(users))
+	for i := range users {
+		index[users[i].ID] = &users[i]
+		ids = append(ids, users[i].ID)
+	}
+
 	rows, err := s.db.Query(ctx, `
-		SELECT id, request_type, requester_name, requester_email, requester_phone,
-			data_subject_info, request_details, status, priority, assigned_to_user_id,
-			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
-		FROM gdpr_dsr
-		ORDER BY 
-			CASE priority
-				WHEN 'urgent' THEN 1
-				WHEN 'high' THEN 2
-				WHEN 'normal' THEN 3
-				WHEN 'low' THEN 4
-				ELSE 5
-			END,
-			deadline_date ASC,
-			created_at DESC
-	`)
+		SELECT m.user_id, g.id, g.display_name
+		FROM scim_group_members m
+		JOIN scim_groups g ON g.id = m.group_id
+		WHERE m.user_id = ANY($1::uuid[])
+		ORDER BY g.display_name;
+	`, ids)
 	if err != nil {
-		return nil, fmt.Errorf("error querying DSRs: %w", err)
+		return err
 	}
 	defer rows.Close()
 
-	var dsrs []GDPRDSR
 	for rows.Next() {
-		var dsr GDPRDSR
-		if err := rows.Scan(&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail,
-			&dsr.RequesterPhone, &dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status,
-			&dsr.Priority, &dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate,
-			&dsr.ResponseSummary, &dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning DSR: %w", err)
+		var userID string
+		var ref SCIMGroupRef
+		if err := rows.Scan(&userID, &ref.ID, &ref.DisplayName); err != nil {
+			return err
 		}
-		dsrs = append(dsrs, dsr)
+		index[userID].Groups = append(index[userID].Groups, ref)
 	}
-	return dsrs, nil
+	return rows.Err()
 }
 
-// GetDSRByID retrieves a single data subject request by ID
-func (s *Store) GetDSRByID(ctx context.Context, dsrID string) (*GDPRDSR, error) {
-	var dsr GDPRDSR
-	err := s.db.QueryRow(ctx, `
-		SELECT id, request_type, requester_name, requester_email, requester_phone,
-			data_subject_info, request_details, status, priority, assigned_to_user_id,
-			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
-		FROM gdpr_dsr
-		WHERE id = $1
-	`, dsrID).Scan(
-		&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail, &dsr.RequesterPhone,
-		&dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status, &dsr.Priority,
-		&dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate, &dsr.ResponseSummary,
-		&dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt,
-	)
+// GetSCIMUser returns one user with its groups
+func (s *Store) GetSCIMUser(ctx context.Context, userID string) (*SCIMUser, error) {
+	user, err := scanSCIMUser(s.db.QueryRow(ctx, `SELECT `+scimUserColumns+` FROM users WHERE id = $1;`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("user not found")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error getting DSR: %w", err)
+		return nil, err
 	}
-	return &dsr, nil
+	users := []SCIMUser{*user}
+	if err := s.attachSCIMUserGroups(ctx, users); err != nil {
+		return nil, err
+	}
+	return &users[0], nil
 }
 
-// UpdateDSR updates a data subject request
-func (s *Store) UpdateDSR(ctx context.Context, dsrID string, req UpdateDSRRequest) (*GDPRDSR, error) {
-	updates := []string{}
-	args := []interface{}{}
-	argPos := 1
-
-	if req.Status != nil {
-		updates = append(updates, fmt.Sprintf("status = $%d", argPos))
-		args = append(args, *req.Status)
-		argPos++
+// checkSCIMManager verifies a manager reference points at another user in the organization
+func checkSCIMManager(ctx context.Context, tx pgx.Tx, userID string, managerID *string) error {
+	if managerID == nil {
+		return nil
 	}
-	if req.Priority != nil {
-		updates = append(updates, fmt.Sprintf("priority = $%d", argPos))
-		args = append(args, *req.Priority)
-		argPos++
+	if *managerID == userID {
+		return fmt.Errorf("manager not found")
 	}
-	if req.AssignedToUserID != nil {
-		updates = append(updates, fmt.Sprintf("assigned_to_user_id = $%d", argPos))
-		args = append(args, *req.AssignedToUserID)
-		argPos++
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1);`, *managerID).Scan(&exists); err != nil {
+		return err
 	}
-	if req.DeadlineDate != nil {
-		updates = append(updates, fmt.Sprintf("deadline_date = $%d", argPos))
-		args = append(args, *req.DeadlineDate)
-		argPos++
+	if !exists {
+		return fmt.Errorf("manager not found")
 	}
-	if req.ResponseSummary != nil {
-		updates = append(updates, fmt.Sprintf("response_summary = $%d", argPos))
-		args = append(args, *req.ResponseSummary)
-		argPos++
+	return nil
+}
+
+// CreateSCIMUser provisions a user. Provisioned users sign in through SSO, so no
+// password is set and password reset does not apply to them.
+func (s *Store) CreateSCIMUser(ctx context.Context, in SCIMUserInput) (*SCIMUser, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
 	}
-	if req.RejectionReason != nil {
-		updates = append(updates, fmt.Sprintf("rejection_reason = $%d", argPos))
-		args = append(args, *req.RejectionReason)
-		argPos++
+	defer tx.Rollback(ctx)
+
+	if err := checkSCIMManager(ctx, tx, "", in.ManagerID); err != nil {
+		return nil, err
 	}
 
-	if len(updates) == 0 {
-		return s.GetDSRByID(ctx, dsrID)
+	var userID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (email, name, role, auth_provider, scim_managed, scim_external_id, active, deactivated_at, manager_id)
+		VALUES ($1, $2, 'user', 'oidc', true, $3, $4, CASE WHEN $4 THEN NULL ELSE NOW() END, $5)
+		RETURNING id;
+	`, in.Email, in.Name, in.ExternalID, in.Active, in.ManagerID).Scan(&userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, fmt.Errorf("email already exists")
+		}
+		log.Printf("Error INSERT SCIM user: %v", err)
+		return nil, err
 	}
 
-	args = append(args, dsrID)
-	query := fmt.Sprintf(`
-		UPDATE gdpr_dsr
-		SET %s
-		WHERE id = $%d
-		RETURNING id, request_type, requester_name, requester_email, requester_phone,
-			data_subject_info, request_details, status, priority, assigned_to_user_id,
-			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
-	`, strings.Join(updates, ", "), argPos)
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetSCIMUser(ctx, userID)
+}
 
-	var dsr GDPRDSR
-	err := s.db.QueryRow(ctx, query, args...).Scan(
-		&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail, &dsr.RequesterPhone,
-		&dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status, &dsr.Priority,
-		&dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate, &dsr.ResponseSummary,
-		&dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt,
-	)
+// ReplaceSCIMUser overwrites the IdP-controlled attributes of a user and marks it
+// SCIM-managed. When the user goes from active to inactive it is deprovisioned in
+// the same transaction and the result says where its controls went. The last
+// active admin of an organization cannot be deactivated.
+func (s *Store) ReplaceSCIMUser(ctx context.Context, userID string, in SCIMUserInput) (*SCIMUser, *DeprovisionResult, error) {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error updating DSR: %w", err)
+		return nil, nil, err
 	}
-	return &dsr, nil
-}
+	defer tx.Rollback(ctx)
 
-// CompleteDSR marks a DSR as completed with response summary
-func (s *Store) CompleteDSR(ctx context.Context, dsrID string, responseSummary string) (*GDPRDSR, error) {
-	var dsr GDPRDSR
-	err := s.db.QueryRow(ctx, `
-		UPDATE gdpr_dsr
-		SET status = 'completed', completed_date = NOW(), response_summary = $1
-		WHERE id = $2
-		RETURNING id, request_type, requester_name, requester_email, requester_phone,
-			data_subject_info, request_details, status, priority, assigned_to_user_id,
-			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
-	`, responseSummary, dsrID).Scan(
-		&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail, &dsr.RequesterPhone,
-		&dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status, &dsr.Priority,
-		&dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate, &dsr.ResponseSummary,
-		&dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt,
-	)
+	// Taken before the row lock, in the same order as UpdateUserRole
+	if !in.Active {
+		if err := lockUserRoles(ctx, tx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var wasActive bool
+	var role, orgID string
+	err = tx.QueryRow(ctx, `SELECT active, role, organization_id FROM users WHERE id = $1 FOR UPDATE;`, userID).Scan(&wasActive, &role, &orgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, fmt.Errorf("user not found")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error completing DSR: %w", err)
+		return nil, nil, err
+	}
+	if wasActive && !in.Active {
+		if err := checkLastAdmin(ctx, tx, orgID, userID, role, ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := checkSCIMManager(ctx, tx, userID, in.ManagerID); err != nil {
+		return nil, nil, err
 	}
-	return &dsr, nil
-}
 
-// ========== ANALYTICS & REPORTING ==========
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET email = $2, name = $3, scim_external_id = $4, active = $5, manager_id = $6, scim_managed = true,
+		    deactivated_at = CASE WHEN $5 THEN NULL ELSE COALESCE(deactivated_at, NOW()) END
+		WHERE id = $1;
+	`, userID, in.Email, in.Name, in.ExternalID, in.Active, in.ManagerID)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, nil, fmt.Errorf("email already exists")
+		}
+		log.Printf("Error UPDATE SCIM user: %v", err)
+		return nil, nil, err
+	}
 
-// ControlComplianceTrend represents control compliance data over time
-type ControlComplianceTrend struct {
-	Date           string `json:"date"`
-	Compliant      int    `json:"compliant"`
-	NonCompliant   int    `json:"non_compliant"`
-	TotalActivated int    `json:"total_activated"`
+	var result *DeprovisionResult
+	if wasActive && !in.Active {
+		if result, err = deprovisionUser(ctx, tx, userID); err != nil {
+			log.Printf("Error deprovisioning user %s: %v", userID, err)
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	user, err := s.GetSCIMUser(ctx, userID)
+	return user, result, err
 }
 
-// GetControlComplianceTrends returns control compliance trends over a date range
-func (s *Store) GetControlComplianceTrends(ctx context.Context, startDate, endDate string) ([]ControlComplianceTrend, error) {
-	query := `
-		WITH date_series AS (
-			SELECT generate_series(
-				$1::date,
-				$2::date,
-				'1 day'::interval
-			)::date AS date
-		),
-		evidence_status AS (
-			SELECT DISTINCT ON (cel.activated_control_id, ds.date)
-				ds.date,
-				cel.activated_control_id,
-				cel.compliance_status
-			FROM date_series ds
-			CROSS JOIN activated_controls ac
-			LEFT JOIN control_evidence_log cel
-				ON cel.activated_control_id = ac.id
-				AND cel.performed_at::date <= ds.date
-			WHERE ac.status = 'active'
-				AND ac.created_at::date <= ds.date
-			ORDER BY cel.activated_control_id, ds.date, cel.performed_at DESC
-		)
-		SELECT
-			ds.date::text,
-			COUNT(CASE WHEN es.compliance_status = 'compliant' THEN 1 END) AS compliant,
-			COUNT(CASE WHEN es.compliance_status = 'non-compliant' THEN 1 END) AS non_compliant,
-			COUNT(DISTINCT ac.id) AS total_activated
-		FROM date_series ds
-		CROSS JOIN activated_controls ac
-		LEFT JOIN evidence_status es ON es.date = ds.date AND es.activated_control_id = ac.id
-		WHERE ac.status = 'active' AND ac.created_at::date <= ds.date
-		GROUP BY ds.date
-		ORDER BY ds.date
-	`
+// deprovisionUser cuts off a deactivated user's access and hands its controls to
+// its manager, or leaves them unowned when there is no active manager
+func deprovisionUser(ctx context.Context, tx pgx.Tx, userID string) (*DeprovisionResult, error) {
+	if _, err := tx.Exec(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'deprovisioned'
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM password_tokens WHERE user_id = $1;`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM control_delegates WHERE user_id = $1;`, userID); err != nil {
+		return nil, err
+	}
 
-	rows, err := s.db.Query(ctx, query, startDate, endDate)
+	result := &DeprovisionResult{ControlIDs: []string{}}
+	err := tx.QueryRow(ctx, `
+		SELECT m.id FROM users u JOIN users m ON m.id = u.manager_id
+		WHERE u.id = $1 AND m.active;
+	`, userID).Scan(&result.NewOwnerID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE activated_controls SET owner_id = $2 WHERE owner_id = $1 RETURNING id;
+	`, userID, result.NewOwnerID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying compliance trends: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
+	for rows.Next() {
+		var controlID string
+		if err := rows.Scan(&controlID); err != nil {
+			return nil, err
+		}
+		result.ControlIDs = append(result.ControlIDs, controlID)
+	}
+	return result, rows.Err()
+}
 
-	var trends []ControlComplianceTrend
+// ReassignControlOwner moves every control owned by one user to another active user
+func (s *Store) ReassignControlOwner(ctx context.Context, fromUserID, toUserID string) ([]string, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id::text = $1 AND active);`, toUserID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE activated_controls SET owner_id = $2 WHERE owner_id::text = $1 RETURNING id;
+	`, fromUserID, toUserID)
+	if err != nil {
+		return nil, err
+	}
+	controlIDs := []string{}
 	for rows.Next() {
-		var trend ControlComplianceTrend
-		if err := rows.Scan(&trend.Date, &trend.Compliant, &trend.NonCompliant, &trend.TotalActivated); err != nil {
-			return nil, fmt.Errorf("error scanning trend row: %w", err)
+		var controlID string
+		if err := rows.Scan(&controlID); err != nil {
+			rows.Close()
+			return nil, err
 		}
-		trends = append(trends, trend)
+		controlIDs = append(controlIDs, controlID)
 	}
-	if trends == nil {
-		trends = []ControlComplianceTrend{}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	return trends, nil
-}
 
-// RiskDistribution represents risk count by severity level
-type RiskDistribution struct {
-	Severity string `json:"severity"`
-	Count    int    `json:"count"`
+	return controlIDs, tx.Commit(ctx)
 }
 
-// GetRiskDistribution returns risk counts grouped by severity level
-func (s *Store) GetRiskDistribution(ctx context.Context) ([]RiskDistribution, error) {
-	query := `
-		SELECT
-			severity_level AS severity,
-			COUNT(*) AS count
-		FROM (
-			SELECT
-				CASE
-					WHEN risk_score >= 15 THEN 'Critical'
-					WHEN risk_score >= 10 THEN 'High'
-					WHEN risk_score >= 6 THEN 'Medium'
-					ELSE 'Low'
-				END AS severity_level
-			FROM risk_assessments
-			WHERE status != 'closed'
-		) AS risks
-		GROUP BY severity_level
-		ORDER BY
-			CASE severity_level
-				WHEN 'Critical' THEN 1
-				WHEN 'High' THEN 2
-				WHEN 'Medium' THEN 3
-				WHEN 'Low' THEN 4
-			END
-	`
-
-	rows, err := s.db.Query(ctx, query)
+// ListActiveUserIDsByRoles returns the active users holding any of roles
+func (s *Store) ListActiveUserIDsByRoles(ctx context.Context, roles []string) ([]string, error) {
+	rows, err := s.db.Query(ctx, `SELECT id FROM users WHERE role = ANY($1) AND active ORDER BY email;`, roles)
 	if err != nil {
-		return nil, fmt.Errorf("error querying risk distribution: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
 
-	var distribution []RiskDistribution
+	ids := []string{}
 	for rows.Next() {
-		var d RiskDistribution
-		if err := rows.Scan(&d.Severity, &d.Count); err != nil {
-			return nil, fmt.Errorf("error scanning distribution row: %w", err)
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
-		distribution = append(distribution, d)
+		ids = append(ids, id)
 	}
-	if distribution == nil {
-		distribution = []RiskDistribution{}
-	}
-	return distribution, nil
+	return ids, rows.Err()
 }
 
-// RiskTrend represents risk metrics over time
-type RiskTrend struct {
-	Month        string  `json:"month"`
-	OpenRisks    int     `json:"open_risks"`
-	ClosedRisks  int     `json:"closed_risks"`
-	AvgRiskScore float64 `json:"avg_risk_score"`
+// scimGroupColumns is the column list scanned by scanSCIMGroup
+const scimGroupColumns = `id, display_name, external_id, role, created_at, updated_at`
+
+// scanSCIMGroup reads one scim_groups row selected with scimGroupColumns
+func scanSCIMGroup(row pgx.Row) (*SCIMGroup, error) {
+	var group SCIMGroup
+	if err := row.Scan(&group.ID, &group.DisplayName, &group.ExternalID, &group.Role, &group.CreatedAt, &group.UpdatedAt); err != nil {
+		return nil, err
+	}
+	group.Members = []SCIMMemberRef{}
+	return &group, nil
 }
 
-// GetRiskTrends returns risk metrics aggregated by month
-func (s *Store) GetRiskTrends(ctx context.Context, months int) ([]RiskTrend, error) {
-	query := `
-		WITH month_series AS (
-			SELECT generate_series(
-				DATE_TRUNC('month', CURRENT_DATE - ($1 || ' months')::interval),
-				DATE_TRUNC('month', CURRENT_DATE),
-				'1 month'::interval
-			) AS month
-		)
-		SELECT
-			TO_CHAR(ms.month, 'YYYY-MM') AS month,
-			COUNT(CASE WHEN ra.status != 'closed' AND ra.created_at <= ms.month + interval '1 month' THEN 1 END) AS open_risks,
-			COUNT(CASE WHEN ra.status = 'closed' AND DATE_TRUNC('month', ra.updated_at) = ms.month THEN 1 END) AS closed_risks,
-			COALESCE(AVG(CASE WHEN ra.status != 'closed' AND ra.created_at <= ms.month + interval '1 month' THEN ra.risk_score END), 0) AS avg_risk_score
-		FROM month_series ms
-		LEFT JOIN risk_assessments ra ON ra.created_at <= ms.month + interval '1 month'
-		GROUP BY ms.month
-		ORDER BY ms.month
-	`
+// ListSCIMGroups returns a page of groups matching filter and the total number of matches.
+// A negative limit returns every match.
+func (s *Store) ListSCIMGroups(ctx context.Context, filter *scimFilter, offset, limit int) ([]SCIMGroup, int, error) {
+	where, args := scimFilterCondition(filter, map[string]string{
+		"displayname": "display_name", "externalid": "external_id",
+	})
 
-	rows, err := s.db.Query(ctx, query, months)
+	var total int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM scim_groups WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	n := len(args)
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+		SELECT `+scimGroupColumns+` FROM scim_groups WHERE `+where+`
+		ORDER BY display_name, id
+		OFFSET $%d LIMIT NULLIF($%d, -1);
+	`, n+1, n+2), append(args, offset, limit)...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying risk trends: %w", err)
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var trends []RiskTrend
+	groups := []SCIMGroup{}
 	for rows.Next() {
-		var trend RiskTrend
-		if err := rows.Scan(&trend.Month, &trend.OpenRisks, &trend.ClosedRisks, &trend.AvgRiskScore); err != nil {
-			return nil, fmt.Errorf("error scanning trend row: %w", err)
+		group, err := scanSCIMGroup(rows)
+		if err != nil {
+			return nil, 0, err
 		}
-		trends = append(trends, trend)
+		groups = append(groups, *group)
 	}
-	if trends == nil {
-		trends = []RiskTrend{}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
 	}
-	return trends, nil
+
+	if err := s.attachSCIMGroupMembers(ctx, groups); err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
 }
 
-// DSRMetrics represents GDPR DSR request metrics
-type DSRMetrics struct {
-	TotalRequests   int     `json:"total_requests"`
-	Submitted       int     `json:"submitted"`
-	UnderReview     int     `json:"under_review"`
-	InProgress      int     `json:"in_progress"`
-	Completed       int     `json:"completed"`
-	Rejected        int     `json:"rejected"`
-	Overdue         int     `json:"overdue"`
-	AvgResponseDays float64 `json:"avg_response_days"`
-	CompletionRate  float64 `json:"completion_rate"`
-}
-
-// GetDSRMetrics returns comprehensive DSR request metrics
-func (s *Store) GetDSRMetrics(ctx context.Context) (*DSRMetrics, error) {
-	query := `
-		SELECT
-			COUNT(*) AS total_requests,
-			COUNT(CASE WHEN status = 'submitted' THEN 1 END) AS submitted,
-			COUNT(CASE WHEN status = 'under_review' THEN 1 END) AS under_review,
-			COUNT(CASE WHEN status = 'in_progress' THEN 1 END) AS in_progress,
-			COUNT(CASE WHEN status = 'completed' THEN 1 END) AS completed,
-			COUNT(CASE WHEN status = 'rejected' THEN 1 END) AS rejected,
-			COUNT(CASE WHEN deadline_date < CURRENT_DATE AND status NOT IN ('completed', 'rejected') THEN 1 END) AS overdue,
-			COALESCE(AVG(CASE WHEN completed_date IS NOT NULL THEN EXTRACT(DAY FROM (completed_date - created_at)) END), 0) AS avg_response_days
-		FROM gdpr_dsr
-	`
+// attachSCIMGroupMembers fills in the members of each group
+func (s *Store) attachSCIMGroupMembers(ctx context.Context, groups []SCIMGroup) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	index := make(map[string]*SCIMGroup, len(groups))
+	ids := make([]string, 0, len(groups))
+	for i := range groups {
+		index[groups[i].ID] = &groups[i]
+		ids = append(ids, groups[i].ID)
+	}
 
-	var metrics DSRMetrics
-	err := s.db.QueryRow(ctx, query).Scan(
-		&metrics.TotalRequests,
-		&metrics.Submitted,
-		&metrics.UnderReview,
-		&metrics.InProgress,
-		&metrics.Completed,
-		&metrics.Rejected,
-		&metrics.Overdue,
-		&metrics.AvgResponseDays,
-	)
+	rows, err := s.db.Query(ctx, `
+		SELECT m.group_id, u.id, u.email
+		FROM scim_group_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = ANY($1::uuid[])
+		ORDER BY u.email;
+	`, ids)
 	if err != nil {
-		return nil, fmt.Errorf("error querying DSR metrics: %w", err)
+		return err
 	}
+	defer rows.Close()
 
-	// Calculate completion rate
-	if metrics.TotalRequests > 0 {
-		metrics.CompletionRate = (float64(metrics.Completed) / float64(metrics.TotalRequests)) * 100
+	for rows.Next() {
+		var groupID string
+		var member SCIMMemberRef
+		if err := rows.Scan(&groupID, &member.ID, &member.Email); err != nil {
+			return err
+		}
+		index[groupID].Members = append(index[groupID].Members, member)
 	}
-
-	return &metrics, nil
+	return rows.Err()
 }
 
-// AssetBreakdown represents asset counts by type
-type AssetBreakdown struct {
-	AssetType string `json:"asset_type"`
-	Count     int    `json:"count"`
-	Active    int    `json:"active"`
-	Inactive  int    `json:"inactive"`
+// GetSCIMGroup returns one group with its members
+func (s *Store) GetSCIMGroup(ctx context.Context, groupID string) (*SCIMGroup, error) {
+	group, err := scanSCIMGroup(s.db.QueryRow(ctx, `SELECT `+scimGroupColumns+` FROM scim_groups WHERE id = $1;`, groupID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("group not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	groups := []SCIMGroup{*group}
+	if err := s.attachSCIMGroupMembers(ctx, groups); err != nil {
+		return nil, err
+	}
+	return &groups[0], nil
 }
 
-// GetAssetBreakdown returns asset counts grouped by asset type
-func (s *Store) GetAssetBreakdown(ctx context.Context) ([]AssetBreakdown, error) {
-	query := `
-		SELECT
-			asset_type,
-			COUNT(*) AS count,
-			COUNT(CASE WHEN status = 'active' THEN 1 END) AS active,
-			COUNT(CASE WHEN status != 'active' THEN 1 END) AS inactive
-		FROM assets
-		GROUP BY asset_type
-		ORDER BY count DESC
-	`
-
-	rows, err := s.db.Query(ctx, query)
+// CreateSCIMGroup stores a group and its members. A group named after a built-in
+// role (e.g. "auditor") is mapped to that role automatically.
+func (s *Store) CreateSCIMGroup(ctx context.Context, in SCIMGroupInput, precedence []string) (*SCIMGroup, []SCIMRoleChange, error) {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error querying asset breakdown: %w", err)
+		return nil, nil, err
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	var breakdown []AssetBreakdown
-	for rows.Next() {
-		var ab AssetBreakdown
-		if err := rows.Scan(&ab.AssetType, &ab.Count, &ab.Active, &ab.Inactive); err != nil {
-			return nil, fmt.Errorf("error scanning breakdown row: %w", err)
+	// Taken before any user row is locked, in the same order as UpdateUserRole
+	if err := lockUserRoles(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+
+	var role *string
+	if IsValidRole(in.DisplayName) {
+		role = &in.DisplayName
+	}
+
+	var groupID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO scim_groups (display_name, external_id, role) VALUES ($1, $2, $3) RETURNING id;
+	`, in.DisplayName, in.ExternalID, role).Scan(&groupID)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, nil, fmt.Errorf("group already exists")
 		}
-		breakdown = append(breakdown, ab)
+		log.Printf("Error INSERT SCIM group: %v", err)
+		return nil, nil, err
 	}
-	if breakdown == nil {
-		breakdown = []AssetBreakdown{}
+
+	affected, err := setSCIMGroupMembers(ctx, tx, groupID, in.MemberIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := syncSCIMRoles(ctx, tx, affected, precedence)
+	if err != nil {
+		return nil, nil, err
 	}
-	return breakdown, nil
-}
 
-// ROPAMetrics represents GDPR ROPA statistics
-type ROPAMetrics struct {
-	TotalProcessingActivities int `json:"total_processing_activities"`
-	Active                    int `json:"active"`
-	Draft                     int `json:"draft"`
-	Archived                  int `json:"archived"`
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	group, err := s.GetSCIMGroup(ctx, groupID)
+	return group, changes, err
 }
 
-// GetROPAMetrics returns ROPA statistics
-func (s *Store) GetROPAMetrics(ctx context.Context) (*ROPAMetrics, error) {
-	query := `
-		SELECT
-			COUNT(*) AS total,
-			COUNT(CASE WHEN status = 'active' THEN 1 END) AS active,
-			COUNT(CASE WHEN status = 'draft' THEN 1 END) AS draft,
-			COUNT(CASE WHEN status = 'archived' THEN 1 END) AS archived
-		FROM gdpr_ropa
-	`
+// ReplaceSCIMGroup overwrites a group's name, external ID and member set
+func (s *Store) ReplaceSCIMGroup(ctx context.Context, groupID string, in SCIMGroupInput, precedence []string) (*SCIMGroup, []SCIMRoleChange, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
 
-	var metrics ROPAMetrics
-	err := s.db.QueryRow(ctx, query).Scan(
-		&metrics.TotalProcessingActivities,
-		&metrics.Active,
-		&metrics.Draft,
-		&metrics.Archived,
-	)
+	// Taken before any user row is locked, in the same order as UpdateUserRole
+	if err := lockUserRoles(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE scim_groups SET display_name = $2, external_id = $3 WHERE id = $1;
+	`, groupID, in.DisplayName, in.ExternalID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying ROPA metrics: %w", err)
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, nil, fmt.Errorf("group already exists")
+		}
+		return nil, nil, err
+	}
+	if result.RowsAffected() == 0 {
+		return nil, nil, fmt.Errorf("group not found")
 	}
 
-	return &metrics, nil
+	affected, err := setSCIMGroupMembers(ctx, tx, groupID, in.MemberIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := syncSCIMRoles(ctx, tx, affected, precedence)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	group, err := s.GetSCIMGroup(ctx, groupID)
+	return group, changes, err
 }
 
-// Vendor Management
+// DeleteSCIMGroup removes a group; its former members lose any role it granted
+func (s *Store) DeleteSCIMGroup(ctx context.Context, groupID string, precedence []string) ([]SCIMRoleChange, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
 
-type Vendor struct {
-	ID                 string     `json:"id"`
-	Name               string     `json:"name"`
-	Description        *string    `json:"description"`
-	Category           string     `json:"category"`
-	RiskTier           string     `json:"risk_tier"`
-	Status             string     `json:"status"`
-	ContactName        *string    `json:"contact_name"`
-	ContactEmail       *string    `json:"contact_email"`
-	ContactPhone       *string    `json:"contact_phone"`
-	Website            *string    `json:"website"`
-	ContractStartDate  *time.Time `json:"contract_start_date"`
-	ContractEndDate    *time.Time `json:"contract_end_date"`
-	ContractValue      *float64   `json:"contract_value"`
-	LastAssessmentDate *time.Time `json:"last_assessment_date"`
-	NextAssessmentDue  *time.Time `json:"next_assessment_due"`
-	OwnerID            *string    `json:"owner_id"`
-	Notes              *string    `json:"notes"`
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
-}
+	// Taken before any user row is locked, in the same order as UpdateUserRole
+	if err := lockUserRoles(ctx, tx); err != nil {
+		return nil, err
+	}
 
-type VendorAssessment struct {
-	ID                         string    `json:"id"`
-	VendorID                   string    `json:"vendor_id"`
-	AssessmentDate             time.Time `json:"assessment_date"`
-	AssessorID                 *string   `json:"assessor_id"`
-	OverallRiskScore           *int      `json:"overall_risk_score"`
-	DataSecurityScore          *int      `json:"data_security_score"`
-	ComplianceScore            *int      `json:"compliance_score"`
-	FinancialStabilityScore    *int      `json:"financial_stability_score"`
-	OperationalCapabilityScore *int      `json:"operational_capability_score"`
-	Findings                   *string   `json:"findings"`
-	Recommendations            *string   `json:"recommendations"`
-	Status                     string    `json:"status"`
-	CreatedAt                  time.Time `json:"created_at"`
-	UpdatedAt                  time.Time `json:"updated_at"`
+	affected, err := setSCIMGroupMembers(ctx, tx, groupID, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(ctx, `DELETE FROM scim_groups WHERE id = $1;`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected() == 0 {
+		return nil, fmt.Errorf("group not found")
+	}
+
+	changes, err := syncSCIMRoles(ctx, tx, affected, precedence)
+	if err != nil {
+		return nil, err
+	}
+	return changes, tx.Commit(ctx)
 }
 
-func (s *Store) CreateVendor(ctx context.Context, v *Vendor) error {
-	query := `
-		INSERT INTO vendors (name, description, category, risk_tier, status, contact_name, 
-			contact_email, contact_phone, website, contract_start_date, contract_end_date, 
-			contract_value, next_assessment_due, owner_id, notes)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
-		RETURNING id, created_at, updated_at`
+// SetSCIMGroupRole maps a group to a role (or clears the mapping) and re-derives its members' roles
+func (s *Store) SetSCIMGroupRole(ctx context.Context, groupID string, role *string, precedence []string) (*SCIMGroup, []SCIMRoleChange, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
 
-	err := s.db.QueryRow(ctx, query, v.Name, v.Description, v.Category, v.RiskTier, v.Status,
-		v.ContactName, v.ContactEmail, v.ContactPhone, v.Website, v.ContractStartDate,
-		v.ContractEndDate, v.ContractValue, v.NextAssessmentDue, v.OwnerID, v.Notes).
-		Scan(&v.ID, &v.CreatedAt, &v.UpdatedAt)
+	// Taken before any user row is locked, in the same order as UpdateUserRole
+	if err := lockUserRoles(ctx, tx); err != nil {
+		return nil, nil, err
+	}
 
+	result, err := tx.Exec(ctx, `UPDATE scim_groups SET role = $2 WHERE id = $1;`, groupID, role)
 	if err != nil {
-		log.Printf("Failed to create vendor: %v", err)
-		return err
+		return nil, nil, err
+	}
+	if result.RowsAffected() == 0 {
+		return nil, nil, fmt.Errorf("group not found")
 	}
 
-	log.Printf("Vendor created: %s (%s)", v.Name, v.ID)
-	return nil
-}
+	members, err := collectIDs(ctx, tx, `SELECT user_id FROM scim_group_members WHERE group_id = $1;`, groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := syncSCIMRoles(ctx, tx, members, precedence)
+	if err != nil {
+		return nil, nil, err
+	}
 
-func (s *Store) GetVendors(ctx context.Context) ([]Vendor, error) {
-	query := `
-		SELECT id, name, description, category, risk_tier, status, contact_name, 
-			contact_email, contact_phone, website, contract_start_date, contract_end_date, 
-			contract_value, last_assessment_date, next_assessment_due, owner_id, notes,
-			created_at, updated_at
-		FROM vendors
-		ORDER BY name ASC`
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	group, err := s.GetSCIMGroup(ctx, groupID)
+	return group, changes, err
+}
 
-	rows, err := s.db.Query(ctx, query)
+// collectIDs runs a single-column query and returns the values
+func collectIDs(ctx context.Context, tx pgx.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var vendors []Vendor
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// setSCIMGroupMembers makes memberIDs the group's exact member set and returns every
+// user whose membership may have changed. Unknown IDs, and users of other
+// organizations (hidden by row-level security), are ignored.
+func setSCIMGroupMembers(ctx context.Context, tx pgx.Tx, groupID string, memberIDs []string) ([]string, error) {
+	if memberIDs == nil {
+		memberIDs = []string{}
+	}
+	previous, err := collectIDs(ctx, tx, `SELECT user_id FROM scim_group_members WHERE group_id = $1;`, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM scim_group_members WHERE group_id = $1 AND NOT (user_id = ANY($2::uuid[]));
+	`, groupID, memberIDs); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO scim_group_members (group_id, user_id)
+		SELECT $1, id FROM users WHERE id = ANY($2::uuid[])
+		ON CONFLICT DO NOTHING;
+	`, groupID, memberIDs); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(previous)+len(memberIDs))
+	affected := make([]string, 0, len(previous)+len(memberIDs))
+	for _, id := range append(previous, memberIDs...) {
+		if !seen[id] {
+			seen[id] = true
+			affected = append(affected, id)
+		}
+	}
+	return affected, nil
+}
+
+// syncSCIMRoles sets each SCIM-managed user's role to the highest-precedence role
+// among its mapped groups, or 'user' when none is mapped. Users created outside
+// SCIM keep their manually assigned role. Callers hold lockUserRoles; a change
+// that would leave an organization without an active admin fails the whole sync.
+func syncSCIMRoles(ctx context.Context, tx pgx.Tx, userIDs []string, precedence []string) ([]SCIMRoleChange, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT id, organization_id, role, new_role FROM (
+			SELECT u.id, u.organization_id, u.role,
+			       COALESCE((
+			           SELECT g.role FROM scim_group_members m
+			           JOIN scim_groups g ON g.id = m.group_id
+			           WHERE m.user_id = u.id AND g.role IS NOT NULL
+			           ORDER BY array_position($2::text[], g.role)
+			           LIMIT 1
+			       ), 'user') AS new_role
+			FROM users u
+			WHERE u.id = ANY($1::uuid[]) AND u.scim_managed
+			FOR UPDATE OF u
+		) target
+		WHERE role <> new_role;
+	`, userIDs, precedence)
+	if err != nil {
+		return nil, err
+	}
+	var changes []SCIMRoleChange
+	var orgIDs []string
+	for rows.Next() {
+		var change SCIMRoleChange
+		var orgID string
+		if err := rows.Scan(&change.UserID, &orgID, &change.PreviousRole, &change.NewRole); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changes = append(changes, change)
+		orgIDs = append(orgIDs, orgID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// One user at a time, so each check sees the demotions before it
+	for i, change := range changes {
+		if err := checkLastAdmin(ctx, tx, orgIDs[i], change.UserID, change.PreviousRole, change.NewRole); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE users SET role = $2 WHERE id = $1;`, change.UserID, change.NewRole); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// ========== DOMAIN EVENTS ==========
+
+// InTx runs fn in one transaction, scoped to ctx's organization. Store calls made
+// with the context passed to fn join it, so a change and the events recorded for
+// it with LogAudit or PublishEvent commit or roll back together. Rows returned
+// by Query must be closed before the next statement. Nested calls reuse the
+// outer transaction.
+func (s *Store) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if txFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(context.WithValue(ctx, txKey, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.signalEvents()
+	return nil
+}
+
+// signalEvents wakes the in-process event dispatcher
+func (s *Store) signalEvents() {
+	select {
+	case s.events <- struct{}{}:
+	default:
+	}
+}
+
+// PublishEvent writes a domain event to the outbox. The organization defaults to
+// the context's, then the actor's.
+func (s *Store) PublishEvent(ctx context.Context, event DomainEvent) error {
+	event.withRequestContext(ctx)
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO domain_events (event_type, actor_id, entity_type, entity_id, data, ip_address, user_agent, request_id, session_id, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9,
+		        COALESCE(NULLIF($10, '')::uuid, NULLIF(current_setting('app.org_id', true), '')::uuid,
+		                 (SELECT organization_id FROM users WHERE id = $2), current_org_id()));
+	`, event.Type, event.ActorID, event.EntityType, event.EntityID, event.Data, event.IPAddress,
+		event.UserAgent, event.RequestID, event.SessionID, OrganizationFromContext(ctx))
+	if err != nil {
+		log.Printf("Error INSERT into domain_events (%s): %v", event.Type, err)
+		return err
+	}
+	if txFromContext(ctx) == nil {
+		s.signalEvents()
+	}
+	return nil
+}
+
+// ClaimDomainEvents leases up to limit undispatched events that are due, oldest
+// first, across every organization, and counts the attempt. Rows locked by
+// another dispatcher are skipped.
+func (s *Store) ClaimDomainEvents(ctx context.Context, limit int, lease time.Duration) ([]DomainEvent, error) {
+	rows, err := s.db.Query(ctx, `
+		WITH claimed AS (
+			UPDATE domain_events
+			SET attempts = attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+			WHERE id IN (
+				SELECT id FROM domain_events
+				WHERE dispatched_at IS NULL AND next_attempt_at <= NOW()
+				ORDER BY occurred_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT id, organization_id, event_type, occurred_at, actor_id, entity_type, entity_id, data, host(ip_address),
+		       user_agent, request_id, session_id, handled_by, attempts
+		FROM claimed
+		ORDER BY occurred_at;
+	`, limit, int(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []DomainEvent{}
+	for rows.Next() {
+		var e DomainEvent
+		if err := rows.Scan(&e.ID, &e.OrganizationID, &e.Type, &e.OccurredAt, &e.ActorID, &e.EntityType, &e.EntityID, &e.Data,
+			&e.IPAddress, &e.UserAgent, &e.RequestID, &e.SessionID, &e.HandledBy, &e.Attempts); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// FinishDomainEvent records which handlers have succeeded. A finished event is
+// marked dispatched; otherwise it is retried at nextAttempt.
+func (s *Store) FinishDomainEvent(ctx context.Context, eventID string, handledBy []string, done bool, failure error, nextAttempt time.Time) error {
+	var lastError *string
+	if failure != nil {
+		text := failure.Error()
+		lastError = &text
+	}
+	_, err := s.db.Exec(ctx, `
+		UPDATE domain_events
+		SET handled_by = $2, last_error = $4,
+		    dispatched_at = CASE WHEN $3 THEN NOW() END,
+		    next_attempt_at = CASE WHEN $3 THEN next_attempt_at ELSE $5 END
+		WHERE id = $1;
+	`, eventID, handledBy, done, lastError, nextAttempt)
+	return err
+}
+
+// PruneDomainEvents deletes events dispatched longer ago than retention. The
+// audit log keeps the record; events it has not recorded are never dispatched,
+// so they are never pruned.
+func (s *Store) PruneDomainEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	result, err := s.db.Exec(ctx, `
+		DELETE FROM domain_events WHERE dispatched_at < NOW() - $1 * INTERVAL '1 second';
+	`, int(retention.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// ========== CONTROL REMINDERS ==========
+
+// GetReminderPolicy returns the organization's reminder policy, or the default
+func (s *Store) GetReminderPolicy(ctx context.Context) (ReminderPolicy, error) {
+	var raw []byte
+	err := s.db.QueryRow(ctx, `SELECT policy FROM reminder_policies WHERE organization_id = current_org_id();`).Scan(&raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DefaultReminderPolicy(), nil
+	}
+	if err != nil {
+		return ReminderPolicy{}, err
+	}
+	var policy ReminderPolicy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return ReminderPolicy{}, fmt.Errorf("invalid reminder policy: %w", err)
+	}
+	return policy, nil
+}
+
+// PutReminderPolicy saves the organization's reminder policy
+func (s *Store) PutReminderPolicy(ctx context.Context, policy ReminderPolicy, updatedByID string) error {
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO reminder_policies (policy, updated_by_id, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (organization_id) DO UPDATE SET
+			policy = EXCLUDED.policy,
+			updated_by_id = EXCLUDED.updated_by_id,
+			updated_at = NOW();
+	`, raw, updatedByID)
+	if err != nil {
+		log.Printf("Error saving reminder policy: %v", err)
+	}
+	return err
+}
+
+// ListRemindableControls returns active controls that are due within
+// lookaheadDays or already overdue, with the stages sent for their current due
+// date. Owner is nil when the control has no owner or its owner is inactive.
+func (s *Store) ListRemindableControls(ctx context.Context, lookaheadDays int) ([]RemindableControl, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT ac.id, ac.control_library_id, ac.next_review_due_date, ac.next_review_due_date - CURRENT_DATE,
+		       u.id, u.name, u.email, m.id, m.name, m.email,
+		       COALESCE((SELECT array_agg(cr.stage) FROM control_reminders cr
+		                 WHERE cr.activated_control_id = ac.id AND cr.due_date = ac.next_review_due_date), '{}')
+		FROM activated_controls ac
+		LEFT JOIN users u ON u.id = ac.owner_id AND u.active
+		LEFT JOIN users m ON m.id = u.manager_id AND m.active
+		WHERE ac.status = 'active'
+		  AND ac.next_review_due_date <= CURRENT_DATE + $1::int
+		ORDER BY ac.next_review_due_date;
+	`, lookaheadDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	controls := []RemindableControl{}
+	for rows.Next() {
+		var control RemindableControl
+		var ownerID, ownerName, ownerEmail, managerID, managerName, managerEmail *string
+		if err := rows.Scan(&control.ID, &control.ControlLibraryID, &control.DueDate, &control.DaysUntilDue,
+			&ownerID, &ownerName, &ownerEmail, &managerID, &managerName, &managerEmail,
+			&control.SentStages); err != nil {
+			return nil, err
+		}
+		if ownerID != nil {
+			control.Owner = &ReminderRecipient{ID: *ownerID, Name: *ownerName, Email: *ownerEmail}
+		}
+		if managerID != nil {
+			control.Manager = &ReminderRecipient{ID: *managerID, Name: *managerName, Email: *managerEmail}
+		}
+		controls = append(controls, control)
+	}
+	return controls, rows.Err()
+}
+
+// ListReminderContactsByRoles returns the active users holding any of roles
+func (s *Store) ListReminderContactsByRoles(ctx context.Context, roles []string) ([]ReminderRecipient, error) {
+	rows, err := s.db.Query(ctx, `SELECT id, name, email FROM users WHERE role = ANY($1) AND active ORDER BY email;`, roles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := []ReminderRecipient{}
+	for rows.Next() {
+		var contact ReminderRecipient
+		if err := rows.Scan(&contact.ID, &contact.Name, &contact.Email); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+// ClaimControlReminder records that a stage is being sent for a control's due
+// date. It returns false if the stage was already recorded.
+func (s *Store) ClaimControlReminder(ctx context.Context, controlID string, dueDate time.Time, stage string, notifiedUserIDs []string) (bool, error) {
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO control_reminders (activated_control_id, due_date, stage, notified_user_ids)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (activated_control_id, due_date, stage) DO NOTHING;
+	`, controlID, dueDate, stage, notifiedUserIDs)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListControlReminders returns the reminder stages sent for a control's current due date
+func (s *Store) ListControlReminders(ctx context.Context, controlID string) ([]ControlReminder, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT cr.id, cr.activated_control_id, cr.due_date, cr.stage, cr.notified_user_ids::text[], cr.sent_at
+		FROM control_reminders cr
+		JOIN activated_controls ac ON ac.id = cr.activated_control_id AND ac.next_review_due_date = cr.due_date
+		WHERE cr.activated_control_id = $1
+		ORDER BY cr.sent_at;
+	`, controlID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []ControlReminder{}
+	for rows.Next() {
+		var reminder ControlReminder
+		if err := rows.Scan(&reminder.ID, &reminder.ActivatedControlID, &reminder.DueDate, &reminder.Stage,
+			&reminder.NotifiedUserIDs, &reminder.SentAt); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	return reminders, rows.Err()
+}
+
+// ========== SCHEDULED JOBS ==========
+
+const jobRunColumns = `id, job_name, source, status, attempt, scheduled_for, organization_id, triggered_by_id,
+	instance, started_at, finished_at, items_processed, error`
+
+func scanJobRun(row pgx.Row) (*JobRun, error) {
+	var run JobRun
+	err := row.Scan(&run.ID, &run.JobName, &run.Source, &run.Status, &run.Attempt, &run.ScheduledFor,
+		&run.OrganizationID, &run.TriggeredByID, &run.Instance, &run.StartedAt, &run.FinishedAt,
+		&run.ItemsProcessed, &run.Error)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// StartJobRun records the start of a job execution. The caller must hold the job's
+// lock, so any run still marked running was interrupted and is closed as failed.
+// Returns "job run already claimed" when another instance took this schedule slot.
+func (s *Store) StartJobRun(ctx context.Context, run JobRun) (*JobRun, error) {
+	if _, err := s.db.Exec(ctx, `
+		UPDATE job_runs SET status = 'failed', finished_at = NOW(), error = 'interrupted before completion'
+		WHERE job_name = $1 AND status = 'running';
+	`, run.JobName); err != nil {
+		return nil, err
+	}
+
+	started, err := scanJobRun(s.db.QueryRow(ctx, `
+		INSERT INTO job_runs (job_name, source, attempt, scheduled_for, organization_id, triggered_by_id, instance)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (job_name, scheduled_for, attempt) WHERE scheduled_for IS NOT NULL DO NOTHING
+		RETURNING `+jobRunColumns+`;
+	`, run.JobName, run.Source, run.Attempt, run.ScheduledFor, run.OrganizationID, run.TriggeredByID, run.Instance))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("job run already claimed")
+	}
+	return started, err
+}
+
+// FinishJobRun records the outcome of a job execution
+func (s *Store) FinishJobRun(ctx context.Context, runID, status string, itemsProcessed int, runErr error) error {
+	var errText *string
+	if runErr != nil {
+		text := runErr.Error()
+		errText = &text
+	}
+	_, err := s.db.Exec(ctx, `
+		UPDATE job_runs SET status = $2, items_processed = $3, error = $4, finished_at = NOW()
+		WHERE id = $1;
+	`, runID, status, itemsProcessed, errText)
+	return err
+}
+
+// ListJobRuns returns a job's executions, newest first
+func (s *Store) ListJobRuns(ctx context.Context, jobName string, limit int) ([]JobRun, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+jobRunColumns+` FROM job_runs
+		WHERE job_name = $1
+		ORDER BY started_at DESC
+		LIMIT $2;
+	`, jobName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// LatestJobRuns returns the most recent execution of every job that has run
+func (s *Store) LatestJobRuns(ctx context.Context) (map[string]JobRun, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT DISTINCT ON (job_name) `+jobRunColumns+` FROM job_runs
+		ORDER BY job_name, started_at DESC;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := map[string]JobRun{}
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		latest[run.JobName] = *run
+	}
+	return latest, rows.Err()
+}
+
+// ========== SYSTEM SETTINGS ==========
+
+// GetSetting loads one of the organization's JSON settings into out; it returns
+// false if the setting has never been saved
+func (s *Store) GetSetting(ctx context.Context, key string, out interface{}) (bool, error) {
+	var raw []byte
+	err := s.db.QueryRow(ctx, `SELECT value FROM system_settings WHERE organization_id = current_org_id() AND key = $1`, key).Scan(&raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Error querying system setting %s: %v", key, err)
+		return false, err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return false, fmt.Errorf("invalid value for setting %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// PutSetting saves one of the organization's JSON settings
+func (s *Store) PutSetting(ctx context.Context, key string, value interface{}, updatedByID string) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO system_settings (key, value, updated_by_id, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (organization_id, key) DO UPDATE SET
+			value = EXCLUDED.value,
+			updated_by_id = EXCLUDED.updated_by_id,
+			updated_at = NOW();
+	`, key, raw, updatedByID)
+	if err != nil {
+		log.Printf("Error saving system setting %s: %v", key, err)
+		return err
+	}
+	return nil
+}
+
+// GetMFAPolicy returns the organization's MFA policy (defaults to not required)
+func (s *Store) GetMFAPolicy(ctx context.Context) (MFAPolicy, error) {
+	var policy MFAPolicy
+	_, err := s.GetSetting(ctx, SettingMFAPolicy, &policy)
+	return policy, err
+}
+
+// Asset CRUD operations
+func (s *Store) CreateAsset(ctx context.Context, req CreateAssetRequest) (*Asset, error) {
+	query := `
+		INSERT INTO assets
+		(name, asset_type, owner_id, status)
+		VALUES ($1, $2, $3, 'active')
+		RETURNING id, name, asset_type, owner_id, status, created_at, updated_at;
+	`
+	var asset Asset
+	err := s.db.QueryRow(ctx, query,
+		req.Name, req.AssetType, req.OwnerID,
+	).Scan(
+		&asset.ID, &asset.Name, &asset.AssetType,
+		&asset.OwnerID, &asset.Status, &asset.CreatedAt, &asset.UpdatedAt,
+	)
+	if err != nil {
+		log.Printf("Error INSERT into assets: %v", err)
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (s *Store) GetAssets(ctx context.Context) ([]Asset, error) {
+	query := `
+		SELECT id, name, asset_type, owner_id, status, created_at, updated_at
+		FROM assets ORDER BY created_at DESC;
+	`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		log.Printf("Error querying assets: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assets []Asset
+	for rows.Next() {
+		var asset Asset
+		if err := rows.Scan(
+			&asset.ID, &asset.Name, &asset.AssetType,
+			&asset.OwnerID, &asset.Status, &asset.CreatedAt, &asset.UpdatedAt,
+		); err != nil {
+			log.Printf("Error scanning asset row: %v", err)
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if assets == nil {
+		assets = make([]Asset, 0)
+	}
+	return assets, nil
+}
+
+func (s *Store) GetAssetByID(ctx context.Context, assetID string) (*Asset, error) {
+	query := `
+		SELECT id, name, asset_type, owner_id, status, created_at, updated_at
+		FROM assets WHERE id = $1;
+	`
+	var asset Asset
+	err := s.db.QueryRow(ctx, query, assetID).Scan(
+		&asset.ID, &asset.Name, &asset.AssetType,
+		&asset.OwnerID, &asset.Status, &asset.CreatedAt, &asset.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("asset not found")
+		}
+		log.Printf("Error querying asset by ID: %v", err)
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (s *Store) UpdateAsset(ctx context.Context, assetID string, req UpdateAssetRequest) (*Asset, error) {
+	setParts := []string{}
+	args := []interface{}{}
+	argCount := 1
+
+	if req.Name != nil {
+		setParts = append(setParts, fmt.Sprintf("name = $%d", argCount))
+		args = append(args, *req.Name)
+		argCount++
+	}
+	if req.AssetType != nil {
+		setParts = append(setParts, fmt.Sprintf("asset_type = $%d", argCount))
+		args = append(args, *req.AssetType)
+		argCount++
+	}
+	if req.OwnerID != nil {
+		setParts = append(setParts, fmt.Sprintf("owner_id = $%d", argCount))
+		args = append(args, *req.OwnerID)
+		argCount++
+	}
+	if req.Status != nil {
+		setParts = append(setParts, fmt.Sprintf("status = $%d", argCount))
+		args = append(args, *req.Status)
+		argCount++
+	}
+
+	if len(setParts) == 0 {
+		return s.GetAssetByID(ctx, assetID)
+	}
+
+	setClause := strings.Join(setParts, ", ")
+	query := fmt.Sprintf(`
+		UPDATE assets
+		SET %s, updated_at = NOW()
+		WHERE id = $%d
+		RETURNING id, name, asset_type, owner_id, status, created_at, updated_at;
+	`, setClause, argCount)
+
+	args = append(args, assetID)
+
+	var asset Asset
+	err := s.db.QueryRow(ctx, query, args...).Scan(
+		&asset.ID, &asset.Name, &asset.AssetType,
+		&asset.OwnerID, &asset.Status, &asset.CreatedAt, &asset.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("asset not found")
+		}
+		log.Printf("Error UPDATE asset: %v", err)
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (s *Store) DeleteAsset(ctx context.Context, assetID string) error {
+	query := `DELETE FROM assets WHERE id = $1;`
+	result, err := s.db.Exec(ctx, query, assetID)
+	if err != nil {
+		log.Printf("Error DELETE asset: %v", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("asset not found")
+	}
+	return nil
+}
+
+// AuditLog represents a row in 'audit_log'
+type AuditLog struct {
+	ID               string    `json:"id" db:"id"`
+	PerformedAt      time.Time `json:"performed_at" db:"performed_at"`
+	UserID           *string   `json:"user_id,omitempty" db:"user_id"`
+	ActionType       string    `json:"action_type" db:"action_type"`
+	TargetEntityType *string   `json:"target_entity_type,omitempty" db:"target_entity_type"`
+	TargetEntityID   *string   `json:"target_entity_id,omitempty" db:"target_entity_id"`
+	Changes          *string   `json:"changes,omitempty" db:"changes"`
+	IPAddress        *string   `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent        *string   `json:"user_agent,omitempty" db:"user_agent"`
+	RequestID        *string   `json:"request_id,omitempty" db:"request_id"`
+	SessionID        *string   `json:"session_id,omitempty" db:"session_id"`
+	Seq              *int64    `json:"seq,omitempty" db:"seq"`               // position in the hash chain; unset until sealed
+	EntryHash        *string   `json:"entry_hash,omitempty" db:"entry_hash"` // see auditchain.go
+}
+
+// LogAudit records an auditable domain event in the outbox; the audit log entry
+// is written when the event is dispatched. Called within InTx, the event commits
+// or rolls back with the change it describes. A nil ipAddress means the client
+// address of the request in ctx, which also supplies the user agent, request ID
+// and session.
+func (s *Store) LogAudit(ctx context.Context, userID *string, actionType string, targetEntityType *string, targetEntityID *string, changes interface{}, ipAddress *string) error {
+	var data json.RawMessage
+	if changes != nil {
+		changesBytes, err := json.Marshal(changes)
+		if err != nil {
+			log.Printf("Error marshaling changes to JSON: %v", err)
+			return err
+		}
+		data = changesBytes
+	}
+
+	return s.PublishEvent(ctx, DomainEvent{
+		Type:       actionType,
+		ActorID:    userID,
+		EntityType: targetEntityType,
+		EntityID:   targetEntityID,
+		Data:       data,
+		IPAddress:  ipAddress,
+	})
+}
+
+// WriteAuditEntry is the event handler that copies an event into audit_log and
+// seals it into the organization's hash chain. The entry takes the event's ID,
+// so handling an event twice writes it once.
+func (s *Store) WriteAuditEntry(ctx context.Context, event DomainEvent) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		_, err := s.db.Exec(ctx, `
+			INSERT INTO audit_log
+			(id, performed_at, user_id, action_type, target_entity_type, target_entity_id, changes, ip_address,
+			 user_agent, request_id, session_id, organization_id)
+			VALUES ($1, $2, (SELECT id FROM users WHERE id = $3), $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (id) DO NOTHING;
+		`, event.ID, event.OccurredAt, event.ActorID, event.Type, event.EntityType, event.EntityID, event.Data, event.IPAddress,
+			event.UserAgent, event.RequestID, event.SessionID, event.OrganizationID)
+		if err != nil {
+			log.Printf("Error INSERT into audit_log: %v", err)
+			return err
+		}
+		_, err = s.SealAuditLog(ctx)
+		return err
+	})
+}
+
+const auditLogColumns = `id, performed_at, user_id, action_type, target_entity_type, target_entity_id, changes::text,
+	host(ip_address), user_agent, request_id, session_id, seq, entry_hash`
+
+func scanAuditLog(row pgx.Row) (AuditLog, error) {
+	var auditLog AuditLog
+	err := row.Scan(
+		&auditLog.ID, &auditLog.PerformedAt, &auditLog.UserID, &auditLog.ActionType,
+		&auditLog.TargetEntityType, &auditLog.TargetEntityID, &auditLog.Changes, &auditLog.IPAddress,
+		&auditLog.UserAgent, &auditLog.RequestID, &auditLog.SessionID, &auditLog.Seq, &auditLog.EntryHash,
+	)
+	return auditLog, err
+}
+
+// GetAuditLogs returns one page of the audit entries matching filter, newest
+// first unless filter.Ascending. Entries are ordered by their position in the
+// hash chain, and entries not yet sealed count as the newest. Pages follow
+// filter.After (keyset) or, for older clients, filter.Offset.
+func (s *Store) GetAuditLogs(ctx context.Context, filter AuditLogFilter) ([]AuditLog, error) {
+	// Entries past the cursor. Unsealed entries (seq NULL) are the newest, which is
+	// where PostgreSQL sorts NULLs in either direction.
+	order := "DESC"
+	keyset := `CASE WHEN $9::bigint IS NULL THEN seq IS NOT NULL OR id < $10 ELSE (seq, id) < ($9, $10) END`
+	if filter.Ascending {
+		order = "ASC"
+		keyset = `CASE WHEN $9::bigint IS NULL THEN seq IS NULL AND id > $10 ELSE seq IS NULL OR (seq, id) > ($9, $10) END`
+	}
+	var afterSeq *int64
+	var afterID *string
+	if filter.After != nil {
+		afterSeq, afterID = filter.After.Seq, &filter.After.ID
+	}
+	var changes *string
+	if len(filter.Changes) > 0 {
+		text := string(filter.Changes)
+		changes = &text
+	}
+
+	query := `
+		SELECT ` + auditLogColumns + `
+		FROM audit_log
+		WHERE ($1::uuid IS NULL OR user_id = $1)
+		AND ($2::text IS NULL OR action_type = $2)
+		AND ($3::text IS NULL OR target_entity_type = $3)
+		AND ($4::text IS NULL OR target_entity_id = $4)
+		AND ($5::timestamptz IS NULL OR performed_at >= $5)
+		AND ($6::timestamptz IS NULL OR performed_at < $6)
+		AND ($7::jsonb IS NULL OR changes @> $7)
+		AND ($8::text IS NULL OR changes ? $8)
+		AND ($10::uuid IS NULL OR ` + keyset + `)
+		ORDER BY seq ` + order + `, id ` + order + `
+		LIMIT $11 OFFSET $12;
+	`
+
+	rows, err := s.db.Query(ctx, query, filter.UserID, filter.ActionType, filter.EntityType, filter.EntityID,
+		filter.From, filter.To, changes, filter.ChangedField, afterSeq, afterID, filter.Limit, filter.Offset)
+	if err != nil {
+		log.Printf("Error querying audit logs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []AuditLog{}
+	for rows.Next() {
+		auditLog, err := scanAuditLog(rows)
+		if err != nil {
+			log.Printf("Error scanning audit log row: %v", err)
+			return nil, err
+		}
+		logs = append(logs, auditLog)
+	}
+	return logs, rows.Err()
+}
+
+// WalkAuditLogs calls fn for every audit entry matching filter, in the filter's
+// order, reading a page at a time so exports of any size use bounded memory.
+// filter.Limit sets the page size.
+func (s *Store) WalkAuditLogs(ctx context.Context, filter AuditLogFilter, fn func(AuditLog) error) error {
+	filter.Offset = 0
+	for {
+		page, err := s.GetAuditLogs(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if len(page) < filter.Limit {
+			return nil
+		}
+		filter.After = auditLogCursorOf(page[len(page)-1])
+	}
+}
+
+// ========== AUDIT CHAIN ==========
+
+const auditChainColumns = `seq, id, organization_id, performed_at, user_id, action_type, target_entity_type,
+	target_entity_id, changes::text, host(ip_address), user_agent, request_id, session_id::text, prev_hash, entry_hash`
+
+func scanAuditChainEntry(row pgx.Row) (AuditChainEntry, error) {
+	var e AuditChainEntry
+	var seq *int64
+	var prevHash, entryHash *string
+	err := row.Scan(&seq, &e.ID, &e.OrganizationID, &e.PerformedAt, &e.UserID, &e.ActionType, &e.TargetEntityType,
+		&e.TargetEntityID, &e.Changes, &e.IPAddress, &e.UserAgent, &e.RequestID, &e.SessionID, &prevHash, &entryHash)
+	if seq != nil {
+		e.Seq = *seq
+	}
+	if prevHash != nil {
+		e.PrevHash = *prevHash
+	}
+	if entryHash != nil {
+		e.EntryHash = *entryHash
+	}
+	return e, err
+}
+
+// SealAuditLog chains the organization's unsealed audit entries, oldest first,
+// and returns how many were sealed. A transaction-scoped advisory lock per
+// organization keeps two writers from extending the chain at once.
+func (s *Store) SealAuditLog(ctx context.Context) (int, error) {
+	orgID := OrganizationFromContext(ctx)
+	if orgID == "" {
+		return 0, fmt.Errorf("sealing the audit log requires an organization")
+	}
+
+	sealed := 0
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('audit_chain:' || $1))`, orgID); err != nil {
+			return err
+		}
+
+		seq, hash := int64(0), auditGenesisHash
+		err := s.db.QueryRow(ctx, `
+			SELECT seq, entry_hash FROM audit_log WHERE seq IS NOT NULL ORDER BY seq DESC LIMIT 1;
+		`).Scan(&seq, &hash)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		const batchSize = 500
+		for {
+			rows, err := s.db.Query(ctx, `
+				SELECT `+auditChainColumns+`
+				FROM audit_log
+				WHERE seq IS NULL
+				ORDER BY performed_at, id
+				LIMIT $1;
+			`, batchSize)
+			if err != nil {
+				return err
+			}
+			pending := []AuditChainEntry{}
+			for rows.Next() {
+				e, err := scanAuditChainEntry(rows)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+				pending = append(pending, e)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for _, e := range pending {
+				e.Seq = seq + 1
+				entryHash, err := e.chainHash(hash)
+				if err != nil {
+					return err
+				}
+				if _, err := s.db.Exec(ctx, `
+					UPDATE audit_log SET seq = $2, prev_hash = $3, entry_hash = $4 WHERE id = $1;
+				`, e.ID, e.Seq, hash, entryHash); err != nil {
+					return err
+				}
+				seq, hash = e.Seq, entryHash
+			}
+			sealed += len(pending)
+			if len(pending) < batchSize {
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Error sealing audit log: %v", err)
+		return 0, err
+	}
+	return sealed, nil
+}
+
+// WalkAuditChain calls fn for each sealed entry after afterSeq in chain order.
+// fn must not use the Store; an error from it stops the walk and is returned.
+func (s *Store) WalkAuditChain(ctx context.Context, afterSeq int64, fn func(AuditChainEntry) error) error {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+auditChainColumns+`
+		FROM audit_log
+		WHERE seq > $1
+		ORDER BY seq;
+	`, afterSeq)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditChainEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountUnsealedAuditEntries returns how many entries are waiting to be chained
+func (s *Store) CountUnsealedAuditEntries(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM audit_log WHERE seq IS NULL`).Scan(&count)
+	return count, err
+}
+
+// CreateAuditCheckpoint records a signed checkpoint
+func (s *Store) CreateAuditCheckpoint(ctx context.Context, cp *AuditCheckpoint) error {
+	return s.db.QueryRow(ctx, `
+		INSERT INTO audit_checkpoints (seq, entry_hash, signed_at, key_id, signature)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, organization_id;
+	`, cp.Seq, cp.EntryHash, cp.SignedAt, cp.KeyID, cp.Signature).Scan(&cp.ID, &cp.OrganizationID)
+}
+
+// ListAuditCheckpoints returns the newest checkpoints first; limit <= 0 returns all
+func (s *Store) ListAuditCheckpoints(ctx context.Context, limit int) ([]AuditCheckpoint, error) {
+	var limitArg *int
+	if limit > 0 {
+		limitArg = &limit
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT id, organization_id, seq, entry_hash, signed_at, key_id, signature
+		FROM audit_checkpoints
+		ORDER BY seq DESC
+		LIMIT $1;
+	`, limitArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := []AuditCheckpoint{}
+	for rows.Next() {
+		var cp AuditCheckpoint
+		if err := rows.Scan(&cp.ID, &cp.OrganizationID, &cp.Seq, &cp.EntryHash, &cp.SignedAt, &cp.KeyID, &cp.Signature); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
+
+// ListAuditSigningKeys returns every checkpoint signing key, oldest first
+func (s *Store) ListAuditSigningKeys(ctx context.Context) ([]StoredAuditSigningKey, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT kid, public_key, private_key, created_at
+		FROM audit_signing_keys
+		ORDER BY created_at;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []StoredAuditSigningKey{}
+	for rows.Next() {
+		k := StoredAuditSigningKey{AuditSigningKey: AuditSigningKey{Algorithm: "Ed25519"}}
+		if err := rows.Scan(&k.KeyID, &k.PublicKey, &k.PrivateKey, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// EnsureAuditSigningKey returns the newest checkpoint signing key, inserting the
+// one generate creates if there is none yet. A transaction-scoped advisory lock
+// keeps replicas from creating one each.
+func (s *Store) EnsureAuditSigningKey(ctx context.Context, generate func() (*StoredAuditSigningKey, error)) (*StoredAuditSigningKey, error) {
+	var key *StoredAuditSigningKey
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('audit_signing_keys'))`); err != nil {
+			return err
+		}
+
+		k := StoredAuditSigningKey{AuditSigningKey: AuditSigningKey{Algorithm: "Ed25519"}}
+		err := s.db.QueryRow(ctx, `
+			SELECT kid, public_key, private_key, created_at
+			FROM audit_signing_keys
+			ORDER BY created_at DESC
+			LIMIT 1;
+		`).Scan(&k.KeyID, &k.PublicKey, &k.PrivateKey, &k.CreatedAt)
+		if err == nil {
+			key = &k
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		if key, err = generate(); err != nil {
+			return err
+		}
+		return s.db.QueryRow(ctx, `
+			INSERT INTO audit_signing_keys (kid, public_key, private_key)
+			VALUES ($1, $2, $3)
+			RETURNING created_at;
+		`, key.KeyID, key.PublicKey, key.PrivateKey).Scan(&key.CreatedAt)
+	})
+	return key, err
+}
+
+// ========== AUDIT FORWARDING ==========
+
+// ForwardAuditEntries passes the next sealed entries a sink has not forwarded,
+// across all organizations and in chain order within each, to send and moves
+// the sink's cursors past them once send succeeds. A transaction-scoped advisory
+// lock keeps replicas from forwarding for the same sink at once; when another
+// replica holds it nothing is sent. Returns the number of entries forwarded.
+func (s *Store) ForwardAuditEntries(ctx context.Context, sink string, limit int, send func([]AuditChainEntry) error) (int, error) {
+	forwarded := 0
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		var locked bool
+		if err := s.db.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext($1))`, "audit_forward:"+sink).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		rows, err := s.db.Query(ctx, `
+			SELECT e.*
+			FROM organizations o
+			LEFT JOIN audit_forward_cursors c ON c.sink = $1 AND c.organization_id = o.id
+			CROSS JOIN LATERAL (
+				SELECT `+auditChainColumns+`
+				FROM audit_log
+				WHERE organization_id = o.id AND seq > COALESCE(c.last_seq, 0)
+				ORDER BY seq
+				LIMIT $2
+			) e
+			ORDER BY e.organization_id, e.seq
+			LIMIT $2;
+		`, sink, limit)
+		if err != nil {
+			return err
+		}
+		batch := []AuditChainEntry{}
+		for rows.Next() {
+			e, err := scanAuditChainEntry(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err = forwardBatch(batch, send, func(orgIDs []string, seqs []int64) error {
+			_, err := s.db.Exec(ctx, `
+				INSERT INTO audit_forward_cursors (sink, organization_id, last_seq)
+				SELECT $1, t.org_id::uuid, t.seq FROM unnest($2::text[], $3::bigint[]) AS t(org_id, seq)
+				ON CONFLICT (sink, organization_id) DO UPDATE
+				SET last_seq = GREATEST(audit_forward_cursors.last_seq, EXCLUDED.last_seq), updated_at = NOW();
+			`, sink, orgIDs, seqs)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		forwarded = len(batch)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return forwarded, nil
+}
+
+// forwardBatch sends a batch, ordered by organization and seq, and only once the
+// sink accepted it advances the cursors to each organization's last entry
+func forwardBatch(batch []AuditChainEntry, send func([]AuditChainEntry) error, advance func(orgIDs []string, seqs []int64) error) error {
+	if err := send(batch); err != nil {
+		return err
+	}
+
+	orgIDs, seqs := []string{}, []int64{}
+	for i, e := range batch {
+		if i == len(batch)-1 || batch[i+1].OrganizationID != e.OrganizationID {
+			orgIDs = append(orgIDs, e.OrganizationID)
+			seqs = append(seqs, e.Seq)
+		}
+	}
+	return advance(orgIDs, seqs)
+}
+
+// CountPendingAuditForwards returns how many sealed entries a sink has yet to forward
+func (s *Store) CountPendingAuditForwards(ctx context.Context, sink string) (int64, error) {
+	var pending int64
+	err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(p.n), 0)::bigint
+		FROM organizations o
+		LEFT JOIN audit_forward_cursors c ON c.sink = $1 AND c.organization_id = o.id
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS n FROM audit_log
+			WHERE organization_id = o.id AND seq > COALESCE(c.last_seq, 0)
+		) p;
+	`, sink).Scan(&pending)
+	return pending, err
+}
+
+// Notification represents a row in 'notifications'
+type Notification struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Message   string    `json:"message" db:"message"`
+	LinkURL   string    `json:"link_url,omitempty" db:"link_url"`
+	IsRead    bool      `json:"is_read" db:"is_read"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// CreateNotification creates a new notification
+func (s *Store) CreateNotification(ctx context.Context, userID string, message string, linkURL string) error {
+	query := `
+		INSERT INTO notifications
+		(user_id, message, link_url)
+		VALUES ($1, $2, $3);
+	`
+
+	_, err := s.db.Exec(ctx, query, userID, message, linkURL)
+	if err != nil {
+		log.Printf("Error INSERT into notifications: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetNotificationsForUser retrieves notifications for a specific user
+func (s *Store) GetNotificationsForUser(ctx context.Context, userID string, onlyUnread bool) ([]Notification, error) {
+	var query string
+	if onlyUnread {
+		query = `
+			SELECT id, user_id, message, link_url, is_read, created_at
+			FROM notifications
+			WHERE user_id = $1 AND is_read = false
+			ORDER BY created_at DESC;
+		`
+	} else {
+		query = `
+			SELECT id, user_id, message, link_url, is_read, created_at
+			FROM notifications
+			WHERE user_id = $1
+			ORDER BY created_at DESC;
+		`
+	}
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		log.Printf("Error querying notifications: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(
+			&n.ID, &n.UserID, &n.Message, &n.LinkURL, &n.IsRead, &n.CreatedAt,
+		); err != nil {
+			log.Printf("Error scanning notification row: %v", err)
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if notifications == nil {
+		notifications = make([]Notification, 0)
+	}
+	return notifications, nil
+}
+
+// MarkNotificationAsRead marks a notification as read
+func (s *Store) MarkNotificationAsRead(ctx context.Context, notificationID string, userID string) error {
+	query := `
+		UPDATE notifications
+		SET is_read = true
+		WHERE id = $1 AND user_id = $2;
+	`
+
+	result, err := s.db.Exec(ctx, query, notificationID, userID)
+	if err != nil {
+		log.Printf("Error UPDATE notification: %v", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("notification not found or not owned by user")
+	}
+	return nil
+}
+
+// GetDashboardSummary provides comprehensive dashboard statistics
+func (s *Store) GetDashboardSummary(ctx context.Context) (map[string]interface{}, error) {
+	// Get control statistics
+	controlStats := make(map[string]interface{})
+
+	// Total controls in library
+	var totalControls int
+	err := s.db.QueryRow(ctx, "SELECT COUNT(*) FROM control_library").Scan(&totalControls)
+	if err != nil {
+		return nil, fmt.Errorf("error counting total controls: %w", err)
+	}
+	controlStats["totalControls"] = totalControls
+
+	// Activated controls
+	var activatedControls int
+	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM activated_controls WHERE status = 'active'").Scan(&activatedControls)
+	if err != nil {
+		return nil, fmt.Errorf("error counting activated controls: %w", err)
+	}
+	controlStats["activatedControls"] = activatedControls
+
+	// Compliant controls (last evidence was compliant)
+	var compliantControls int
+	err = s.db.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT ac.id)
+		FROM activated_controls ac
+		WHERE ac.status = 'active'
+		AND EXISTS (
+			SELECT 1 FROM control_evidence_log cel
+			WHERE cel.activated_control_id = ac.id
+			AND cel.compliance_status = 'compliant'
+			AND cel.performed_at = (
+				SELECT MAX(performed_at)
+				FROM control_evidence_log
+				WHERE activated_control_id = ac.id
+			)
+		)
+	`).Scan(&compliantControls)
+	if err != nil {
+		return nil, fmt.Errorf("error counting compliant controls: %w", err)
+	}
+	controlStats["compliantControls"] = compliantControls
+
+	// Non-compliant controls
+	var nonCompliantControls int
+	err = s.db.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT ac.id)
+		FROM activated_controls ac
+		WHERE ac.status = 'active'
+		AND EXISTS (
+			SELECT 1 FROM control_evidence_log cel
+			WHERE cel.activated_control_id = ac.id
+			AND cel.compliance_status = 'non-compliant'
+			AND cel.performed_at = (
+				SELECT MAX(performed_at)
+				FROM control_evidence_log
+				WHERE activated_control_id = ac.id
+			)
+		)
+	`).Scan(&nonCompliantControls)
+	if err != nil {
+		return nil, fmt.Errorf("error counting non-compliant controls: %w", err)
+	}
+	controlStats["nonCompliantControls"] = nonCompliantControls
+
+	// Overdue controls
+	var overdueControls int
+	err = s.db.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM activated_controls
+		WHERE status = 'active'
+		AND next_review_due_date < CURRENT_DATE
+	`).Scan(&overdueControls)
+	if err != nil {
+		return nil, fmt.Errorf("error counting overdue controls: %w", err)
+	}
+	controlStats["overdueControls"] = overdueControls
+
+	// Get ticket statistics
+	ticketStats := make(map[string]interface{})
+
+	// Total tickets
+	var totalTickets int
+	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM tickets").Scan(&totalTickets)
+	if err != nil {
+		return nil, fmt.Errorf("error counting total tickets: %w", err)
+	}
+	ticketStats["totalTickets"] = totalTickets
+
+	// Open tickets
+	var openTickets int
+	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM tickets WHERE status IN ('new', 'in_progress')").Scan(&openTickets)
+	if err != nil {
+		return nil, fmt.Errorf("error counting open tickets: %w", err)
+	}
+	ticketStats["openTickets"] = openTickets
+
+	// Resolved tickets this month
+	var resolvedThisMonth int
+	err = s.db.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM tickets
+		WHERE status = 'resolved'
+		AND resolved_at >= DATE_TRUNC('month', CURRENT_DATE)
+	`).Scan(&resolvedThisMonth)
+	if err != nil {
+		return nil, fmt.Errorf("error counting resolved tickets this month: %w", err)
+	}
+	ticketStats["resolvedThisMonth"] = resolvedThisMonth
+
+	// Get asset and document statistics
+	var totalAssets int
+	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM assets WHERE status = 'active'").Scan(&totalAssets)
+	if err != nil {
+		return nil, fmt.Errorf("error counting assets: %w", err)
+	}
+
+	var totalDocuments int
+	err = s.db.QueryRow(ctx, "SELECT COUNT(*) FROM documents").Scan(&totalDocuments)
+	if err != nil {
+		return nil, fmt.Errorf("error counting documents: %w", err)
+	}
+
+	// Calculate compliance percentage
+	compliancePercentage := 0.0
+	if activatedControls > 0 {
+		compliancePercentage = float64(compliantControls) / float64(activatedControls) * 100
+	}
+
+	return map[string]interface{}{
+		"controls": map[string]interface{}{
+			"total":                totalControls,
+			"activated":            activatedControls,
+			"compliant":            compliantControls,
+			"nonCompliant":         nonCompliantControls,
+			"overdue":              overdueControls,
+			"compliancePercentage": compliancePercentage,
+		},
+		"tickets": ticketStats,
+		"assets": map[string]interface{}{
+			"total": totalAssets,
+		},
+		"documents": map[string]interface{}{
+			"total": totalDocuments,
+		},
+	}, nil
+}
+
+// ========== DOCUMENT MANAGEMENT ==========
+
+// DocumentInfo represents a document with its basic info
+type DocumentInfo struct {
+	ID                 string         `json:"id"`
+	Title              string         `json:"title"`
+	Category           string         `json:"category"`
+	OwnerID            sql.NullString `json:"owner_id,omitempty"`
+	PublishedVersionID sql.NullString `json:"published_version_id,omitempty"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+}
+
+// DocumentVersion represents a version of a document
+type DocumentVersion struct {
+	ID                string    `json:"id"`
+	DocumentID        string    `json:"document_id"`
+	VersionNumber     int       `json:"version_number"`
+	BodyContent       string    `json:"body_content"`
+	ChangeDescription string    `json:"change_description,omitempty"`
+	Status            string    `json:"status"`
+	CreatedByUserID   string    `json:"created_by_user_id"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// CreateDocumentRequest is the JSON for creating a document
+type CreateDocumentRequest struct {
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	OwnerID  string `json:"owner_id"`
+}
+
+// CreateDocumentVersionRequest is the JSON for creating a document version
+type CreateDocumentVersionRequest struct {
+	BodyContent       string `json:"body_content"`
+	ChangeDescription string `json:"change_description,omitempty"`
+}
+
+// CreateDocument creates a new document
+func (s *Store) CreateDocument(ctx context.Context, title, category, ownerID string) (*DocumentInfo, error) {
+	var doc DocumentInfo
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO documents (title, category, owner_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, title, category, owner_id, published_version_id, created_at, updated_at
+	`, title, category, ownerID).Scan(
+		&doc.ID, &doc.Title, &doc.Category, &doc.OwnerID, &doc.PublishedVersionID,
+		&doc.CreatedAt, &doc.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating document: %w", err)
+	}
+	return &doc, nil
+}
+
+// GetDocuments retrieves all documents
+func (s *Store) GetDocuments(ctx context.Context) ([]DocumentInfo, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, title, category, owner_id, published_version_id, created_at, updated_at
+		FROM documents
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying documents: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []DocumentInfo
+	for rows.Next() {
+		var doc DocumentInfo
+		if err := rows.Scan(&doc.ID, &doc.Title, &doc.Category, &doc.OwnerID,
+			&doc.PublishedVersionID, &doc.CreatedAt, &doc.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning document: %w", err)
+		}
+		documents = append(documents, doc)
+	}
+	return documents, nil
+}
+
+// GetDocumentByID retrieves a single document by ID
+func (s *Store) GetDocumentByID(ctx context.Context, documentID string) (*DocumentInfo, error) {
+	var doc DocumentInfo
+	err := s.db.QueryRow(ctx, `
+		SELECT id, title, category, owner_id, published_version_id, created_at, updated_at
+		FROM documents
+		WHERE id = $1
+	`, documentID).Scan(
+		&doc.ID, &doc.Title, &doc.Category, &doc.OwnerID, &doc.PublishedVersionID,
+		&doc.CreatedAt, &doc.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting document: %w", err)
+	}
+	return &doc, nil
+}
+
+// CreateDocumentVersion creates a new draft version of a document
+func (s *Store) CreateDocumentVersion(ctx context.Context, documentID, bodyContent, changeDescription, userID string) (*DocumentVersion, error) {
+	// Get the next version number
+	var nextVersion int
+	err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(MAX(version_number), 0) + 1
+		FROM document_versions
+		WHERE document_id = $1
+	`, documentID).Scan(&nextVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error getting next version number: %w", err)
+	}
+
+	// Create the new version
+	var version DocumentVersion
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO document_versions (document_id, version_number, body_content, change_description, status, created_by_user_id)
+		VALUES ($1, $2, $3, $4, 'draft', $5)
+		RETURNING id, document_id, version_number, body_content, change_description, status, created_by_user_id, created_at
+	`, documentID, nextVersion, bodyContent, changeDescription, userID).Scan(
+		&version.ID, &version.DocumentID, &version.VersionNumber, &version.BodyContent,
+		&version.ChangeDescription, &version.Status, &version.CreatedByUserID, &version.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating document version: %w", err)
+	}
+	return &version, nil
+}
+
+// PublishDocumentVersion publishes a draft version
+func (s *Store) PublishDocumentVersion(ctx context.Context, versionID, documentID string) error {
+	// Start transaction
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Archive any currently published versions
+	_, err = tx.Exec(ctx, `
+		UPDATE document_versions
+		SET status = 'archived'
+		WHERE document_id = $1 AND status = 'published'
+	`, documentID)
+	if err != nil {
+		return fmt.Errorf("error archiving old versions: %w", err)
+	}
+
+	// Set the new version as published
+	_, err = tx.Exec(ctx, `
+		UPDATE document_versions
+		SET status = 'published'
+		WHERE id = $1
+	`, versionID)
+	if err != nil {
+		return fmt.Errorf("error publishing version: %w", err)
+	}
+
+	// Update the document's published_version_id
+	_, err = tx.Exec(ctx, `
+		UPDATE documents
+		SET published_version_id = $1
+		WHERE id = $2
+	`, versionID, documentID)
+	if err != nil {
+		return fmt.Errorf("error updating document published version: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetDocumentVersions retrieves all versions of a document
+func (s *Store) GetDocumentVersions(ctx context.Context, documentID string) ([]DocumentVersion, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, document_id, version_number, body_content, change_description, status, created_by_user_id, created_at
+		FROM document_versions
+		WHERE document_id = $1
+		ORDER BY version_number DESC
+	`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying document versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []DocumentVersion
+	for rows.Next() {
+		var version DocumentVersion
+		if err := rows.Scan(&version.ID, &version.DocumentID, &version.VersionNumber,
+			&version.BodyContent, &version.ChangeDescription, &version.Status,
+			&version.CreatedByUserID, &version.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// AcknowledgeDocument records that a user has read a specific version
+func (s *Store) AcknowledgeDocument(ctx context.Context, versionID, userID string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO document_read_acknowledgements (document_version_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (document_version_id, user_id) DO NOTHING
+	`, versionID, userID)
+	if err != nil {
+		return fmt.Errorf("error acknowledging document: %w", err)
+	}
+	return nil
+}
+
+// CreateDocumentControlMapping links a document to a control
+func (s *Store) CreateDocumentControlMapping(ctx context.Context, documentID, activatedControlID string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO document_control_mapping (document_id, activated_control_id)
+		VALUES ($1, $2)
+		ON CONFLICT (document_id, activated_control_id) DO NOTHING
+	`, documentID, activatedControlID)
+	if err != nil {
+		return fmt.Errorf("error creating document-control mapping: %w", err)
+	}
+	return nil
+}
+
+// DeleteDocumentControlMapping removes a document-control mapping
+func (s *Store) DeleteDocumentControlMapping(ctx context.Context, documentID, activatedControlID string) error {
+	result, err := s.db.Exec(ctx, `
+		DELETE FROM document_control_mapping
+		WHERE document_id = $1 AND activated_control_id = $2
+	`, documentID, activatedControlID)
+	if err != nil {
+		return fmt.Errorf("error deleting document-control mapping: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("mapping not found")
+	}
+	return nil
+}
+
+// ========== GDPR ROPA MANAGEMENT ==========
+
+// GDPRROPA represents a Record of Processing Activities
+type GDPRROPA struct {
+	ID                    string    `json:"id"`
+	ActivityName          string    `json:"activity_name"`
+	Department            string    `json:"department,omitempty"`
+	DataControllerDetails string    `json:"data_controller_details"`
+	DataCategories        string    `json:"data_categories"`
+	DataSubjectCategories string    `json:"data_subject_categories"`
+	Recipients            string    `json:"recipients,omitempty"`
+	ThirdCountryTransfers string    `json:"third_country_transfers,omitempty"`
+	RetentionPeriod       string    `json:"retention_period,omitempty"`
+	SecurityMeasures      string    `json:"security_measures,omitempty"`
+	Status                string    `json:"status"`
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// CreateROPARequest is the JSON for creating a ROPA entry
+type CreateROPARequest struct {
+	ActivityName          string `json:"activity_name"`
+	Department            string `json:"department,omitempty"`
+	DataControllerDetails string `json:"data_controller_details"`
+	DataCategories        string `json:"data_categories"`
+	DataSubjectCategories string `json:"data_subject_categories"`
+	Recipients            string `json:"recipients,omitempty"`
+	ThirdCountryTransfers string `json:"third_country_transfers,omitempty"`
+	RetentionPeriod       string `json:"retention_period,omitempty"`
+	SecurityMeasures      string `json:"security_measures,omitempty"`
+}
+
+// UpdateROPARequest is the JSON for updating a ROPA entry
+type UpdateROPARequest struct {
+	ActivityName          *string `json:"activity_name,omitempty"`
+	Department            *string `json:"department,omitempty"`
+	DataControllerDetails *string `json:"data_controller_details,omitempty"`
+	DataCategories        *string `json:"data_categories,omitempty"`
+	DataSubjectCategories *string `json:"data_subject_categories,omitempty"`
+	Recipients            *string `json:"recipients,omitempty"`
+	ThirdCountryTransfers *string `json:"third_country_transfers,omitempty"`
+	RetentionPeriod       *string `json:"retention_period,omitempty"`
+	SecurityMeasures      *string `json:"security_measures,omitempty"`
+	Status                *string `json:"status,omitempty"`
+}
+
+// CreateROPA creates a new ROPA entry
+func (s *Store) CreateROPA(ctx context.Context, req CreateROPARequest) (*GDPRROPA, error) {
+	var ropa GDPRROPA
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO gdpr_ropa (
+			activity_name, department, data_controller_details, data_categories,
+			data_subject_categories, recipients, third_country_transfers,
+			retention_period, security_measures, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 'draft')
+		RETURNING id, activity_name, department, data_controller_details, data_categories,
+			data_subject_categories, recipients, third_country_transfers, retention_period,
+			security_measures, status, created_at, updated_at
+	`, req.ActivityName, req.Department, req.DataControllerDetails, req.DataCategories,
+		req.DataSubjectCategories, req.Recipients, req.ThirdCountryTransfers,
+		req.RetentionPeriod, req.SecurityMeasures).Scan(
+		&ropa.ID, &ropa.ActivityName, &ropa.Department, &ropa.DataControllerDetails,
+		&ropa.DataCategories, &ropa.DataSubjectCategories, &ropa.Recipients,
+		&ropa.ThirdCountryTransfers, &ropa.RetentionPeriod, &ropa.SecurityMeasures,
+		&ropa.Status, &ropa.CreatedAt, &ropa.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ROPA: %w", err)
+	}
+	return &ropa, nil
+}
+
+// GetROPAs retrieves all ROPA entries
+func (s *Store) GetROPAs(ctx context.Context) ([]GDPRROPA, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, activity_name, department, data_controller_details, data_categories,
+			data_subject_categories, recipients, third_country_transfers, retention_period,
+			security_measures, status, created_at, updated_at
+		FROM gdpr_ropa
+		WHERE status != 'archived'
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying ROPAs: %w", err)
+	}
+	defer rows.Close()
+
+	var ropas []GDPRROPA
+	for rows.Next() {
+		var ropa GDPRROPA
+		if err := rows.Scan(&ropa.ID, &ropa.ActivityName, &ropa.Department,
+			&ropa.DataControllerDetails, &ropa.DataCategories, &ropa.DataSubjectCategories,
+			&ropa.Recipients, &ropa.ThirdCountryTransfers, &ropa.RetentionPeriod,
+			&ropa.SecurityMeasures, &ropa.Status, &ropa.CreatedAt, &ropa.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning ROPA: %w", err)
+		}
+		ropas = append(ropas, ropa)
+	}
+	return ropas, nil
+}
+
+// GetROPAByID retrieves a single ROPA entry by ID
+func (s *Store) GetROPAByID(ctx context.Context, ropaID string) (*GDPRROPA, error) {
+	var ropa GDPRROPA
+	err := s.db.QueryRow(ctx, `
+		SELECT id, activity_name, department, data_controller_details, data_categories,
+			data_subject_categories, recipients, third_country_transfers, retention_period,
+			security_measures, status, created_at, updated_at
+		FROM gdpr_ropa
+		WHERE id = $1
+	`, ropaID).Scan(
+		&ropa.ID, &ropa.ActivityName, &ropa.Department, &ropa.DataControllerDetails,
+		&ropa.DataCategories, &ropa.DataSubjectCategories, &ropa.Recipients,
+		&ropa.ThirdCountryTransfers, &ropa.RetentionPeriod, &ropa.SecurityMeasures,
+		&ropa.Status, &ropa.CreatedAt, &ropa.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ROPA: %w", err)
+	}
+	return &ropa, nil
+}
+
+// UpdateROPA updates a ROPA entry
+func (s *Store) UpdateROPA(ctx context.Context, ropaID string, req UpdateROPARequest) (*GDPRROPA, error) {
+	// Build dynamic update query
+	updates := []string{}
+	args := []interface{}{}
+	argPos := 1
+
+	if req.ActivityName != nil {
+		updates = append(updates, fmt.Sprintf("activity_name = $%d", argPos))
+		args = append(args, *req.ActivityName)
+		argPos++
+	}
+	if req.Department != nil {
+		updates = append(updates, fmt.Sprintf("department = $%d", argPos))
+		args = append(args, *req.Department)
+		argPos++
+	}
+	if req.DataControllerDetails != nil {
+		updates = append(updates, fmt.Sprintf("data_controller_details = $%d", argPos))
+		args = append(args, *req.DataControllerDetails)
+		argPos++
+	}
+	if req.DataCategories != nil {
+		updates = append(updates, fmt.Sprintf("data_categories = $%d", argPos))
+		args = append(args, *req.DataCategories)
+		argPos++
+	}
+	if req.DataSubjectCategories != nil {
+		updates = append(updates, fmt.Sprintf("data_subject_categories = $%d", argPos))
+		args = append(args, *req.DataSubjectCategories)
+		argPos++
+	}
+	if req.Recipients != nil {
+		updates = append(updates, fmt.Sprintf("recipients = $%d", argPos))
+		args = append(args, *req.Recipients)
+		argPos++
+	}
+	if req.ThirdCountryTransfers != nil {
+		updates = append(updates, fmt.Sprintf("third_country_transfers = $%d", argPos))
+		args = append(args, *req.ThirdCountryTransfers)
+		argPos++
+	}
+	if req.RetentionPeriod != nil {
+		updates = append(updates, fmt.Sprintf("retention_period = $%d", argPos))
+		args = append(args, *req.RetentionPeriod)
+		argPos++
+	}
+	if req.SecurityMeasures != nil {
+		updates = append(updates, fmt.Sprintf("security_measures = $%d", argPos))
+		args = append(args, *req.SecurityMeasures)
+		argPos++
+	}
+	if req.Status != nil {
+		updates = append(updates, fmt.Sprintf("status = $%d", argPos))
+		args = append(args, *req.Status)
+		argPos++
+	}
+
+	if len(updates) == 0 {
+		return s.GetROPAByID(ctx, ropaID)
+	}
+
+	args = append(args, ropaID)
+	query := fmt.Sprintf(`
+		UPDATE gdpr_ropa
+		SET %s
+		WHERE id = $%d
+		RETURNING id, activity_name, department, data_controller_details, data_categories,
+			data_subject_categories, recipients, third_country_transfers, retention_period,
+			security_measures, status, created_at, updated_at
+	`, strings.Join(updates, ", "), argPos)
+
+	var ropa GDPRROPA
+	err := s.db.QueryRow(ctx, query, args...).Scan(
+		&ropa.ID, &ropa.ActivityName, &ropa.Department, &ropa.DataControllerDetails,
+		&ropa.DataCategories, &ropa.DataSubjectCategories, &ropa.Recipients,
+		&ropa.ThirdCountryTransfers, &ropa.RetentionPeriod, &ropa.SecurityMeasures,
+		&ropa.Status, &ropa.CreatedAt, &ropa.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating ROPA: %w", err)
+	}
+	return &ropa, nil
+}
+
+// ArchiveROPA soft-deletes a ROPA entry by setting status to 'archived'
+func (s *Store) ArchiveROPA(ctx context.Context, ropaID string) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE gdpr_ropa
+		SET status = 'archived'
+		WHERE id = $1
+	`, ropaID)
+	if err != nil {
+		return fmt.Errorf("error archiving ROPA: %w", err)
+	}
+	return nil
+}
+
+// MappedControl represents a control mapped to an asset or risk
+type MappedControl struct {
+	ActivatedControlID string     `json:"activated_control_id"`
+	ControlLibraryID   string     `json:"control_library_id"`
+	ControlName        string     `json:"control_name"`
+	Status             string     `json:"status"`
+	NextReviewDueDate  *time.Time `json:"next_review_due_date,omitempty"`
+}
+
+// Risk Assessment CRUD operations
+
+// RiskAssessment represents a risk assessment record
+type RiskAssessment struct {
+	ID                 string     `json:"id"`
+	Title              string     `json:"title"`
+	Description        string     `json:"description"`
+	Category           *string    `json:"category"`
+	Likelihood         int        `json:"likelihood"` // 1-5
+	Impact             int        `json:"impact"`     // 1-5
+	RiskScore          int        `json:"risk_score"` // Calculated: likelihood * impact
+	Status             string     `json:"status"`     // identified, assessed, mitigated, accepted, closed
+	OwnerID            *string    `json:"owner_id"`
+	MitigationPlan     *string    `json:"mitigation_plan"`
+	ResidualLikelihood *int       `json:"residual_likelihood"` // After mitigation
+	ResidualImpact     *int       `json:"residual_impact"`     // After mitigation
+	ResidualRiskScore  int        `json:"residual_risk_score"` // Calculated
+	ReviewDate         *time.Time `json:"review_date"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// CreateRiskRequest represents the request body for creating a risk
+type CreateRiskRequest struct {
+	Title              string     `json:"title"`
+	Description        string     `json:"description"`
+	Category           *string    `json:"category"`
+	Likelihood         int        `json:"likelihood"`
+	Impact             int        `json:"impact"`
+	OwnerID            *string    `json:"owner_id"`
+	MitigationPlan     *string    `json:"mitigation_plan"`
+	ResidualLikelihood *int       `json:"residual_likelihood"`
+	ResidualImpact     *int       `json:"residual_impact"`
+	ReviewDate         *time.Time `json:"review_date"`
+}
+
+// UpdateRiskRequest represents the request body for updating a risk
+type UpdateRiskRequest struct {
+	Title              *string    `json:"title"`
+	Description        *string    `json:"description"`
+	Category           *string    `json:"category"`
+	Likelihood         *int       `json:"likelihood"`
+	Impact             *int       `json:"impact"`
+	Status             *string    `json:"status"`
+	OwnerID            *string    `json:"owner_id"`
+	MitigationPlan     *string    `json:"mitigation_plan"`
+	ResidualLikelihood *int       `json:"residual_likelihood"`
+	ResidualImpact     *int       `json:"residual_impact"`
+	ReviewDate         *time.Time `json:"review_date"`
+}
+
+// CreateRisk creates a new risk assessment
+func (s *Store) CreateRisk(ctx context.Context, req CreateRiskRequest) (*RiskAssessment, error) {
+	query := `
+		INSERT INTO risk_assessments
+		(title, description, category, likelihood, impact, owner_id, mitigation_plan,
+		 residual_likelihood, residual_impact, review_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, title, description, category, likelihood, impact, risk_score, status,
+			owner_id, mitigation_plan, residual_likelihood, residual_impact, residual_risk_score,
+			review_date, created_at, updated_at
+	`
+	var risk RiskAssessment
+	err := s.db.QueryRow(ctx, query,
+		req.Title, req.Description, req.Category, req.Likelihood, req.Impact,
+		req.OwnerID, req.MitigationPlan, req.ResidualLikelihood, req.ResidualImpact, req.ReviewDate,
+	).Scan(
+		&risk.ID, &risk.Title, &risk.Description, &risk.Category, &risk.Likelihood, &risk.Impact,
+		&risk.RiskScore, &risk.Status, &risk.OwnerID, &risk.MitigationPlan,
+		&risk.ResidualLikelihood, &risk.ResidualImpact, &risk.ResidualRiskScore,
+		&risk.ReviewDate, &risk.CreatedAt, &risk.UpdatedAt,
+	)
+	if err != nil {
+		log.Printf("Error creating risk: %v", err)
+		return nil, fmt.Errorf("error creating risk: %w", err)
+	}
+	return &risk, nil
+}
+
+// GetRisks retrieves all risk assessments
+func (s *Store) GetRisks(ctx context.Context) ([]RiskAssessment, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, title, description, category, likelihood, impact, risk_score, status,
+			owner_id, mitigation_plan, residual_likelihood, residual_impact, residual_risk_score,
+			review_date, created_at, updated_at
+		FROM risk_assessments
+		WHERE status != 'closed'
+		ORDER BY risk_score DESC, created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying risks: %w", err)
+	}
+	defer rows.Close()
+
+	var risks []RiskAssessment
+	for rows.Next() {
+		var risk RiskAssessment
+		if err := rows.Scan(&risk.ID, &risk.Title, &risk.Description, &risk.Category,
+			&risk.Likelihood, &risk.Impact, &risk.RiskScore, &risk.Status, &risk.OwnerID,
+			&risk.MitigationPlan, &risk.ResidualLikelihood, &risk.ResidualImpact,
+			&risk.ResidualRiskScore, &risk.ReviewDate, &risk.CreatedAt, &risk.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning risk: %w", err)
+		}
+		risks = append(risks, risk)
+	}
+	return risks, nil
+}
+
+// GetRiskByID retrieves a single risk assessment by ID
+func (s *Store) GetRiskByID(ctx context.Context, riskID string) (*RiskAssessment, error) {
+	var risk RiskAssessment
+	err := s.db.QueryRow(ctx, `
+		SELECT id, title, description, category, likelihood, impact, risk_score, status,
+			owner_id, mitigation_plan, residual_likelihood, residual_impact, residual_risk_score,
+			review_date, created_at, updated_at
+		FROM risk_assessments
+		WHERE id = $1
+	`, riskID).Scan(
+		&risk.ID, &risk.Title, &risk.Description, &risk.Category, &risk.Likelihood, &risk.Impact,
+		&risk.RiskScore, &risk.Status, &risk.OwnerID, &risk.MitigationPlan,
+		&risk.ResidualLikelihood, &risk.ResidualImpact, &risk.ResidualRiskScore,
+		&risk.ReviewDate, &risk.CreatedAt, &risk.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting risk: %w", err)
+	}
+	return &risk, nil
+}
+
+// UpdateRisk updates a risk assessment
+func (s *Store) UpdateRisk(ctx context.Context, riskID string, req UpdateRiskRequest) (*RiskAssessment, error) {
+	updates := []string{}
+	args := []interface{}{}
+	argPos := 1
+
+	if req.Title != nil {
+		updates = append(updates, fmt.Sprintf("title = $%d", argPos))
+		args = append(args, *req.Title)
+		argPos++
+	}
+	if req.Description != nil {
+		updates = append(updates, fmt.Sprintf("description = $%d", argPos))
+		args = append(args, *req.Description)
+		argPos++
+	}
+	if req.Category != nil {
+		updates = append(updates, fmt.Sprintf("category = $%d", argPos))
+		args = append(args, *req.Category)
+		argPos++
+	}
+	if req.Likelihood != nil {
+		updates = append(updates, fmt.Sprintf("likelihood = $%d", argPos))
+		args = append(args, *req.Likelihood)
+		argPos++
+	}
+	if req.Impact != nil {
+		updates = append(updates, fmt.Sprintf("impact = $%d", argPos))
+		args = append(args, *req.Impact)
+		argPos++
+	}
+	if req.Status != nil {
+		updates = append(updates, fmt.Sprintf("status = $%d", argPos))
+		args = append(args, *req.Status)
+		argPos++
+	}
+	if req.OwnerID != nil {
+		updates = append(updates, fmt.Sprintf("owner_id = $%d", argPos))
+		args = append(args, *req.OwnerID)
+		argPos++
+	}
+	if req.MitigationPlan != nil {
+		updates = append(updates, fmt.Sprintf("mitigation_plan = $%d", argPos))
+		args = append(args, *req.MitigationPlan)
+		argPos++
+	}
+	if req.ResidualLikelihood != nil {
+		updates = append(updates, fmt.Sprintf("residual_likelihood = $%d", argPos))
+		args = append(args, *req.ResidualLikelihood)
+		argPos++
+	}
+	if req.ResidualImpact != nil {
+		updates = append(updates, fmt.Sprintf("residual_impact = $%d", argPos))
+		args = append(args, *req.ResidualImpact)
+		argPos++
+	}
+	if req.ReviewDate != nil {
+		updates = append(updates, fmt.Sprintf("review_date = $%d", argPos))
+		args = append(args, *req.ReviewDate)
+		argPos++
+	}
+
+	if len(updates) == 0 {
+		return s.GetRiskByID(ctx, riskID)
+	}
+
+	args = append(args, riskID)
+	query := fmt.Sprintf(`
+		UPDATE risk_assessments
+		SET %s
+		WHERE id = $%d
+		RETURNING id, title, description, category, likelihood, impact, risk_score, status,
+			owner_id, mitigation_plan, residual_likelihood, residual_impact, residual_risk_score,
+			review_date, created_at, updated_at
+	`, strings.Join(updates, ", "), argPos)
+
+	var risk RiskAssessment
+	err := s.db.QueryRow(ctx, query, args...).Scan(
+		&risk.ID, &risk.Title, &risk.Description, &risk.Category, &risk.Likelihood, &risk.Impact,
+		&risk.RiskScore, &risk.Status, &risk.OwnerID, &risk.MitigationPlan,
+		&risk.ResidualLikelihood, &risk.ResidualImpact, &risk.ResidualRiskScore,
+		&risk.ReviewDate, &risk.CreatedAt, &risk.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating risk: %w", err)
+	}
+	return &risk, nil
+}
+
+// DeleteRisk deletes a risk assessment (hard delete)
+func (s *Store) DeleteRisk(ctx context.Context, riskID string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM risk_assessments WHERE id = $1`, riskID)
+	if err != nil {
+		return fmt.Errorf("error deleting risk: %w", err)
+	}
+	return nil
+}
+
+// CreateRiskControlMapping links a risk to a control
+func (s *Store) CreateRiskControlMapping(ctx context.Context, riskID, controlID string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO risk_control_mapping (risk_id, activated_control_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, riskID, controlID)
+	return err
+}
+
+// DeleteRiskControlMapping removes a risk-control link
+func (s *Store) DeleteRiskControlMapping(ctx context.Context, riskID, controlID string) error {
+	_, err := s.db.Exec(ctx, `
+		DELETE FROM risk_control_mapping
+		WHERE risk_id = $1 AND activated_control_id = $2
+	`, riskID, controlID)
+	return err
+}
+
+// GetRiskControls retrieves all controls linked to a risk
+func (s *Store) GetRiskControls(ctx context.Context, riskID string) ([]MappedControl, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT ac.id, cl.id, cl.name, ac.status, ac.next_review_due_date
+		FROM risk_control_mapping rcm
+		JOIN activated_controls ac ON rcm.activated_control_id = ac.id
+		JOIN control_library cl ON ac.control_library_id = cl.id
+		WHERE rcm.risk_id = $1
+	`, riskID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying risk controls: %w", err)
+	}
+	defer rows.Close()
+
+	var controls []MappedControl
+	for rows.Next() {
+		var ctrl MappedControl
+		if err := rows.Scan(&ctrl.ActivatedControlID, &ctrl.ControlLibraryID, &ctrl.ControlName,
+			&ctrl.Status, &ctrl.NextReviewDueDate); err != nil {
+			return nil, fmt.Errorf("error scanning control: %w", err)
+		}
+		controls = append(controls, ctrl)
+	}
+	return controls, nil
+}
+
+// GDPR Data Subject Request (DSR) CRUD operations
+
+// GDPRDSR represents a data subject request
+type GDPRDSR struct {
+	ID               string     `json:"id"`
+	RequestType      string     `json:"request_type"` // access, erasure, rectification, portability, restriction, objection
+	RequesterName    string     `json:"requester_name"`
+	RequesterEmail   string     `json:"requester_email"`
+	RequesterPhone   *string    `json:"requester_phone"`
+	DataSubjectInfo  string     `json:"data_subject_info"`
+	RequestDetails   *string    `json:"request_details"`
+	Status           string     `json:"status"`   // submitted, under_review, in_progress, completed, rejected
+	Priority         string     `json:"priority"` // low, normal, high, urgent
+	AssignedToUserID *string    `json:"assigned_to_user_id"`
+	DeadlineDate     time.Time  `json:"deadline_date"`
+	CompletedDate    *time.Time `json:"completed_date"`
+	ResponseSummary  *string    `json:"response_summary"`
+	RejectionReason  *string    `json:"rejection_reason"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// CreateDSRRequest represents the request body for creating a DSR
+type CreateDSRRequest struct {
+	RequestType     string  `json:"request_type"`
+	RequesterName   string  `json:"requester_name"`
+	RequesterEmail  string  `json:"requester_email"`
+	RequesterPhone  *string `json:"requester_phone"`
+	DataSubjectInfo string  `json:"data_subject_info"`
+	RequestDetails  *string `json:"request_details"`
+	Priority        string  `json:"priority"`
+}
+
+// UpdateDSRRequest represents the request body for updating a DSR
+type UpdateDSRRequest struct {
+	Status           *string    `json:"status"`
+	Priority         *string    `json:"priority"`
+	AssignedToUserID *string    `json:"assigned_to_user_id"`
+	DeadlineDate     *time.Time `json:"deadline_date"`
+	ResponseSummary  *string    `json:"response_summary"`
+	RejectionReason  *string    `json:"rejection_reason"`
+}
+
+// CreateDSR creates a new data subject request with automatic 30-day deadline
+func (s *Store) CreateDSR(ctx context.Context, req CreateDSRRequest) (*GDPRDSR, error) {
+	// Calculate deadline (30 days from now, GDPR requirement)
+	deadline := time.Now().AddDate(0, 0, 30)
+
+	query := `
+		INSERT INTO gdpr_dsr
+		(request_type, requester_name, requester_email, requester_phone, data_subject_info,
+		 request_details, priority, deadline_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, request_type, requester_name, requester_email, requester_phone,
+			data_subject_info, request_details, status, priority, assigned_to_user_id,
+			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
+	`
+	var dsr GDPRDSR
+	err := s.db.QueryRow(ctx, query,
+		req.RequestType, req.RequesterName, req.RequesterEmail, req.RequesterPhone,
+		req.DataSubjectInfo, req.RequestDetails, req.Priority, deadline,
+	).Scan(
+		&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail, &dsr.RequesterPhone,
+		&dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status, &dsr.Priority,
+		&dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate, &dsr.ResponseSummary,
+		&dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt,
+	)
+	if err != nil {
+		log.Printf("Error creating DSR: %v", err)
+		return nil, fmt.Errorf("error creating DSR: %w", err)
+	}
+	return &dsr, nil
+}
+
+// GetDSRs retrieves all data subject requests
+func (s *Store) GetDSRs(ctx context.Context) ([]GDPRDSR, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, request_type, requester_name, requester_email, requester_phone,
+			data_subject_info, request_details, status, priority, assigned_to_user_id,
+			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
+		FROM gdpr_dsr
+		ORDER BY 
+			CASE priority
+				WHEN 'urgent' THEN 1
+				WHEN 'high' THEN 2
+				WHEN 'normal' THEN 3
+				WHEN 'low' THEN 4
+				ELSE 5
+			END,
+			deadline_date ASC,
+			created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying DSRs: %w", err)
+	}
+	defer rows.Close()
+
+	var dsrs []GDPRDSR
+	for rows.Next() {
+		var dsr GDPRDSR
+		if err := rows.Scan(&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail,
+			&dsr.RequesterPhone, &dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status,
+			&dsr.Priority, &dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate,
+			&dsr.ResponseSummary, &dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning DSR: %w", err)
+		}
+		dsrs = append(dsrs, dsr)
+	}
+	return dsrs, nil
+}
+
+// GetDSRByID retrieves a single data subject request by ID
+func (s *Store) GetDSRByID(ctx context.Context, dsrID string) (*GDPRDSR, error) {
+	var dsr GDPRDSR
+	err := s.db.QueryRow(ctx, `
+		SELECT id, request_type, requester_name, requester_email, requester_phone,
+			data_subject_info, request_details, status, priority, assigned_to_user_id,
+			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
+		FROM gdpr_dsr
+		WHERE id = $1
+	`, dsrID).Scan(
+		&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail, &dsr.RequesterPhone,
+		&dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status, &dsr.Priority,
+		&dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate, &dsr.ResponseSummary,
+		&dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting DSR: %w", err)
+	}
+	return &dsr, nil
+}
+
+// UpdateDSR updates a data subject request
+func (s *Store) UpdateDSR(ctx context.Context, dsrID string, req UpdateDSRRequest) (*GDPRDSR, error) {
+	updates := []string{}
+	args := []interface{}{}
+	argPos := 1
+
+	if req.Status != nil {
+		updates = append(updates, fmt.Sprintf("status = $%d", argPos))
+		args = append(args, *req.Status)
+		argPos++
+	}
+	if req.Priority != nil {
+		updates = append(updates, fmt.Sprintf("priority = $%d", argPos))
+		args = append(args, *req.Priority)
+		argPos++
+	}
+	if req.AssignedToUserID != nil {
+		updates = append(updates, fmt.Sprintf("assigned_to_user_id = $%d", argPos))
+		args = append(args, *req.AssignedToUserID)
+		argPos++
+	}
+	if req.DeadlineDate != nil {
+		updates = append(updates, fmt.Sprintf("deadline_date = $%d", argPos))
+		args = append(args, *req.DeadlineDate)
+		argPos++
+	}
+	if req.ResponseSummary != nil {
+		updates = append(updates, fmt.Sprintf("response_summary = $%d", argPos))
+		args = append(args, *req.ResponseSummary)
+		argPos++
+	}
+	if req.RejectionReason != nil {
+		updates = append(updates, fmt.Sprintf("rejection_reason = $%d", argPos))
+		args = append(args, *req.RejectionReason)
+		argPos++
+	}
+
+	if len(updates) == 0 {
+		return s.GetDSRByID(ctx, dsrID)
+	}
+
+	args = append(args, dsrID)
+	query := fmt.Sprintf(`
+		UPDATE gdpr_dsr
+		SET %s
+		WHERE id = $%d
+		RETURNING id, request_type, requester_name, requester_email, requester_phone,
+			data_subject_info, request_details, status, priority, assigned_to_user_id,
+			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
+	`, strings.Join(updates, ", "), argPos)
+
+	var dsr GDPRDSR
+	err := s.db.QueryRow(ctx, query, args...).Scan(
+		&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail, &dsr.RequesterPhone,
+		&dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status, &dsr.Priority,
+		&dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate, &dsr.ResponseSummary,
+		&dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating DSR: %w", err)
+	}
+	return &dsr, nil
+}
+
+// CompleteDSR marks a DSR as completed with response summary
+func (s *Store) CompleteDSR(ctx context.Context, dsrID string, responseSummary string) (*GDPRDSR, error) {
+	var dsr GDPRDSR
+	err := s.db.QueryRow(ctx, `
+		UPDATE gdpr_dsr
+		SET status = 'completed', completed_date = NOW(), response_summary = $1
+		WHERE id = $2
+		RETURNING id, request_type, requester_name, requester_email, requester_phone,
+			data_subject_info, request_details, status, priority, assigned_to_user_id,
+			deadline_date, completed_date, response_summary, rejection_reason, created_at, updated_at
+	`, responseSummary, dsrID).Scan(
+		&dsr.ID, &dsr.RequestType, &dsr.RequesterName, &dsr.RequesterEmail, &dsr.RequesterPhone,
+		&dsr.DataSubjectInfo, &dsr.RequestDetails, &dsr.Status, &dsr.Priority,
+		&dsr.AssignedToUserID, &dsr.DeadlineDate, &dsr.CompletedDate, &dsr.ResponseSummary,
+		&dsr.RejectionReason, &dsr.CreatedAt, &dsr.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error completing DSR: %w", err)
+	}
+	return &dsr, nil
+}
+
+// ========== ANALYTICS & REPORTING ==========
+
+// ControlComplianceTrend represents control compliance data over time
+type ControlComplianceTrend struct {
+	Date           string `json:"date"`
+	Compliant      int    `json:"compliant"`
+	NonCompliant   int    `json:"non_compliant"`
+	TotalActivated int    `json:"total_activated"`
+}
+
+// GetControlComplianceTrends returns control compliance trends over a date range
+func (s *Store) GetControlComplianceTrends(ctx context.Context, startDate, endDate string) ([]ControlComplianceTrend, error) {
+	query := `
+		WITH date_series AS (
+			SELECT generate_series(
+				$1::date,
+				$2::date,
+				'1 day'::interval
+			)::date AS date
+		),
+		evidence_status AS (
+			SELECT DISTINCT ON (cel.activated_control_id, ds.date)
+				ds.date,
+				cel.activated_control_id,
+				cel.compliance_status
+			FROM date_series ds
+			CROSS JOIN activated_controls ac
+			LEFT JOIN control_evidence_log cel
+				ON cel.activated_control_id = ac.id
+				AND cel.performed_at::date <= ds.date
+			WHERE ac.status = 'active'
+				AND ac.created_at::date <= ds.date
+			ORDER BY cel.activated_control_id, ds.date, cel.performed_at DESC
+		)
+		SELECT
+			ds.date::text,
+			COUNT(CASE WHEN es.compliance_status = 'compliant' THEN 1 END) AS compliant,
+			COUNT(CASE WHEN es.compliance_status = 'non-compliant' THEN 1 END) AS non_compliant,
+			COUNT(DISTINCT ac.id) AS total_activated
+		FROM date_series ds
+		CROSS JOIN activated_controls ac
+		LEFT JOIN evidence_status es ON es.date = ds.date AND es.activated_control_id = ac.id
+		WHERE ac.status = 'active' AND ac.created_at::date <= ds.date
+		GROUP BY ds.date
+		ORDER BY ds.date
+	`
+
+	rows, err := s.db.Query(ctx, query, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("error querying compliance trends: %w", err)
+	}
+	defer rows.Close()
+
+	var trends []ControlComplianceTrend
+	for rows.Next() {
+		var trend ControlComplianceTrend
+		if err := rows.Scan(&trend.Date, &trend.Compliant, &trend.NonCompliant, &trend.TotalActivated); err != nil {
+			return nil, fmt.Errorf("error scanning trend row: %w", err)
+		}
+		trends = append(trends, trend)
+	}
+	if trends == nil {
+		trends = []ControlComplianceTrend{}
+	}
+	return trends, nil
+}
+
+// RiskDistribution represents risk count by severity level
+type RiskDistribution struct {
+	Severity string `json:"severity"`
+	Count    int    `json:"count"`
+}
+
+// GetRiskDistribution returns risk counts grouped by severity level
+func (s *Store) GetRiskDistribution(ctx context.Context) ([]RiskDistribution, error) {
+	query := `
+		SELECT
+			severity_level AS severity,
+			COUNT(*) AS count
+		FROM (
+			SELECT
+				CASE
+					WHEN risk_score >= 15 THEN 'Critical'
+					WHEN risk_score >= 10 THEN 'High'
+					WHEN risk_score >= 6 THEN 'Medium'
+					ELSE 'Low'
+				END AS severity_level
+			FROM risk_assessments
+			WHERE status != 'closed'
+		) AS risks
+		GROUP BY severity_level
+		ORDER BY
+			CASE severity_level
+				WHEN 'Critical' THEN 1
+				WHEN 'High' THEN 2
+				WHEN 'Medium' THEN 3
+				WHEN 'Low' THEN 4
+			END
+	`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying risk distribution: %w", err)
+	}
+	defer rows.Close()
+
+	var distribution []RiskDistribution
+	for rows.Next() {
+		var d RiskDistribution
+		if err := rows.Scan(&d.Severity, &d.Count); err != nil {
+			return nil, fmt.Errorf("error scanning distribution row: %w", err)
+		}
+		distribution = append(distribution, d)
+	}
+	if distribution == nil {
+		distribution = []RiskDistribution{}
+	}
+	return distribution, nil
+}
+
+// RiskTrend represents risk metrics over time
+type RiskTrend struct {
+	Month        string  `json:"month"`
+	OpenRisks    int     `json:"open_risks"`
+	ClosedRisks  int     `json:"closed_risks"`
+	AvgRiskScore float64 `json:"avg_risk_score"`
+}
+
+// GetRiskTrends returns risk metrics aggregated by month
+func (s *Store) GetRiskTrends(ctx context.Context, months int) ([]RiskTrend, error) {
+	query := `
+		WITH month_series AS (
+			SELECT generate_series(
+				DATE_TRUNC('month', CURRENT_DATE - ($1 || ' months')::interval),
+				DATE_TRUNC('month', CURRENT_DATE),
+				'1 month'::interval
+			) AS month
+		)
+		SELECT
+			TO_CHAR(ms.month, 'YYYY-MM') AS month,
+			COUNT(CASE WHEN ra.status != 'closed' AND ra.created_at <= ms.month + interval '1 month' THEN 1 END) AS open_risks,
+			COUNT(CASE WHEN ra.status = 'closed' AND DATE_TRUNC('month', ra.updated_at) = ms.month THEN 1 END) AS closed_risks,
+			COALESCE(AVG(CASE WHEN ra.status != 'closed' AND ra.created_at <= ms.month + interval '1 month' THEN ra.risk_score END), 0) AS avg_risk_score
+		FROM month_series ms
+		LEFT JOIN risk_assessments ra ON ra.created_at <= ms.month + interval '1 month'
+		GROUP BY ms.month
+		ORDER BY ms.month
+	`
+
+	rows, err := s.db.Query(ctx, query, months)
+	if err != nil {
+		return nil, fmt.Errorf("error querying risk trends: %w", err)
+	}
+	defer rows.Close()
+
+	var trends []RiskTrend
+	for rows.Next() {
+		var trend RiskTrend
+		if err := rows.Scan(&trend.Month, &trend.OpenRisks, &trend.ClosedRisks, &trend.AvgRiskScore); err != nil {
+			return nil, fmt.Errorf("error scanning trend row: %w", err)
+		}
+		trends = append(trends, trend)
+	}
+	if trends == nil {
+		trends = []RiskTrend{}
+	}
+	return trends, nil
+}
+
+// DSRMetrics represents GDPR DSR request metrics
+type DSRMetrics struct {
+	TotalRequests   int     `json:"total_requests"`
+	Submitted       int     `json:"submitted"`
+	UnderReview     int     `json:"under_review"`
+	InProgress      int     `json:"in_progress"`
+	Completed       int     `json:"completed"`
+	Rejected        int     `json:"rejected"`
+	Overdue         int     `json:"overdue"`
+	AvgResponseDays float64 `json:"avg_response_days"`
+	CompletionRate  float64 `json:"completion_rate"`
+}
+
+// GetDSRMetrics returns comprehensive DSR request metrics
+func (s *Store) GetDSRMetrics(ctx context.Context) (*DSRMetrics, error) {
+	query := `
+		SELECT
+			COUNT(*) AS total_requests,
+			COUNT(CASE WHEN status = 'submitted' THEN 1 END) AS submitted,
+			COUNT(CASE WHEN status = 'under_review' THEN 1 END) AS under_review,
+			COUNT(CASE WHEN status = 'in_progress' THEN 1 END) AS in_progress,
+			COUNT(CASE WHEN status = 'completed' THEN 1 END) AS completed,
+			COUNT(CASE WHEN status = 'rejected' THEN 1 END) AS rejected,
+			COUNT(CASE WHEN deadline_date < CURRENT_DATE AND status NOT IN ('completed', 'rejected') THEN 1 END) AS overdue,
+			COALESCE(AVG(CASE WHEN completed_date IS NOT NULL THEN EXTRACT(DAY FROM (completed_date - created_at)) END), 0) AS avg_response_days
+		FROM gdpr_dsr
+	`
+
+	var metrics DSRMetrics
+	err := s.db.QueryRow(ctx, query).Scan(
+		&metrics.TotalRequests,
+		&metrics.Submitted,
+		&metrics.UnderReview,
+		&metrics.InProgress,
+		&metrics.Completed,
+		&metrics.Rejected,
+		&metrics.Overdue,
+		&metrics.AvgResponseDays,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying DSR metrics: %w", err)
+	}
+
+	// Calculate completion rate
+	if metrics.TotalRequests > 0 {
+		metrics.CompletionRate = (float64(metrics.Completed) / float64(metrics.TotalRequests)) * 100
+	}
+
+	return &metrics, nil
+}
+
+// AssetBreakdown represents asset counts by type
+type AssetBreakdown struct {
+	AssetType string `json:"asset_type"`
+	Count     int    `json:"count"`
+	Active    int    `json:"active"`
+	Inactive  int    `json:"inactive"`
+}
+
+// GetAssetBreakdown returns asset counts grouped by asset type
+func (s *Store) GetAssetBreakdown(ctx context.Context) ([]AssetBreakdown, error) {
+	query := `
+		SELECT
+			asset_type,
+			COUNT(*) AS count,
+			COUNT(CASE WHEN status = 'active' THEN 1 END) AS active,
+			COUNT(CASE WHEN status != 'active' THEN 1 END) AS inactive
+		FROM assets
+		GROUP BY asset_type
+		ORDER BY count DESC
+	`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying asset breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	var breakdown []AssetBreakdown
+	for rows.Next() {
+		var ab AssetBreakdown
+		if err := rows.Scan(&ab.AssetType, &ab.Count, &ab.Active, &ab.Inactive); err != nil {
+			return nil, fmt.Errorf("error scanning breakdown row: %w", err)
+		}
+		breakdown = append(breakdown, ab)
+	}
+	if breakdown == nil {
+		breakdown = []AssetBreakdown{}
+	}
+	return breakdown, nil
+}
+
+// ROPAMetrics represents GDPR ROPA statistics
+type ROPAMetrics struct {
+	TotalProcessingActivities int `json:"total_processing_activities"`
+	Active                    int `json:"active"`
+	Draft                     int `json:"draft"`
+	Archived                  int `json:"archived"`
+}
+
+// GetROPAMetrics returns ROPA statistics
+func (s *Store) GetROPAMetrics(ctx context.Context) (*ROPAMetrics, error) {
+	query := `
+		SELECT
+			COUNT(*) AS total,
+			COUNT(CASE WHEN status = 'active' THEN 1 END) AS active,
+			COUNT(CASE WHEN status = 'draft' THEN 1 END) AS draft,
+			COUNT(CASE WHEN status = 'archived' THEN 1 END) AS archived
+		FROM gdpr_ropa
+	`
+
+	var metrics ROPAMetrics
+	err := s.db.QueryRow(ctx, query).Scan(
+		&metrics.TotalProcessingActivities,
+		&metrics.Active,
+		&metrics.Draft,
+		&metrics.Archived,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying ROPA metrics: %w", err)
+	}
+
+	return &metrics, nil
+}
+
+// Vendor Management
+
+type Vendor struct {
+	ID                 string     `json:"id"`
+	Name               string     `json:"name"`
+	Description        *string    `json:"description"`
+	Category           string     `json:"category"`
+	RiskTier           string     `json:"risk_tier"`
+	Status             string     `json:"status"`
+	ContactName        *string    `json:"contact_name"`
+	ContactEmail       *string    `json:"contact_email"`
+	ContactPhone       *string    `json:"contact_phone"`
+	Website            *string    `json:"website"`
+	ContractStartDate  *time.Time `json:"contract_start_date"`
+	ContractEndDate    *time.Time `json:"contract_end_date"`
+	ContractValue      *float64   `json:"contract_value"`
+	LastAssessmentDate *time.Time `json:"last_assessment_date"`
+	NextAssessmentDue  *time.Time `json:"next_assessment_due"`
+	OwnerID            *string    `json:"owner_id"`
+	Notes              *string    `json:"notes"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+type VendorAssessment struct {
+	ID                         string    `json:"id"`
+	VendorID                   string    `json:"vendor_id"`
+	AssessmentDate             time.Time `json:"assessment_date"`
+	AssessorID                 *string   `json:"assessor_id"`
+	OverallRiskScore           *int      `json:"overall_risk_score"`
+	DataSecurityScore          *int      `json:"data_security_score"`
+	ComplianceScore            *int      `json:"compliance_score"`
+	FinancialStabilityScore    *int      `json:"financial_stability_score"`
+	OperationalCapabilityScore *int      `json:"operational_capability_score"`
+	Findings                   *string   `json:"findings"`
+	Recommendations            *string   `json:"recommendations"`
+	Status                     string    `json:"status"`
+	CreatedAt                  time.Time `json:"created_at"`
+	UpdatedAt                  time.Time `json:"updated_at"`
+}
+
+func (s *Store) CreateVendor(ctx context.Context, v *Vendor) error {
+	query := `
+		INSERT INTO vendors (name, description, category, risk_tier, status, contact_name, 
+			contact_email, contact_phone, website, contract_start_date, contract_end_date, 
+			contract_value, next_assessment_due, owner_id, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, created_at, updated_at`
+
+	err := s.db.QueryRow(ctx, query, v.Name, v.Description, v.Category, v.RiskTier, v.Status,
+		v.ContactName, v.ContactEmail, v.ContactPhone, v.Website, v.ContractStartDate,
+		v.ContractEndDate, v.ContractValue, v.NextAssessmentDue, v.OwnerID, v.Notes).
+		Scan(&v.ID, &v.CreatedAt, &v.UpdatedAt)
+
+	if err != nil {
+		log.Printf("Failed to create vendor: %v", err)
+		return err
+	}
+
+	log.Printf("Vendor created: %s (%s)", v.Name, v.ID)
+	return nil
+}
+
+func (s *Store) GetVendors(ctx context.Context) ([]Vendor, error) {
+	query := `
+		SELECT id, name, description, category, risk_tier, status, contact_name, 
+			contact_email, contact_phone, website, contract_start_date, contract_end_date, 
+			contract_value, last_assessment_date, next_assessment_due, owner_id, notes,
+			created_at, updated_at
+		FROM vendors
+		ORDER BY name ASC`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vendors []Vendor
+	for rows.Next() {
+		var v Vendor
+		err := rows.Scan(&v.ID, &v.Name, &v.Description, &v.Category, &v.RiskTier, &v.Status,
+			&v.ContactName, &v.ContactEmail, &v.ContactPhone, &v.Website, &v.ContractStartDate,
+			&v.ContractEndDate, &v.ContractValue, &v.LastAssessmentDate, &v.NextAssessmentDue,
+			&v.OwnerID, &v.Notes, &v.CreatedAt, &v.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		vendors = append(vendors, v)
+	}
+
+	if vendors == nil {
+		vendors = make([]Vendor, 0)
+	}
+
+	return vendors, nil
+}
+
+func (s *Store) GetVendorByID(ctx context.Context, id string) (*Vendor, error) {
+	query := `
+		SELECT id, name, description, category, risk_tier, status, contact_name, 
+			contact_email, contact_phone, website, contract_start_date, contract_end_date, 
+			contract_value, last_assessment_date, next_assessment_due, owner_id, notes,
+			created_at, updated_at
+		FROM vendors
+		WHERE id = $1`
+
+	var v Vendor
+	err := s.db.QueryRow(ctx, query, id).Scan(&v.ID, &v.Name, &v.Description, &v.Category, &v.RiskTier,
+		&v.Status, &v.ContactName, &v.ContactEmail, &v.ContactPhone, &v.Website, &v.ContractStartDate,
+		&v.ContractEndDate, &v.ContractValue, &v.LastAssessmentDate, &v.NextAssessmentDue,
+		&v.OwnerID, &v.Notes, &v.CreatedAt, &v.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func (s *Store) UpdateVendor(ctx context.Context, id string, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	query := "UPDATE vendors SET "
+	args := []interface{}{}
+	argPos := 1
+
+	for key, value := range updates {
+		if argPos > 1 {
+			query += ", "
+		}
+		query += fmt.Sprintf("%s = $%d", key, argPos)
+		args = append(args, value)
+		argPos++
+	}
+
+	query += fmt.Sprintf(" WHERE id = $%d", argPos)
+	args = append(args, id)
+
+	_, err := s.db.Exec(ctx, query, args...)
+	if err != nil {
+		log.Printf("Failed to update vendor: %v", err)
+		return err
+	}
+
+	log.Printf("Updated vendor %s", id)
+	return nil
+}
+
+func (s *Store) DeleteVendor(ctx context.Context, id string) error {
+	query := "DELETE FROM vendors WHERE id = $1"
+	_, err := s.db.Exec(ctx, query, id)
+	if err != nil {
+		log.Printf("Failed to delete vendor: %v", err)
+		return err
+	}
+
+	log.Printf("Deleted vendor %s", id)
+	return nil
+}
+
+func (s *Store) CreateVendorAssessment(ctx context.Context, va *VendorAssessment) error {
+	query := `
+		INSERT INTO vendor_assessments (vendor_id, assessment_date, assessor_id, 
+			overall_risk_score, data_security_score, compliance_score, 
+			financial_stability_score, operational_capability_score, 
+			findings, recommendations, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at, updated_at`
+
+	err := s.db.QueryRow(ctx, query, va.VendorID, va.AssessmentDate, va.AssessorID,
+		va.OverallRiskScore, va.DataSecurityScore, va.ComplianceScore,
+		va.FinancialStabilityScore, va.OperationalCapabilityScore,
+		va.Findings, va.Recommendations, va.Status).
+		Scan(&va.ID, &va.CreatedAt, &va.UpdatedAt)
+
+	if err != nil {
+		log.Printf("Failed to create vendor assessment: %v", err)
+		return err
+	}
+
+	// Update vendor's last_assessment_date
+	s.db.Exec(ctx, "UPDATE vendors SET last_assessment_date = $1 WHERE id = $2",
+		va.AssessmentDate, va.VendorID)
+
+	log.Printf("Vendor assessment created for vendor %s: %s", va.VendorID, va.ID)
+	return nil
+}
+
+func (s *Store) GetVendorAssessments(ctx context.Context, vendorID string) ([]VendorAssessment, error) {
+	query := `
+		SELECT id, vendor_id, assessment_date, assessor_id, overall_risk_score, 
+			data_security_score, compliance_score, financial_stability_score, 
+			operational_capability_score, findings, recommendations, status,
+			created_at, updated_at
+		FROM vendor_assessments
+		WHERE vendor_id = $1
+		ORDER BY assessment_date DESC`
+
+	rows, err := s.db.Query(ctx, query, vendorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assessments []VendorAssessment
+	for rows.Next() {
+		var va VendorAssessment
+		err := rows.Scan(&va.ID, &va.VendorID, &va.AssessmentDate, &va.AssessorID,
+			&va.OverallRiskScore, &va.DataSecurityScore, &va.ComplianceScore,
+			&va.FinancialStabilityScore, &va.OperationalCapabilityScore,
+			&va.Findings, &va.Recommendations, &va.Status, &va.CreatedAt, &va.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		assessments = append(assessments, va)
+	}
+
+	if assessments == nil {
+		assessments = make([]VendorAssessment, 0)
+	}
+
+	return assessments, nil
+}
+
+func (s *Store) GetVendorControls(ctx context.Context, vendorID string) ([]MappedControl, error) {
+	query := `
+		SELECT ac.id, cl.name, ac.status, ac.next_review_due_date
+		FROM vendor_control_mapping vcm
+		JOIN activated_controls ac ON vcm.activated_control_id = ac.id
+		JOIN control_library cl ON ac.control_library_id = cl.id
+		WHERE vcm.vendor_id = $1
+		ORDER BY cl.name ASC`
+
+	rows, err := s.db.Query(ctx, query, vendorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var controls []MappedControl
+	for rows.Next() {
+		var mc MappedControl
+		err := rows.Scan(&mc.ActivatedControlID, &mc.ControlName, &mc.Status, mc.NextReviewDueDate)
+		if err != nil {
+			return nil, err
+		}
+		controls = append(controls, mc)
+	}
+
+	if controls == nil {
+		controls = make([]MappedControl, 0)
+	}
+
+	return controls, nil
+}
+
+func (s *Store) CreateVendorControlMapping(ctx context.Context, vendorID, controlID string) error {
+	query := "INSERT INTO vendor_control_mapping (vendor_id, activated_control_id) VALUES ($1, $2)"
+	_, err := s.db.Exec(ctx, query, vendorID, controlID)
+	if err != nil {
+		log.Printf("Failed to create vendor-control mapping: %v", err)
+		return err
+	}
+
+	log.Printf("Mapped control %s to vendor %s", controlID, vendorID)
+	return nil
+}
+
+func (s *Store) DeleteVendorControlMapping(ctx context.Context, vendorID, controlID string) error {
+	query := "DELETE FROM vendor_control_mapping WHERE vendor_id = $1 AND activated_control_id = $2"
+	_, err := s.db.Exec(ctx, query, vendorID, controlID)
+	if err != nil {
+		log.Printf("Failed to delete vendor-control mapping: %v", err)
+		return err
+	}
+
+	log.Printf("Unmapped control %s from vendor %s", controlID, vendorID)
+	return nil
+}
+
+// ============================================================================
+// Standards Management
+// ============================================================================
+
+// ControlStandard represents a compliance standard metadata
+type ControlStandard struct {
+	ID            string     `json:"id" db:"id"`
+	Code          string     `json:"code" db:"code"`
+	Name          string     `json:"name" db:"name"`
+	Version       string     `json:"version" db:"version"`
+	Organization  string     `json:"organization" db:"organization"`
+	PublishedDate *time.Time `json:"published_date,omitempty" db:"published_date"`
+	Description   string     `json:"description" db:"description"`
+	WebsiteURL    string     `json:"website_url,omitempty" db:"website_url"`
+	TotalControls int        `json:"total_controls" db:"total_controls"`
+	Lineage       string     `json:"lineage" db:"lineage"`
+	SupersedesID  *string    `json:"supersedes_id,omitempty" db:"supersedes_id"`
+	SupersededAt  *time.Time `json:"superseded_at,omitempty" db:"superseded_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ControlArticle represents detailed article/spec text for a control
+type ControlArticle struct {
+	ID                 string    `json:"id" db:"id"`
+	ControlLibraryID   string    `json:"control_library_id" db:"control_library_id"`
+	StandardID         string    `json:"standard_id" db:"standard_id"`
+	ArticleNumber      string    `json:"article_number" db:"article_number"`
+	SectionName        string    `json:"section_name" db:"section_name"`
+	FullText           string    `json:"full_text" db:"full_text"`
+	Guidance           string    `json:"guidance,omitempty" db:"guidance"`
+	ExternalReferences string    `json:"external_references,omitempty" db:"external_references"`
+	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// StandardImportData represents the JSON structure for importing standards
+type StandardImportData struct {
+	Standard struct {
+		Code          string `json:"code"`
+		Name          string `json:"name"`
+		Version       string `json:"version"`
+		Organization  string `json:"organization"`
+		PublishedDate string `json:"published_date"`
+		Description   string `json:"description"`
+		WebsiteURL    string `json:"website_url"`
+		TotalControls int    `json:"total_controls"`
+		Lineage       string `json:"lineage,omitempty"`    // e.g. ISO-27001; defaults to the superseded version's, or the code
+		Supersedes    string `json:"supersedes,omitempty"` // code of the previous version
+	} `json:"standard"`
+	Controls []StandardImportControl `json:"controls"`
+}
+
+// StandardImportControl is one control of a standard file
+type StandardImportControl struct {
+	ControlID   string `json:"control_id"`
+	Name        string `json:"name"`
+	Family      string `json:"family"`
+	Description string `json:"description"`
+	Article     struct {
+		ArticleNumber      string `json:"article_number"`
+		SectionName        string `json:"section_name"`
+		FullText           string `json:"full_text"`
+		Guidance           string `json:"guidance"`
+		ExternalReferences string `json:"external_references"`
+	} `json:"article"`
+	Replaces []string `json:"replaces,omitempty"` // controls of the superseded version this one takes over from
+}
+
+const controlStandardColumns = `id, code, name, version, organization, published_date, description, website_url, total_controls,
+	lineage, supersedes_id, superseded_at, created_at, updated_at`
+
+func scanControlStandard(row pgx.Row) (*ControlStandard, error) {
+	var std ControlStandard
+	err := row.Scan(&std.ID, &std.Code, &std.Name, &std.Version, &std.Organization,
+		&std.PublishedDate, &std.Description, &std.WebsiteURL, &std.TotalControls,
+		&std.Lineage, &std.SupersedesID, &std.SupersededAt, &std.CreatedAt, &std.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &std, nil
+}
+
+func (s *Store) GetStandards(ctx context.Context) ([]ControlStandard, error) {
+	query := `SELECT ` + controlStandardColumns + `
+			  FROM control_standards 
+			  ORDER BY code ASC`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standards []ControlStandard
+	for rows.Next() {
+		std, err := scanControlStandard(rows)
+		if err != nil {
+			return nil, err
+		}
+		standards = append(standards, *std)
+	}
+
+	if standards == nil {
+		standards = make([]ControlStandard, 0)
+	}
+
+	return standards, nil
+}
+
+func (s *Store) GetStandardByID(ctx context.Context, id string) (*ControlStandard, error) {
+	query := `SELECT ` + controlStandardColumns + `
+			  FROM control_standards 
+			  WHERE id = $1`
+
+	return scanControlStandard(s.db.QueryRow(ctx, query, id))
+}
+
+// GetStandardByCode returns the standard with a code, or nil if there is none
+func (s *Store) GetStandardByCode(ctx context.Context, code string) (*ControlStandard, error) {
+	std, err := scanControlStandard(s.db.QueryRow(ctx, `SELECT `+controlStandardColumns+` FROM control_standards WHERE code = $1`, code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return std, err
+}
+
+// ImportStandard validates a standard file and imports it in one transaction,
+// reporting the outcome of every control. A file that fails validation writes
+// nothing and is returned as a failed report rather than an error; see
+// validateStandardImport for what strict and lenient modes accept.
+func (s *Store) ImportStandard(ctx context.Context, data StandardImportData, opts StandardImportOptions) (*StandardImportReport, error) {
+	if opts.Mode == "" {
+		opts.Mode = StandardImportLenient
+	}
+	report := validateStandardImport(data, opts)
+	if len(report.Errors) > 0 {
+		report.fail("the standard is invalid")
+		return report, nil
+	}
+	if n := report.controlErrorCount(); n > 0 && opts.Mode == StandardImportStrict {
+		report.fail(fmt.Sprintf("%d controls are invalid", n))
+		return report, nil
+	}
+
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		// The controls without errors; lenient mode drops the others
+		importData := data
+		selectValid := func() {
+			importData.Controls = nil
+			for i, c := range data.Controls {
+				if len(report.Controls[i].Errors) == 0 {
+					importData.Controls = append(importData.Controls, c)
+				}
+			}
+		}
+		selectValid()
+
+		diff, err := s.DiffStandardImport(ctx, importData)
+		if err != nil {
+			return err
+		}
+		if problems := diffControlProblems(diff); len(problems) > 0 {
+			for i := range report.Controls {
+				report.Controls[i].Errors = append(report.Controls[i].Errors, problems[report.Controls[i].ControlID]...)
+			}
+			if opts.Mode == StandardImportStrict {
+				report.Diff = diff
+				report.fail(fmt.Sprintf("%d controls are invalid", report.controlErrorCount()))
+				return nil
+			}
+			selectValid()
+			if diff, err = s.DiffStandardImport(ctx, importData); err != nil {
+				return err
+			}
+		}
+		report.Diff = diff
+		for _, msg := range diff.Errors {
+			report.Errors = append(report.Errors, StandardImportIssue{Field: "standard", Message: msg})
+		}
+		if diff.Blocked() {
+			report.fail("the standard cannot be imported")
+			return nil
+		}
+
+		// Controls skipped in lenient mode are not removed from the standard
+		skipped := map[string]bool{}
+		for _, c := range report.Controls {
+			if len(c.Errors) > 0 {
+				skipped[c.ControlID] = true
+			}
+		}
+		removed := diff.Removed[:0]
+		for _, c := range diff.Removed {
+			if !skipped[c.ControlID] {
+				removed = append(removed, c)
+			}
+		}
+		diff.Removed = removed
+
+		report.recordOutcomes(diff)
+		if report.ControlsImported == 0 {
+			report.fail("no control can be imported")
+			return nil
+		}
+		if opts.DryRun {
+			return nil
+		}
+		return s.writeStandard(ctx, importData, diff)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// writeStandard stores a validated standard file as its diff describes
+func (s *Store) writeStandard(ctx context.Context, data StandardImportData, diff *StandardDiff) error {
+	var supersedesID *string
+	if diff.Action == StandardImportNewVersion {
+		supersedesID = &diff.ComparedTo.ID
+	}
+
+	// Parse published date
+	var publishedDate *time.Time
+	if data.Standard.PublishedDate != "" {
+		t, err := time.Parse("2006-01-02", data.Standard.PublishedDate)
+		if err == nil {
+			publishedDate = &t
+		}
+	}
+
+	// Insert standard metadata
+	standardID := ""
+	standardQuery := `INSERT INTO control_standards (code, name, version, organization, published_date, description, website_url, total_controls, lineage, supersedes_id)
+					 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+					 ON CONFLICT (code) DO UPDATE SET 
+						name = EXCLUDED.name,
+						version = EXCLUDED.version,
+						organization = EXCLUDED.organization,
+						published_date = EXCLUDED.published_date,
+						description = EXCLUDED.description,
+						website_url = EXCLUDED.website_url,
+						total_controls = EXCLUDED.total_controls,
+						lineage = EXCLUDED.lineage,
+						updated_at = NOW()
+					 RETURNING id`
+
+	err := s.db.QueryRow(ctx, standardQuery, data.Standard.Code, data.Standard.Name,
+		data.Standard.Version, data.Standard.Organization, publishedDate,
+		data.Standard.Description, data.Standard.WebsiteURL, data.Standard.TotalControls,
+		diff.Lineage, supersedesID).Scan(&standardID)
+	if err != nil {
+		log.Printf("Failed to insert standard: %v", err)
+		return err
+	}
+
+	// Keep the text an update replaces
+	if diff.Action == StandardImportUpdate {
+		for _, change := range diff.Changed {
+			if err := s.recordControlRevision(ctx, change.ControlID); err != nil {
+				return fmt.Errorf("recording revision of control %s: %w", change.ControlID, err)
+			}
+		}
+	}
+
+	log.Printf("Imported standard: %s (ID: %s)", data.Standard.Code, standardID)
+
+	// Insert controls
+	controlQuery := `INSERT INTO control_library (id, standard, family, name, description, standard_id)
+					 VALUES ($1, $2, $3, $4, $5, $6)
+					 ON CONFLICT (id) DO UPDATE SET
+						standard = EXCLUDED.standard,
+						family = EXCLUDED.family,
+						name = EXCLUDED.name,
+						description = EXCLUDED.description,
+						standard_id = EXCLUDED.standard_id,
+						retired_at = NULL`
+
+	articleQuery := `INSERT INTO control_articles (control_library_id, standard_id, article_number, section_name, full_text, guidance, external_references)
+					 VALUES ($1, $2, $3, $4, $5, $6, $7)
+					 ON CONFLICT (control_library_id, standard_id) DO UPDATE SET
+						article_number = EXCLUDED.article_number,
+						section_name = EXCLUDED.section_name,
+						full_text = EXCLUDED.full_text,
+						guidance = EXCLUDED.guidance,
+						external_references = EXCLUDED.external_references,
+						updated_at = NOW()`
+
+	for _, control := range data.Controls {
+		// Insert control
+		_, err := s.db.Exec(ctx, controlQuery, control.ControlID, data.Standard.Code,
+			control.Family, control.Name, control.Description, standardID)
+		if err != nil {
+			return fmt.Errorf("importing control %s: %w", control.ControlID, err)
+		}
+
+		// Insert article if provided
+		if control.Article.FullText != "" {
+			_, err = s.db.Exec(ctx, articleQuery, control.ControlID, standardID,
+				control.Article.ArticleNumber, control.Article.SectionName,
+				control.Article.FullText, control.Article.Guidance,
+				control.Article.ExternalReferences)
+			if err != nil {
+				return fmt.Errorf("importing article of control %s: %w", control.ControlID, err)
+			}
+		}
+	}
+
+	log.Printf("Imported %d controls for standard %s", len(data.Controls), data.Standard.Code)
+
+	switch diff.Action {
+	case StandardImportUpdate:
+		// Controls the file no longer has stay referenced by activations
+		if len(diff.Removed) > 0 {
+			removed := make([]string, len(diff.Removed))
+			for i, c := range diff.Removed {
+				removed[i] = c.ControlID
+			}
+			if _, err := s.db.Exec(ctx, `
+				UPDATE control_library SET retired_at = NOW()
+				WHERE standard_id = $1 AND id = ANY($2) AND retired_at IS NULL;
+			`, standardID, removed); err != nil {
+				return err
+			}
+		}
+	case StandardImportNewVersion:
+		if _, err := s.db.Exec(ctx, `
+			UPDATE control_standards SET superseded_at = NOW() WHERE id = $1 AND superseded_at IS NULL;
+		`, diff.ComparedTo.ID); err != nil {
+			return err
+		}
+		if err := s.recordControlSuccessors(ctx, diff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetArticleByControlID(ctx context.Context, controlID string) (*ControlArticle, error) {
+	query := `SELECT id, control_library_id, standard_id, article_number, section_name, full_text, guidance, external_references, created_at, updated_at
+			  FROM control_articles
+			  WHERE control_library_id = $1`
+
+	var article ControlArticle
+	err := s.db.QueryRow(ctx, query, controlID).Scan(&article.ID, &article.ControlLibraryID,
+		&article.StandardID, &article.ArticleNumber, &article.SectionName, &article.FullText,
+		&article.Guidance, &article.ExternalReferences, &article.CreatedAt, &article.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil // No article found, not an error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &article, nil
+}
+
+func (s *Store) GetControlsByStandardID(ctx context.Context, standardID string) ([]ControlLibraryItem, error) {
+	query := `SELECT id, standard, family, name, description
+			  FROM control_library
+			  WHERE standard_id = $1
+			  ORDER BY id ASC`
+
+	rows, err := s.db.Query(ctx, query, standardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var controls []ControlLibraryItem
 	for rows.Next() {
-		var v Vendor
-		err := rows.Scan(&v.ID, &v.Name, &v.Description, &v.Category, &v.RiskTier, &v.Status,
-			&v.ContactName, &v.ContactEmail, &v.ContactPhone, &v.Website, &v.ContractStartDate,
-			&v.ContractEndDate, &v.ContractValue, &v.LastAssessmentDate, &v.NextAssessmentDue,
-			&v.OwnerID, &v.Notes, &v.CreatedAt, &v.UpdatedAt)
+		var ctrl ControlLibraryItem
+		err := rows.Scan(&ctrl.ID, &ctrl.Standard, &ctrl.Family, &ctrl.Name, &ctrl.Description)
 		if err != nil {
 			return nil, err
 		}
-		vendors = append(vendors, v)
+		controls = append(controls, ctrl)
 	}
 
-	if vendors == nil {
-		vendors = make([]Vendor, 0)
+	if controls == nil {
+		controls = make([]ControlLibraryItem, 0)
 	}
 
-	return vendors, nil
+	return controls, nil
 }
 
-func (s *Store) GetVendorByID(ctx context.Context, id string) (*Vendor, error) {
-	query := `
-		SELECT id, name, description, category, risk_tier, status, contact_name, 
-			contact_email, contact_phone, website, contract_start_date, contract_end_date, 
-			contract_value, last_assessment_date, next_assessment_due, owner_id, notes,
-			created_at, updated_at
-		FROM vendors
-		WHERE id = $1`
+// ========== CONTROL MAPPINGS ==========
 
-	var v Vendor
-	err := s.db.QueryRow(ctx, query, id).Scan(&v.ID, &v.Name, &v.Description, &v.Category, &v.RiskTier,
-		&v.Status, &v.ContactName, &v.ContactEmail, &v.ContactPhone, &v.Website, &v.ContractStartDate,
-		&v.ContractEndDate, &v.ContractValue, &v.LastAssessmentDate, &v.NextAssessmentDue,
-		&v.OwnerID, &v.Notes, &v.CreatedAt, &v.UpdatedAt)
+const controlMappingColumns = `m.id, m.source_control_id, sc.standard, sc.name, m.target_control_id, tc.standard, tc.name,
+	m.relationship, m.notes, m.origin, m.created_at, m.updated_at`
+
+const controlMappingJoins = `control_library_mappings m
+	JOIN control_library sc ON sc.id = m.source_control_id
+	JOIN control_library tc ON tc.id = m.target_control_id`
 
+func scanControlMapping(row pgx.Row) (*ControlMapping, error) {
+	var m ControlMapping
+	err := row.Scan(&m.ID, &m.SourceControlID, &m.SourceStandard, &m.SourceName, &m.TargetControlID, &m.TargetStandard,
+		&m.TargetName, &m.Relationship, &m.Notes, &m.Origin, &m.CreatedAt, &m.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-
-	return &v, nil
+	return &m, nil
 }
 
-func (s *Store) UpdateVendor(ctx context.Context, id string, updates map[string]interface{}) error {
-	if len(updates) == 0 {
-		return nil
+// ListControlMappings returns the mappings involving a control and/or a
+// standard (by its code, e.g. SOC-2); nil lists all
+func (s *Store) ListControlMappings(ctx context.Context, controlID, standard *string) ([]ControlMapping, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+controlMappingColumns+`
+		FROM `+controlMappingJoins+`
+		WHERE ($1::text IS NULL OR m.source_control_id = $1 OR m.target_control_id = $1)
+		AND ($2::text IS NULL OR sc.standard = $2 OR tc.standard = $2)
+		ORDER BY m.source_control_id, m.target_control_id;
+	`, controlID, standard)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	query := "UPDATE vendors SET "
-	args := []interface{}{}
-	argPos := 1
-
-	for key, value := range updates {
-		if argPos > 1 {
-			query += ", "
+	mappings := []ControlMapping{}
+	for rows.Next() {
+		m, err := scanControlMapping(rows)
+		if err != nil {
+			return nil, err
 		}
-		query += fmt.Sprintf("%s = $%d", key, argPos)
-		args = append(args, value)
-		argPos++
+		mappings = append(mappings, *m)
 	}
+	return mappings, rows.Err()
+}
 
-	query += fmt.Sprintf(" WHERE id = $%d", argPos)
-	args = append(args, id)
+// upsertControlMapping stores a normalized mapping, replacing the relationship
+// of an existing pair, and reports whether it was new
+func (s *Store) upsertControlMapping(ctx context.Context, req ControlMappingRequest, origin string) (string, bool, error) {
+	var id string
+	var created bool
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO control_library_mappings (source_control_id, target_control_id, relationship, notes, origin)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (source_control_id, target_control_id) DO UPDATE
+		SET relationship = EXCLUDED.relationship, notes = EXCLUDED.notes, origin = EXCLUDED.origin
+		RETURNING id, (xmax = 0);
+	`, req.SourceControlID, req.TargetControlID, req.Relationship, req.Notes, origin).Scan(&id, &created)
+	return id, created, err
+}
+
+// SaveControlMapping creates or replaces the mapping between two library controls
+func (s *Store) SaveControlMapping(ctx context.Context, req ControlMappingRequest) (*ControlMapping, error) {
+	var missing int
+	if err := s.db.QueryRow(ctx, `
+		SELECT 2 - COUNT(*) FROM control_library WHERE id IN ($1, $2);
+	`, req.SourceControlID, req.TargetControlID).Scan(&missing); err != nil {
+		return nil, err
+	}
+	if missing > 0 {
+		return nil, fmt.Errorf("control not found")
+	}
 
-	_, err := s.db.Exec(ctx, query, args...)
+	id, _, err := s.upsertControlMapping(ctx, req, "api")
 	if err != nil {
-		log.Printf("Failed to update vendor: %v", err)
-		return err
+		log.Printf("Error saving control mapping %s -> %s: %v", req.SourceControlID, req.TargetControlID, err)
+		return nil, err
 	}
-
-	log.Printf("Updated vendor %s", id)
-	return nil
+	return scanControlMapping(s.db.QueryRow(ctx, `SELECT `+controlMappingColumns+` FROM `+controlMappingJoins+` WHERE m.id = $1;`, id))
 }
 
-func (s *Store) DeleteVendor(ctx context.Context, id string) error {
-	query := "DELETE FROM vendors WHERE id = $1"
-	_, err := s.db.Exec(ctx, query, id)
+// DeleteControlMapping removes a mapping and returns it
+func (s *Store) DeleteControlMapping(ctx context.Context, id string) (*ControlMapping, error) {
+	m, err := scanControlMapping(s.db.QueryRow(ctx, `SELECT `+controlMappingColumns+` FROM `+controlMappingJoins+` WHERE m.id = $1;`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("control mapping not found")
+	}
 	if err != nil {
-		log.Printf("Failed to delete vendor: %v", err)
-		return err
+		return nil, err
 	}
-
-	log.Printf("Deleted vendor %s", id)
-	return nil
+	if _, err := s.db.Exec(ctx, `DELETE FROM control_library_mappings WHERE id = $1;`, id); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-func (s *Store) CreateVendorAssessment(ctx context.Context, va *VendorAssessment) error {
-	query := `
-		INSERT INTO vendor_assessments (vendor_id, assessment_date, assessor_id, 
-			overall_risk_score, data_security_score, compliance_score, 
-			financial_stability_score, operational_capability_score, 
-			findings, recommendations, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING id, created_at, updated_at`
-
-	err := s.db.QueryRow(ctx, query, va.VendorID, va.AssessmentDate, va.AssessorID,
-		va.OverallRiskScore, va.DataSecurityScore, va.ComplianceScore,
-		va.FinancialStabilityScore, va.OperationalCapabilityScore,
-		va.Findings, va.Recommendations, va.Status).
-		Scan(&va.ID, &va.CreatedAt, &va.UpdatedAt)
+// ImportControlMappings stores every mapping of a mapping file in one
+// transaction. Entries must already be normalized; those naming controls that
+// are not in the library are skipped.
+func (s *Store) ImportControlMappings(ctx context.Context, mappings []ControlMappingRequest, origin string) (*ControlMappingImportResult, error) {
+	result := &ControlMappingImportResult{}
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		ids := []string{}
+		for _, m := range mappings {
+			ids = append(ids, m.SourceControlID, m.TargetControlID)
+		}
+		rows, err := s.db.Query(ctx, `SELECT id FROM control_library WHERE id = ANY($1);`, ids)
+		if err != nil {
+			return err
+		}
+		known := map[string]bool{}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			known[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
 
+		unknown := map[string]bool{}
+		for _, m := range mappings {
+			if !known[m.SourceControlID] || !known[m.TargetControlID] {
+				for _, id := range []string{m.SourceControlID, m.TargetControlID} {
+					if !known[id] {
+						unknown[id] = true
+					}
+				}
+				result.Skipped++
+				continue
+			}
+			_, created, err := s.upsertControlMapping(ctx, m, origin)
+			if err != nil {
+				return fmt.Errorf("mapping %s -> %s: %w", m.SourceControlID, m.TargetControlID, err)
+			}
+			if created {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+		}
+		for id := range unknown {
+			result.UnknownControls = append(result.UnknownControls, id)
+		}
+		sort.Strings(result.UnknownControls)
+		return nil
+	})
 	if err != nil {
-		log.Printf("Failed to create vendor assessment: %v", err)
-		return err
+		log.Printf("Error importing control mappings from %s: %v", origin, err)
+		return nil, err
 	}
-
-	// Update vendor's last_assessment_date
-	s.db.Exec(ctx, "UPDATE vendors SET last_assessment_date = $1 WHERE id = $2",
-		va.AssessmentDate, va.VendorID)
-
-	log.Printf("Vendor assessment created for vendor %s: %s", va.VendorID, va.ID)
-	return nil
+	return result, nil
 }
 
-func (s *Store) GetVendorAssessments(ctx context.Context, vendorID string) ([]VendorAssessment, error) {
-	query := `
-		SELECT id, vendor_id, assessment_date, assessor_id, overall_risk_score, 
-			data_security_score, compliance_score, financial_stability_score, 
-			operational_capability_score, findings, recommendations, status,
-			created_at, updated_at
-		FROM vendor_assessments
-		WHERE vendor_id = $1
-		ORDER BY assessment_date DESC`
-
-	rows, err := s.db.Query(ctx, query, vendorID)
+// GetControlEvidenceSummaries returns the evidence recorded on the
+// organization's active controls, by library ID
+func (s *Store) GetControlEvidenceSummaries(ctx context.Context) (map[string]ControlEvidenceSummary, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT DISTINCT ON (ac.control_library_id)
+			ac.control_library_id,
+			COUNT(*) OVER (PARTITION BY ac.control_library_id),
+			cel.compliance_status, cel.performed_at
+		FROM control_evidence_log cel
+		JOIN activated_controls ac ON ac.id = cel.activated_control_id
+		WHERE ac.status = 'active'
+		ORDER BY ac.control_library_id, cel.performed_at DESC;
+	`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var assessments []VendorAssessment
+	summaries := map[string]ControlEvidenceSummary{}
 	for rows.Next() {
-		var va VendorAssessment
-		err := rows.Scan(&va.ID, &va.VendorID, &va.AssessmentDate, &va.AssessorID,
-			&va.OverallRiskScore, &va.DataSecurityScore, &va.ComplianceScore,
-			&va.FinancialStabilityScore, &va.OperationalCapabilityScore,
-			&va.Findings, &va.Recommendations, &va.Status, &va.CreatedAt, &va.UpdatedAt)
-		if err != nil {
+		var e ControlEvidenceSummary
+		if err := rows.Scan(&e.ControlID, &e.EvidenceCount, &e.LatestStatus, &e.LatestAt); err != nil {
 			return nil, err
 		}
-		assessments = append(assessments, va)
+		summaries[e.ControlID] = e
 	}
+	return summaries, rows.Err()
+}
 
-	if assessments == nil {
-		assessments = make([]VendorAssessment, 0)
+// GetControlCoverage returns every library control's evidence, including what
+// it inherits from mapped controls (see computeControlCoverage)
+func (s *Store) GetControlCoverage(ctx context.Context) (map[string]ControlCoverage, error) {
+	evidence, err := s.GetControlEvidenceSummaries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading evidence: %w", err)
 	}
-
-	return assessments, nil
+	mappings, err := s.ListControlMappings(ctx, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("loading control mappings: %w", err)
+	}
+	return computeControlCoverage(evidence, mappings), nil
 }
 
-func (s *Store) GetVendorControls(ctx context.Context, vendorID string) ([]MappedControl, error) {
-	query := `
-		SELECT ac.id, cl.name, ac.status, ac.next_review_due_date
-		FROM vendor_control_mapping vcm
-		JOIN activated_controls ac ON vcm.activated_control_id = ac.id
-		JOIN control_library cl ON ac.control_library_id = cl.id
-		WHERE vcm.vendor_id = $1
-		ORDER BY cl.name ASC`
+// ========== STANDARD VERSIONS ==========
 
-	rows, err := s.db.Query(ctx, query, vendorID)
+// getStandardControls returns a standard's current controls in the form of a
+// standard file, for comparing with one
+func (s *Store) getStandardControls(ctx context.Context, standardID string) ([]StandardImportControl, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT c.id, c.name, c.family, c.description,
+			COALESCE(a.article_number, ''), COALESCE(a.section_name, ''), COALESCE(a.full_text, ''),
+			COALESCE(a.guidance, ''), COALESCE(a.external_references, '')
+		FROM control_library c
+		LEFT JOIN control_articles a ON a.control_library_id = c.id AND a.standard_id = c.standard_id
+		WHERE c.standard_id = $1 AND c.retired_at IS NULL
+		ORDER BY c.id;
+	`, standardID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var controls []MappedControl
+	controls := []StandardImportControl{}
 	for rows.Next() {
-		var mc MappedControl
-		err := rows.Scan(&mc.ActivatedControlID, &mc.ControlName, &mc.Status, mc.NextReviewDueDate)
-		if err != nil {
+		var c StandardImportControl
+		if err := rows.Scan(&c.ControlID, &c.Name, &c.Family, &c.Description, &c.Article.ArticleNumber,
+			&c.Article.SectionName, &c.Article.FullText, &c.Article.Guidance, &c.Article.ExternalReferences); err != nil {
 			return nil, err
 		}
-		controls = append(controls, mc)
-	}
-
-	if controls == nil {
-		controls = make([]MappedControl, 0)
+		controls = append(controls, c)
 	}
-
-	return controls, nil
+	return controls, rows.Err()
 }
 
-func (s *Store) CreateVendorControlMapping(ctx context.Context, vendorID, controlID string) error {
-	query := "INSERT INTO vendor_control_mapping (vendor_id, activated_control_id) VALUES ($1, $2)"
-	_, err := s.db.Exec(ctx, query, vendorID, controlID)
+// DiffStandardImport compares a standard file with the library without
+// changing anything: with the same code when it was imported before, otherwise
+// with the version it supersedes
+func (s *Store) DiffStandardImport(ctx context.Context, data StandardImportData) (*StandardDiff, error) {
+	diff := &StandardDiff{Code: data.Standard.Code, Version: data.Standard.Version, Action: StandardImportCreate}
+
+	existing, err := s.GetStandardByCode(ctx, data.Standard.Code)
 	if err != nil {
-		log.Printf("Failed to create vendor-control mapping: %v", err)
-		return err
+		return nil, err
+	}
+	var base []StandardImportControl
+	var ownID *string
+	switch {
+	case existing != nil:
+		diff.Action, diff.ComparedTo, diff.Lineage, ownID = StandardImportUpdate, existing, existing.Lineage, &existing.ID
+		if existing.Version != data.Standard.Version {
+			diff.Errors = append(diff.Errors, fmt.Sprintf("%s is imported as version %q; import version %q under a new code with \"supersedes\": %q",
+				existing.Code, existing.Version, data.Standard.Version, existing.Code))
+		}
+		compareStandardMetadata(diff, existing, data)
+		if base, err = s.getStandardControls(ctx, existing.ID); err != nil {
+			return nil, err
+		}
+	case data.Standard.Supersedes != "":
+		previous, err := s.GetStandardByCode(ctx, data.Standard.Supersedes)
+		if err != nil {
+			return nil, err
+		}
+		if previous == nil {
+			diff.Errors = append(diff.Errors, fmt.Sprintf("standard %s to supersede is not in the library", data.Standard.Supersedes))
+			break
+		}
+		diff.Action, diff.ComparedTo, diff.Lineage = StandardImportNewVersion, previous, previous.Lineage
+		if base, err = s.getStandardControls(ctx, previous.ID); err != nil {
+			return nil, err
+		}
+	}
+	if data.Standard.Lineage != "" {
+		diff.Lineage = data.Standard.Lineage
+	}
+	if diff.Lineage == "" {
+		diff.Lineage = data.Standard.Code
 	}
 
-	log.Printf("Mapped control %s to vendor %s", controlID, vendorID)
-	return nil
-}
+	// Compare with what the library stores: articles without text are not kept
+	incoming := make([]StandardImportControl, len(data.Controls))
+	ids := make([]string, len(data.Controls))
+	for i, c := range data.Controls {
+		if c.Article.FullText == "" {
+			c.Article = StandardImportControl{}.Article
+		}
+		incoming[i], ids[i] = c, c.ControlID
+	}
+	compareStandardControls(diff, base, incoming)
+	if diff.Action == StandardImportCreate {
+		for _, c := range incoming {
+			if len(c.Replaces) > 0 {
+				diff.controlErrors[c.ControlID] = append(diff.controlErrors[c.ControlID], "replaces other controls, but the standard supersedes none")
+			}
+		}
+	}
 
-func (s *Store) DeleteVendorControlMapping(ctx context.Context, vendorID, controlID string) error {
-	query := "DELETE FROM vendor_control_mapping WHERE vendor_id = $1 AND activated_control_id = $2"
-	_, err := s.db.Exec(ctx, query, vendorID, controlID)
+	rows, err := s.db.Query(ctx, `
+		SELECT c.id, st.code
+		FROM control_library c
+		JOIN control_standards st ON st.id = c.standard_id
+		WHERE c.id = ANY($1) AND ($2::uuid IS NULL OR c.standard_id <> $2)
+		ORDER BY c.id;
+	`, ids, ownID)
 	if err != nil {
-		log.Printf("Failed to delete vendor-control mapping: %v", err)
-		return err
+		return nil, err
 	}
-
-	log.Printf("Unmapped control %s from vendor %s", controlID, vendorID)
-	return nil
-}
-
-// ============================================================================
-// Standards Management
-// ============================================================================
-
-// ControlStandard represents a compliance standard metadata
-type ControlStandard struct {
-	ID            string     `json:"id" db:"id"`
-	Code          string     `json:"code" db:"code"`
-	Name          string     `json:"name" db:"name"`
-	Version       string     `json:"version" db:"version"`
-	Organization  string     `json:"organization" db:"organization"`
-	PublishedDate *time.Time `json:"published_date,omitempty" db:"published_date"`
-	Description   string     `json:"description" db:"description"`
-	WebsiteURL    string     `json:"website_url,omitempty" db:"website_url"`
-	TotalControls int        `json:"total_controls" db:"total_controls"`
-	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
-}
-
-// ControlArticle represents detailed article/spec text for a control
-type ControlArticle struct {
-	ID                 string    `json:"id" db:"id"`
-	ControlLibraryID   string    `json:"control_library_id" db:"control_library_id"`
-	StandardID         string    `json:"standard_id" db:"standard_id"`
-	ArticleNumber      string    `json:"article_number" db:"article_number"`
-	SectionName        string    `json:"section_name" db:"section_name"`
-	FullText           string    `json:"full_text" db:"full_text"`
-	Guidance           string    `json:"guidance,omitempty" db:"guidance"`
-	ExternalReferences string    `json:"external_references,omitempty" db:"external_references"`
-	CreatedAt          time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
+	defer rows.Close()
+	for rows.Next() {
+		var conflict ControlConflict
+		if err := rows.Scan(&conflict.ControlID, &conflict.Standard); err != nil {
+			return nil, err
+		}
+		diff.Conflicts = append(diff.Conflicts, conflict)
+	}
+	return diff, rows.Err()
 }
 
-// StandardImportData represents the JSON structure for importing standards
-type StandardImportData struct {
-	Standard struct {
-		Code          string `json:"code"`
-		Name          string `json:"name"`
-		Version       string `json:"version"`
-		Organization  string `json:"organization"`
-		PublishedDate string `json:"published_date"`
-		Description   string `json:"description"`
-		WebsiteURL    string `json:"website_url"`
-		TotalControls int    `json:"total_controls"`
-	} `json:"standard"`
-	Controls []struct {
-		ControlID   string `json:"control_id"`
-		Name        string `json:"name"`
-		Family      string `json:"family"`
-		Description string `json:"description"`
-		Article     struct {
-			ArticleNumber      string `json:"article_number"`
-			SectionName        string `json:"section_name"`
-			FullText           string `json:"full_text"`
-			Guidance           string `json:"guidance"`
-			ExternalReferences string `json:"external_references"`
-		} `json:"article"`
-	} `json:"controls"`
+// recordControlRevision keeps a control's current text before it is replaced
+func (s *Store) recordControlRevision(ctx context.Context, controlID string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO control_library_revisions (control_library_id, standard_id, family, name, description,
+			article_number, section_name, full_text, guidance, external_references)
+		SELECT c.id, c.standard_id, c.family, c.name, c.description,
+			a.article_number, a.section_name, a.full_text, a.guidance, a.external_references
+		FROM control_library c
+		LEFT JOIN control_articles a ON a.control_library_id = c.id AND a.standard_id = c.standard_id
+		WHERE c.id = $1;
+	`, controlID)
+	return err
 }
 
-func (s *Store) GetStandards(ctx context.Context) ([]ControlStandard, error) {
-	query := `SELECT id, code, name, version, organization, published_date, description, website_url, total_controls, created_at, updated_at 
-			  FROM control_standards 
-			  ORDER BY code ASC`
+// recordControlSuccessors links the controls of a new version to those they
+// take over from, and gives each successor the cross-standard mappings of its
+// predecessor. A mapping is kept as is only when the requirement text is
+// unchanged; otherwise it becomes "related". Existing mappings win.
+func (s *Store) recordControlSuccessors(ctx context.Context, diff *StandardDiff) error {
+	origin := fmt.Sprintf("%s (from %s)", diff.Code, diff.ComparedTo.Code)
+	for _, m := range diff.matches {
+		if _, err := s.db.Exec(ctx, `
+			INSERT INTO control_successors (predecessor_id, successor_id, match)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (predecessor_id, successor_id) DO UPDATE SET match = EXCLUDED.match;
+		`, m.predecessor.ControlID, m.successor.ControlID, m.match); err != nil {
+			return err
+		}
 
-	rows, err := s.db.Query(ctx, query)
+		predecessorID := m.predecessor.ControlID
+		mappings, err := s.ListControlMappings(ctx, &predecessorID, nil)
+		if err != nil {
+			return err
+		}
+		changed := requirementChanged(diffControlFields(m.predecessor, m.successor))
+		for _, mapping := range mappings {
+			other, otherStandard, relationship := mapping.TargetControlID, mapping.TargetStandard, mapping.Relationship
+			if mapping.TargetControlID == predecessorID {
+				other, otherStandard, relationship = mapping.SourceControlID, mapping.SourceStandard, invertRelationship(mapping.Relationship)
+			}
+			if otherStandard == diff.ComparedTo.Code || otherStandard == diff.Code {
+				continue
+			}
+			if changed {
+				relationship = MappingRelated
+			}
+			req, msg := normalizeControlMapping(ControlMappingRequest{SourceControlID: m.successor.ControlID, TargetControlID: other, Relationship: relationship})
+			if msg != "" {
+				continue
+			}
+			if _, err := s.db.Exec(ctx, `
+				INSERT INTO control_library_mappings (source_control_id, target_control_id, relationship, notes, origin)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (source_control_id, target_control_id) DO NOTHING;
+			`, req.SourceControlID, req.TargetControlID, req.Relationship, mapping.Notes, origin); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ProposeStandardMigration lists the organization's activated controls of the
+// version a standard supersedes, with the controls of the new version each can
+// migrate to: its successors, and controls it is equal to or a superset of
+func (s *Store) ProposeStandardMigration(ctx context.Context, standardID string) (*StandardMigrationPlan, error) {
+	std, err := s.GetStandardByID(ctx, standardID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("standard not found")
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	if std.SupersedesID == nil {
+		return nil, fmt.Errorf("standard has no previous version")
+	}
+	from, err := s.GetStandardByID(ctx, *std.SupersedesID)
+	if err != nil {
+		return nil, err
+	}
+	plan := &StandardMigrationPlan{Standard: std, From: from, Controls: []ControlMigrationRow{}}
 
-	var standards []ControlStandard
+	rows, err := s.db.Query(ctx, `
+		SELECT ac.id, ac.control_library_id, c.name, ac.status,
+			(SELECT COUNT(*) FROM control_evidence_log e WHERE e.activated_control_id = ac.id)
+		FROM activated_controls ac
+		JOIN control_library c ON c.id = ac.control_library_id
+		WHERE c.standard_id = $1 AND ac.migrated_to_id IS NULL
+		ORDER BY ac.control_library_id;
+	`, from.ID)
+	if err != nil {
+		return nil, err
+	}
 	for rows.Next() {
-		var std ControlStandard
-		err := rows.Scan(&std.ID, &std.Code, &std.Name, &std.Version, &std.Organization,
-			&std.PublishedDate, &std.Description, &std.WebsiteURL, &std.TotalControls,
-			&std.CreatedAt, &std.UpdatedAt)
-		if err != nil {
+		row := ControlMigrationRow{Targets: []ControlMigrationTarget{}}
+		if err := rows.Scan(&row.ActivatedControlID, &row.ControlID, &row.Name, &row.Status, &row.EvidenceCount); err != nil {
+			rows.Close()
 			return nil, err
 		}
-		standards = append(standards, std)
+		plan.Controls = append(plan.Controls, row)
 	}
-
-	if standards == nil {
-		standards = make([]ControlStandard, 0)
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return standards, nil
-}
-
-func (s *Store) GetStandardByID(ctx context.Context, id string) (*ControlStandard, error) {
-	query := `SELECT id, code, name, version, organization, published_date, description, website_url, total_controls, created_at, updated_at 
-			  FROM control_standards 
-			  WHERE id = $1`
-
-	var std ControlStandard
-	err := s.db.QueryRow(ctx, query, id).Scan(&std.ID, &std.Code, &std.Name, &std.Version,
-		&std.Organization, &std.PublishedDate, &std.Description, &std.WebsiteURL, &std.TotalControls,
-		&std.CreatedAt, &std.UpdatedAt)
+	// Candidate targets by predecessor
+	targets := map[string][]ControlMigrationTarget{}
+	rows, err = s.db.Query(ctx, `
+		SELECT cs.predecessor_id, cs.successor_id, c.name, cs.match
+		FROM control_successors cs
+		JOIN control_library c ON c.id = cs.successor_id
+		WHERE c.standard_id = $1 AND c.retired_at IS NULL
+		ORDER BY cs.successor_id;
+	`, std.ID)
 	if err != nil {
 		return nil, err
 	}
-
-	return &std, nil
-}
-
-func (s *Store) ImportStandard(ctx context.Context, data StandardImportData) error {
-	// Parse published date
-	var publishedDate *time.Time
-	if data.Standard.PublishedDate != "" {
-		t, err := time.Parse("2006-01-02", data.Standard.PublishedDate)
-		if err == nil {
-			publishedDate = &t
+	for rows.Next() {
+		var predecessor string
+		var t ControlMigrationTarget
+		if err := rows.Scan(&predecessor, &t.ControlID, &t.Name, &t.Match); err != nil {
+			rows.Close()
+			return nil, err
 		}
+		targets[predecessor] = append(targets[predecessor], t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	// Insert standard metadata
-	standardID := ""
-	standardQuery := `INSERT INTO control_standards (code, name, version, organization, published_date, description, website_url, total_controls)
-					 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-					 ON CONFLICT (code) DO UPDATE SET 
-						name = EXCLUDED.name,
-						version = EXCLUDED.version,
-						organization = EXCLUDED.organization,
-						published_date = EXCLUDED.published_date,
-						description = EXCLUDED.description,
-						website_url = EXCLUDED.website_url,
-						total_controls = EXCLUDED.total_controls,
-						updated_at = NOW()
-					 RETURNING id`
-
-	err := s.db.QueryRow(ctx, standardQuery, data.Standard.Code, data.Standard.Name,
-		data.Standard.Version, data.Standard.Organization, publishedDate,
-		data.Standard.Description, data.Standard.WebsiteURL, data.Standard.TotalControls).Scan(&standardID)
+	mappings, err := s.ListControlMappings(ctx, nil, &std.Code)
 	if err != nil {
-		log.Printf("Failed to insert standard: %v", err)
-		return err
+		return nil, err
 	}
-
-	log.Printf("Imported standard: %s (ID: %s)", data.Standard.Code, standardID)
-
-	// Insert controls
-	controlQuery := `INSERT INTO control_library (id, standard, family, name, description, standard_id)
-					 VALUES ($1, $2, $3, $4, $5, $6)
-					 ON CONFLICT (id) DO UPDATE SET
-						standard = EXCLUDED.standard,
-						family = EXCLUDED.family,
-						name = EXCLUDED.name,
-						description = EXCLUDED.description,
-						standard_id = EXCLUDED.standard_id`
-
-	articleQuery := `INSERT INTO control_articles (control_library_id, standard_id, article_number, section_name, full_text, guidance, external_references)
-					 VALUES ($1, $2, $3, $4, $5, $6, $7)
-					 ON CONFLICT (control_library_id, standard_id) DO UPDATE SET
-						article_number = EXCLUDED.article_number,
-						section_name = EXCLUDED.section_name,
-						full_text = EXCLUDED.full_text,
-						guidance = EXCLUDED.guidance,
-						external_references = EXCLUDED.external_references,
-						updated_at = NOW()`
-
-	importedCount := 0
-	for _, control := range data.Controls {
-		// Insert control
-		_, err := s.db.Exec(ctx, controlQuery, control.ControlID, data.Standard.Code,
-			control.Family, control.Name, control.Description, standardID)
-		if err != nil {
-			log.Printf("Failed to insert control %s: %v", control.ControlID, err)
+	for _, m := range mappings {
+		old, oldStandard, target, name, relationship := m.SourceControlID, m.SourceStandard, m.TargetControlID, m.TargetName, m.Relationship
+		if m.TargetStandard == from.Code {
+			old, oldStandard, target, name, relationship = m.TargetControlID, m.TargetStandard, m.SourceControlID, m.SourceName, invertRelationship(m.Relationship)
+		}
+		if oldStandard != from.Code || !carriesEvidence(relationship) {
 			continue
 		}
+		duplicate := false
+		for _, t := range targets[old] {
+			duplicate = duplicate || t.ControlID == target
+		}
+		if !duplicate {
+			targets[old] = append(targets[old], ControlMigrationTarget{ControlID: target, Name: name, Match: relationship})
+		}
+	}
 
-		// Insert article if provided
-		if control.Article.FullText != "" {
-			_, err = s.db.Exec(ctx, articleQuery, control.ControlID, standardID,
-				control.Article.ArticleNumber, control.Article.SectionName,
-				control.Article.FullText, control.Article.Guidance,
-				control.Article.ExternalReferences)
-			if err != nil {
-				log.Printf("Failed to insert article for control %s: %v", control.ControlID, err)
+	activated, err := s.activatedControlsOfStandard(ctx, std.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range plan.Controls {
+		for _, t := range targets[row.ControlID] {
+			if id, ok := activated[t.ControlID]; ok {
+				t.ActivatedControlID = &id
 			}
+			plan.Controls[i].Targets = append(plan.Controls[i].Targets, t)
 		}
+	}
+	return plan, nil
+}
 
-		importedCount++
+// activatedControlsOfStandard maps the organization's activated controls of a
+// standard by library ID
+func (s *Store) activatedControlsOfStandard(ctx context.Context, standardID string) (map[string]string, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT ac.control_library_id, ac.id
+		FROM activated_controls ac
+		JOIN control_library c ON c.id = ac.control_library_id
+		WHERE c.standard_id = $1
+		ORDER BY ac.created_at;
+	`, standardID)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	log.Printf("Imported %d controls for standard %s", importedCount, data.Standard.Code)
-	return nil
+	activated := map[string]string{}
+	for rows.Next() {
+		var controlID, id string
+		if err := rows.Scan(&controlID, &id); err != nil {
+			return nil, err
+		}
+		if _, ok := activated[controlID]; !ok {
+			activated[controlID] = id
+		}
+	}
+	return activated, rows.Err()
 }
 
-func (s *Store) GetArticleByControlID(ctx context.Context, controlID string) (*ControlArticle, error) {
-	query := `SELECT id, control_library_id, standard_id, article_number, section_name, full_text, guidance, external_references, created_at, updated_at
-			  FROM control_articles
-			  WHERE control_library_id = $1`
+// ApplyStandardMigration carries the organization's activated controls of the
+// superseded version over to the new one. The first target not yet activated
+// takes over the activation itself, with its evidence, owner and schedule;
+// further targets get the evidence log copied, on a new activation with the
+// same owner and schedule if needed. Activations that were not taken over are
+// deactivated unless req.KeepPrevious.
+func (s *Store) ApplyStandardMigration(ctx context.Context, standardID string, req StandardMigrationRequest) (*StandardMigrationResult, error) {
+	plan, err := s.ProposeStandardMigration(ctx, standardID)
+	if err != nil {
+		return nil, err
+	}
+	rows := map[string]ControlMigrationRow{}
+	for _, row := range plan.Controls {
+		rows[row.ActivatedControlID] = row
+	}
 
-	var article ControlArticle
-	err := s.db.QueryRow(ctx, query, controlID).Scan(&article.ID, &article.ControlLibraryID,
-		&article.StandardID, &article.ArticleNumber, &article.SectionName, &article.FullText,
-		&article.Guidance, &article.ExternalReferences, &article.CreatedAt, &article.UpdatedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil // No article found, not an error
+	// What to migrate: the request, or every row as proposed
+	type selection struct {
+		row ControlMigrationRow
+		to  []string
+	}
+	var selections []selection
+	result := &StandardMigrationResult{Controls: []ControlMigrationOutcome{}}
+	if len(req.Controls) == 0 {
+		for _, row := range plan.Controls {
+			var to []string
+			for _, t := range row.Targets {
+				to = append(to, t.ControlID)
+			}
+			if len(to) == 0 {
+				result.Skipped = append(result.Skipped, row.ControlID)
+				continue
+			}
+			selections = append(selections, selection{row, to})
+		}
+	} else {
+		current, err := s.getStandardControls(ctx, plan.Standard.ID)
+		if err != nil {
+			return nil, err
+		}
+		valid := map[string]bool{}
+		for _, c := range current {
+			valid[c.ControlID] = true
+		}
+		for _, c := range req.Controls {
+			row, ok := rows[c.ActivatedControlID]
+			if !ok {
+				return nil, fmt.Errorf("invalid migration: %s is not an activated control of %s awaiting migration", c.ActivatedControlID, plan.From.Code)
+			}
+			to := []string{}
+			seen := map[string]bool{}
+			for _, id := range c.To {
+				if !valid[id] {
+					return nil, fmt.Errorf("invalid migration: %s is not a control of %s", id, plan.Standard.Code)
+				}
+				if !seen[id] {
+					seen[id] = true
+					to = append(to, id)
+				}
+			}
+			if len(to) == 0 {
+				result.Skipped = append(result.Skipped, row.ControlID)
+				continue
+			}
+			selections = append(selections, selection{row, to})
+		}
 	}
+
+	err = s.InTx(ctx, func(ctx context.Context) error {
+		activated, err := s.activatedControlsOfStandard(ctx, plan.Standard.ID)
+		if err != nil {
+			return err
+		}
+		for _, sel := range selections {
+			source := sel.row.ActivatedControlID
+			outcome := ControlMigrationOutcome{ActivatedControlID: source, From: sel.row.ControlID, To: sel.to}
+			primary := ""
+			for _, target := range sel.to {
+				id, ok := activated[target]
+				switch {
+				case ok:
+				case !outcome.Moved:
+					if _, err := s.db.Exec(ctx, `UPDATE activated_controls SET control_library_id = $2 WHERE id = $1;`, source, target); err != nil {
+						return err
+					}
+					id, outcome.Moved = source, true
+					activated[target] = id
+					result.Moved++
+				default:
+					if err := s.db.QueryRow(ctx, `
+						INSERT INTO activated_controls (control_library_id, owner_id, status, review_interval_days, last_reviewed_at, next_review_due_date)
+						SELECT $2, owner_id, status, review_interval_days, last_reviewed_at, next_review_due_date
+						FROM activated_controls WHERE id = $1
+						RETURNING id;
+					`, source, target).Scan(&id); err != nil {
+						return err
+					}
+					activated[target] = id
+					result.Activated++
+				}
+				if primary == "" {
+					primary = id
+				}
+				if id == source {
+					continue
+				}
+				tag, err := s.db.Exec(ctx, `
+					INSERT INTO control_evidence_log (activated_control_id, performed_by_id, performed_at, compliance_status, notes, evidence_link, migrated_from_id)
+					SELECT $2, e.performed_by_id, e.performed_at, e.compliance_status, e.notes, e.evidence_link, e.id
+					FROM control_evidence_log e
+					WHERE e.activated_control_id = $1
+					AND NOT EXISTS (SELECT 1 FROM control_evidence_log x WHERE x.activated_control_id = $2 AND x.migrated_from_id = e.id);
+				`, source, id)
+				if err != nil {
+					return err
+				}
+				result.EvidenceCopied += int(tag.RowsAffected())
+			}
+			if !outcome.Moved {
+				if _, err := s.db.Exec(ctx, `
+					UPDATE activated_controls
+					SET migrated_to_id = $2, status = CASE WHEN $3 THEN status ELSE 'inactive' END
+					WHERE id = $1;
+				`, source, primary, req.KeepPrevious); err != nil {
+					return err
+				}
+			}
+			result.Migrated++
+			result.Controls = append(result.Controls, outcome)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	return &article, nil
+	return result, nil
 }
 
-func (s *Store) GetControlsByStandardID(ctx context.Context, standardID string) ([]ControlLibraryItem, error) {
-	query := `SELECT id, standard, family, name, description
-			  FROM control_library
-			  WHERE standard_id = $1
-			  ORDER BY id ASC`
+// ========== OSCAL ==========
 
-	rows, err := s.db.Query(ctx, query, standardID)
+// ExportOSCALCatalog returns a standard and its current controls as an OSCAL
+// catalog
+func (s *Store) ExportOSCALCatalog(ctx context.Context, standardID string) (*oscalCatalog, error) {
+	std, err := s.GetStandardByID(ctx, standardID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("standard not found")
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var controls []ControlLibraryItem
-	for rows.Next() {
-		var ctrl ControlLibraryItem
-		err := rows.Scan(&ctrl.ID, &ctrl.Standard, &ctrl.Family, &ctrl.Name, &ctrl.Description)
+	supersedes := ""
+	if std.SupersedesID != nil {
+		previous, err := s.GetStandardByID(ctx, *std.SupersedesID)
 		if err != nil {
 			return nil, err
 		}
-		controls = append(controls, ctrl)
+		supersedes = previous.Code
 	}
-
-	if controls == nil {
-		controls = make([]ControlLibraryItem, 0)
+	controls, err := s.getStandardControls(ctx, std.ID)
+	if err != nil {
+		return nil, err
 	}
+	return buildOSCALCatalog(std, supersedes, controls), nil
+}
 
-	return controls, nil
+// OSCALLibrarySource resolves the catalogs a profile imports to standards in
+// the library: the standard with code, or else the one named like the file the
+// import refers to ("ISO-27001-2022.json")
+func (s *Store) OSCALLibrarySource(ctx context.Context, code string) oscalCatalogSource {
+	return func(href string) (*oscalDocument, error) {
+		want := code
+		if want == "" {
+			want = oscalHrefCode(href)
+		}
+		std, err := s.GetStandardByCode(ctx, want)
+		if err != nil {
+			return nil, err
+		}
+		if std == nil {
+			return nil, fmt.Errorf("%s is not a standard in the library", want)
+		}
+		cat, err := s.ExportOSCALCatalog(ctx, std.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &oscalDocument{Catalog: cat}, nil
+	}
 }
 
 // ========== QUICK START TEMPLATES ==========
@@ -3549,6 +7651,9 @@ func (s *Store) GetEvidenceFileByID(ctx context.Context, fileID string) (*Eviden
 		&file.FileSize, &file.ContentType, &file.UploadedByID, &file.UploadedAt,
 	)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("evidence file not found")
+		}
 		return nil, err
 	}
 
@@ -3558,6 +7663,111 @@ func (s *Store) GetEvidenceFileByID(ctx context.Context, fileID string) (*Eviden
 // DeleteEvidenceFile removes an evidence file record from the database
 func (s *Store) DeleteEvidenceFile(ctx context.Context, fileID string) error {
 	query := `DELETE FROM evidence_files WHERE id = $1`
-	_, err := s.db.Exec(ctx, query, fileID)
+	result, err := s.db.Exec(ctx, query, fileID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("evidence file not found")
+	}
+	return nil
+}
+
+// ========== EVIDENCE OWNERSHIP ==========
+
+// GetControlEvidenceAccess reports whether userID owns or is a delegate of an activated control
+func (s *Store) GetControlEvidenceAccess(ctx context.Context, activatedControlID, userID string) (*EvidenceAccess, error) {
+	query := `
+		SELECT ac.id, COALESCE(ac.owner_id::text, ''),
+		       EXISTS (SELECT 1 FROM control_delegates cd WHERE cd.activated_control_id = ac.id AND cd.user_id = $2)
+		FROM activated_controls ac
+		WHERE ac.id = $1;
+	`
+	var access EvidenceAccess
+	err := s.db.QueryRow(ctx, query, activatedControlID, userID).Scan(&access.ActivatedControlID, &access.OwnerID, &access.IsDelegate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("control not found")
+		}
+		return nil, err
+	}
+	access.IsOwner = access.OwnerID != "" && access.OwnerID == userID
+	return &access, nil
+}
+
+// GetEvidenceLogAccess resolves an evidence log to its control and reports how userID relates to it
+func (s *Store) GetEvidenceLogAccess(ctx context.Context, evidenceLogID, userID string) (*EvidenceAccess, error) {
+	query := `
+		SELECT ac.id, COALESCE(ac.owner_id::text, ''),
+		       EXISTS (SELECT 1 FROM control_delegates cd WHERE cd.activated_control_id = ac.id AND cd.user_id = $2),
+		       cel.performed_by_id = $2
+		FROM control_evidence_log cel
+		JOIN activated_controls ac ON ac.id = cel.activated_control_id
+		WHERE cel.id = $1;
+	`
+	var access EvidenceAccess
+	err := s.db.QueryRow(ctx, query, evidenceLogID, userID).Scan(
+		&access.ActivatedControlID, &access.OwnerID, &access.IsDelegate, &access.IsPerformer,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("evidence log not found")
+		}
+		return nil, err
+	}
+	access.IsOwner = access.OwnerID != "" && access.OwnerID == userID
+	return &access, nil
+}
+
+// ListControlDelegates returns the users delegated to an activated control
+func (s *Store) ListControlDelegates(ctx context.Context, activatedControlID string) ([]ControlDelegate, error) {
+	query := `
+		SELECT u.id, u.name, u.email, cd.delegated_by_id, cd.created_at
+		FROM control_delegates cd
+		JOIN users u ON u.id = cd.user_id
+		WHERE cd.activated_control_id = $1
+		ORDER BY u.name;
+	`
+	rows, err := s.db.Query(ctx, query, activatedControlID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delegates := []ControlDelegate{}
+	for rows.Next() {
+		var d ControlDelegate
+		if err := rows.Scan(&d.UserID, &d.Name, &d.Email, &d.DelegatedByID, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		delegates = append(delegates, d)
+	}
+	return delegates, rows.Err()
+}
+
+// AddControlDelegate lets userID submit evidence for an activated control
+func (s *Store) AddControlDelegate(ctx context.Context, activatedControlID, userID, delegatedByID string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO control_delegates (activated_control_id, user_id, delegated_by_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (activated_control_id, user_id) DO NOTHING;
+	`, activatedControlID, userID, delegatedByID)
+	if err != nil && strings.Contains(err.Error(), "foreign key") {
+		return fmt.Errorf("user not found")
+	}
 	return err
 }
+
+// RemoveControlDelegate revokes a delegation
+func (s *Store) RemoveControlDelegate(ctx context.Context, activatedControlID, userID string) error {
+	result, err := s.db.Exec(ctx, `
+		DELETE FROM control_delegates WHERE activated_control_id = $1 AND user_id = $2;
+	`, activatedControlID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("delegate not found")
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tenant isolation
+//
+// Every tenant-owned table carries organization_id and a row-level security
+// policy (see "TENANT ISOLATION" in migrations/). When a request context carries
+// an organization, tenantDB runs each statement in a transaction as the
+// non-owner tenantRole with app.org_id set, so PostgreSQL only exposes that
+// organization's rows and stamps new rows with it. Contexts without an
+// organization (login, token refresh, background maintenance, super-admin
+// tooling) run as the table owner, which RLS does not restrict. Inside
+// Store.InTx every statement joins the transaction carried by the context.
+
+const (
+	// tenantRole is the database role org-scoped statements run as
+	tenantRole = "grc_tenant"
+
+	// OrganizationIDKey holds the organization a request is scoped to
+	OrganizationIDKey contextKey = "organizationID"
+	// SuperAdminKey is true for platform operators who can manage every organization
+	SuperAdminKey contextKey = "superAdmin"
+	// txKey holds the transaction opened by Store.InTx
+	txKey contextKey = "tx"
+)
+
+// Organization is a tenant. Users and all compliance data belong to exactly one.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Status    string    `json:"status"` // 'active', 'suspended'
+	IsDefault bool      `json:"is_default"`
+	UserCount int       `json:"user_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationRequest is the JSON for creating or updating an organization
+type OrganizationRequest struct {
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`
+	Status string `json:"status"`
+}
+
+// MoveUserRequest is the JSON for moving a user to another organization
+type MoveUserRequest struct {
+	OrganizationID string `json:"organization_id"`
+}
+
+// SessionPrincipal is what the auth middleware needs to know about a live session
+type SessionPrincipal struct {
+	Role               string
+	OrganizationID     string
+	OrganizationStatus string
+	IsSuperAdmin       bool
+}
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// isValidOrgSlug reports whether slug is a lowercase URL-safe identifier
+func isValidOrgSlug(slug string) bool {
+	return orgSlugPattern.MatchString(slug)
+}
+
+// WithOrganization scopes database access made with ctx to one organization
+func WithOrganization(ctx context.Context, orgID string) context.Context {
+	return context.WithValue(ctx, OrganizationIDKey, orgID)
+}
+
+// WithoutOrganization lifts organization scoping, for super-admin tooling and platform jobs
+func WithoutOrganization(ctx context.Context) context.Context {
+	return context.WithValue(ctx, OrganizationIDKey, "")
+}
+
+// OrganizationFromContext returns the organization ctx is scoped to, if any
+func OrganizationFromContext(ctx context.Context) string {
+	orgID, _ := ctx.Value(OrganizationIDKey).(string)
+	return orgID
+}
+
+// txFromContext returns the transaction ctx runs in, if any
+func txFromContext(ctx context.Context) pgx.Tx {
+	tx, _ := ctx.Value(txKey).(pgx.Tx)
+	return tx
+}
+
+// tenantDB wraps the connection pool and applies organization scoping from the context
+type tenantDB struct {
+	pool *pgxpool.Pool
+}
+
+// beginScoped opens a transaction restricted to one organization's rows
+func (d *tenantDB) beginScoped(ctx context.Context, orgID string) (pgx.Tx, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `SELECT set_config('role', $1, true), set_config('app.org_id', $2, true);`, tenantRole, orgID); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Begin starts a transaction, scoped to the context's organization if it has one.
+// Within Store.InTx it starts a savepoint in the surrounding transaction instead.
+func (d *tenantDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	if tx := txFromContext(ctx); tx != nil {
+		return tx.Begin(ctx)
+	}
+	orgID := OrganizationFromContext(ctx)
+	if orgID == "" {
+		return d.pool.Begin(ctx)
+	}
+	return d.beginScoped(ctx, orgID)
+}
+
+// Exec runs a statement, scoped to the context's organization if it has one
+func (d *tenantDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if tx := txFromContext(ctx); tx != nil {
+		return tx.Exec(ctx, sql, args...)
+	}
+	orgID := OrganizationFromContext(ctx)
+	if orgID == "" {
+		return d.pool.Exec(ctx, sql, args...)
+	}
+
+	tx, err := d.beginScoped(ctx, orgID)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return tag, err
+	}
+	return tag, tx.Commit(ctx)
+}
+
+// QueryRow runs a single-row query, scoped to the context's organization if it has one
+func (d *tenantDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if tx := txFromContext(ctx); tx != nil {
+		return tx.QueryRow(ctx, sql, args...)
+	}
+	orgID := OrganizationFromContext(ctx)
+	if orgID == "" {
+		return d.pool.QueryRow(ctx, sql, args...)
+	}
+	return &tenantRow{db: d, ctx: ctx, orgID: orgID, sql: sql, args: args}
+}
+
+// Query runs a query, scoped to the context's organization if it has one.
+// The scoped transaction ends when the rows are exhausted or closed.
+func (d *tenantDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if tx := txFromContext(ctx); tx != nil {
+		return tx.Query(ctx, sql, args...)
+	}
+	orgID := OrganizationFromContext(ctx)
+	if orgID == "" {
+		return d.pool.Query(ctx, sql, args...)
+	}
+
+	tx, err := d.beginScoped(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	return &tenantRows{Rows: rows, ctx: ctx, tx: tx}, nil
+}
+
+// tenantRow defers an org-scoped QueryRow until Scan, like pgx does
+type tenantRow struct {
+	db    *tenantDB
+	ctx   context.Context
+	orgID string
+	sql   string
+	args  []any
+}
+
+func (r *tenantRow) Scan(dest ...any) error {
+	tx, err := r.db.beginScoped(r.ctx, r.orgID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(r.ctx)
+
+	if err := tx.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...); err != nil {
+		return err
+	}
+	return tx.Commit(r.ctx)
+}
+
+// tenantRows commits its scoped transaction once the result set is finished
+type tenantRows struct {
+	pgx.Rows
+	ctx  context.Context
+	tx   pgx.Tx
+	done bool
+	err  error
+}
+
+func (r *tenantRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.finish()
+	return false
+}
+
+func (r *tenantRows) Close() {
+	r.finish()
+}
+
+func (r *tenantRows) Err() error {
+	if err := r.Rows.Err(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+func (r *tenantRows) finish() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.Rows.Close()
+	if r.Rows.Err() != nil {
+		r.tx.Rollback(r.ctx)
+		return
+	}
+	r.err = r.tx.Commit(r.ctx)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Outbound webhooks
+//
+// Organizations subscribe HTTP endpoints to audit events (EVIDENCE_SUBMITTED,
+// TICKET_CREATED_EXTERNAL, DSR_UPDATED, RISK_UPDATED and so on, or "*" for all).
+// The "webhooks" event handler queues a delivery for every matching subscription
+// when a domain event is dispatched, and the dispatcher posts due deliveries,
+// signed with the subscription's secret. Failures are retried with exponential backoff
+// until WEBHOOK_MAX_ATTEMPTS, after which the delivery is marked failed and can
+// be replayed from the delivery log.
+//
+// Receivers must be on public addresses: the dispatcher checks every address it
+// connects to, after DNS resolution, unless WEBHOOK_ALLOW_PRIVATE is set. Only
+// the receiver's status code is recorded, never its response body.
+
+const (
+	// webhookSecretPrefix marks webhook signing secrets
+	webhookSecretPrefix = "whsec_"
+	// webhookTestEvent is sent by the test endpoint
+	webhookTestEvent = "WEBHOOK_TEST"
+	// webhookResponseLimit is how much of a receiver's response is read before the connection is reused
+	webhookResponseLimit = 64 << 10
+	// webhookMaxBackoff caps the delay between attempts
+	webhookMaxBackoff = 6 * time.Hour
+)
+
+var webhookEventPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// errWebhookDestination is returned when a receiver resolves to a non-public address
+var errWebhookDestination = errors.New("webhook destination is not a public address")
+
+// nonPublicPrefixes are special-purpose ranges not covered by the netip.Addr predicates
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, can embed private IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4, can embed private IPv4
+}
+
+// WebhookSubscription is an endpoint that receives events. The secret is only
+// returned when it is created or rotated.
+type WebhookSubscription struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	Name           string    `json:"name"`
+	URL            string    `json:"url"`
+	Events         []string  `json:"events"`
+	Active         bool      `json:"active"`
+	CreatedByID    *string   `json:"created_by_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// WebhookRequest is the JSON for creating or updating a subscription
+type WebhookRequest struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // audit action types, or "*"
+	Active *bool    `json:"active"` // defaults to true
+}
+
+// WebhookSecretResponse returns a subscription with its signing secret
+type WebhookSecretResponse struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookDelivery is one queued or attempted delivery of an event
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // pending, succeeded or failed
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	Error          *string         `json:"error,omitempty"`
+	ReplayOf       *string         `json:"replay_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// claimedWebhookDelivery is a delivery leased by the dispatcher, with its endpoint
+type claimedWebhookDelivery struct {
+	WebhookDelivery
+	URL             string
+	SecretEncrypted string
+}
+
+// validateWebhookRequest checks the fields shared by create and update
+func validateWebhookRequest(req *WebhookRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return "Field 'name' is required"
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "Field 'url' must be an absolute http or https URL"
+	}
+	if u.User != nil {
+		return "Field 'url' must not contain credentials"
+	}
+	// Host names are checked again when connecting, after they are resolved
+	if !webhookAllowPrivate() {
+		host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		if addr, err := netip.ParseAddr(host); (err == nil && !isPublicAddress(addr)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return "Field 'url' must point to a public address"
+		}
+	}
+	if len(req.Events) == 0 {
+		return "At least one event is required"
+	}
+	seen := map[string]bool{}
+	events := []string{}
+	for _, event := range req.Events {
+		event = strings.ToUpper(strings.TrimSpace(event))
+		if event != "*" && !webhookEventPattern.MatchString(event) {
+			return fmt.Sprintf("Invalid event '%s'", event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	req.Events = events
+	return ""
+}
+
+// generateWebhookSecret returns a new random signing secret
+func generateWebhookSecret() (string, error) {
+	token, err := randomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + token, nil
+}
+
+// SignWebhookPayload computes the X-GRC-Signature value for a delivery:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>"
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookAllowPrivate reports whether WEBHOOK_ALLOW_PRIVATE permits receivers on
+// loopback, private and link-local addresses
+func webhookAllowPrivate() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE"))
+	return allow
+}
+
+// isPublicAddress reports whether addr is routable on the public internet
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialControl refuses connections to non-public addresses. It runs for
+// every address the dialer tries, so DNS rebinding cannot get around it.
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !isPublicAddress(addr) {
+		return fmt.Errorf("%w: %s", errWebhookDestination, host)
+	}
+	return nil
+}
+
+// newWebhookClient returns the HTTP client deliveries are sent with. It
+// connects directly, bypassing HTTP_PROXY, so the address check sees the receiver.
+func newWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = webhookDialControl
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		// Receivers must answer at the configured URL
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// WebhookDispatcher posts queued deliveries in the background. Several
+// replicas can run one; each delivery is leased to a single dispatcher.
+type WebhookDispatcher struct {
+	store        *Store
+	keys         *KeyManager
+	client       *http.Client
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	retryBackoff time.Duration
+}
+
+// NewWebhookDispatcher reads the WEBHOOK_* settings
+func NewWebhookDispatcher(store *Store, keys *KeyManager) *WebhookDispatcher {
+	allowPrivate := webhookAllowPrivate()
+	if allowPrivate {
+		log.Println("WARNING: WEBHOOK_ALLOW_PRIVATE is set - webhooks may reach internal addresses")
+	}
+	return &WebhookDispatcher{
+		store:        store,
+		keys:         keys,
+		client:       newWebhookClient(envDuration("WEBHOOK_TIMEOUT", 10*time.Second), allowPrivate),
+		pollInterval: envDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		batchSize:    envInt("WEBHOOK_BATCH_SIZE", 20),
+		maxAttempts:  envInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		retryBackoff: envDuration("WEBHOOK_RETRY_BACKOFF", 30*time.Second),
+	}
+}
+
+// Start polls for due deliveries until ctx is cancelled
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.deliverDue(ctx)
+			}
+		}
+	}()
+}
+
+// deliverDue claims and sends batches until nothing is due
+func (d *WebhookDispatcher) deliverDue(ctx context.Context) {
+	// A claimed delivery is not picked up again until its lease runs out,
+	// which only matters if this process dies mid-request
+	lease := 2*d.client.Timeout + time.Minute
+	for ctx.Err() == nil {
+		deliveries, err := d.store.ClaimWebhookDeliveries(WithoutOrganization(ctx), d.batchSize, lease)
+		if err != nil {
+			log.Printf("Error claiming webhook deliveries: %v", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery claimedWebhookDelivery) {
+				defer wg.Done()
+				d.deliver(ctx, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < d.batchSize {
+			return
+		}
+	}
+}
+
+// deliver sends one delivery and records the outcome
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery claimedWebhookDelivery) {
+	status, sendErr := d.send(ctx, delivery)
+	result := d.outcome(delivery, status, sendErr)
+	if result.Status == "failed" {
+		log.Printf("Webhook delivery %s to %s failed after %d attempt(s): %v", delivery.ID, delivery.URL, delivery.Attempts, sendErr)
+	}
+
+	if err := d.store.FinishWebhookDelivery(WithoutOrganization(ctx), result); err != nil {
+		log.Printf("Error recording webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// outcome is the delivery's new state after an attempt: succeeded, pending a
+// retry after backoff, or failed once the attempts are used up
+func (d *WebhookDispatcher) outcome(delivery claimedWebhookDelivery, status int, sendErr error) WebhookDelivery {
+	result := WebhookDelivery{ID: delivery.ID, Status: "succeeded"}
+	if status != 0 {
+		result.ResponseStatus = &status
+	}
+	if sendErr != nil {
+		text := sendErr.Error()
+		result.Error = &text
+		result.Status = "pending"
+		result.NextAttemptAt = time.Now().Add(d.backoff(delivery.Attempts))
+		if delivery.Attempts >= d.maxAttempts {
+			result.Status = "failed"
+		}
+	}
+	return result
+}
+
+// backoff is the delay after the given number of failed attempts
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := d.retryBackoff << (attempts - 1)
+	if delay > webhookMaxBackoff || delay <= 0 {
+		return webhookMaxBackoff
+	}
+	return delay
+}
+
+// send posts the payload and returns the response status. Anything other than
+// a 2xx response is an error.
+func (d *WebhookDispatcher) send(ctx context.Context, delivery claimedWebhookDelivery) (int, error) {
+	secret, err := d.keys.decrypt(delivery.SecretEncrypted)
+	if err != nil {
+		return 0, fmt.Errorf("decrypting secret: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GRC-Platform-Webhooks/1.0")
+	req.Header.Set("X-GRC-Event", delivery.EventType)
+	req.Header.Set("X-GRC-Event-ID", delivery.EventID)
+	req.Header.Set("X-GRC-Delivery", delivery.ID)
+	req.Header.Set("X-GRC-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-GRC-Signature", SignWebhookPayload(string(secret), timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// The body is discarded: receivers are tenant-controlled and it is never shown
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWebhookDispatcher returns a dispatcher with a fixed encryption key and no store
+func testWebhookDispatcher(t *testing.T, allowPrivate bool) (*WebhookDispatcher, string) {
+	t.Helper()
+	keys := &KeyManager{encryptionKey: make([]byte, 32)}
+	encrypted, err := keys.encrypt([]byte("whsec_test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &WebhookDispatcher{
+		keys:         keys,
+		client:       newWebhookClient(5*time.Second, allowPrivate),
+		maxAttempts:  3,
+		retryBackoff: 30 * time.Second,
+	}, encrypted
+}
+
+func TestWebhookSignatureAndRetry(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-GRC-Timestamp"), 10, 64)
+		if err != nil {
+			t.Errorf("bad timestamp header %q", r.Header.Get("X-GRC-Timestamp"))
+		}
+		want := SignWebhookPayload("whsec_test", timestamp, body)
+		if !hmac.Equal([]byte(r.Header.Get("X-GRC-Signature")), []byte(want)) {
+			t.Errorf("signature = %q, want %q", r.Header.Get("X-GRC-Signature"), want)
+		}
+		if r.Header.Get("X-GRC-Event") != "EVIDENCE_SUBMITTED" || r.Header.Get("X-GRC-Delivery") != "delivery-1" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if n == 1 {
+			http.Error(w, "internal details the tenant must not see", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d, secret := testWebhookDispatcher(t, true)
+	delivery := claimedWebhookDelivery{
+		WebhookDelivery: WebhookDelivery{
+			ID:        "delivery-1",
+			EventID:   "event-1",
+			EventType: "EVIDENCE_SUBMITTED",
+			Payload:   []byte(`{"id":"event-1","event":"EVIDENCE_SUBMITTED"}`),
+			Attempts:  1,
+		},
+		URL:             server.URL,
+		SecretEncrypted: secret,
+	}
+
+	// First attempt: the receiver fails, so the delivery is retried after backoff
+	status, err := d.send(context.Background(), delivery)
+	if err == nil || status != http.StatusServiceUnavailable {
+		t.Fatalf("send = %d, %v; want 503 and an error", status, err)
+	}
+	result := d.outcome(delivery, status, err)
+	if result.Status != "pending" || result.ResponseStatus == nil || *result.ResponseStatus != http.StatusServiceUnavailable {
+		t.Errorf("outcome after failure = %+v", result)
+	}
+	if wait := time.Until(result.NextAttemptAt); wait < 29*time.Second || wait > 31*time.Second {
+		t.Errorf("next attempt in %s, want about 30s", wait)
+	}
+
+	// Second attempt succeeds
+	delivery.Attempts = 2
+	status, err = d.send(context.Background(), delivery)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("send = %d, %v; want 204", status, err)
+	}
+	if result := d.outcome(delivery, status, err); result.Status != "succeeded" || result.Error != nil {
+		t.Errorf("outcome after success = %+v", result)
+	}
+
+	// Once the attempts are used up the delivery fails for good
+	delivery.Attempts = d.maxAttempts
+	if result := d.outcome(delivery, http.StatusBadGateway, errors.New("receiver returned 502")); result.Status != "failed" {
+		t.Errorf("outcome after last attempt = %+v", result)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	d := &WebhookDispatcher{retryBackoff: 30 * time.Second}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{20, webhookMaxBackoff},
+		{200, webhookMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := d.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRefusesPrivateAddresses(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback receiver")
+	}))
+	defer server.Close()
+
+	d, secret := testWebhookDispatcher(t, false)
+	delivery := claimedWebhookDelivery{
+		WebhookDelivery: WebhookDelivery{ID: "delivery-1", Payload: []byte(`{}`)},
+		URL:             server.URL,
+		SecretEncrypted: secret,
+	}
+	if _, err := d.send(context.Background(), delivery); !errors.Is(err, errWebhookDestination) {
+		t.Fatalf("send to loopback = %v, want errWebhookDestination", err)
+	}
+
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1"} {
+		if isPublicAddress(netip.MustParseAddr(addr)) {
+			t.Errorf("%s treated as public", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+		if !isPublicAddress(netip.MustParseAddr(addr)) {
+			t.Errorf("%s treated as private", addr)
+		}
+	}
+
+	for _, url := range []string{"http://127.0.0.1/hook", "http://[::1]/hook", "https://localhost/hook", "http://169.254.169.254/latest"} {
+		req := WebhookRequest{Name: "hook", URL: url, Events: []string{"*"}}
+		if msg := validateWebhookRequest(&req); msg == "" {
+			t.Errorf("validateWebhookRequest accepted %s", url)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 
 # Import all compliance standards into the GRC platform
 # Run this script after starting the backend server
+# (or, without a running server: cd grc-backend && go run . import-standard ../standards-data/*.json)
 
 API_URL="http://localhost:8080/api/v1/standards/import"
 STANDARDS_DIR="./standards-data"
@@ -34,10 +35,12 @@ import_standard() {
   
   status=$(echo "$response" | jq -r '.status // "error"')
   
-  if [ "$status" = "success" ]; then
+  if [ "$status" = "success" ] || [ "$status" = "partial" ]; then
     controls=$(echo "$response" | jq -r '.controls_imported')
+    skipped=$(echo "$response" | jq -r '.controls_skipped')
     standard=$(echo "$response" | jq -r '.standard')
-    echo "✅ $name imported: $standard ($controls controls)"
+    echo "✅ $name imported: $standard ($controls controls, $skipped skipped)"
+    echo "$response" | jq -r '.warnings[]? | "   ⚠️  \(.field) \(.message)"'
   else
     echo "❌ Failed to import $name"
     echo "   Response: $response"
@@ -56,6 +59,26 @@ import_standard "$STANDARDS_DIR/NIS-2-Directive.json"
 import_standard "$STANDARDS_DIR/SOC-2.json"
 import_standard "$STANDARDS_DIR/GDPR.json"
 
+# Import cross-standard control mappings
+for file in "$STANDARDS_DIR"/mappings/*.json; do
+  [ -e "$file" ] || continue
+  name=$(basename "$file" .json)
+  echo "🔗 Importing mappings $name..."
+  response=$(curl -s -X POST "http://localhost:8080/api/v1/controls/mappings/import" \
+    -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $TOKEN" \
+    -d @"$file")
+  created=$(echo "$response" | jq -r '.created // empty' 2>/dev/null)
+  if [ -n "$created" ]; then
+    updated=$(echo "$response" | jq -r '.updated')
+    echo "✅ $name imported ($created created, $updated updated)"
+  else
+    echo "❌ Failed to import mappings $name"
+    echo "   Response: $response"
+  fi
+  echo ""
+done
+
 echo "=============================================="
 echo "Import process complete!"
 echo ""
@@ -79,15 +79,8 @@ fi
 
 # Wait for PostgreSQL to be ready
 if wait_for_service "PostgreSQL" 5444; then
-    # Check if database schema is initialized
-    echo -e "${YELLOW}Checking database schema...${NC}"
-    if PGPASSWORD=grc_password psql -h localhost -p 5444 -U grc_user -d grc_db -c "SELECT 1 FROM users LIMIT 1;" >/dev/null 2>&1; then
-        echo -e "${GREEN}✓ Database schema exists${NC}"
-    else
-        echo -e "${YELLOW}Initializing database schema...${NC}"
-        PGPASSWORD=grc_password psql -h localhost -p 5444 -U grc_user -d grc_db -f grc-backend/schema.sql
-        echo -e "${GREEN}✓ Database schema initialized${NC}"
-    fi
+    # The backend applies pending schema migrations when it starts
+    echo -e "${GREEN}✓ Database ready (schema is migrated by the backend on startup)${NC}"
 else
     echo -e "${RED}Failed to start PostgreSQL${NC}"
     exit 1